@@ -66,6 +66,11 @@ func automigrateDB() error {
 	if err != nil {
 		log.Fatalf("Failed to AutoMigrate table (osquery_result_data): %v", err)
 	}
+	// columns in osquery_result_data used to be bytea, and must be jsonb to be queried
+	err = migrateResultColumns()
+	if err != nil {
+		log.Fatalf("Failed to migrate columns (osquery_result_data): %v", err)
+	}
 	// table osquery_query_data
 	err = db.AutoMigrate(OsqueryQueryData{}).Error
 	if err != nil {
@@ -73,3 +78,25 @@ func automigrateDB() error {
 	}
 	return nil
 }
+
+// Helper to convert the columns of result logs to jsonb, if they are not already
+func migrateResultColumns() error {
+	var column struct {
+		DataType string
+	}
+	q := "SELECT data_type FROM information_schema.columns WHERE table_name = ? AND column_name = ?"
+	if err := db.Raw(q, "osquery_result_data", "columns").Scan(&column).Error; err != nil {
+		return err
+	}
+	if column.DataType == "jsonb" {
+		return nil
+	}
+	log.Printf("Converting osquery_result_data.columns from %s to jsonb", column.DataType)
+	value := "columns"
+	if column.DataType == "bytea" {
+		value = "convert_from(columns, 'UTF8')"
+	}
+	// Empty columns are converted to an empty object
+	alter := "ALTER TABLE osquery_result_data ALTER COLUMN columns TYPE jsonb USING COALESCE(NULLIF(" + value + ", ''), '{}')::jsonb"
+	return db.Exec(alter).Error
+}
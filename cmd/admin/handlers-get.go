@@ -716,6 +716,26 @@ func confGETHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("error getting environment %v", err)
 		return
 	}
+	// Get shared packs attached to the environment
+	attached, err := packsmgr.Attached(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting packs %v", err)
+		return
+	}
+	var packNames []string
+	for _, p := range attached {
+		packNames = append(packNames, p.Name)
+	}
+	// Get revisions of the environment
+	revisions, err := envs.Revisions(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting revisions %v", err)
+		return
+	}
+	// Get active rollout, if any
+	rollout, _ := rolloutsmgr.Active(envVar)
 	// Get context data
 	ctx := r.Context().Value(contextKey("session")).(contextValue)
 	// Prepare template data
@@ -726,6 +746,9 @@ func confGETHandler(w http.ResponseWriter, r *http.Request) {
 		Environment:    env,
 		Environments:   envAll,
 		Platforms:      platforms,
+		Packs:          packNames,
+		Revisions:      revisions,
+		Rollout:        rollout,
 		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
 		AdminDebug:     settingsmgr.DebugService(settings.ServiceAdmin),
 		AdminDebugHTTP: settingsmgr.DebugHTTP(settings.ServiceAdmin),
@@ -794,6 +817,13 @@ func enrollGETHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("error getting environment %v", err)
 		return
 	}
+	// Get enroll secrets
+	secrets, err := envs.Secrets(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting secrets %v", err)
+		return
+	}
 	// Get context data
 	ctx := r.Context().Value(contextKey("session")).(contextValue)
 	// Prepare template data
@@ -814,7 +844,12 @@ func enrollGETHandler(w http.ResponseWriter, r *http.Request) {
 		QuickRemoveShell:      shellQuickRemove,
 		QuickAddPowershell:    powershellQuickAdd,
 		QuickRemovePowershell: powershellQuickRemove,
+		PackageDeb:            environments.QuickAddPackageURL(env, environments.PackageDeb),
+		PackageRPM:            environments.QuickAddPackageURL(env, environments.PackageRPM),
+		PackagePkg:            environments.QuickAddPackageURL(env, environments.PackagePkg),
 		Secret:                env.Secret,
+		Secrets:               secrets,
+		SecretOverlap:         environments.DefaultSecretOverlap,
 		Flags:                 env.Flags,
 		Certificate:           env.Certificate,
 		Environments:          envAll,
@@ -886,6 +921,13 @@ func nodeHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("error getting node %v", err)
 		return
 	}
+	// Get tags of the node
+	tags, err := nodesmgr.GetNodeTags(node.UUID)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting tags %v", err)
+		return
+	}
 	// Get context data
 	ctx := r.Context().Value(contextKey("session")).(contextValue)
 	// Prepare template data
@@ -895,6 +937,7 @@ func nodeHandler(w http.ResponseWriter, r *http.Request) {
 		CSRFToken:      ctx["csrftoken"],
 		Logs:           adminConfig.Logging,
 		Node:           node,
+		Tags:           tags,
 		Environments:   envAll,
 		Platforms:      platforms,
 		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
@@ -968,6 +1011,91 @@ func envsGETHandler(w http.ResponseWriter, r *http.Request) {
 	incMetric(metricAdminOK)
 }
 
+// Handler for GET requests for /packs
+func packsGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	// Prepare template
+	t, err := template.ParseFiles(
+		templatesFilesFolder + "/packs.html",
+		templatesFilesFolder + "/components/page-head.html",
+		templatesFilesFolder + "/components/page-js.html",
+		templatesFilesFolder + "/components/page-header.html",
+		templatesFilesFolder + "/components/page-sidebar.html",
+		templatesFilesFolder + "/components/page-aside.html",
+		templatesFilesFolder + "/components/page-modals.html")
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting packs template: %v", err)
+		return
+	}
+	// Get stats for all environments
+	envAll, err := envs.All()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get stats for all platforms
+	platforms, err := nodesmgr.GetAllPlatforms()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get all shared packs
+	packsAll, err := packsmgr.All()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting packs %v", err)
+		return
+	}
+	var packs []PackView
+	for _, p := range packsAll {
+		pack, err := p.Pack()
+		if err != nil {
+			log.Printf("error parsing pack %s %v", p.Name, err)
+		}
+		attached, err := packsmgr.Environments(p.Name)
+		if err != nil {
+			log.Printf("error getting environments for pack %s %v", p.Name, err)
+		}
+		packs = append(packs, PackView{
+			Name:         p.Name,
+			Description:  p.Description,
+			Queries:      len(pack.Queries),
+			Platform:     pack.Platform,
+			Version:      pack.Version,
+			Shard:        pack.Shard,
+			Value:        p.Value,
+			Environments: attached,
+		})
+	}
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Prepare template data
+	templateData := PacksTemplateData{
+		Title:          "Manage query packs",
+		Username:       ctx["user"],
+		CSRFToken:      ctx["csrftoken"],
+		Packs:          packs,
+		Environments:   envAll,
+		Platforms:      platforms,
+		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
+		AdminDebug:     settingsmgr.DebugService(settings.ServiceAdmin),
+		AdminDebugHTTP: settingsmgr.DebugHTTP(settings.ServiceAdmin),
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Packs template served")
+	}
+	incMetric(metricAdminOK)
+}
+
 // Handler GET requests for /settings
 func settingsGETHandler(w http.ResponseWriter, r *http.Request) {
 	incMetric(metricAdminReq)
@@ -1159,3 +1287,351 @@ func carvesDownloadHandler(w http.ResponseWriter, r *http.Request) {
 	fileReader, _ = os.Open(result.File)
 	_, _ = io.Copy(w, fileReader)
 }
+
+// Handler GET requests to search result logs by environment
+func resultsGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting environment")
+		return
+	}
+	// Get environment
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Prepare template
+	t, err := template.New("results.html").ParseFiles(
+		templatesFilesFolder + "/results.html",
+		templatesFilesFolder + "/components/page-head.html",
+		templatesFilesFolder + "/components/page-js.html",
+		templatesFilesFolder + "/components/page-header.html",
+		templatesFilesFolder + "/components/page-sidebar.html",
+		templatesFilesFolder + "/components/page-aside.html",
+		templatesFilesFolder + "/components/page-modals.html")
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting results template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := envs.All()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := nodesmgr.GetAllPlatforms()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Prepare template data
+	templateData := ResultsTemplateData{
+		Title:          "Results in " + env.Name,
+		Username:       ctx["user"],
+		CSRFToken:      ctx["csrftoken"],
+		Environment:    env,
+		Environments:   envAll,
+		Platforms:      platforms,
+		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
+		AdminDebug:     settingsmgr.DebugService(settings.ServiceAdmin),
+		AdminDebugHTTP: settingsmgr.DebugHTTP(settings.ServiceAdmin),
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Results template served")
+	}
+	incMetric(metricAdminOK)
+}
+
+// Handler for GET requests to display drifted nodes by environment
+func driftGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting environment")
+		return
+	}
+	// Get environment
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Prepare template
+	t, err := template.New("drift.html").ParseFiles(
+		templatesFilesFolder + "/drift.html",
+		templatesFilesFolder + "/components/page-head.html",
+		templatesFilesFolder + "/components/page-js.html",
+		templatesFilesFolder + "/components/page-header.html",
+		templatesFilesFolder + "/components/page-sidebar.html",
+		templatesFilesFolder + "/components/page-aside.html",
+		templatesFilesFolder + "/components/page-modals.html")
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting drift template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := envs.All()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := nodesmgr.GetAllPlatforms()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get drifted nodes
+	report, err := driftReport(env, false)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting drift %v", err)
+		return
+	}
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Prepare template data
+	templateData := DriftTemplateData{
+		Title:          "Configuration drift in " + env.Name,
+		Username:       ctx["user"],
+		CSRFToken:      ctx["csrftoken"],
+		Environment:    env,
+		Drift:          report,
+		Environments:   envAll,
+		Platforms:      platforms,
+		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
+		AdminDebug:     settingsmgr.DebugService(settings.ServiceAdmin),
+		AdminDebugHTTP: settingsmgr.DebugHTTP(settings.ServiceAdmin),
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Drift template served")
+	}
+	incMetric(metricAdminOK)
+}
+
+// Handler for GET requests to display the configuration rollouts by environment
+func rolloutGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting environment")
+		return
+	}
+	// Get environment
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Prepare template
+	t, err := template.New("rollout.html").ParseFiles(
+		templatesFilesFolder + "/rollout.html",
+		templatesFilesFolder + "/components/page-head.html",
+		templatesFilesFolder + "/components/page-js.html",
+		templatesFilesFolder + "/components/page-header.html",
+		templatesFilesFolder + "/components/page-sidebar.html",
+		templatesFilesFolder + "/components/page-aside.html",
+		templatesFilesFolder + "/components/page-modals.html")
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting rollout template: %v", err)
+		return
+	}
+	// Get all environments
+	envAll, err := envs.All()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	// Get all platforms
+	platforms, err := nodesmgr.GetAllPlatforms()
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting platforms: %v", err)
+		return
+	}
+	// Get previous rollouts
+	history, err := rolloutsmgr.All(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting rollouts %v", err)
+		return
+	}
+	// Get revision of the current configuration
+	current, err := envs.LatestConfigurationRevision(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting revision %v", err)
+		return
+	}
+	// Get active rollout with the changes and the health of its cohort
+	var changes []environments.DiffLine
+	var health RolloutHealth
+	rollout, err := rolloutsmgr.Active(envVar)
+	if err == nil {
+		candidate := []byte(rollout.Configuration)
+		if conf, err := rollout.Candidate(); err == nil {
+			if assembled, err := conf.JSON(); err == nil {
+				candidate = assembled
+			}
+		}
+		changes = environments.Diff(env.Configuration, string(candidate))
+		if health, err = rolloutHealth(rollout); err != nil {
+			incMetric(metricAdminErr)
+			log.Printf("error getting rollout health %v", err)
+			return
+		}
+	}
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Prepare template data
+	templateData := RolloutTemplateData{
+		Title:          "Configuration rollouts in " + env.Name,
+		Username:       ctx["user"],
+		CSRFToken:      ctx["csrftoken"],
+		Environment:    env,
+		Rollout:        rollout,
+		Current:        current,
+		Changes:        changes,
+		Health:         health,
+		History:        history,
+		Environments:   envAll,
+		Platforms:      platforms,
+		TLSDebug:       settingsmgr.DebugService(settings.ServiceTLS),
+		AdminDebug:     settingsmgr.DebugService(settings.ServiceAdmin),
+		AdminDebugHTTP: settingsmgr.DebugHTTP(settings.ServiceAdmin),
+	}
+	if err := t.Execute(w, templateData); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("template error %v", err)
+		return
+	}
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Rollout template served")
+	}
+	incMetric(metricAdminOK)
+}
+
+// Handler for GET requests to download the flagfile of an environment for a platform
+func flagsGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting environment")
+		return
+	}
+	// Extract platform
+	platformVar, ok := vars["platform"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting platform")
+		return
+	}
+	// Get environment
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	flags, err := environments.PlatformFlags(env, platformVar, projectName)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error generating flags %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=osquery.flags")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(flags))
+	incMetric(metricAdminOK)
+}
+
+// Handler for the enrollment packages of environments
+func packageGETHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting environment")
+		return
+	}
+	// Extract package format
+	formatVar, ok := vars["format"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting format")
+		return
+	}
+	// Get environment
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	// Packages include the enroll secret, so they expire with the enroll link
+	if environments.IsItExpired(env.EnrollExpire) {
+		incMetric(metricAdminErr)
+		log.Printf("enroll link expired for %s", envVar)
+		http.Error(w, "enroll link expired, extend it to download packages", http.StatusForbidden)
+		return
+	}
+	pkg, err := environments.BuildPackage(env, formatVar, projectName)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error building package %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", environments.PackageContentType(formatVar))
+	w.Header().Set("Content-Disposition", "attachment; filename="+environments.PackageFilename(projectName, env.Name, formatVar))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pkg)
+	incMetric(metricAdminOK)
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/queries"
 	"github.com/jmpsec/osctrl/pkg/settings"
@@ -138,7 +141,6 @@ func queryRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	// Check CSRF Token
 	if checkCSRFToken(ctx["csrftoken"], q.CSRFToken) {
-		// FIXME check validity of query
 		// Query can not be empty
 		if q.Query == "" {
 			responseMessage = "query can not be empty"
@@ -146,6 +148,34 @@ func queryRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("%s %v", responseMessage, err)
 			goto response
 		}
+		// Check SQL against the osquery tables of the targeted platforms
+		if _, err := sqlValidator.Validate(q.Query, targetPlatforms(q.TargetsRequest), settingsmgr.ExtraTables(settings.ServiceAdmin)); err != nil {
+			responseMessage = fmt.Sprintf("invalid query - %v", err)
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s", responseMessage)
+			goto response
+		}
+		// Get and validate targets
+		targets, err := requestTargets(q.TargetsRequest)
+		if err != nil {
+			responseMessage = fmt.Sprintf("invalid targets - %v", err)
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s", responseMessage)
+			goto response
+		}
+		// Validate schedule for recurring queries
+		if q.Repeat < 0 {
+			responseMessage = "invalid schedule - repeat can not be negative"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s", responseMessage)
+			goto response
+		}
+		if err := queries.ValidateSchedule(uint(q.Repeat), q.Cron); err != nil {
+			responseMessage = fmt.Sprintf("invalid schedule - %v", err)
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s", responseMessage)
+			goto response
+		}
 		// Prepare and create new query
 		queryName := "query_" + generateQueryName()
 		newQuery := queries.DistributedQuery{
@@ -157,8 +187,20 @@ func queryRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			Active:     true,
 			Completed:  false,
 			Deleted:    false,
-			Repeat:     0,
+			Repeat:     uint(q.Repeat),
+			Cron:       q.Cron,
 			Type:       queries.StandardQueryType,
+			Match:      q.Match,
+		}
+		// Recurring queries run the first generation now
+		if q.Repeat > 0 || q.Cron != "" {
+			newQuery.Generation = 1
+			if newQuery.NextRun, err = queries.ScheduleNext(newQuery.Repeat, newQuery.Cron, time.Now()); err != nil {
+				responseMessage = fmt.Sprintf("invalid schedule - %v", err)
+				responseCode = http.StatusInternalServerError
+				log.Printf("%s", responseMessage)
+				goto response
+			}
 		}
 		if err := queriesmgr.Create(newQuery); err != nil {
 			responseMessage = "error creating query"
@@ -166,85 +208,31 @@ func queryRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("%s %v", responseMessage, err)
 			goto response
 		}
-		// Temporary list of UUIDs to calculate Expected
-		var expected []string
-		// Create environment target
-		if len(q.Environments) > 0 {
-			for _, e := range q.Environments {
-				if (e != "") && envs.Exists(e) {
-					if err := queriesmgr.CreateTarget(queryName, queries.QueryTargetEnvironment, e); err != nil {
-						responseMessage = "error creating query environment target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					nodes, err := nodesmgr.GetByEnv(e, "active", settingsmgr.InactiveHours())
-					if err != nil {
-						responseMessage = "error getting nodes by environment"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					for _, n := range nodes {
-						expected = append(expected, n.UUID)
-					}
-				}
-			}
-		}
-		// Create platform target
-		if len(q.Platforms) > 0 {
-			for _, p := range q.Platforms {
-				if (p != "") && checkValidPlatform(p) {
-					if err := queriesmgr.CreateTarget(queryName, queries.QueryTargetPlatform, p); err != nil {
-						responseMessage = "error creating query platform target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					nodes, err := nodesmgr.GetByPlatform(p, "active", settingsmgr.InactiveHours())
-					if err != nil {
-						responseMessage = "error getting nodes by platform"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					for _, n := range nodes {
-						expected = append(expected, n.UUID)
-					}
-				}
+		// Create targets
+		for _, t := range targets {
+			if err := queriesmgr.CreateTarget(queryName, t.Type, t.Value); err != nil {
+				responseMessage = "error creating query " + t.Type + " target"
+				responseCode = http.StatusInternalServerError
+				log.Printf("%s %v", responseMessage, err)
+				goto response
 			}
 		}
-		// Create UUIDs target
-		if len(q.UUIDs) > 0 {
-			for _, u := range q.UUIDs {
-				if (u != "") && nodesmgr.CheckByUUID(u) {
-					if err := queriesmgr.CreateTarget(queryName, queries.QueryTargetUUID, u); err != nil {
-						responseMessage = "error creating query UUID target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					expected = append(expected, u)
-				}
-			}
+		// Nodes matching the targets to calculate Expected
+		expected, err := targetNodes(targets, q.Match)
+		if err != nil {
+			responseMessage = "error getting target nodes"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s %v", responseMessage, err)
+			goto response
 		}
-		// Create hostnames target
-		if len(q.Hosts) > 0 {
-			for _, h := range q.Hosts {
-				if (h != "") && nodesmgr.CheckByHost(h) {
-					if err := queriesmgr.CreateTarget(queryName, queries.QueryTargetLocalname, h); err != nil {
-						responseMessage = "error creating query hostname target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-				}
-			}
+		if err := createSeenTargets(queryName, targets, expected); err != nil {
+			responseMessage = "error creating query last seen targets"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s %v", responseMessage, err)
+			goto response
 		}
-		// Remove duplicates from expected
-		expectedClear := removeStringDuplicates(expected)
 		// Update value for expected
-		if err := queriesmgr.SetExpected(queryName, len(expectedClear)); err != nil {
+		if err := queriesmgr.SetExpected(queryName, len(expected)); err != nil {
 			responseMessage = "error setting expected"
 			responseCode = http.StatusInternalServerError
 			log.Printf("%s %v", responseMessage, err)
@@ -272,6 +260,115 @@ response:
 	}
 }
 
+// Handler for POST requests to check the SQL of a query before running it
+func queryCheckPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "The query is valid"
+	responseCode := http.StatusOK
+	var warnings []string
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	var q DistributedQueryRequest
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&q)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		log.Printf("%s %v", responseMessage, err)
+		goto response
+	}
+	// Check CSRF Token
+	if checkCSRFToken(ctx["csrftoken"], q.CSRFToken) {
+		warnings, err = sqlValidator.Validate(q.Query, targetPlatforms(q.TargetsRequest), settingsmgr.ExtraTables(settings.ServiceAdmin))
+		if err != nil {
+			responseMessage = fmt.Sprintf("invalid query - %v", err)
+			responseCode = http.StatusInternalServerError
+		}
+	} else {
+		responseMessage = "invalid CSRF token"
+		responseCode = http.StatusInternalServerError
+		log.Printf("%s %v", responseMessage, err)
+	}
+response:
+	// Prepare response
+	response, err := json.Marshal(QueryCheckResponse{Message: responseMessage, Warnings: warnings})
+	if err != nil {
+		log.Printf("error formating response [ %v ]", err)
+		responseCode = http.StatusInternalServerError
+		response = []byte("error formating response")
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Query check response sent")
+	}
+}
+
+// Handler for POST requests to preview the nodes targeted by a query or carve before running it
+func targetsPreviewPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	var expected int
+	var hosts []string
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	var p TargetsPreviewRequest
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		log.Printf("%s %v", responseMessage, err)
+		goto response
+	}
+	// Check CSRF Token
+	if checkCSRFToken(ctx["csrftoken"], p.CSRFToken) {
+		targets, err := requestTargets(p.TargetsRequest)
+		if err != nil {
+			responseMessage = fmt.Sprintf("invalid targets - %v", err)
+			responseCode = http.StatusInternalServerError
+			goto response
+		}
+		matched, err := targetNodes(targets, p.Match)
+		if err != nil {
+			responseMessage = "error getting target nodes"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s %v", responseMessage, err)
+			goto response
+		}
+		expected = len(matched)
+		for i, n := range matched {
+			if i == previewNodes {
+				break
+			}
+			hosts = append(hosts, n.Hostname)
+		}
+		responseMessage = fmt.Sprintf("%d active node(s) expected", expected)
+	} else {
+		responseMessage = "invalid CSRF token"
+		responseCode = http.StatusInternalServerError
+		log.Printf("%s %v", responseMessage, err)
+	}
+response:
+	// Prepare response
+	response, err := json.Marshal(TargetsPreviewResponse{Message: responseMessage, Expected: expected, Nodes: hosts})
+	if err != nil {
+		log.Printf("error formating response [ %v ]", err)
+		responseCode = http.StatusInternalServerError
+		response = []byte("error formating response")
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Targets preview response sent")
+	}
+}
+
 // Handler for POST requests to run file carves
 func carvesRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	responseMessage := "The carve was created successfully"
@@ -298,6 +395,14 @@ func carvesRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("%s %v", responseMessage, err)
 			goto response
 		}
+		// Get and validate targets
+		targets, err := requestTargets(c.TargetsRequest)
+		if err != nil {
+			responseMessage = fmt.Sprintf("invalid targets - %v", err)
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s", responseMessage)
+			goto response
+		}
 		query := generateCarveQuery(c.Path, false)
 		// Prepare and create new carve
 		carveName := "carve_" + generateQueryName()
@@ -313,6 +418,7 @@ func carvesRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			Repeat:     0,
 			Type:       queries.CarveQueryType,
 			Path:       c.Path,
+			Match:      c.Match,
 		}
 		if err := queriesmgr.Create(newQuery); err != nil {
 			responseMessage = "error creating carve"
@@ -320,85 +426,31 @@ func carvesRunPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("%s %v", responseMessage, err)
 			goto response
 		}
-		// Temporary list of UUIDs to calculate Expected
-		var expected []string
-		// Create environment target
-		if len(c.Environments) > 0 {
-			for _, e := range c.Environments {
-				if (e != "") && envs.Exists(e) {
-					if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetEnvironment, e); err != nil {
-						responseMessage = "error creating carve environment target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					nodes, err := nodesmgr.GetByEnv(e, "active", settingsmgr.InactiveHours())
-					if err != nil {
-						responseMessage = "error getting nodes by environment"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					for _, n := range nodes {
-						expected = append(expected, n.UUID)
-					}
-				}
-			}
-		}
-		// Create platform target
-		if len(c.Platforms) > 0 {
-			for _, p := range c.Platforms {
-				if (p != "") && checkValidPlatform(p) {
-					if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetPlatform, p); err != nil {
-						responseMessage = "error creating carve platform target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					nodes, err := nodesmgr.GetByPlatform(p, "active", settingsmgr.InactiveHours())
-					if err != nil {
-						responseMessage = "error getting nodes by platform"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					for _, n := range nodes {
-						expected = append(expected, n.UUID)
-					}
-				}
+		// Create targets
+		for _, t := range targets {
+			if err := queriesmgr.CreateTarget(carveName, t.Type, t.Value); err != nil {
+				responseMessage = "error creating carve " + t.Type + " target"
+				responseCode = http.StatusInternalServerError
+				log.Printf("%s %v", responseMessage, err)
+				goto response
 			}
 		}
-		// Create UUIDs target
-		if len(c.UUIDs) > 0 {
-			for _, u := range c.UUIDs {
-				if (u != "") && nodesmgr.CheckByUUID(u) {
-					if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetUUID, u); err != nil {
-						responseMessage = "error creating carve UUID target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-					expected = append(expected, u)
-				}
-			}
+		// Nodes matching the targets to calculate Expected
+		expected, err := targetNodes(targets, c.Match)
+		if err != nil {
+			responseMessage = "error getting target nodes"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s %v", responseMessage, err)
+			goto response
 		}
-		// Create hostnames target
-		if len(c.Hosts) > 0 {
-			for _, h := range c.Hosts {
-				if (h != "") && nodesmgr.CheckByHost(h) {
-					if err := queriesmgr.CreateTarget(carveName, queries.QueryTargetLocalname, h); err != nil {
-						responseMessage = "error creating carve hostname target"
-						responseCode = http.StatusInternalServerError
-						log.Printf("%s %v", responseMessage, err)
-						goto response
-					}
-				}
-			}
+		if err := createSeenTargets(carveName, targets, expected); err != nil {
+			responseMessage = "error creating carve last seen targets"
+			responseCode = http.StatusInternalServerError
+			log.Printf("%s %v", responseMessage, err)
+			goto response
 		}
-		// Remove duplicates from expected
-		expectedClear := removeStringDuplicates(expected)
 		// Update value for expected
-		if err := queriesmgr.SetExpected(carveName, len(expectedClear)); err != nil {
+		if err := queriesmgr.SetExpected(carveName, len(expected)); err != nil {
 			responseMessage = "error setting expected"
 			responseCode = http.StatusInternalServerError
 			log.Printf("%s %v", responseMessage, err)
@@ -610,13 +662,15 @@ func confPOSTHandler(w http.ResponseWriter, r *http.Request) {
 						log.Printf("DebugService: %s %v", responseMessage, err)
 					}
 				} else {
-					err = envs.UpdateConfiguration(environmentVar, string(configuration))
+					warnings, err := saveConfiguration(environmentVar, configuration, ctx["user"], c.Comment)
 					if err != nil {
-						responseMessage = "error saving configuration"
+						responseMessage = fmt.Sprintf("error saving configuration - %v", err)
 						responseCode = http.StatusInternalServerError
 						if settingsmgr.DebugService(settings.ServiceAdmin) {
 							log.Printf("DebugService: %s %v", responseMessage, err)
 						}
+					} else {
+						responseMessage = withWarnings(responseMessage, warnings)
 					}
 				}
 			} else {
@@ -700,13 +754,21 @@ func intervalsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 			flags, err := envs.GenerateFlagsEnv(environmentVar, "", "")
 			if err == nil {
 				// Update flags in the newly created environment
-				if err := envs.UpdateFlags(environmentVar, flags); err != nil {
+				if _, err := envs.UpdateFlags(environmentVar, flags); err != nil {
 					responseMessage = "error updating flags"
 					responseCode = http.StatusInternalServerError
 					if settingsmgr.DebugService(settings.ServiceAdmin) {
 						log.Printf("DebugService: %s %v", responseMessage, err)
 					}
 				}
+				// Keep intervals and flags as a new revision
+				if _, err := envs.SaveRevision(environmentVar, ctx["user"], c.Comment); err != nil {
+					responseMessage = "error saving revision"
+					responseCode = http.StatusInternalServerError
+					if settingsmgr.DebugService(settings.ServiceAdmin) {
+						log.Printf("DebugService: %s %v", responseMessage, err)
+					}
+				}
 			} else {
 				responseMessage = "error re-generating flags"
 				responseCode = http.StatusInternalServerError
@@ -741,8 +803,8 @@ func intervalsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Handler POST requests for expiring enroll links
-func expirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
+// Handler POST requests for actions on revisions of an environment
+func revisionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	responseMessage := "OK"
 	responseCode := http.StatusOK
 	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
@@ -762,11 +824,11 @@ func expirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	var e ExpirationRequest
+	var c RevisionsRequest
 	// Get context data
 	ctx := r.Context().Value(contextKey("session")).(contextValue)
 	// Parse request JSON body
-	err := json.NewDecoder(r.Body).Decode(&e)
+	err := json.NewDecoder(r.Body).Decode(&c)
 	if err != nil {
 		responseMessage = "error parsing POST body"
 		responseCode = http.StatusInternalServerError
@@ -775,50 +837,25 @@ func expirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		// Check CSRF Token
-		if checkCSRFToken(ctx["csrftoken"], e.CSRFToken) {
-			switch e.Type {
-			case "enroll":
-				switch e.Action {
-				case "expire":
-					err = envs.ExpireEnroll(environmentVar)
-					if err != nil {
-						responseMessage = "error expiring enroll"
-						responseCode = http.StatusInternalServerError
-						if settingsmgr.DebugService(settings.ServiceAdmin) {
-							log.Printf("DebugService: %s %v", responseMessage, err)
-						}
-					}
-				case "extend":
-					err = envs.RotateEnrollPath(environmentVar)
-					if err != nil {
-						responseMessage = "error extending enroll"
-						responseCode = http.StatusInternalServerError
-						if settingsmgr.DebugService(settings.ServiceAdmin) {
-							log.Printf("DebugService: %s %v", responseMessage, err)
-						}
-					}
+		if checkCSRFToken(ctx["csrftoken"], c.CSRFToken) {
+			switch c.Action {
+			case "rollback":
+				rev, err := envs.Rollback(environmentVar, c.Number, ctx["user"])
+				if err == nil {
+					err = restoreConfiguration(environmentVar)
 				}
-			case "remove":
-				switch e.Action {
-				case "expire":
-					err = envs.ExpireRemove(environmentVar)
-					if err != nil {
-						responseMessage = "error expiring enroll"
-						responseCode = http.StatusInternalServerError
-						if settingsmgr.DebugService(settings.ServiceAdmin) {
-							log.Printf("DebugService: %s %v", responseMessage, err)
-						}
-					}
-				case "extend":
-					err = envs.RotateRemove(environmentVar)
-					if err != nil {
-						responseMessage = "error extending enroll"
-						responseCode = http.StatusInternalServerError
-						if settingsmgr.DebugService(settings.ServiceAdmin) {
-							log.Printf("DebugService: %s %v", responseMessage, err)
-						}
+				if err != nil {
+					responseMessage = "error rolling back revision"
+					responseCode = http.StatusInternalServerError
+					if settingsmgr.DebugService(settings.ServiceAdmin) {
+						log.Printf("DebugService: %s %v", responseMessage, err)
 					}
+				} else {
+					responseMessage = fmt.Sprintf("Rolled back to revision %d as revision %d", c.Number, rev.Number)
 				}
+			default:
+				responseMessage = "invalid action"
+				responseCode = http.StatusInternalServerError
 			}
 		} else {
 			responseMessage = "invalid CSRF token"
@@ -843,23 +880,351 @@ func expirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(responseCode)
 	_, _ = w.Write(response)
 	if settingsmgr.DebugService(settings.ServiceAdmin) {
-		log.Println("DebugService: Expiration response sent")
+		log.Println("DebugService: Revisions response sent")
 	}
 }
 
-// Handler POST requests for multi node action
-func nodeActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+// Handler POST requests to start, promote and abort configuration rollouts
+func rolloutPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	responseMessage := "OK"
 	responseCode := http.StatusOK
 	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
-	var m NodeMultiActionRequest
-	// Get context data
-	ctx := r.Context().Value(contextKey("session")).(contextValue)
-	// Parse request JSON body
-	err := json.NewDecoder(r.Body).Decode(&m)
-	if err != nil {
-		responseMessage = "error parsing POST body"
-		responseCode = http.StatusInternalServerError
+	vars := mux.Vars(r)
+	// Extract environment
+	environmentVar, ok := vars["environment"]
+	if !ok {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error getting environment")
+		}
+		return
+	}
+	// Verify environment
+	if !envs.Exists(environmentVar) {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error unknown environment (%s)", environmentVar)
+		}
+		return
+	}
+	var c RolloutRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+	} else {
+		// Check CSRF Token
+		if checkCSRFToken(ctx["csrftoken"], c.CSRFToken) {
+			switch c.Action {
+			case "start":
+				configuration, err := base64.StdEncoding.DecodeString(c.ConfigurationB64)
+				if err != nil {
+					responseMessage = "error decoding configuration"
+					responseCode = http.StatusInternalServerError
+					break
+				}
+				var warnings []string
+				candidate, err := config.ParseConfiguration(configuration)
+				if err == nil {
+					warnings, err = checkConfiguration(candidate)
+				}
+				var current environments.Revision
+				if err == nil {
+					current, err = envs.LatestRevision(environmentVar)
+				}
+				if err == nil {
+					_, err = rolloutsmgr.Start(environmentVar, configuration, current.Number, c.Percentage, c.Tag, ctx["user"], c.Comment)
+				}
+				if err != nil {
+					responseMessage = fmt.Sprintf("error starting rollout - %v", err)
+					responseCode = http.StatusInternalServerError
+					if settingsmgr.DebugService(settings.ServiceAdmin) {
+						log.Printf("DebugService: %s", responseMessage)
+					}
+				} else {
+					responseMessage = withWarnings("Rollout started successfully", warnings)
+				}
+			case "promote":
+				rollout, err := rolloutsmgr.Active(environmentVar)
+				if err == nil {
+					var current int
+					current, err = envs.LatestConfigurationRevision(environmentVar)
+					if err == nil {
+						err = rollout.CanPromote(current)
+					}
+				}
+				if err == nil {
+					comment := fmt.Sprintf("Promoted rollout to %s", rollout.Target())
+					if rollout.Comment != "" {
+						comment += " - " + rollout.Comment
+					}
+					_, err = saveConfiguration(environmentVar, []byte(rollout.Configuration), ctx["user"], comment)
+				}
+				if err == nil {
+					_, err = rolloutsmgr.Finish(environmentVar, config.RolloutPromoted)
+				}
+				if err != nil {
+					responseMessage = fmt.Sprintf("error promoting rollout - %v", err)
+					responseCode = http.StatusInternalServerError
+					if settingsmgr.DebugService(settings.ServiceAdmin) {
+						log.Printf("DebugService: %s %v", responseMessage, err)
+					}
+				} else {
+					responseMessage = "Rollout promoted successfully"
+				}
+			case "abort":
+				if _, err := rolloutsmgr.Finish(environmentVar, config.RolloutAborted); err != nil {
+					responseMessage = "error aborting rollout"
+					responseCode = http.StatusInternalServerError
+					if settingsmgr.DebugService(settings.ServiceAdmin) {
+						log.Printf("DebugService: %s %v", responseMessage, err)
+					}
+				} else {
+					responseMessage = "Rollout aborted successfully"
+				}
+			default:
+				responseMessage = "invalid action"
+				responseCode = http.StatusInternalServerError
+			}
+		} else {
+			responseMessage = "invalid CSRF token"
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s %v", responseMessage, err)
+			}
+		}
+	}
+	// Prepare response
+	response, err := json.Marshal(AdminResponse{Message: responseMessage})
+	if err != nil {
+		responseMessage = "error formating response"
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+		responseCode = http.StatusInternalServerError
+		response = []byte(responseMessage)
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Rollout response sent")
+	}
+}
+
+// Handler POST requests for expiring enroll links
+func expirationPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	vars := mux.Vars(r)
+	// Extract environment
+	environmentVar, ok := vars["environment"]
+	if !ok {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error getting environment")
+		}
+		return
+	}
+	// Verify environment
+	if !envs.Exists(environmentVar) {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error unknown environment (%s)", environmentVar)
+		}
+		return
+	}
+	var e ExpirationRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&e)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+	} else {
+		// Check CSRF Token
+		if checkCSRFToken(ctx["csrftoken"], e.CSRFToken) {
+			switch e.Type {
+			case "enroll":
+				switch e.Action {
+				case "expire":
+					err = envs.ExpireEnroll(environmentVar)
+					if err != nil {
+						responseMessage = "error expiring enroll"
+						responseCode = http.StatusInternalServerError
+						if settingsmgr.DebugService(settings.ServiceAdmin) {
+							log.Printf("DebugService: %s %v", responseMessage, err)
+						}
+					}
+				case "extend":
+					err = envs.RotateEnrollPath(environmentVar)
+					if err != nil {
+						responseMessage = "error extending enroll"
+						responseCode = http.StatusInternalServerError
+						if settingsmgr.DebugService(settings.ServiceAdmin) {
+							log.Printf("DebugService: %s %v", responseMessage, err)
+						}
+					}
+				}
+			case "remove":
+				switch e.Action {
+				case "expire":
+					err = envs.ExpireRemove(environmentVar)
+					if err != nil {
+						responseMessage = "error expiring enroll"
+						responseCode = http.StatusInternalServerError
+						if settingsmgr.DebugService(settings.ServiceAdmin) {
+							log.Printf("DebugService: %s %v", responseMessage, err)
+						}
+					}
+				case "extend":
+					err = envs.RotateRemove(environmentVar)
+					if err != nil {
+						responseMessage = "error extending enroll"
+						responseCode = http.StatusInternalServerError
+						if settingsmgr.DebugService(settings.ServiceAdmin) {
+							log.Printf("DebugService: %s %v", responseMessage, err)
+						}
+					}
+				}
+			}
+		} else {
+			responseMessage = "invalid CSRF token"
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s %v", responseMessage, err)
+			}
+		}
+	}
+	// Prepare response
+	response, err := json.Marshal(AdminResponse{Message: responseMessage})
+	if err != nil {
+		responseMessage = "error formating response"
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+		responseCode = http.StatusInternalServerError
+		response = []byte(responseMessage)
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Expiration response sent")
+	}
+}
+
+// Handler POST requests for enroll secrets
+func secretsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	vars := mux.Vars(r)
+	// Extract environment
+	environmentVar, ok := vars["environment"]
+	if !ok {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error getting environment")
+		}
+		return
+	}
+	// Verify environment
+	if !envs.Exists(environmentVar) {
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: error unknown environment (%s)", environmentVar)
+		}
+		return
+	}
+	var s SecretRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&s)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+	} else {
+		// Check CSRF Token
+		if checkCSRFToken(ctx["csrftoken"], s.CSRFToken) {
+			switch s.Action {
+			case "add":
+				_, err = envs.AddSecret(environmentVar, s.Name, s.Secret, s.Hours, s.MaxEnrollments)
+				responseMessage = "Secret added successfully"
+			case "rotate":
+				var rotated environments.EnrollSecret
+				rotated, err = envs.RotateSecret(environmentVar, environments.DefaultSecretOverlap)
+				responseMessage = fmt.Sprintf("Secret rotated successfully, new primary secret is %s", rotated.Name)
+			case "primary":
+				err = envs.SetPrimarySecret(environmentVar, s.Name)
+				responseMessage = "Primary secret changed successfully"
+			case "expire":
+				err = envs.ExpireSecret(environmentVar, s.Name, s.Hours)
+				responseMessage = "Secret expired successfully"
+			case "delete":
+				err = envs.DeleteSecret(environmentVar, s.Name)
+				responseMessage = "Secret deleted successfully"
+			default:
+				err = fmt.Errorf("unknown action %s", s.Action)
+			}
+			if err != nil {
+				responseMessage = fmt.Sprintf("error with secret - %v", err)
+				responseCode = http.StatusInternalServerError
+				if settingsmgr.DebugService(settings.ServiceAdmin) {
+					log.Printf("DebugService: %s", responseMessage)
+				}
+			}
+		} else {
+			responseMessage = "invalid CSRF token"
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s %v", responseMessage, err)
+			}
+		}
+	}
+	// Prepare response
+	response, err := json.Marshal(AdminResponse{Message: responseMessage})
+	if err != nil {
+		responseMessage = "error formating response"
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+		responseCode = http.StatusInternalServerError
+		response = []byte(responseMessage)
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Secrets response sent")
+	}
+}
+
+// Handler POST requests for multi node action
+func nodeActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	var m NodeMultiActionRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
 		if settingsmgr.DebugService(settings.ServiceAdmin) {
 			log.Printf("DebugService: %s %v", responseMessage, err)
 		}
@@ -917,6 +1282,73 @@ func nodeActionsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Handler for POST request for /node/tags
+func nodeTagsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	var t NodeTagRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&t)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+	} else {
+		// Check CSRF Token
+		if checkCSRFToken(ctx["csrftoken"], t.CSRFToken) {
+			if !nodesmgr.CheckByUUID(t.UUID) {
+				err = fmt.Errorf("unknown node %s", t.UUID)
+			} else {
+				switch t.Action {
+				case "set":
+					err = nodesmgr.SetTag(t.UUID, strings.TrimSpace(t.Key), strings.TrimSpace(t.Value))
+					responseMessage = "Tag set successfully"
+				case "remove":
+					err = nodesmgr.RemoveTag(t.UUID, t.Key)
+					responseMessage = "Tag removed successfully"
+				default:
+					err = fmt.Errorf("unknown action %s", t.Action)
+				}
+			}
+			if err != nil {
+				responseMessage = fmt.Sprintf("error changing tags - %v", err)
+				responseCode = http.StatusInternalServerError
+				if settingsmgr.DebugService(settings.ServiceAdmin) {
+					log.Printf("DebugService: %s", responseMessage)
+				}
+			}
+		} else {
+			responseMessage = "invalid CSRF token"
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s %v", responseMessage, err)
+			}
+		}
+	}
+	// Prepare response
+	response, err := json.Marshal(AdminResponse{Message: responseMessage})
+	if err != nil {
+		responseMessage = "error formating response"
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s", responseMessage)
+		}
+		responseCode = http.StatusInternalServerError
+		response = []byte(responseMessage)
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Node tags response sent")
+	}
+}
+
 // Handler for POST request for /environments
 func envsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	responseMessage := "OK"
@@ -968,9 +1400,14 @@ func envsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 							log.Printf("DebugService: %s %v", responseMessage, err)
 						}
 						goto response
-					} else {
-						responseMessage = "Environment created successfully"
 					}
+					if err := configsmgr.Import(env.Name, []byte(env.Configuration)); err != nil {
+						log.Printf("error importing configuration for %s %v", env.Name, err)
+					}
+					if err := envs.BaselineRevision(env.Name, ctx["user"]); err != nil {
+						log.Printf("error saving revision for %s %v", env.Name, err)
+					}
+					responseMessage = "Environment created successfully"
 				}
 			case "delete":
 				if c.Name == settingsmgr.DefaultEnv(settings.ServiceAdmin) {
@@ -985,9 +1422,26 @@ func envsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 							log.Printf("DebugService: %s %v", responseMessage, err)
 						}
 						goto response
-					} else {
-						responseMessage = "Environment deleted successfully"
 					}
+					if err := configsmgr.Delete(c.Name); err != nil {
+						log.Printf("error deleting configuration for %s %v", c.Name, err)
+					}
+					if err := packsmgr.DetachAll(c.Name); err != nil {
+						log.Printf("error detaching packs for %s %v", c.Name, err)
+					}
+					if err := overlaysmgr.DeleteAll(c.Name); err != nil {
+						log.Printf("error deleting overlays for %s %v", c.Name, err)
+					}
+					if err := rolloutsmgr.DeleteAll(c.Name); err != nil {
+						log.Printf("error deleting rollouts for %s %v", c.Name, err)
+					}
+					if err := envs.DeleteRevisions(c.Name); err != nil {
+						log.Printf("error deleting revisions for %s %v", c.Name, err)
+					}
+					if err := envs.DeleteSecrets(c.Name); err != nil {
+						log.Printf("error deleting secrets for %s %v", c.Name, err)
+					}
+					responseMessage = "Environment deleted successfully"
 				}
 			case "debug":
 				// FIXME verify fields
@@ -1034,6 +1488,112 @@ response:
 	}
 }
 
+// Handler for POST request for /packs
+func packsPOSTHandler(w http.ResponseWriter, r *http.Request) {
+	responseMessage := "OK"
+	responseCode := http.StatusOK
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), true)
+	var c PacksRequest
+	// Get context data
+	ctx := r.Context().Value(contextKey("session")).(contextValue)
+	// Parse request JSON body
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		responseMessage = "error parsing POST body"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+		goto response
+	}
+	// Check CSRF Token
+	if !checkCSRFToken(ctx["csrftoken"], c.CSRFToken) {
+		responseMessage = "invalid CSRF token"
+		responseCode = http.StatusInternalServerError
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+		goto response
+	}
+	switch c.Action {
+	case "create", "update":
+		pack, err := base64.StdEncoding.DecodeString(c.PackB64)
+		if err != nil {
+			responseMessage = "error decoding pack"
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s %v", responseMessage, err)
+			}
+			goto response
+		}
+		for _, e := range c.Environments {
+			if !envs.Exists(e) {
+				responseMessage = fmt.Sprintf("unknown environment %s", e)
+				responseCode = http.StatusInternalServerError
+				goto response
+			}
+		}
+		// Check the SQL of the queries in the pack
+		var warnings []string
+		if parsed, err := config.ParsePack(c.Name, pack); err == nil {
+			if warnings, err = parsed.CheckQueries(c.Name, checkScheduled, nil); err != nil {
+				responseMessage = fmt.Sprintf("error saving pack - %v", err)
+				responseCode = http.StatusInternalServerError
+				goto response
+			}
+		}
+		if c.Action == "create" {
+			err = packsmgr.Create(c.Name, c.Description, pack)
+			responseMessage = "Pack created successfully"
+		} else {
+			err = packsmgr.Update(c.Name, c.Description, pack)
+			responseMessage = "Pack updated successfully"
+		}
+		if err == nil {
+			err = packsmgr.SetEnvironments(c.Name, c.Environments)
+		}
+		responseMessage = withWarnings(responseMessage, warnings)
+		if err != nil {
+			responseMessage = fmt.Sprintf("error saving pack - %v", err)
+			responseCode = http.StatusInternalServerError
+			if settingsmgr.DebugService(settings.ServiceAdmin) {
+				log.Printf("DebugService: %s", responseMessage)
+			}
+			goto response
+		}
+	case "delete":
+		if packsmgr.Exists(c.Name) {
+			if err := packsmgr.Delete(c.Name); err != nil {
+				responseMessage = "error deleting pack"
+				responseCode = http.StatusInternalServerError
+				if settingsmgr.DebugService(settings.ServiceAdmin) {
+					log.Printf("DebugService: %s %v", responseMessage, err)
+				}
+				goto response
+			}
+			responseMessage = "Pack deleted successfully"
+		}
+	}
+response:
+	// Prepare response
+	response, err := json.Marshal(AdminResponse{Message: responseMessage})
+	if err != nil {
+		responseMessage = "error formating response"
+		responseCode = http.StatusInternalServerError
+		response = []byte(responseMessage)
+		if settingsmgr.DebugService(settings.ServiceAdmin) {
+			log.Printf("DebugService: %s %v", responseMessage, err)
+		}
+	}
+	// Send response
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(responseCode)
+	_, _ = w.Write(response)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Println("DebugService: Packs response sent")
+	}
+}
+
 // Handler for POST request for /settings
 func settingsPOSTHandler(w http.ResponseWriter, r *http.Request) {
 	responseMessage := "OK"
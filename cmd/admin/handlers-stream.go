@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/pkg/queries"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/utils"
+)
+
+const (
+	// Interval to check for new query results while streaming
+	streamInterval = 1 * time.Second
+	// Interval to keep idle streams alive through proxies
+	streamKeepAlive = 15 * time.Second
+	// Time to wait for results still in the logging queue once a query is completed
+	streamGrace = 10 * time.Second
+	// Maximum of query logs to read from the DB at once
+	streamBatch int = 500
+	// Query logs are read again for this window, since concurrent inserts can commit out of ID order
+	streamWindow = 1 * time.Minute
+)
+
+// QueryProgressJSON to stream the progress of a query, in the current generation for recurring queries
+type QueryProgressJSON struct {
+	Expected   int  `json:"expected"`
+	Executions int  `json:"executions"`
+	Errors     int  `json:"errors"`
+	Active     bool `json:"active"`
+	Completed  bool `json:"completed"`
+	Generation uint `json:"generation"`
+}
+
+// Helper to prepare one query log to be returned as JSON
+func queryLogToJSON(q OsqueryQueryData) QueryLogJSON {
+	return QueryLogJSON{
+		ID: q.ID,
+		Created: CreationTimes{
+			Display:   pastTimeAgo(q.CreatedAt),
+			Timestamp: pastTimestamp(q.CreatedAt),
+		},
+		Generation: q.Generation,
+		Data:       string(q.Data),
+	}
+}
+
+// Helper to get the progress of a query
+func queryProgress(query queries.DistributedQuery) QueryProgressJSON {
+	return QueryProgressJSON{
+		Expected:   query.Expected,
+		Executions: query.Executions,
+		Errors:     query.Errors,
+		Active:     query.Active,
+		Completed:  query.Completed,
+		Generation: query.Generation,
+	}
+}
+
+// Helper to send one server-sent event, with ID when it is not zero
+func sendEvent(w http.ResponseWriter, event string, id uint, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// Handler for GET requests to stream the results and progress of a query as server-sent events
+// Results after the ID in the from parameter, or in the Last-Event-ID header when reconnecting, are sent first
+// Recent results are sent again on reconnect, and the client must ignore the IDs already received
+func queryStreamHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting name")
+		return
+	}
+	// Get query by name
+	query, err := queriesmgr.Get(name)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting query %v", err)
+		http.Error(w, "unknown query", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error streaming, flush not supported")
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	// Cursor of the last result sent
+	from := r.Header.Get("Last-Event-ID")
+	if from == "" {
+		from = r.URL.Query().Get("from")
+	}
+	var cursor uint
+	if from != "" {
+		c, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			incMetric(metricAdminErr)
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = uint(c)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	incMetric(metricAdminOK)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Printf("DebugService: Streaming query %s from %d", name, cursor)
+	}
+	progress := queryProgress(query)
+	if err := sendEvent(w, "progress", 0, progress); err != nil {
+		return
+	}
+	ticker := time.NewTicker(streamInterval)
+	defer ticker.Stop()
+	lastSent := time.Now()
+	lastResult := query.UpdatedAt
+	// Results sent within the window, so they are not sent again when they are read again
+	sent := make(map[uint]time.Time)
+	for {
+		since := time.Now().Add(-streamWindow)
+		for id, created := range sent {
+			if created.Before(since) {
+				delete(sent, id)
+			}
+		}
+		// Send all new results, in batches
+		var after uint
+		for {
+			logs, err := postgresQueryLogsSince(name, after, cursor, since, streamBatch)
+			if err != nil {
+				log.Printf("error getting logs %v", err)
+				return
+			}
+			for _, l := range logs {
+				after = l.ID
+				if _, ok := sent[l.ID]; ok {
+					continue
+				}
+				if err := sendEvent(w, "result", l.ID, queryLogToJSON(l)); err != nil {
+					return
+				}
+				sent[l.ID] = l.CreatedAt
+				if l.ID > cursor {
+					cursor = l.ID
+				}
+				lastSent = time.Now()
+				lastResult = lastSent
+			}
+			if len(logs) < streamBatch {
+				break
+			}
+		}
+		if p := queryProgress(query); p != progress {
+			progress = p
+			if err := sendEvent(w, "progress", 0, progress); err != nil {
+				return
+			}
+			lastSent = time.Now()
+		}
+		// Completed and deleted queries do not get more results, once the logging queue is drained
+		if (query.Completed || query.Deleted) && time.Since(lastResult) > streamGrace {
+			_ = sendEvent(w, "done", 0, progress)
+			flusher.Flush()
+			return
+		}
+		if time.Since(lastSent) > streamKeepAlive {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			lastSent = time.Now()
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		// Read the progress before the results, so all results are sent once the query is completed
+		if query, err = queriesmgr.Get(name); err != nil {
+			log.Printf("error getting query %v", err)
+			return
+		}
+	}
+}
+
+// Helper to get the generation of a recurring query from the request, zero when it is missing
+func requestGeneration(r *http.Request) (uint, error) {
+	g := r.URL.Query().Get("generation")
+	if g == "" {
+		return 0, nil
+	}
+	generation, err := strconv.ParseUint(g, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid generation %s", g)
+	}
+	return uint(generation), nil
+}
+
+// Handler for GET requests to export the results of a query as CSV, JSON Lines or parquet
+// Results of one generation are exported with the generation parameter, all of them otherwise
+// Results are written to the response as they are read from the DB
+func queryExportHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract name
+	name, ok := vars["name"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting name")
+		return
+	}
+	// Extract format
+	format, ok := vars["format"]
+	if !ok || !queries.ValidExportFormat(format) {
+		incMetric(metricAdminErr)
+		log.Printf("error unknown export format %s", format)
+		http.Error(w, "unknown export format", http.StatusBadRequest)
+		return
+	}
+	// Extract generation
+	generation, err := requestGeneration(r)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting generation %v", err)
+		http.Error(w, "invalid generation", http.StatusBadRequest)
+		return
+	}
+	// Verify query
+	if _, err := queriesmgr.Get(name); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting query %v", err)
+		http.Error(w, "unknown query", http.StatusNotFound)
+		return
+	}
+	// Hostnames of nodes by UUID
+	allNodes, err := nodesmgr.Gets("all", 0)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting nodes %v", err)
+		http.Error(w, "error getting nodes", http.StatusInternalServerError)
+		return
+	}
+	hostnames := make(map[string]string)
+	for _, n := range allNodes {
+		hostnames[n.UUID] = n.Hostname
+	}
+	filename := queries.GenerationName(name, generation)
+	w.Header().Set("Content-Type", queries.ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", filename, format))
+	if err := queriesmgr.ExportResults(name, format, generation, hostnames, w); err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error exporting results %v", err)
+		return
+	}
+	incMetric(metricAdminOK)
+	if settingsmgr.DebugService(settings.ServiceAdmin) {
+		log.Printf("DebugService: Query %s exported as %s", filename, format)
+	}
+}
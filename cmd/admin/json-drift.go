@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/pkg/config"
+	"github.com/jmpsec/osctrl/pkg/environments"
+	"github.com/jmpsec/osctrl/pkg/nodes"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/utils"
+)
+
+// DriftNodeJSON to return the configuration status of a node
+type DriftNodeJSON struct {
+	UUID         string    `json:"uuid"`
+	Hostname     string    `json:"hostname"`
+	Platform     string    `json:"platform"`
+	Status       string    `json:"status"`
+	Reported     string    `json:"reported"`
+	Expected     string    `json:"expected"`
+	DriftedSince time.Time `json:"drifted_since"`
+	DriftSeconds int64     `json:"drift_seconds"`
+	LastConfig   time.Time `json:"last_config"`
+}
+
+// ReturnedDrift to return the configuration status of the nodes in an environment
+type ReturnedDrift struct {
+	Environment string           `json:"environment"`
+	Expected    string           `json:"expected"`
+	Stats       nodes.DriftStats `json:"stats"`
+	Nodes       []DriftNodeJSON  `json:"nodes"`
+}
+
+// Helper to generate the hash expected from nodes of an environment without overlays
+func environmentHash(env environments.TLSEnvironment) (string, error) {
+	conf, err := configsmgr.Load(env.Name, env.Configuration)
+	if err != nil {
+		return config.Hash([]byte(env.Configuration)), nil
+	}
+	packs, err := packsmgr.Attached(env.Name)
+	if err != nil {
+		return "", err
+	}
+	conf.MergePacks(packs)
+	if settingsmgr.RemoteFlags(settings.ServiceTLS) {
+		if flags, err := environments.RemoteFlags(env.Flags); err == nil {
+			conf.MergeOptions(flags)
+		}
+	}
+	served, err := conf.JSON()
+	if err != nil {
+		return "", err
+	}
+	return config.Hash(served), nil
+}
+
+// Helper to generate the configuration status of the nodes in an environment, only drifted nodes unless all is set
+func driftReport(env environments.TLSEnvironment, all bool) (ReturnedDrift, error) {
+	report := ReturnedDrift{Environment: env.Name, Nodes: []DriftNodeJSON{}}
+	var err error
+	if report.Expected, err = environmentHash(env); err != nil {
+		return report, err
+	}
+	if report.Stats, err = nodesmgr.GetDriftStatsByEnv(env.Name); err != nil {
+		return report, err
+	}
+	var nodesList []nodes.OsqueryNode
+	if all {
+		nodesList, err = nodesmgr.GetByEnv(env.Name, "all", settingsmgr.InactiveHours())
+	} else {
+		nodesList, err = nodesmgr.GetDriftedByEnv(env.Name)
+	}
+	if err != nil {
+		return report, err
+	}
+	for _, n := range nodesList {
+		report.Nodes = append(report.Nodes, DriftNodeJSON{
+			UUID:         n.UUID,
+			Hostname:     n.Hostname,
+			Platform:     n.Platform,
+			Status:       n.ConfigStatus(),
+			Reported:     n.ConfigHash,
+			Expected:     n.ExpectedHash,
+			DriftedSince: n.DriftedSince,
+			DriftSeconds: int64(n.DriftDuration().Seconds()),
+			LastConfig:   n.LastConfig,
+		})
+	}
+	return report, nil
+}
+
+// Handler for the configuration status of nodes by environment in JSON
+// Only drifted nodes are returned, unless the parameter all=true is used
+func jsonDriftHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("environment is missing")
+		return
+	}
+	env, err := envs.Get(envVar)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting environment %v", err)
+		return
+	}
+	report, err := driftReport(env, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting drift %v", err)
+		return
+	}
+	// Serialize JSON
+	returnedJSON, err := json.Marshal(report)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error serializing JSON %v", err)
+		return
+	}
+	incMetric(metricAdminOK)
+	// Header to serve JSON
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(returnedJSON)
+}
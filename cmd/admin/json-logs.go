@@ -5,9 +5,12 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/pkg/queries"
 	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
 	"github.com/jmpsec/osctrl/pkg/utils"
 )
 
@@ -19,6 +22,18 @@ var (
 	}
 )
 
+// Define result actions to be used
+var (
+	ResultActions = map[string]bool{
+		types.ResultAdded:    true,
+		types.ResultRemoved:  true,
+		types.ResultSnapshot: true,
+	}
+)
+
+// Maximum number of results to return when searching
+const maxSearchResults int = 1000
+
 // ReturnedLogs to return a JSON with status/result logs
 type ReturnedLogs struct {
 	Data []LogJSON `json:"data"`
@@ -37,15 +52,39 @@ type LogJSON struct {
 	Second  string        `json:"second"`
 }
 
+// ReturnedResults to return a JSON with searched result logs
+type ReturnedResults struct {
+	Data []ResultJSON `json:"data"`
+}
+
+// ResultJSON to be used to populate JSON data for a result row
+type ResultJSON struct {
+	Created CreationTimes `json:"created"`
+	UUID    string        `json:"uuid"`
+	Name    string        `json:"name"`
+	Action  string        `json:"action"`
+	Columns string        `json:"columns"`
+}
+
 // ReturnedQueryLogs to return a JSON with query logs
+// Cursor is the last ID returned, to stream the logs added afterwards
 type ReturnedQueryLogs struct {
-	Data []QueryLogJSON `json:"data"`
+	Data   []QueryLogJSON `json:"data"`
+	Cursor uint           `json:"cursor"`
 }
 
 // QueryLogJSON to be used to populate JSON data for a query log
 type QueryLogJSON struct {
-	Created CreationTimes `json:"created"`
-	Data    string        `json:"data"`
+	ID         uint          `json:"id"`
+	Created    CreationTimes `json:"created"`
+	Generation uint          `json:"generation"`
+	Data       string        `json:"data"`
+}
+
+// ReturnedQueryDiff to return a JSON with the changes in the results of a recurring query
+type ReturnedQueryDiff struct {
+	queries.ResultDiff
+	Hostnames map[string]string `json:"hostnames"`
 }
 
 // Handler GET requests for JSON status/result logs by node and environment
@@ -134,7 +173,7 @@ func jsonLogsHandler(w http.ResponseWriter, r *http.Request) {
 					Timestamp: pastTimestamp(r.CreatedAt),
 				},
 				First:  r.Name,
-				Second: string(r.Columns),
+				Second: r.Columns,
 			}
 			logJSON = append(logJSON, _l)
 		}
@@ -156,6 +195,93 @@ func jsonLogsHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(returnedJSON)
 }
 
+// Handler GET requests to search result logs by environment
+// Parameters are uuid, name, action, seconds and filter, as many as needed with column=value
+func jsonResultsHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	env, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("environment is missing")
+		return
+	}
+	// Check if environment is valid
+	if !envs.Exists(env) {
+		incMetric(metricAdminErr)
+		log.Printf("error unknown environment (%s)", env)
+		return
+	}
+	params := r.URL.Query()
+	filter := ResultsFilter{
+		Environment: env,
+		UUID:        params.Get("uuid"),
+		Name:        params.Get("name"),
+		Action:      params.Get("action"),
+		Seconds:     int64(sixHours),
+		Columns:     make(map[string]string),
+		Limit:       maxSearchResults,
+	}
+	// Verify action
+	if filter.Action != "" && !ResultActions[filter.Action] {
+		incMetric(metricAdminErr)
+		log.Printf("invalid action %s", filter.Action)
+		return
+	}
+	// If parameter for seconds is not present or invalid, it defaults to 6 hours back
+	if s, err := strconv.ParseInt(params.Get("seconds"), 10, 64); err == nil {
+		filter.Seconds = s
+	}
+	for _, f := range params["filter"] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			incMetric(metricAdminErr)
+			log.Printf("invalid filter %s", f)
+			return
+		}
+		filter.Columns[kv[0]] = kv[1]
+	}
+	// Get results
+	results, err := postgresSearchResults(filter)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error searching results %v", err)
+		return
+	}
+	// Prepare data to be returned
+	resultsJSON := []ResultJSON{}
+	for _, res := range results {
+		_r := ResultJSON{
+			Created: CreationTimes{
+				Display:   pastTimeAgo(res.Timestamp),
+				Timestamp: pastTimestamp(res.Timestamp),
+			},
+			UUID:    res.UUID,
+			Name:    res.Name,
+			Action:  res.Action,
+			Columns: res.Columns,
+		}
+		resultsJSON = append(resultsJSON, _r)
+	}
+	returned := ReturnedResults{
+		Data: resultsJSON,
+	}
+	// Serialize JSON
+	returnedJSON, err := json.Marshal(returned)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error serializing JSON %v", err)
+		return
+	}
+	incMetric(metricAdminOK)
+	// Header to serve JSON
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(returnedJSON)
+}
+
 // Handler for JSON query logs by query name
 func jsonQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 	incMetric(metricAdminReq)
@@ -178,19 +304,86 @@ func jsonQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	// Prepare data to be returned
 	queryLogJSON := []QueryLogJSON{}
+	var cursor uint
 	for _, q := range queryLogs {
-		_c := CreationTimes{
-			Display:   pastTimeAgo(q.CreatedAt),
-			Timestamp: pastTimestamp(q.CreatedAt),
+		if q.ID > cursor {
+			cursor = q.ID
 		}
-		_l := QueryLogJSON{
-			Created: _c,
-			Data:    string(q.Data),
-		}
-		queryLogJSON = append(queryLogJSON, _l)
+		queryLogJSON = append(queryLogJSON, queryLogToJSON(q))
 	}
 	returned := ReturnedQueryLogs{
-		Data: queryLogJSON,
+		Data:   queryLogJSON,
+		Cursor: cursor,
+	}
+	// Serialize JSON
+	returnedJSON, err := json.Marshal(returned)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error serializing JSON %v", err)
+		return
+	}
+	incMetric(metricAdminOK)
+	// Header to serve JSON
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(returnedJSON)
+}
+
+// Handler for JSON changes in the results of a recurring query, from the previous generation
+func jsonQueryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract query name
+	name, ok := vars["name"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("error getting name")
+		return
+	}
+	// Extract generation
+	g, err := strconv.ParseUint(vars["generation"], 10, 32)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting generation %v", err)
+		http.Error(w, "invalid generation", http.StatusBadRequest)
+		return
+	}
+	// Verify query
+	query, err := queriesmgr.Get(name)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error getting query %v", err)
+		http.Error(w, "unknown query", http.StatusNotFound)
+		return
+	}
+	if !query.Recurring() || uint(g) > query.Generation {
+		incMetric(metricAdminErr)
+		log.Printf("error unknown generation %d for %s", g, name)
+		http.Error(w, "unknown generation", http.StatusBadRequest)
+		return
+	}
+	// Compare results
+	diff, err := queriesmgr.CompareGenerations(name, uint(g))
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error comparing generations %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	returned := ReturnedQueryDiff{
+		ResultDiff: diff,
+		Hostnames:  make(map[string]string),
+	}
+	for _, rows := range [][]queries.ResultDiffRow{diff.Added, diff.Removed} {
+		for _, row := range rows {
+			if _, ok := returned.Hostnames[row.UUID]; ok {
+				continue
+			}
+			if node, err := nodesmgr.GetByUUID(row.UUID); err == nil {
+				returned.Hostnames[row.UUID] = node.Hostname
+			}
+		}
 	}
 	// Serialize JSON
 	returnedJSON, err := json.Marshal(returned)
@@ -76,6 +76,10 @@ func jsonQueryHandler(w http.ResponseWriter, r *http.Request) {
 		data := make(QueryData)
 		data["query"] = q.Query
 		data["name"] = q.Name
+		if q.Recurring() {
+			data["repeats"] = q.Schedule()
+			progress["generation"] = int(q.Generation)
+		}
 		_q := QueryJSON{
 			Name:    q.Name,
 			Creator: q.Creator,
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/utils"
+)
+
+// Handler for the diff between two revisions of an environment in JSON
+// Without parameters, the latest revision is compared with the previous one
+func jsonRevisionsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	incMetric(metricAdminReq)
+	utils.DebugHTTPDump(r, settingsmgr.DebugHTTP(settings.ServiceAdmin), false)
+	vars := mux.Vars(r)
+	// Extract environment
+	envVar, ok := vars["environment"]
+	if !ok {
+		incMetric(metricAdminErr)
+		log.Println("environment is missing")
+		return
+	}
+	// Check if environment is valid
+	if !envs.Exists(envVar) {
+		incMetric(metricAdminErr)
+		log.Printf("error unknown environment (%s)", envVar)
+		return
+	}
+	// Revisions to compare
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		latest, err := envs.LatestRevision(envVar)
+		if err != nil {
+			incMetric(metricAdminErr)
+			log.Printf("error getting revisions %v", err)
+			return
+		}
+		to = latest.Number
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		from = to - 1
+	}
+	diff, err := envs.DiffRevisions(envVar, from, to)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error comparing revisions %v", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// Serialize JSON
+	returnedJSON, err := json.Marshal(diff)
+	if err != nil {
+		incMetric(metricAdminErr)
+		log.Printf("error serializing JSON %v", err)
+		return
+	}
+	incMetric(metricAdminOK)
+	// Header to serve JSON
+	w.Header().Set("Content-Type", JSONApplicationUTF8)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(returnedJSON)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/jmpsec/osctrl/pkg/carves"
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/metrics"
 	"github.com/jmpsec/osctrl/pkg/nodes"
@@ -59,6 +60,8 @@ const (
 	defaultRefresh int = 300
 	// Default hours to classify nodes as inactive
 	defaultInactive int = -72
+	// Hostnames of target nodes to show in previews
+	previewNodes int = 20
 )
 
 // Global variables
@@ -71,12 +74,17 @@ var (
 	nodesmgr       *nodes.NodeManager
 	queriesmgr     *queries.Queries
 	carvesmgr      *carves.Carves
+	configsmgr     *config.Configs
+	packsmgr       *config.Packs
+	overlaysmgr    *config.Overlays
+	rolloutsmgr    *config.Rollouts
 	sessionsmgr    *SessionManager
 	envs           *environments.Environment
 	adminUsers     *users.UserManager
 	sessionsTicker *time.Ticker
 	// FIXME this is nasty and should not be a global but here we are
 	osqueryTables []OsqueryTable
+	sqlValidator  *queries.SQLValidator
 	_metrics      *metrics.Metrics
 )
 
@@ -161,6 +169,7 @@ func init() {
 	if err != nil {
 		log.Fatalf("Error loading osquery tables %s", err)
 	}
+	sqlValidator = createSQLValidator(osqueryTables)
 }
 
 // Go go!
@@ -192,6 +201,15 @@ func main() {
 	queriesmgr = queries.CreateQueries(db)
 	// Initialize carves
 	carvesmgr = carves.CreateFileCarves(db)
+	// Initialize configurations
+	configsmgr = config.CreateConfigs(db)
+	importConfigurations()
+	// Initialize shared packs
+	packsmgr = config.CreatePacks(db)
+	// Initialize configuration overlays
+	overlaysmgr = config.CreateOverlays(db)
+	// Initialize configuration rollouts
+	rolloutsmgr = config.CreateRollouts(db)
 	// Initialize sessions
 	sessionsmgr = CreateSessionManager(db)
 	// Initialize service settings
@@ -277,10 +295,18 @@ func main() {
 	routerAdmin.Handle("/json/platform/{platform}/{target}", handlerAuthCheck(http.HandlerFunc(jsonPlatformHandler))).Methods("GET")
 	// Admin: JSON data for logs
 	routerAdmin.Handle("/json/logs/{type}/{environment}/{uuid}", handlerAuthCheck(http.HandlerFunc(jsonLogsHandler))).Methods("GET")
+	// Admin: JSON data to search result logs
+	routerAdmin.Handle("/json/results/{environment}", handlerAuthCheck(http.HandlerFunc(jsonResultsHandler))).Methods("GET")
+	// Admin: JSON data for configuration drift
+	routerAdmin.Handle("/json/drift/{environment}", handlerAuthCheck(http.HandlerFunc(jsonDriftHandler))).Methods("GET")
 	// Admin: JSON data for query logs
 	routerAdmin.Handle("/json/query/{name}", handlerAuthCheck(http.HandlerFunc(jsonQueryLogsHandler))).Methods("GET")
+	// Admin: JSON data for changes between generations of recurring queries
+	routerAdmin.Handle("/json/query/{name}/diff/{generation}", handlerAuthCheck(http.HandlerFunc(jsonQueryDiffHandler))).Methods("GET")
 	// Admin: JSON data for sidebar stats
 	routerAdmin.Handle("/json/stats/{target}/{name}", handlerAuthCheck(http.HandlerFunc(jsonStatsHandler))).Methods("GET")
+	// Admin: JSON data for diff between revisions
+	routerAdmin.Handle("/json/revisions/{environment}", handlerAuthCheck(http.HandlerFunc(jsonRevisionsDiffHandler))).Methods("GET")
 	// Admin: table for environments
 	routerAdmin.Handle("/environment/{environment}/{target}", handlerAuthCheck(http.HandlerFunc(environmentHandler))).Methods("GET")
 	// Admin: table for platforms
@@ -294,9 +320,14 @@ func main() {
 	routerAdmin.Handle("/node/{uuid}", handlerAuthCheck(http.HandlerFunc(nodeHandler))).Methods("GET")
 	// Admin: multi node action
 	routerAdmin.Handle("/node/actions", handlerAuthCheck(http.HandlerFunc(nodeActionsPOSTHandler))).Methods("POST")
+	// Admin: node tags
+	routerAdmin.Handle("/node/tags", handlerAuthCheck(http.HandlerFunc(nodeTagsPOSTHandler))).Methods("POST")
 	// Admin: run queries
 	routerAdmin.Handle("/query/run", handlerAuthCheck(http.HandlerFunc(queryRunGETHandler))).Methods("GET")
 	routerAdmin.Handle("/query/run", handlerAuthCheck(http.HandlerFunc(queryRunPOSTHandler))).Methods("POST")
+	// Admin: check SQL of a query before running it
+	routerAdmin.Handle("/query/check", handlerAuthCheck(http.HandlerFunc(queryCheckPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/targets/preview", handlerAuthCheck(http.HandlerFunc(targetsPreviewPOSTHandler))).Methods("POST")
 	// Admin: list queries
 	routerAdmin.Handle("/query/list", handlerAuthCheck(http.HandlerFunc(queryListGETHandler))).Methods("GET")
 	// Admin: query actions
@@ -305,6 +336,8 @@ func main() {
 	routerAdmin.Handle("/query/json/{target}", handlerAuthCheck(http.HandlerFunc(jsonQueryHandler))).Methods("GET")
 	// Admin: query logs
 	routerAdmin.Handle("/query/logs/{name}", handlerAuthCheck(http.HandlerFunc(queryLogsHandler))).Methods("GET")
+	routerAdmin.Handle("/query/stream/{name}", handlerAuthCheck(http.HandlerFunc(queryStreamHandler))).Methods("GET")
+	routerAdmin.Handle("/query/export/{name}/{format}", handlerAuthCheck(http.HandlerFunc(queryExportHandler))).Methods("GET")
 	// Admin: carve files
 	routerAdmin.Handle("/carves/run", handlerAuthCheck(http.HandlerFunc(carvesRunGETHandler))).Methods("GET")
 	routerAdmin.Handle("/carves/run", handlerAuthCheck(http.HandlerFunc(carvesRunPOSTHandler))).Methods("POST")
@@ -322,16 +355,31 @@ func main() {
 	routerAdmin.Handle("/conf/{environment}", handlerAuthCheck(http.HandlerFunc(confGETHandler))).Methods("GET")
 	routerAdmin.Handle("/conf/{environment}", handlerAuthCheck(http.HandlerFunc(confPOSTHandler))).Methods("POST")
 	routerAdmin.Handle("/intervals/{environment}", handlerAuthCheck(http.HandlerFunc(intervalsPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/revisions/{environment}", handlerAuthCheck(http.HandlerFunc(revisionsPOSTHandler))).Methods("POST")
+	// Admin: canary rollouts of configuration
+	routerAdmin.Handle("/rollout/{environment}", handlerAuthCheck(http.HandlerFunc(rolloutGETHandler))).Methods("GET")
+	routerAdmin.Handle("/rollout/{environment}", handlerAuthCheck(http.HandlerFunc(rolloutPOSTHandler))).Methods("POST")
+	// Admin: search result logs
+	routerAdmin.Handle("/results/{environment}", handlerAuthCheck(http.HandlerFunc(resultsGETHandler))).Methods("GET")
+	// Admin: nodes not running the expected configuration
+	routerAdmin.Handle("/drift/{environment}", handlerAuthCheck(http.HandlerFunc(driftGETHandler))).Methods("GET")
 	// Admin: nodes enroll
 	routerAdmin.Handle("/enroll/{environment}", handlerAuthCheck(http.HandlerFunc(enrollGETHandler))).Methods("GET")
+	// Admin: download flagfile by platform
+	routerAdmin.Handle("/flags/{environment}/{platform}", handlerAuthCheck(http.HandlerFunc(flagsGETHandler))).Methods("GET")
+	routerAdmin.Handle("/package/{environment}/{format}", handlerAuthCheck(http.HandlerFunc(packageGETHandler))).Methods("GET")
 	routerAdmin.Handle("/enroll/{environment}", handlerAuthCheck(http.HandlerFunc(enrollPOSTHandler))).Methods("POST")
 	routerAdmin.Handle("/expiration/{environment}", handlerAuthCheck(http.HandlerFunc(expirationPOSTHandler))).Methods("POST")
+	routerAdmin.Handle("/secrets/{environment}", handlerAuthCheck(http.HandlerFunc(secretsPOSTHandler))).Methods("POST")
 	// Admin: server settings
 	routerAdmin.Handle("/settings/{service}", handlerAuthCheck(http.HandlerFunc(settingsGETHandler))).Methods("GET")
 	routerAdmin.Handle("/settings/{service}", handlerAuthCheck(http.HandlerFunc(settingsPOSTHandler))).Methods("POST")
 	// Admin: manage environments
 	routerAdmin.Handle("/environments", handlerAuthCheck(http.HandlerFunc(envsGETHandler))).Methods("GET")
 	routerAdmin.Handle("/environments", handlerAuthCheck(http.HandlerFunc(envsPOSTHandler))).Methods("POST")
+	// Admin: manage shared packs
+	routerAdmin.Handle("/packs", handlerAuthCheck(http.HandlerFunc(packsGETHandler))).Methods("GET")
+	routerAdmin.Handle("/packs", handlerAuthCheck(http.HandlerFunc(packsPOSTHandler))).Methods("POST")
 	// Admin: manage users
 	routerAdmin.Handle("/users", handlerAuthCheck(http.HandlerFunc(usersGETHandler))).Methods("GET")
 	routerAdmin.Handle("/users", handlerAuthCheck(http.HandlerFunc(usersPOSTHandler))).Methods("POST")
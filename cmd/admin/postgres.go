@@ -7,16 +7,17 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
-// OsqueryResultData to log result data to database
+// OsqueryResultData to log result data to database, one row per result
 type OsqueryResultData struct {
 	gorm.Model
 	UUID        string `gorm:"index"`
-	Environment string
-	Name        string
-	Action      string
+	Environment string `gorm:"index"`
+	Name        string `gorm:"index"`
+	Action      string `gorm:"index"`
 	Epoch       int64
-	Columns     json.RawMessage
+	Columns     string `gorm:"type:jsonb"`
 	Counter     int
+	Timestamp   time.Time `gorm:"index"`
 }
 
 // OsqueryStatusData to log status data to database
@@ -37,6 +38,7 @@ type OsqueryQueryData struct {
 	UUID        string `gorm:"index"`
 	Environment string
 	Name        string
+	Generation  uint
 	Data        json.RawMessage
 	Status      int
 }
@@ -51,6 +53,26 @@ func postgresStatusLogs(uuid, environment string, seconds int64) ([]OsqueryStatu
 	return logs, nil
 }
 
+// Function to count the error status logs by node of an environment, since a given time
+// osquery uses severity 2 for errors and 3 for fatal
+func postgresStatusErrors(environment string, since time.Time) (map[string]int, error) {
+	errors := make(map[string]int)
+	rows, err := db.Model(&OsqueryStatusData{}).Select("uuid, count(*)").Where("environment = ?", environment).Where("created_at > ?", since).Where("severity IN (?)", []string{"2", "3"}).Group("uuid").Rows()
+	if err != nil {
+		return errors, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uuid string
+		var count int
+		if err := rows.Scan(&uuid, &count); err != nil {
+			return errors, err
+		}
+		errors[uuid] = count
+	}
+	return errors, nil
+}
+
 // Function to retrieve the last result logs for a given node
 func postgresResultLogs(uuid, environment string, seconds int64) ([]OsqueryResultData, error) {
 	var logs []OsqueryResultData
@@ -61,6 +83,43 @@ func postgresResultLogs(uuid, environment string, seconds int64) ([]OsqueryResul
 	return logs, nil
 }
 
+// ResultsFilter to search result logs, columns are matched by value
+type ResultsFilter struct {
+	Environment string
+	UUID        string
+	Name        string
+	Action      string
+	Seconds     int64
+	Columns     map[string]string
+	Limit       int
+}
+
+// Function to search result logs, matching values inside the columns JSON
+func postgresSearchResults(filter ResultsFilter) ([]OsqueryResultData, error) {
+	var logs []OsqueryResultData
+	query := db.Where("environment = ?", filter.Environment)
+	if filter.UUID != "" {
+		query = query.Where("uuid = ?", filter.UUID)
+	}
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Seconds > 0 {
+		minusSeconds := time.Now().Add(time.Duration(-filter.Seconds) * time.Second)
+		query = query.Where("timestamp > ?", minusSeconds)
+	}
+	for column, value := range filter.Columns {
+		query = query.Where("columns->>? = ?", column, value)
+	}
+	if err := query.Order("timestamp desc").Limit(filter.Limit).Find(&logs).Error; err != nil {
+		return logs, err
+	}
+	return logs, nil
+}
+
 // Function to retrieve the query log by name
 func postgresQueryLogs(name string) ([]OsqueryQueryData, error) {
 	var logs []OsqueryQueryData
@@ -69,3 +128,13 @@ func postgresQueryLogs(name string) ([]OsqueryQueryData, error) {
 	}
 	return logs, nil
 }
+
+// Function to retrieve the query logs by name added after the cursor ID or created since the provided time
+// Logs are returned in order, after the ID in the after parameter to read them in pages
+func postgresQueryLogsSince(name string, after, cursor uint, since time.Time, limit int) ([]OsqueryQueryData, error) {
+	var logs []OsqueryQueryData
+	if err := db.Where("name = ? AND id > ? AND (id > ? OR created_at >= ?)", name, after, cursor, since).Order("id").Limit(limit).Find(&logs).Error; err != nil {
+		return logs, err
+	}
+	return logs, nil
+}
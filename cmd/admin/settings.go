@@ -67,6 +67,12 @@ func loadingSettings() {
 			log.Fatalf("Failed to add %s to configuration: %v", settings.InactiveHours, err)
 		}
 	}
+	// Check if service settings for tables from osquery extensions is ready
+	if !settingsmgr.IsValue(settings.ServiceAdmin, settings.ExtraTables) {
+		if err := settingsmgr.NewStringValue(settings.ServiceAdmin, settings.ExtraTables, ""); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.ExtraTables, err)
+		}
+	}
 	// Write JSON config to settings
 	if err := settingsmgr.SetAllJSON(settings.ServiceAdmin, adminConfig.Listener, adminConfig.Port, adminConfig.Host, adminConfig.Auth, adminConfig.Logging); err != nil {
 		log.Fatalf("Failed to add JSON values to configuration: %v", err)
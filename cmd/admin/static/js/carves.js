@@ -1,36 +1,13 @@
 function sendCarve() {
   var _csrftoken = $("#csrftoken").val();
-  var _env_list = $("#target_env").val();
-  var _platform_list = $("#target_platform").val();
-  var _uuid_list = $("#target_uuids").val();
-  var _host_list = $("#target_hosts").val();
   var _repeat = $('#target_repeat').prop('checked') ? 1 : 0;
   var _path = $("#carve").val();
 
   // Making sure targets are specified
-  if (_env_list.length === 0 && _platform_list.length === 0 && _uuid_list.length === 0 && _host_list.length === 0) {
-    $("#warningModalMessage").text("No targets have been specified");
-    $("#warningModal").modal();
+  var _targets = getTargets();
+  if (_targets === null) {
     return;
   }
-  // Check if all environments have been selected
-  if (_env_list.includes("all_environments_99")) {
-    _env_list = [];
-    $('#target_env option').each(function () {
-      if ($(this).val() !== "" && $(this).val() !== "all_environments_99") {
-        _env_list.push($(this).val());
-      }
-    });
-  }
-  // Check if all platforms have been selected
-  if (_platform_list.includes("all_platforms_99")) {
-    _platform_list = [];
-    $('#target_platform option').each(function () {
-      if ($(this).val() !== "" && $(this).val() !== "all_platforms_99") {
-        _platform_list.push($(this).val());
-      }
-    });
-  }
   // Making sure path isn't empty
   console.log(_path);
   if (_path === "") {
@@ -41,13 +18,10 @@ function sendCarve() {
   var _url = '/carves/run';
   var data = {
     csrftoken: _csrftoken,
-    environment_list: _env_list,
-    platform_list: _platform_list,
-    uuid_list: _uuid_list,
-    host_list: _host_list,
     path: _path,
     repeat: _repeat
   };
+  $.extend(data, _targets);
   sendPostRequest(data, _url, '/carves/list', false);
 }
 
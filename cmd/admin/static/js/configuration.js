@@ -8,6 +8,7 @@ function saveConfiguration() {
   var data = {
     csrftoken: _csrftoken,
     configuration: btoa(_configuration),
+    comment: $("#revision_comment").val(),
   };
   sendPostRequest(data, _url, '', true);
   $('#configuration_header').removeClass("bg-changed");
@@ -26,6 +27,7 @@ function saveIntervals() {
     config: parseInt(_config),
     log: parseInt(_log),
     query: parseInt(_query),
+    comment: $("#revision_comment").val(),
   };
   sendPostRequest(data, _url, '', true);
   $('#intervals_header').removeClass("bg-changed");
@@ -50,3 +52,77 @@ function lineCharPosition(_pos) {
   });
   return 'line ' + line;
 }
+
+function showRevisionDiff(_number) {
+  var _url = '/json/revisions/' + window.location.pathname.split('/').pop() + '?to=' + _number;
+  $.getJSON(_url, function(data) {
+    var _content = $("#diff_content");
+    _content.empty();
+    var sections = {Configuration: data.configuration, Flags: data.flags, Intervals: data.intervals};
+    $.each(sections, function(name, lines) {
+      var _changed = lines.some(function(l) { return l.type !== ' '; });
+      if (!_changed) {
+        return;
+      }
+      _content.append($('<b>').text('--- ' + name + '\n'));
+      $.each(lines, function(i, l) {
+        var _line = $('<span>').text(l.type + ' ' + l.line + '\n');
+        if (l.type === '+') {
+          _line.addClass('text-success');
+        } else if (l.type === '-') {
+          _line.addClass('text-danger');
+        }
+        _content.append(_line);
+      });
+    });
+    $("#diff_title").text('Changes from revision ' + data.from + ' to revision ' + data.to);
+    $("#diffModal").modal();
+  });
+}
+
+function confirmRollback(_number) {
+  var modal_message = 'Are you sure you want to rollback to revision ' + _number + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    rollbackRevision(_number);
+  });
+  $("#confirmModal").modal();
+}
+
+function rollbackRevision(_number) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = '/revisions/' + window.location.pathname.split('/').pop();
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'rollback',
+    number: _number,
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
+
+function showRolloutModal() {
+  $("#rolloutModal").modal();
+}
+
+function startRollout() {
+  var _csrftoken = $("#csrftoken").val();
+  var _editor = $('#conf').data('CodeMirrorInstance');
+  var _configuration = _editor.getValue();
+
+  var _env = window.location.pathname.split('/').pop();
+  var _url = '/rollout/' + _env;
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'start',
+    configuration: btoa(_configuration),
+    percentage: parseInt($("#rollout_percentage").val()),
+    tag: $("#rollout_tag").val(),
+    comment: $("#revision_comment").val(),
+  };
+  $('#rolloutModal').modal('hide');
+  sendPostRequest(data, _url, _url, false);
+}
@@ -46,3 +46,56 @@ function uploadCertificate() {
   };
   sendPostRequest(data, _url, window.location.pathname, false);
 }
+
+function genericSecretAction(_action, _name, _secret, _hours, _max) {
+  var _csrftoken = $("#csrftoken").val();
+  var _url = '/secrets/' + window.location.pathname.split('/').pop();
+  var data = {
+    csrftoken: _csrftoken,
+    action: _action,
+    name: _name,
+    secret: _secret,
+    hours: _hours,
+    max: _max,
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
+
+function secretAction(_action, _name) {
+  genericSecretAction(_action, _name, '', 0, 0);
+}
+
+function showSecretModal() {
+  $("#secret_name").val('');
+  $("#secret_value").val('');
+  $("#secret_hours").val(0);
+  $("#secret_max").val(0);
+  $("#secretModal").modal();
+}
+
+function addSecret() {
+  $('#secretModal').modal('hide');
+  var _hours = parseInt($("#secret_hours").val()) || 0;
+  var _max = parseInt($("#secret_max").val()) || 0;
+  genericSecretAction('add', $("#secret_name").val(), $("#secret_value").val(), _hours, _max);
+}
+
+function confirmRotateSecret() {
+  var modal_message = 'A new primary secret will be generated. Current secrets will expire after the overlap window. Are you sure?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    secretAction('rotate', '');
+  });
+  $("#confirmModal").modal();
+}
+
+function confirmDeleteSecret(_name) {
+  var modal_message = 'Nodes will not be able to enroll with the secret ' + _name + '. Are you sure?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    secretAction('delete', _name);
+  });
+  $("#confirmModal").modal();
+}
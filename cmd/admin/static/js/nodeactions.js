@@ -85,3 +85,46 @@ function showCarveFiles(_uuids) {
   });
   $("#carveModal").modal();
 }
+
+function setNodeTag(_uuid) {
+  var _csrftoken = $("#csrftoken").val();
+  var _tag = $("#node_tag").val().trim();
+  var _split = _tag.indexOf('=');
+
+  if (_split < 1) {
+    $("#warningModalMessage").text("Tag must be key=value");
+    $("#warningModal").modal();
+    return;
+  }
+  var _url = '/node/tags';
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'set',
+    uuid: _uuid,
+    key: _tag.substring(0, _split),
+    value: _tag.substring(_split + 1)
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
+
+function confirmRemoveNodeTag(_uuid, _key) {
+  $("#confirmModalMessage").text('Are you sure you want to remove the tag ' + _key + '?');
+  $('#confirm_action').off('click').click(function () {
+    $('#confirmModal').modal('hide');
+    removeNodeTag(_uuid, _key);
+  });
+  $("#confirmModal").modal();
+}
+
+function removeNodeTag(_uuid, _key) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = '/node/tags';
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'remove',
+    uuid: _uuid,
+    key: _key
+  };
+  sendPostRequest(data, _url, window.location.pathname, false);
+}
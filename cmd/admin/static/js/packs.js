@@ -0,0 +1,63 @@
+var emptyPack = '{\n  "queries": {}\n}';
+
+function createPack() {
+  $("#pack_modal_title").text('Create new pack');
+  $("#pack_action").val('create');
+  $("#pack_name").val('').prop('readonly', false);
+  $("#pack_description").val('');
+  $("#pack_environments").val([]);
+  $('#pack_value').data('CodeMirrorInstance').setValue(emptyPack);
+  $("#packModal").modal();
+}
+
+function editPack(_name, _description, _value, _environments) {
+  $("#pack_modal_title").text('Edit pack ' + _name);
+  $("#pack_action").val('update');
+  $("#pack_name").val(_name).prop('readonly', true);
+  $("#pack_description").val(_description);
+  $("#pack_environments").val(_environments);
+  $('#pack_value').data('CodeMirrorInstance').setValue(JSON.stringify(JSON.parse(_value), null, 2));
+  $("#packModal").modal();
+}
+
+function confirmSavePack() {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = window.location.pathname;
+
+  var _pack = $('#pack_value').data('CodeMirrorInstance').getValue();
+  var _environments = $("#pack_environments").val();
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: $("#pack_action").val(),
+    name: $("#pack_name").val(),
+    description: $("#pack_description").val(),
+    pack: btoa(_pack),
+    environments: _environments ? _environments : [],
+  };
+  sendPostRequest(data, _url, _url, false);
+}
+
+function confirmDeletePack(_name) {
+  var modal_message = 'Are you sure you want to delete the pack ' + _name + '?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    deletePack(_name);
+  });
+  $("#confirmModal").modal();
+}
+
+function deletePack(_name) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = window.location.pathname;
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: 'delete',
+    name: _name,
+  };
+  sendPostRequest(data, _url, _url, false);
+}
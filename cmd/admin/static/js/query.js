@@ -1,36 +1,20 @@
 function sendQuery() {
   var _csrftoken = $("#csrftoken").val();
-  var _env_list = $("#target_env").val();
-  var _platform_list = $("#target_platform").val();
-  var _uuid_list = $("#target_uuids").val();
-  var _host_list = $("#target_hosts").val();
-  var _repeat = $('#target_repeat').prop('checked') ? 1 : 0;
+  var _repeat = parseInt($('#target_repeat').val(), 10) || 0;
+  var _cron = $('#target_cron').val().trim();
   var editor = $('.CodeMirror')[0].CodeMirror;
   var _query = editor.getValue();
 
   // Making sure targets are specified
-  if (_env_list.length === 0 && _platform_list.length === 0 && _uuid_list.length === 0 && _host_list.length === 0) {
-    $("#warningModalMessage").text("No targets have been specified");
-    $("#warningModal").modal();
+  var _targets = getTargets();
+  if (_targets === null) {
     return;
   }
-  // Check if all environments have been selected
-  if (_env_list.includes("all_environments_99")) {
-    _env_list = [];
-    $('#target_env option').each(function () {
-      if ($(this).val() !== "" && $(this).val() !== "all_environments_99") {
-        _env_list.push($(this).val());
-      }
-    });
-  }
-  // Check if all platforms have been selected
-  if (_platform_list.includes("all_platforms_99")) {
-    _platform_list = [];
-    $('#target_platform option').each(function () {
-      if ($(this).val() !== "" && $(this).val() !== "all_platforms_99") {
-        _platform_list.push($(this).val());
-      }
-    });
+  // Making sure the query repeats only in one way
+  if (_repeat > 0 && _cron !== "") {
+    $("#warningModalMessage").text("Query can repeat every some minutes or on a cron schedule, but not both");
+    $("#warningModal").modal();
+    return;
   }
   // Making sure query isn't empty
   console.log(_query);
@@ -46,14 +30,37 @@ function sendQuery() {
   var _url = '/query/run';
   var data = {
     csrftoken: _csrftoken,
-    environment_list: _env_list,
-    platform_list: _platform_list,
-    uuid_list: _uuid_list,
-    host_list: _host_list,
     query: _query,
-    repeat: _repeat
+    repeat: _repeat,
+    cron: _cron
   };
-  sendPostRequest(data, _url, '/query/list', false);
+  $.extend(data, _targets);
+  // Check the query first, and confirm when there are warnings
+  $.ajax({
+    url: '/query/check',
+    dataType: 'json',
+    type: 'POST',
+    contentType: 'application/json',
+    data: JSON.stringify(data),
+    processData: false,
+    success: function(resp, textStatus, jQxhr){
+      if (resp.warnings && resp.warnings.length > 0) {
+        $("#confirmModalMessage").text('Warnings: ' + resp.warnings.join('; ') + '. Run the query anyway?');
+        $('#confirm_action').off('click').click(function () {
+          $('#confirmModal').modal('hide');
+          sendPostRequest(data, _url, '/query/list', false);
+        });
+        $("#confirmModal").modal();
+        return;
+      }
+      sendPostRequest(data, _url, '/query/list', false);
+    },
+    error: function(jqXhr, textStatus, errorThrown){
+      var _serverJSON = $.parseJSON(jqXhr.responseText);
+      $("#warningModalMessage").text(_serverJSON.message);
+      $("#warningModal").modal();
+    }
+  });
 }
 
 function clearQuery() {
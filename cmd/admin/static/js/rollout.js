@@ -0,0 +1,21 @@
+function confirmRollout(_action) {
+  var modal_message = 'Are you sure you want to ' + _action + ' this rollout?';
+  $("#confirmModalMessage").text(modal_message);
+  $('#confirm_action').click(function () {
+    $('#confirmModal').modal('hide');
+    rolloutAction(_action);
+  });
+  $("#confirmModal").modal();
+}
+
+function rolloutAction(_action) {
+  var _csrftoken = $("#csrftoken").val();
+
+  var _url = window.location.pathname;
+
+  var data = {
+    csrftoken: _csrftoken,
+    action: _action,
+  };
+  sendPostRequest(data, _url, _url, false);
+}
@@ -0,0 +1,84 @@
+function splitTargetList(_value) {
+  return _value.split(/[\s,]+/).filter(function (v) {
+    return v !== "";
+  });
+}
+
+function getTargets() {
+  var _env_list = $("#target_env").val();
+  var _platform_list = $("#target_platform").val();
+  var _uuid_list = $("#target_uuids").val();
+  var _host_list = $("#target_hosts").val();
+  var _tag_expression = $("#target_tags").val().trim();
+  var _cidr_list = splitTargetList($("#target_cidrs").val());
+  var _osquery_version = $("#target_osquery_version").val().trim();
+  var _platform_version = $("#target_platform_version").val().trim();
+  var _last_seen = $("#target_last_seen").val();
+  var _match = $("#target_match").val();
+
+  // Making sure targets are specified
+  if (_env_list.length === 0 && _platform_list.length === 0 && _uuid_list.length === 0 && _host_list.length === 0 &&
+    _tag_expression === "" && _cidr_list.length === 0 && _osquery_version === "" && _platform_version === "" && _last_seen === "") {
+    $("#warningModalMessage").text("No targets have been specified");
+    $("#warningModal").modal();
+    return null;
+  }
+  // Check if all environments have been selected
+  if (_env_list.includes("all_environments_99")) {
+    _env_list = [];
+    $('#target_env option').each(function () {
+      if ($(this).val() !== "" && $(this).val() !== "all_environments_99") {
+        _env_list.push($(this).val());
+      }
+    });
+  }
+  // Check if all platforms have been selected
+  if (_platform_list.includes("all_platforms_99")) {
+    _platform_list = [];
+    $('#target_platform option').each(function () {
+      if ($(this).val() !== "" && $(this).val() !== "all_platforms_99") {
+        _platform_list.push($(this).val());
+      }
+    });
+  }
+  return {
+    environment_list: _env_list,
+    platform_list: _platform_list,
+    uuid_list: _uuid_list,
+    host_list: _host_list,
+    tag_expression: _tag_expression,
+    cidr_list: _cidr_list,
+    osquery_version: _osquery_version,
+    platform_version: _platform_version,
+    last_seen: _last_seen,
+    match: _match
+  };
+}
+
+function previewTargets() {
+  var _targets = getTargets();
+  if (_targets === null) {
+    return;
+  }
+  var data = $.extend({ csrftoken: $("#csrftoken").val() }, _targets);
+  $.ajax({
+    url: '/targets/preview',
+    dataType: 'json',
+    type: 'POST',
+    contentType: 'application/json',
+    data: JSON.stringify(data),
+    processData: false,
+    success: function(resp, textStatus, jQxhr){
+      var _shown = resp.nodes || [];
+      var _nodes = _shown.join(', ');
+      if (resp.expected > _shown.length) {
+        _nodes = _nodes + ' and ' + (resp.expected - _shown.length) + ' more';
+      }
+      $("#target_preview").removeClass("text-danger").text(resp.message + (_nodes !== '' ? ': ' + _nodes : ''));
+    },
+    error: function(jqXhr, textStatus, errorThrown){
+      var _serverJSON = $.parseJSON(jqXhr.responseText);
+      $("#target_preview").addClass("text-danger").text(_serverJSON.message);
+    }
+  });
+}
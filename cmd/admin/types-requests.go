@@ -11,26 +11,41 @@ type LogoutRequest struct {
 	CSRFToken string `json:"csrftoken"`
 }
 
+// TargetsRequest to receive the targets of queries and carves
+type TargetsRequest struct {
+	Environments    []string `json:"environment_list"`
+	Platforms       []string `json:"platform_list"`
+	UUIDs           []string `json:"uuid_list"`
+	Hosts           []string `json:"host_list"`
+	Tags            string   `json:"tag_expression"`
+	CIDRs           []string `json:"cidr_list"`
+	OsqueryVersion  string   `json:"osquery_version"`
+	PlatformVersion string   `json:"platform_version"`
+	LastSeen        string   `json:"last_seen"`
+	Match           string   `json:"match"`
+}
+
 // DistributedQueryRequest to receive query requests
 type DistributedQueryRequest struct {
-	CSRFToken    string   `json:"csrftoken"`
-	Environments []string `json:"environment_list"`
-	Platforms    []string `json:"platform_list"`
-	UUIDs        []string `json:"uuid_list"`
-	Hosts        []string `json:"host_list"`
-	Query        string   `json:"query"`
-	Repeat       int      `json:"repeat"`
+	CSRFToken string `json:"csrftoken"`
+	TargetsRequest
+	Query  string `json:"query"`
+	Repeat int    `json:"repeat"`
+	Cron   string `json:"cron"`
 }
 
 // DistributedCarveRequest to receive carve requests
 type DistributedCarveRequest struct {
-	CSRFToken    string   `json:"csrftoken"`
-	Environments []string `json:"environment_list"`
-	Platforms    []string `json:"platform_list"`
-	UUIDs        []string `json:"uuid_list"`
-	Hosts        []string `json:"host_list"`
-	Path         string   `json:"path"`
-	Repeat       int      `json:"repeat"`
+	CSRFToken string `json:"csrftoken"`
+	TargetsRequest
+	Path   string `json:"path"`
+	Repeat int    `json:"repeat"`
+}
+
+// TargetsPreviewRequest to receive the targets to preview before running a query or carve
+type TargetsPreviewRequest struct {
+	CSRFToken string `json:"csrftoken"`
+	TargetsRequest
 }
 
 // DistributedQueryActionRequest to receive query requests
@@ -54,6 +69,15 @@ type NodeMultiActionRequest struct {
 	UUIDs     []string `json:"uuids"`
 }
 
+// NodeTagRequest to receive changes to the tags of a node
+type NodeTagRequest struct {
+	CSRFToken string `json:"csrftoken"`
+	Action    string `json:"action"`
+	UUID      string `json:"uuid"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+}
+
 // SettingsRequest to receive changes to settings
 type SettingsRequest struct {
 	CSRFToken string `json:"csrftoken"`
@@ -68,6 +92,17 @@ type SettingsRequest struct {
 type ConfigurationRequest struct {
 	CSRFToken        string `json:"csrftoken"`
 	ConfigurationB64 string `json:"configuration"`
+	Comment          string `json:"comment"`
+}
+
+// PacksRequest to receive changes to shared packs
+type PacksRequest struct {
+	CSRFToken    string   `json:"csrftoken"`
+	Action       string   `json:"action"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	PackB64      string   `json:"pack"`
+	Environments []string `json:"environments"`
 }
 
 // EnrollRequest to receive changes to enroll certificates
@@ -76,12 +111,40 @@ type EnrollRequest struct {
 	CertificateB64 string `json:"certificate"`
 }
 
+// SecretRequest to receive changes to enroll secrets
+type SecretRequest struct {
+	CSRFToken      string `json:"csrftoken"`
+	Action         string `json:"action"`
+	Name           string `json:"name"`
+	Secret         string `json:"secret"`
+	Hours          int    `json:"hours"`
+	MaxEnrollments int    `json:"max"`
+}
+
 // IntervalsRequest to receive changes to intervals
 type IntervalsRequest struct {
 	CSRFToken      string `json:"csrftoken"`
 	ConfigInterval int    `json:"config"`
 	LogInterval    int    `json:"log"`
 	QueryInterval  int    `json:"query"`
+	Comment        string `json:"comment"`
+}
+
+// RevisionsRequest to receive actions on revisions of an environment
+type RevisionsRequest struct {
+	CSRFToken string `json:"csrftoken"`
+	Action    string `json:"action"`
+	Number    int    `json:"number"`
+}
+
+// RolloutRequest to receive actions on configuration rollouts of an environment
+type RolloutRequest struct {
+	CSRFToken        string `json:"csrftoken"`
+	Action           string `json:"action"`
+	ConfigurationB64 string `json:"configuration"`
+	Percentage       int    `json:"percentage"`
+	Tag              string `json:"tag"`
+	Comment          string `json:"comment"`
 }
 
 // ExpirationRequest to receive expiration changes to enroll/remove nodes
@@ -116,3 +179,16 @@ type UsersRequest struct {
 type AdminResponse struct {
 	Message string `json:"message"`
 }
+
+// TargetsPreviewResponse to send the nodes that a query or carve would target
+type TargetsPreviewResponse struct {
+	Message  string   `json:"message"`
+	Expected int      `json:"expected"`
+	Nodes    []string `json:"nodes"`
+}
+
+// QueryCheckResponse to send the result of checking the SQL of a query
+type QueryCheckResponse struct {
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings"`
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/jmpsec/osctrl/pkg/carves"
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/jmpsec/osctrl/pkg/queries"
@@ -39,6 +40,49 @@ type ConfTemplateData struct {
 	Environment    environments.TLSEnvironment
 	Environments   []environments.TLSEnvironment
 	Platforms      []string
+	Packs          []string
+	Revisions      []environments.Revision
+	Rollout        config.ConfigRollout
+	TLSDebug       bool
+	AdminDebug     bool
+	AdminDebugHTTP bool
+}
+
+// RolloutNode to show one node of the cohort of a rollout
+type RolloutNode struct {
+	UUID         string
+	Hostname     string
+	Platform     string
+	LastSeen     string
+	ConfigStatus string
+	Errors       int
+}
+
+// RolloutHealth to compare the cohort of a rollout with the rest of the environment
+type RolloutHealth struct {
+	Nodes         []RolloutNode
+	Cohort        int
+	Updated       int
+	Errors        int
+	ErrorNodes    int
+	Control       int
+	ControlErrors int
+	ErrorsKnown   bool
+}
+
+// RolloutTemplateData for passing data to the rollout template
+type RolloutTemplateData struct {
+	Title          string
+	Username       string
+	CSRFToken      string
+	Environment    environments.TLSEnvironment
+	Rollout        config.ConfigRollout
+	Current        int
+	Changes        []environments.DiffLine
+	Health         RolloutHealth
+	History        []config.ConfigRollout
+	Environments   []environments.TLSEnvironment
+	Platforms      []string
 	TLSDebug       bool
 	AdminDebug     bool
 	AdminDebugHTTP bool
@@ -58,7 +102,12 @@ type EnrollTemplateData struct {
 	QuickRemoveShell      string
 	QuickAddPowershell    string
 	QuickRemovePowershell string
+	PackageDeb            string
+	PackageRPM            string
+	PackagePkg            string
 	Secret                string
+	Secrets               []environments.EnrollSecret
+	SecretOverlap         int
 	Flags                 string
 	Certificate           string
 	Environments          []environments.TLSEnvironment
@@ -136,6 +185,33 @@ type QueryLogsTemplateData struct {
 	AdminDebugHTTP bool
 }
 
+// ResultsTemplateData for passing data to the results template
+type ResultsTemplateData struct {
+	Title          string
+	Username       string
+	CSRFToken      string
+	Environment    environments.TLSEnvironment
+	Environments   []environments.TLSEnvironment
+	Platforms      []string
+	TLSDebug       bool
+	AdminDebug     bool
+	AdminDebugHTTP bool
+}
+
+// DriftTemplateData for passing data to the drift template
+type DriftTemplateData struct {
+	Title          string
+	Username       string
+	CSRFToken      string
+	Environment    environments.TLSEnvironment
+	Drift          ReturnedDrift
+	Environments   []environments.TLSEnvironment
+	Platforms      []string
+	TLSDebug       bool
+	AdminDebug     bool
+	AdminDebugHTTP bool
+}
+
 // EnvironmentsTemplateData for passing data to the environments template
 type EnvironmentsTemplateData struct {
 	Title          string
@@ -148,6 +224,31 @@ type EnvironmentsTemplateData struct {
 	AdminDebugHTTP bool
 }
 
+// PackView to display one shared pack
+type PackView struct {
+	Name         string
+	Description  string
+	Queries      int
+	Platform     string
+	Version      string
+	Shard        int
+	Value        string
+	Environments []string
+}
+
+// PacksTemplateData for passing data to the packs template
+type PacksTemplateData struct {
+	Title          string
+	Username       string
+	CSRFToken      string
+	Packs          []PackView
+	Environments   []environments.TLSEnvironment
+	Platforms      []string
+	TLSDebug       bool
+	AdminDebug     bool
+	AdminDebugHTTP bool
+}
+
 // SettingsTemplateData for passing data to the settings template
 type SettingsTemplateData struct {
 	Title           string
@@ -183,6 +284,7 @@ type NodeTemplateData struct {
 	CSRFToken      string
 	Logs           string
 	Node           nodes.OsqueryNode
+	Tags           []nodes.NodeTag
 	Environments   []environments.TLSEnvironment
 	Platforms      []string
 	TLSDebug       bool
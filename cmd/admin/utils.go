@@ -15,6 +15,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jmpsec/osctrl/pkg/config"
+	"github.com/jmpsec/osctrl/pkg/nodes"
+	"github.com/jmpsec/osctrl/pkg/queries"
 	"github.com/jmpsec/osctrl/pkg/settings"
 	"github.com/jmpsec/osctrl/pkg/types"
 )
@@ -294,3 +297,297 @@ func loadOsqueryTables(file string) ([]OsqueryTable, error) {
 	}
 	return tables, nil
 }
+
+// Helper to create the validator for queries with the loaded osquery tables
+func createSQLValidator(tables []OsqueryTable) *queries.SQLValidator {
+	var info []queries.TableInfo
+	for _, t := range tables {
+		info = append(info, queries.TableInfo{Name: t.Name, Platforms: t.Platforms})
+	}
+	return queries.CreateSQLValidator(info)
+}
+
+// Helper to get the platforms of the nodes targeted by a distributed query
+// Empty when the targets do not narrow down the platforms
+func targetPlatforms(q TargetsRequest) []string {
+	platforms := make(map[string]bool)
+	for _, p := range q.Platforms {
+		if p != "" {
+			platforms[queries.TablePlatform(p)] = true
+		}
+	}
+	// Matching all targets, the platforms are narrowed down to the selected ones
+	if q.Match == queries.QueryMatchAll && len(platforms) > 0 {
+		var result []string
+		for p := range platforms {
+			result = append(result, p)
+		}
+		return result
+	}
+	for _, e := range q.Environments {
+		if e == "" {
+			continue
+		}
+		envPlatforms, err := nodesmgr.GetEnvPlatforms(e)
+		if err != nil {
+			log.Printf("error getting platforms for %s %v", e, err)
+			return nil
+		}
+		for _, p := range envPlatforms {
+			platforms[queries.TablePlatform(p)] = true
+		}
+	}
+	for _, u := range q.UUIDs {
+		if node, err := nodesmgr.GetByUUID(u); err == nil {
+			platforms[queries.TablePlatform(node.Platform)] = true
+		}
+	}
+	// Nodes targeted by hostname, tags, network, versions or activity can be in any platform
+	if len(q.Hosts) > 0 || strings.TrimSpace(q.Tags) != "" || len(q.CIDRs) > 0 ||
+		q.OsqueryVersion != "" || q.PlatformVersion != "" || q.LastSeen != "" {
+		return nil
+	}
+	var result []string
+	for p := range platforms {
+		result = append(result, p)
+	}
+	return result
+}
+
+// Helper to get the targets of a query or carve request
+// Unknown environments, platforms, UUIDs and hosts are skipped, invalid expressions and ranges are errors
+func requestTargets(t TargetsRequest) ([]queries.DistributedQueryTarget, error) {
+	var targets []queries.DistributedQueryTarget
+	add := func(targetType, targetValue string) error {
+		targetValue = strings.TrimSpace(targetValue)
+		if targetValue == "" {
+			return nil
+		}
+		if err := queries.ValidateTarget(targetType, targetValue); err != nil {
+			return err
+		}
+		if targetType == queries.QueryTargetTag {
+			expr, _ := nodes.ParseTagExpression(targetValue)
+			targetValue = expr.String()
+		}
+		targets = append(targets, queries.DistributedQueryTarget{Type: targetType, Value: targetValue})
+		return nil
+	}
+	if t.Match != "" && t.Match != queries.QueryMatchAny && t.Match != queries.QueryMatchAll {
+		return nil, fmt.Errorf("unknown match %s", t.Match)
+	}
+	for _, e := range t.Environments {
+		if (e != "") && envs.Exists(e) {
+			_ = add(queries.QueryTargetEnvironment, e)
+		}
+	}
+	for _, p := range t.Platforms {
+		if (p != "") && checkValidPlatform(p) {
+			_ = add(queries.QueryTargetPlatform, p)
+		}
+	}
+	for _, u := range t.UUIDs {
+		if (u != "") && nodesmgr.CheckByUUID(u) {
+			_ = add(queries.QueryTargetUUID, u)
+		}
+	}
+	for _, h := range t.Hosts {
+		if (h != "") && nodesmgr.CheckByHost(h) {
+			_ = add(queries.QueryTargetLocalname, h)
+		}
+	}
+	for _, c := range t.CIDRs {
+		if err := add(queries.QueryTargetCIDR, c); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(queries.QueryTargetTag, t.Tags); err != nil {
+		return nil, err
+	}
+	if err := add(queries.QueryTargetOsqueryVersion, t.OsqueryVersion); err != nil {
+		return nil, err
+	}
+	if err := add(queries.QueryTargetPlatformVersion, t.PlatformVersion); err != nil {
+		return nil, err
+	}
+	if err := add(queries.QueryTargetLastSeen, t.LastSeen); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no valid targets")
+	}
+	return targets, nil
+}
+
+// Helper to get the active nodes that match the targets of a query or carve
+func targetNodes(targets []queries.DistributedQueryTarget, match string) ([]nodes.OsqueryNode, error) {
+	var result []nodes.OsqueryNode
+	active, err := nodesmgr.Gets("active", settingsmgr.InactiveHours())
+	if err != nil {
+		return result, err
+	}
+	tags, err := nodesmgr.AllTags()
+	if err != nil {
+		return result, err
+	}
+	for _, n := range active {
+		if queries.IsQueryTarget(n, tags[n.UUID], targets, match) {
+			result = append(result, n)
+		}
+	}
+	return result, nil
+}
+
+// Helper to keep the nodes matching last seen targets when a query or carve is launched
+// Nodes are updated when they poll for queries, so the targets can not be checked again later
+func createSeenTargets(name string, targets []queries.DistributedQueryTarget, expected []nodes.OsqueryNode) error {
+	for _, t := range targets {
+		if t.Type == queries.QueryTargetLastSeen {
+			var uuids []string
+			for _, n := range expected {
+				uuids = append(uuids, n.UUID)
+			}
+			return queriesmgr.CreateSeenTargets(name, uuids)
+		}
+	}
+	return nil
+}
+
+// Helper to check the SQL of a scheduled query, accepting the tables from osquery extensions in settings
+func checkScheduled(sql, platform string, extra []string) ([]string, error) {
+	return sqlValidator.CheckScheduled(sql, platform, append(settingsmgr.ExtraTables(settings.ServiceAdmin), extra...))
+}
+
+// Helper to check the SQL of the scheduled queries in a configuration
+func checkConfiguration(conf config.OsqueryConf) ([]string, error) {
+	return conf.CheckQueries(checkScheduled)
+}
+
+// Helper to add warnings to a response message
+func withWarnings(message string, warnings []string) string {
+	if len(warnings) == 0 {
+		return message
+	}
+	return message + ", with warnings: " + strings.Join(warnings, "; ")
+}
+
+// Helper to validate and save the osquery configuration of an environment, as a new revision
+// The stored sections are the source of truth, the assembled JSON is kept in the environment
+// Warnings from checking the SQL of scheduled queries are returned
+func saveConfiguration(environment string, raw []byte, author, comment string) ([]string, error) {
+	conf, err := config.ParseConfiguration(raw)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := checkConfiguration(conf)
+	if err != nil {
+		return warnings, err
+	}
+	if err := configsmgr.Save(environment, conf); err != nil {
+		return warnings, err
+	}
+	assembled, err := conf.JSON()
+	if err != nil {
+		return warnings, err
+	}
+	if err := envs.UpdateConfiguration(environment, string(assembled)); err != nil {
+		return warnings, err
+	}
+	_, err = envs.SaveRevision(environment, author, comment)
+	return warnings, err
+}
+
+// Helper to restore the configuration sections of an environment after a rollback
+func restoreConfiguration(environment string) error {
+	env, err := envs.Get(environment)
+	if err != nil {
+		return err
+	}
+	if err := configsmgr.Delete(environment); err != nil {
+		return err
+	}
+	if err := configsmgr.Import(environment, []byte(env.Configuration)); err != nil {
+		log.Printf("Configuration for %s can not be imported, it will be served as is - %v", environment, err)
+	}
+	return nil
+}
+
+// Helper to import the configuration of environments that were created before sections and revisions were stored
+func importConfigurations() {
+	all, err := envs.All()
+	if err != nil {
+		log.Printf("error getting environments %v", err)
+		return
+	}
+	for _, e := range all {
+		if err := envs.BaselineRevision(e.Name, serviceName); err != nil {
+			log.Printf("error saving baseline revision for %s - %v", e.Name, err)
+		}
+		if configsmgr.Exists(e.Name) || e.Configuration == "" {
+			continue
+		}
+		if err := configsmgr.Import(e.Name, []byte(e.Configuration)); err != nil {
+			log.Printf("Configuration for %s can not be imported, it will be served as is - %v", e.Name, err)
+		}
+	}
+}
+
+// Helper to check if osctrl-tls sends logs to the database, as one of its logging destinations
+func tlsLoggingDB() bool {
+	value, err := settingsmgr.RetrieveJSON(settings.ServiceTLS, settings.JSONLogging)
+	if err != nil {
+		return false
+	}
+	for _, l := range strings.Split(value.String, ",") {
+		if strings.TrimSpace(l) == settings.LoggingDB {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper to compare the health of the cohort of a rollout with the rest of the environment
+// Cohort nodes are updated once they request configuration after the rollout started
+func rolloutHealth(rollout config.ConfigRollout) (RolloutHealth, error) {
+	health := RolloutHealth{Nodes: []RolloutNode{}}
+	nodesList, err := nodesmgr.GetByEnv(rollout.Environment, "all", settingsmgr.InactiveHours())
+	if err != nil {
+		return health, err
+	}
+	allTags, err := nodesmgr.AllTags()
+	if err != nil {
+		return health, err
+	}
+	// Status errors are only known when osctrl-tls sends status logs to the database
+	errors := make(map[string]int)
+	if tlsLoggingDB() {
+		health.ErrorsKnown = true
+		if errors, err = postgresStatusErrors(rollout.Environment, rollout.CreatedAt); err != nil {
+			return health, err
+		}
+	}
+	for _, n := range nodesList {
+		if !rollout.InCohort(config.OverlayNodeData{UUID: n.UUID, Platform: n.Platform, Tags: allTags[n.UUID]}) {
+			health.Control++
+			health.ControlErrors += errors[n.UUID]
+			continue
+		}
+		health.Cohort++
+		if n.LastConfig.After(rollout.CreatedAt) {
+			health.Updated++
+		}
+		if errors[n.UUID] > 0 {
+			health.ErrorNodes++
+			health.Errors += errors[n.UUID]
+		}
+		health.Nodes = append(health.Nodes, RolloutNode{
+			UUID:         n.UUID,
+			Hostname:     n.Hostname,
+			Platform:     n.Platform,
+			LastSeen:     pastTimeAgo(n.UpdatedAt),
+			ConfigStatus: n.ConfigStatus(),
+			Errors:       errors[n.UUID],
+		})
+	}
+	return health, nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/jmpsec/osctrl/pkg/environments"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the environment name and make sure its configuration is stored by sections
+func configEnvironment(c *cli.Context) (string, error) {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	env, err := envs.Get(envName)
+	if err != nil {
+		return envName, err
+	}
+	if err := envs.BaselineRevision(envName, cliAuthor()); err != nil {
+		return envName, err
+	}
+	if !configsmgr.Exists(envName) && env.Configuration != "" {
+		if err := configsmgr.Import(envName, []byte(env.Configuration)); err != nil {
+			return envName, fmt.Errorf("error importing existing configuration - %v", err)
+		}
+	}
+	return envName, nil
+}
+
+// Helper to keep the assembled configuration in the environment, as a new revision
+func syncConfig(envName, comment string) error {
+	assembled, err := configsmgr.Generate(envName)
+	if err != nil {
+		return err
+	}
+	if err := envs.UpdateConfiguration(envName, string(assembled)); err != nil {
+		return err
+	}
+	_, err = envs.SaveRevision(envName, cliAuthor(), comment)
+	return err
+}
+
+// Helper to identify the author of changes made with the CLI
+func cliAuthor() string {
+	if u, err := user.Current(); err == nil {
+		return appName + ":" + u.Username
+	}
+	return appName
+}
+
+// Helper to read a JSON file
+func readJSONFile(file string) (json.RawMessage, error) {
+	if file == "" {
+		fmt.Println("File is required")
+		os.Exit(1)
+	}
+	value := json.RawMessage(environments.ReadExternalFile(file))
+	if !json.Valid(value) {
+		return value, fmt.Errorf("invalid JSON in %s", file)
+	}
+	return value, nil
+}
+
+func showConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	conf, err := configsmgr.Get(envName)
+	if err != nil {
+		return err
+	}
+	section := c.String("section")
+	pack := c.String("pack")
+	var output []byte
+	switch {
+	case pack != "":
+		p, ok := conf.Packs[pack]
+		if !ok {
+			fmt.Printf("Pack %s does not exist\n", pack)
+			os.Exit(1)
+		}
+		output, err = json.MarshalIndent(p, "", "  ")
+	case section != "":
+		sections, err := conf.Sections()
+		if err != nil {
+			return err
+		}
+		s, ok := sections[section]
+		if !ok {
+			fmt.Printf("Section %s does not exist\n", section)
+			os.Exit(1)
+		}
+		output, err = json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+	default:
+		output, err = conf.JSON()
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", output)
+	return nil
+}
+
+func importConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	value, err := readJSONFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	if err := configsmgr.Import(envName, value); err != nil {
+		return err
+	}
+	return syncConfig(envName, c.String("comment"))
+}
+
+func setSectionConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	section := c.String("section")
+	if section == "" {
+		fmt.Println("Section is required")
+		os.Exit(1)
+	}
+	value, err := readJSONFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	if err := configsmgr.SaveSection(envName, section, value); err != nil {
+		return err
+	}
+	return syncConfig(envName, c.String("comment"))
+}
+
+func deleteSectionConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	section := c.String("section")
+	if section == "" {
+		fmt.Println("Section is required")
+		os.Exit(1)
+	}
+	if err := configsmgr.DeleteSection(envName, section); err != nil {
+		return err
+	}
+	return syncConfig(envName, c.String("comment"))
+}
+
+func setPackConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	pack := c.String("pack")
+	if pack == "" {
+		fmt.Println("Pack is required")
+		os.Exit(1)
+	}
+	value, err := readJSONFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	if err := configsmgr.SavePack(envName, pack, value); err != nil {
+		return err
+	}
+	return syncConfig(envName, c.String("comment"))
+}
+
+func deletePackConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	pack := c.String("pack")
+	if pack == "" {
+		fmt.Println("Pack is required")
+		os.Exit(1)
+	}
+	if err := configsmgr.DeletePack(envName, pack); err != nil {
+		return err
+	}
+	return syncConfig(envName, c.String("comment"))
+}
+
+func historyConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	revisions, err := envs.Revisions(envName)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Revision",
+		"Date",
+		"Author",
+		"Comment",
+	})
+	if len(revisions) > 0 {
+		data := [][]string{}
+		for _, r := range revisions {
+			_r := []string{
+				strconv.Itoa(r.Number),
+				r.CreatedAt.String(),
+				r.Author,
+				r.Comment,
+			}
+			data = append(data, _r)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No revisions\n")
+	}
+	return nil
+}
+
+func diffConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	to := c.Int("to")
+	if to == 0 {
+		latest, err := envs.LatestRevision(envName)
+		if err != nil {
+			return err
+		}
+		to = latest.Number
+	}
+	from := c.Int("from")
+	if from == 0 {
+		from = to - 1
+	}
+	diff, err := envs.DiffRevisions(envName, from, to)
+	if err != nil {
+		return err
+	}
+	printDiff := func(name string, lines []environments.DiffLine) {
+		if !environments.Changed(lines) {
+			return
+		}
+		fmt.Printf("--- %s (revision %d)\n+++ %s (revision %d)\n", name, from, name, to)
+		for _, l := range lines {
+			fmt.Printf("%s %s\n", l.Type, l.Line)
+		}
+	}
+	printDiff("configuration", diff.Configuration)
+	printDiff("flags", diff.Flags)
+	printDiff("intervals", diff.Intervals)
+	return nil
+}
+
+func rollbackConfig(c *cli.Context) error {
+	envName, err := configEnvironment(c)
+	if err != nil {
+		return err
+	}
+	number := c.Int("revision")
+	if number == 0 {
+		fmt.Println("Revision is required")
+		os.Exit(1)
+	}
+	rev, err := envs.Rollback(envName, number, cliAuthor())
+	if err != nil {
+		return err
+	}
+	// Sections must match the restored configuration
+	if err := configsmgr.Delete(envName); err != nil {
+		return err
+	}
+	if err := configsmgr.Import(envName, []byte(rev.Configuration)); err != nil {
+		fmt.Printf("Restored configuration will be served as is - %v\n", err)
+	}
+	fmt.Printf("Rolled back to revision %d as revision %d\n", number, rev.Number)
+	return nil
+}
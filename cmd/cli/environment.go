@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"time"
 
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
@@ -33,6 +35,9 @@ func addEnvironment(c *cli.Context) error {
 	confFile := c.String("configuration")
 	if confFile != "" {
 		configuration = environments.ReadExternalFile(confFile)
+		if _, err := config.ParseConfiguration([]byte(configuration)); err != nil {
+			return err
+		}
 	}
 	// Get certificate
 	var certificate string
@@ -57,7 +62,17 @@ func addEnvironment(c *cli.Context) error {
 			return err
 		}
 		// Update flags in the newly created environment
-		if err := envs.UpdateFlags(envName, flags); err != nil {
+		if _, err := envs.UpdateFlags(envName, flags); err != nil {
+			return err
+		}
+		// Store configuration by sections
+		if configuration != "" {
+			if err := configsmgr.Import(envName, []byte(configuration)); err != nil {
+				return err
+			}
+		}
+		// First revision of the environment
+		if err := envs.BaselineRevision(envName, cliAuthor()); err != nil {
 			return err
 		}
 	} else {
@@ -74,7 +89,25 @@ func deleteEnvironment(c *cli.Context) error {
 		fmt.Println("Environment name is required")
 		os.Exit(1)
 	}
-	return envs.Delete(envName)
+	if err := envs.Delete(envName); err != nil {
+		return err
+	}
+	if err := configsmgr.Delete(envName); err != nil {
+		return err
+	}
+	if err := packsmgr.DetachAll(envName); err != nil {
+		return err
+	}
+	if err := overlaysmgr.DeleteAll(envName); err != nil {
+		return err
+	}
+	if err := rolloutsmgr.DeleteAll(envName); err != nil {
+		return err
+	}
+	if err := envs.DeleteSecrets(envName); err != nil {
+		return err
+	}
+	return envs.DeleteRevisions(envName)
 }
 
 func showEnvironment(c *cli.Context) error {
@@ -201,7 +234,12 @@ func flagsEnvironment(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	flags, err := environments.GenerateFlags(env, secret, cert)
+	var flags string
+	if platform := c.String("platform"); platform != "" {
+		flags, err = environments.PlatformFlags(env, platform, projectName)
+	} else {
+		flags, err = environments.GenerateFlags(env, secret, cert)
+	}
 	if err != nil {
 		return err
 	}
@@ -209,6 +247,60 @@ func flagsEnvironment(c *cli.Context) error {
 	return nil
 }
 
+func updateFlagsEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	file := c.String("file")
+	if file == "" {
+		fmt.Println("File is required")
+		os.Exit(1)
+	}
+	warnings, err := envs.UpdateFlags(envName, environments.ReadExternalFile(file))
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
+	}
+	_, err = envs.SaveRevision(envName, cliAuthor(), c.String("comment"))
+	return err
+}
+
+func packageEnvironment(c *cli.Context) error {
+	// Get environment name
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	env, err := envs.Get(envName)
+	if err != nil {
+		return err
+	}
+	// Packages include the enroll secret, so they expire with the enroll link
+	if environments.IsItExpired(env.EnrollExpire) {
+		return fmt.Errorf("enroll link for %s is expired", envName)
+	}
+	format := c.String("type")
+	pkg, err := environments.BuildPackage(env, format, projectName)
+	if err != nil {
+		return err
+	}
+	output := c.String("output")
+	if output == "" {
+		output = environments.PackageFilename(projectName, env.Name, format)
+	}
+	if err := ioutil.WriteFile(output, pkg, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Package written to %s\n", output)
+	return nil
+}
+
 func secretEnvironment(c *cli.Context) error {
 	// Get environment name
 	envName := c.String("name")
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/jmpsec/osctrl/pkg/queries"
@@ -44,6 +45,10 @@ var (
 	queriesmgr   *queries.Queries
 	adminUsers   *users.UserManager
 	envs         *environments.Environment
+	configsmgr   *config.Configs
+	packsmgr     *config.Packs
+	overlaysmgr  *config.Overlays
+	rolloutsmgr  *config.Rollouts
 	err          error
 )
 
@@ -250,9 +255,54 @@ func init() {
 							Name:  "secret, s",
 							Usage: "Secret file path to be used",
 						},
+						cli.StringFlag{
+							Name:  "platform, p",
+							Usage: "Platform (linux, darwin, windows, freebsd) to use its secret and certificate paths",
+						},
 					},
 					Action: cliWrapper(flagsEnvironment),
 				},
+				{
+					Name:    "update-flags",
+					Aliases: []string{"u"},
+					Usage:   "Validate and update the flags of an environment from a flagfile",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be updated",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Flagfile with one --flag=value per line",
+						},
+						cli.StringFlag{
+							Name:  "comment, m",
+							Usage: "Comment to keep with the revision",
+						},
+					},
+					Action: cliWrapper(updateFlagsEnvironment),
+				},
+				{
+					Name:    "package",
+					Aliases: []string{"p"},
+					Usage:   "Build the enrollment package of an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Environment to be used",
+						},
+						cli.StringFlag{
+							Name:  "type, t",
+							Value: environments.PackageDeb,
+							Usage: "Package type (deb, rpm or pkg for the macOS payload layout)",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "File to write the package, by default the package filename in the current directory",
+						},
+					},
+					Action: cliWrapper(packageEnvironment),
+				},
 				{
 					Name:    "secret",
 					Aliases: []string{"x"},
@@ -265,6 +315,528 @@ func init() {
 					},
 					Action: cliWrapper(secretEnvironment),
 				},
+				{
+					Name:    "secrets",
+					Aliases: []string{"k"},
+					Usage:   "Commands for the enroll secrets of a TLS environment",
+					Subcommands: []cli.Command{
+						{
+							Name:    "list",
+							Aliases: []string{"l"},
+							Usage:   "List all the enroll secrets",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+							},
+							Action: cliWrapper(listSecrets),
+						},
+						{
+							Name:    "show",
+							Aliases: []string{"w"},
+							Usage:   "Output the value of one enroll secret",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "secret, s",
+									Usage: "Name of the secret",
+								},
+							},
+							Action: cliWrapper(showSecret),
+						},
+						{
+							Name:    "add",
+							Aliases: []string{"a"},
+							Usage:   "Add a new enroll secret",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "secret, s",
+									Usage: "Name of the secret",
+								},
+								cli.StringFlag{
+									Name:  "value, v",
+									Usage: "Value of the secret, generated if empty",
+								},
+								cli.IntFlag{
+									Name:  "hours, e",
+									Usage: "Hours until the secret expires, 0 never expires",
+								},
+								cli.IntFlag{
+									Name:  "max, m",
+									Usage: "Max number of enrollments with the secret, 0 for no limit",
+								},
+								cli.BoolFlag{
+									Name:  "primary, p",
+									Usage: "Make it the primary secret of the environment",
+								},
+							},
+							Action: cliWrapper(addSecret),
+						},
+						{
+							Name:    "rotate",
+							Aliases: []string{"r"},
+							Usage:   "Generate a new primary secret, keeping the current ones valid for some time",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.IntFlag{
+									Name:  "overlap, o",
+									Value: environments.DefaultSecretOverlap,
+									Usage: "Hours that the current secrets are still valid",
+								},
+							},
+							Action: cliWrapper(rotateSecret),
+						},
+						{
+							Name:    "primary",
+							Aliases: []string{"p"},
+							Usage:   "Make one enroll secret the primary secret of the environment",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "secret, s",
+									Usage: "Name of the secret",
+								},
+							},
+							Action: cliWrapper(primarySecret),
+						},
+						{
+							Name:    "expire",
+							Aliases: []string{"x"},
+							Usage:   "Expire one enroll secret",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "secret, s",
+									Usage: "Name of the secret",
+								},
+								cli.IntFlag{
+									Name:  "hours, e",
+									Usage: "Hours until the secret expires, 0 to expire it now",
+								},
+							},
+							Action: cliWrapper(expireSecret),
+						},
+						{
+							Name:    "delete",
+							Aliases: []string{"d"},
+							Usage:   "Delete one enroll secret",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "secret, s",
+									Usage: "Name of the secret",
+								},
+							},
+							Action: cliWrapper(deleteSecret),
+						},
+					},
+				},
+				{
+					Name:    "config",
+					Aliases: []string{"c"},
+					Usage:   "Commands for the osquery configuration of a TLS environment",
+					Subcommands: []cli.Command{
+						{
+							Name:    "show",
+							Aliases: []string{"s"},
+							Usage:   "Show the configuration, or one section or pack of it",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "section, s",
+									Usage: "Section to be displayed",
+								},
+								cli.StringFlag{
+									Name:  "pack, p",
+									Usage: "Pack to be displayed",
+								},
+							},
+							Action: cliWrapper(showConfig),
+						},
+						{
+							Name:    "import",
+							Aliases: []string{"i"},
+							Usage:   "Replace the full configuration from a file",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "file, f",
+									Usage: "Configuration file to be read",
+								},
+								cli.StringFlag{
+									Name:  "comment, m",
+									Usage: "Comment to keep with the revision",
+								},
+							},
+							Action: cliWrapper(importConfig),
+						},
+						{
+							Name:    "set-section",
+							Aliases: []string{"ss"},
+							Usage:   "Replace one section of the configuration from a file",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "section, s",
+									Usage: "Section to be replaced",
+								},
+								cli.StringFlag{
+									Name:  "file, f",
+									Usage: "Section file to be read",
+								},
+								cli.StringFlag{
+									Name:  "comment, m",
+									Usage: "Comment to keep with the revision",
+								},
+							},
+							Action: cliWrapper(setSectionConfig),
+						},
+						{
+							Name:    "delete-section",
+							Aliases: []string{"ds"},
+							Usage:   "Remove one section from the configuration",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "section, s",
+									Usage: "Section to be removed",
+								},
+								cli.StringFlag{
+									Name:  "comment, m",
+									Usage: "Comment to keep with the revision",
+								},
+							},
+							Action: cliWrapper(deleteSectionConfig),
+						},
+						{
+							Name:    "set-pack",
+							Aliases: []string{"sp"},
+							Usage:   "Add or replace one pack in the configuration from a file",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "pack, p",
+									Usage: "Pack to be added or replaced",
+								},
+								cli.StringFlag{
+									Name:  "file, f",
+									Usage: "Pack file to be read",
+								},
+								cli.StringFlag{
+									Name:  "comment, m",
+									Usage: "Comment to keep with the revision",
+								},
+							},
+							Action: cliWrapper(setPackConfig),
+						},
+						{
+							Name:    "delete-pack",
+							Aliases: []string{"dp"},
+							Usage:   "Remove one pack from the configuration",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "pack, p",
+									Usage: "Pack to be removed",
+								},
+								cli.StringFlag{
+									Name:  "comment, m",
+									Usage: "Comment to keep with the revision",
+								},
+							},
+							Action: cliWrapper(deletePackConfig),
+						},
+						{
+							Name:    "history",
+							Aliases: []string{"y"},
+							Usage:   "List the revisions of the configuration, flags and intervals",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+							},
+							Action: cliWrapper(historyConfig),
+						},
+						{
+							Name:    "diff",
+							Aliases: []string{"f"},
+							Usage:   "Show the changes between two revisions, by default the last change",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.IntFlag{
+									Name:  "from",
+									Usage: "Revision to compare from",
+								},
+								cli.IntFlag{
+									Name:  "to",
+									Usage: "Revision to compare to",
+								},
+							},
+							Action: cliWrapper(diffConfig),
+						},
+						{
+							Name:    "rollback",
+							Aliases: []string{"r"},
+							Usage:   "Restore the configuration, flags and intervals of a revision",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.IntFlag{
+									Name:  "revision, r",
+									Usage: "Revision to be restored",
+								},
+							},
+							Action: cliWrapper(rollbackConfig),
+						},
+					},
+				},
+				{
+					Name:    "overlay",
+					Aliases: []string{"o"},
+					Usage:   "Commands for the configuration overlays of a TLS environment",
+					Subcommands: []cli.Command{
+						{
+							Name:    "list",
+							Aliases: []string{"l"},
+							Usage:   "List all the overlays",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+							},
+							Action: cliWrapper(listOverlays),
+						},
+						{
+							Name:    "show",
+							Aliases: []string{"s"},
+							Usage:   "Show one overlay",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "type, t",
+									Usage: "Overlay type: platform, tag or node",
+								},
+								cli.StringFlag{
+									Name:  "target, g",
+									Usage: "Overlay target: platform or family, tag expression or node UUID",
+								},
+							},
+							Action: cliWrapper(showOverlay),
+						},
+						{
+							Name:    "set",
+							Aliases: []string{"a"},
+							Usage:   "Add or replace one overlay from a file",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "type, t",
+									Usage: "Overlay type: platform, tag or node",
+								},
+								cli.StringFlag{
+									Name:  "target, g",
+									Usage: "Overlay target: platform or family, tag expression or node UUID",
+								},
+								cli.StringFlag{
+									Name:  "file, f",
+									Usage: "Overlay file to be read",
+								},
+							},
+							Action: cliWrapper(setOverlay),
+						},
+						{
+							Name:    "delete",
+							Aliases: []string{"d"},
+							Usage:   "Delete one overlay",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Environment to be used",
+								},
+								cli.StringFlag{
+									Name:  "type, t",
+									Usage: "Overlay type: platform, tag or node",
+								},
+								cli.StringFlag{
+									Name:  "target, g",
+									Usage: "Overlay target: platform or family, tag expression or node UUID",
+								},
+							},
+							Action: cliWrapper(deleteOverlay),
+						},
+						{
+							Name:    "preview",
+							Aliases: []string{"p"},
+							Usage:   "Show the configuration served to a node",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "uuid, u",
+									Usage: "Node UUID to be used",
+								},
+							},
+							Action: cliWrapper(previewOverlay),
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "pack",
+			Usage: "Commands for query packs shared across environments",
+			Subcommands: []cli.Command{
+				{
+					Name:    "add",
+					Aliases: []string{"a"},
+					Usage:   "Add a new pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+						cli.StringFlag{
+							Name:  "description, d",
+							Usage: "Pack description",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Pack file to be read",
+						},
+					},
+					Action: cliWrapper(addPack),
+				},
+				{
+					Name:    "update",
+					Aliases: []string{"u"},
+					Usage:   "Update an existing pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+						cli.StringFlag{
+							Name:  "description, d",
+							Usage: "Pack description",
+						},
+						cli.StringFlag{
+							Name:  "file, f",
+							Usage: "Pack file to be read",
+						},
+					},
+					Action: cliWrapper(updatePack),
+				},
+				{
+					Name:    "delete",
+					Aliases: []string{"d"},
+					Usage:   "Delete an existing pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+					},
+					Action: cliWrapper(deletePack),
+				},
+				{
+					Name:    "show",
+					Aliases: []string{"s"},
+					Usage:   "Show a pack",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+					},
+					Action: cliWrapper(showPack),
+				},
+				{
+					Name:    "list",
+					Aliases: []string{"l"},
+					Usage:   "List all existing packs",
+					Action:  cliWrapper(listPacks),
+				},
+				{
+					Name:    "attach",
+					Aliases: []string{"t"},
+					Usage:   "Attach a pack to an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment to be used",
+						},
+					},
+					Action: cliWrapper(attachPack),
+				},
+				{
+					Name:    "detach",
+					Aliases: []string{"x"},
+					Usage:   "Detach a pack from an environment",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Pack to be used",
+						},
+						cli.StringFlag{
+							Name:  "environment, e",
+							Usage: "Environment to be used",
+						},
+					},
+					Action: cliWrapper(detachPack),
+				},
 			},
 		},
 		{
@@ -416,9 +988,108 @@ func init() {
 							Hidden: false,
 							Usage:  "Show inactive nodes",
 						},
+						cli.StringFlag{
+							Name:  "tags, t",
+							Usage: "Show only nodes with tags matching the expression, as team=payments AND !role=db",
+						},
 					},
 					Action: cliWrapper(listNodes),
 				},
+				{
+					Name:    "tag",
+					Aliases: []string{"t"},
+					Usage:   "Add or replace a tag of an existing node",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "uuid, u",
+							Usage: "Node UUID to be tagged",
+						},
+						cli.StringFlag{
+							Name:  "tag, t",
+							Usage: "Tag to be added, as key=value",
+						},
+					},
+					Action: cliWrapper(tagNode),
+				},
+				{
+					Name:    "untag",
+					Aliases: []string{"x"},
+					Usage:   "Remove a tag from an existing node",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "uuid, u",
+							Usage: "Node UUID to be untagged",
+						},
+						cli.StringFlag{
+							Name:  "key, k",
+							Usage: "Tag key to be removed",
+						},
+					},
+					Action: cliWrapper(untagNode),
+				},
+				{
+					Name:    "rules",
+					Aliases: []string{"r"},
+					Usage:   "Commands for rules to tag nodes automatically",
+					Subcommands: []cli.Command{
+						{
+							Name:    "list",
+							Aliases: []string{"l"},
+							Usage:   "List all tag rules",
+							Action:  cliWrapper(listTagRules),
+						},
+						{
+							Name:    "add",
+							Aliases: []string{"a"},
+							Usage:   "Add a new tag rule",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Tag rule name to be added",
+								},
+								cli.StringFlag{
+									Name:  "type, t",
+									Usage: "Tag rule type: hostname, cidr or platform_version",
+								},
+								cli.StringFlag{
+									Name:  "pattern, p",
+									Usage: "Hostname glob, CIDR or platform version like >=10.15",
+								},
+								cli.StringFlag{
+									Name:  "platform, P",
+									Usage: "Only match nodes of this platform",
+								},
+								cli.StringFlag{
+									Name:  "environment, e",
+									Usage: "Only match nodes of this environment",
+								},
+								cli.StringFlag{
+									Name:  "tag, T",
+									Usage: "Tag to be set, as key=value",
+								},
+							},
+							Action: cliWrapper(addTagRule),
+						},
+						{
+							Name:    "delete",
+							Aliases: []string{"d"},
+							Usage:   "Delete a tag rule and the tags it set",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name, n",
+									Usage: "Tag rule name to be deleted",
+								},
+							},
+							Action: cliWrapper(deleteTagRule),
+						},
+						{
+							Name:    "apply",
+							Aliases: []string{"y"},
+							Usage:   "Apply all tag rules to the existing nodes",
+							Action:  cliWrapper(applyTagRules),
+						},
+					},
+				},
 			},
 		},
 		{
@@ -477,6 +1148,137 @@ func init() {
 					},
 					Action: cliWrapper(listQueries),
 				},
+				{
+					Name:    "results",
+					Aliases: []string{"r"},
+					Usage:   "Export the results of an on-demand query",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Query name to be exported",
+						},
+						cli.StringFlag{
+							Name:  "format, f",
+							Value: queries.ExportCSV,
+							Usage: "Export format: csv, jsonl or parquet",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "File to write the results, instead of stdout",
+						},
+						cli.UintFlag{
+							Name:  "generation, g",
+							Usage: "Generation of a recurring query to be exported, all of them by default",
+						},
+					},
+					Action: cliWrapper(resultsQuery),
+				},
+				{
+					Name:    "changes",
+					Aliases: []string{"g"},
+					Usage:   "Show the results of a recurring query that changed from the previous generation",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name, n",
+							Usage: "Recurring query name to be compared",
+						},
+						cli.UintFlag{
+							Name:  "generation, g",
+							Usage: "Generation to be compared, the last one by default",
+						},
+					},
+					Action: cliWrapper(changesQuery),
+				},
+			},
+		},
+		{
+			Name:  "spool",
+			Usage: "Commands for the spool of undelivered logs",
+			Subcommands: []cli.Command{
+				{
+					Name:    "list",
+					Aliases: []string{"l"},
+					Usage:   "List spooled logs by logging destination",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "dir",
+							Usage: "Spool directory, instead of the one in settings",
+						},
+					},
+					Action: cliWrapper(listSpool),
+				},
+				{
+					Name:    "show",
+					Aliases: []string{"s"},
+					Usage:   "Show spooled logs for a logging destination",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "destination, d",
+							Usage: "Logging destination of the spool",
+						},
+						cli.StringFlag{
+							Name:  "dir",
+							Usage: "Spool directory, instead of the one in settings",
+						},
+						cli.BoolFlag{
+							Name:  "quarantined, q",
+							Usage: "Quarantined logs, that failed too many times",
+						},
+					},
+					Action: cliWrapper(showSpool),
+				},
+				{
+					Name:    "replay",
+					Aliases: []string{"r"},
+					Usage:   "Replay spooled logs for a logging destination",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "destination, d",
+							Usage: "Logging destination of the spool",
+						},
+						cli.StringFlag{
+							Name:  "dir",
+							Usage: "Spool directory, instead of the one in settings",
+						},
+					},
+					Action: cliWrapper(replaySpool),
+				},
+				{
+					Name:    "purge",
+					Aliases: []string{"p"},
+					Usage:   "Purge spooled logs for a logging destination",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "destination, d",
+							Usage: "Logging destination of the spool",
+						},
+						cli.StringFlag{
+							Name:  "dir",
+							Usage: "Spool directory, instead of the one in settings",
+						},
+						cli.BoolFlag{
+							Name:  "quarantined, q",
+							Usage: "Quarantined logs, that failed too many times",
+						},
+					},
+					Action: cliWrapper(purgeSpool),
+				},
+				{
+					Name:    "requeue",
+					Aliases: []string{"q"},
+					Usage:   "Requeue quarantined logs for a logging destination, to be replayed again",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "destination, d",
+							Usage: "Logging destination of the spool",
+						},
+						cli.StringFlag{
+							Name:  "dir",
+							Usage: "Spool directory, instead of the one in settings",
+						},
+					},
+					Action: cliWrapper(requeueSpool),
+				},
 			},
 		},
 		{
@@ -502,6 +1304,14 @@ func checkDB(c *cli.Context) error {
 	nodesmgr = nodes.CreateNodes(db)
 	// Initialize queries
 	queriesmgr = queries.CreateQueries(db)
+	// Initialize configurations
+	configsmgr = config.CreateConfigs(db)
+	// Initialize shared packs
+	packsmgr = config.CreatePacks(db)
+	// Initialize configuration overlays
+	overlaysmgr = config.CreateOverlays(db)
+	// Initialize configuration rollouts
+	rolloutsmgr = config.CreateRollouts(db)
 	// Should be good
 	return nil
 }
@@ -540,6 +1350,14 @@ func cliWrapper(action func(*cli.Context) error) func(*cli.Context) error {
 		nodesmgr = nodes.CreateNodes(db)
 		// Initialize queries
 		queriesmgr = queries.CreateQueries(db)
+		// Initialize configurations
+		configsmgr = config.CreateConfigs(db)
+		// Initialize shared packs
+		packsmgr = config.CreatePacks(db)
+		// Initialize configuration overlays
+		overlaysmgr = config.CreateOverlays(db)
+		// Initialize configuration rollouts
+		rolloutsmgr = config.CreateRollouts(db)
 		// Execute action
 		return action(c)
 	}
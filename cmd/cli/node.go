@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 
+	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
@@ -17,7 +20,19 @@ func listNodes(c *cli.Context) error {
 	if c.Bool("inactive") {
 		target = "inactive"
 	}
-	nodes, err := nodesmgr.Gets(target, settingsmgr.InactiveHours())
+	var expr nodes.TagExpression
+	if c.String("tags") != "" {
+		var err error
+		if expr, err = nodes.ParseTagExpression(c.String("tags")); err != nil {
+			fmt.Printf("invalid tag expression - %v\n", err)
+			os.Exit(1)
+		}
+	}
+	all, err := nodesmgr.Gets(target, settingsmgr.InactiveHours())
+	if err != nil {
+		return err
+	}
+	tags, err := nodesmgr.AllTags()
 	if err != nil {
 		return err
 	}
@@ -30,22 +45,27 @@ func listNodes(c *cli.Context) error {
 		"Last Status",
 		"IPAddress",
 		"Version",
+		"Tags",
 	})
-	if len(nodes) > 0 {
-		data := [][]string{}
-		fmt.Printf("Existing %s nodes (%d):\n", target, len(nodes))
-		for _, n := range nodes {
-			_n := []string{
-				n.Hostname,
-				n.UUID,
-				n.Platform,
-				n.Environment,
-				pastTimeAgo(n.LastStatus),
-				n.IPAddress,
-				n.OsqueryVersion,
-			}
-			data = append(data, _n)
+	data := [][]string{}
+	for _, n := range all {
+		if expr.Op != "" && !expr.Match(tags[n.UUID]) {
+			continue
 		}
+		_n := []string{
+			n.Hostname,
+			n.UUID,
+			n.Platform,
+			n.Environment,
+			pastTimeAgo(n.LastStatus),
+			n.IPAddress,
+			n.OsqueryVersion,
+			stringifyTags(tags[n.UUID]),
+		}
+		data = append(data, _n)
+	}
+	if len(data) > 0 {
+		fmt.Printf("Existing %s nodes (%d):\n", target, len(data))
 		table.AppendBulk(data)
 		table.Render()
 	} else {
@@ -54,6 +74,20 @@ func listNodes(c *cli.Context) error {
 	return nil
 }
 
+// Helper to format the tags of a node as key=value, sorted by key
+func stringifyTags(tags map[string]string) string {
+	var keys []string
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var res []string
+	for _, k := range keys {
+		res = append(res, k+"="+tags[k])
+	}
+	return strings.Join(res, ", ")
+}
+
 func deleteNode(c *cli.Context) error {
 	// Get values from flags
 	uuid := c.String("uuid")
@@ -63,3 +97,37 @@ func deleteNode(c *cli.Context) error {
 	}
 	return nodesmgr.ArchiveDeleteByUUID(uuid)
 }
+
+func tagNode(c *cli.Context) error {
+	// Get values from flags
+	uuid := c.String("uuid")
+	if uuid == "" {
+		fmt.Println("uuid is required")
+		os.Exit(1)
+	}
+	tag := strings.SplitN(c.String("tag"), "=", 2)
+	if len(tag) != 2 || tag[0] == "" {
+		fmt.Println("tag is required as key=value")
+		os.Exit(1)
+	}
+	if !nodesmgr.CheckByUUID(uuid) {
+		fmt.Printf("Node %s does not exist\n", uuid)
+		os.Exit(1)
+	}
+	return nodesmgr.SetTag(uuid, tag[0], tag[1])
+}
+
+func untagNode(c *cli.Context) error {
+	// Get values from flags
+	uuid := c.String("uuid")
+	if uuid == "" {
+		fmt.Println("uuid is required")
+		os.Exit(1)
+	}
+	key := c.String("key")
+	if key == "" {
+		fmt.Println("key is required")
+		os.Exit(1)
+	}
+	return nodesmgr.RemoveTag(uuid, key)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jmpsec/osctrl/pkg/config"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the environment, type and target of an overlay from flags
+func overlayFlags(c *cli.Context) (string, string, string) {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	otype := c.String("type")
+	if otype == "" {
+		fmt.Println("Overlay type is required")
+		os.Exit(1)
+	}
+	target := c.String("target")
+	if target == "" {
+		fmt.Println("Overlay target is required")
+		os.Exit(1)
+	}
+	return envName, otype, target
+}
+
+func listOverlays(c *cli.Context) error {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	overlays, err := overlaysmgr.All(envName)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Type",
+		"Target",
+		"Sections",
+		"Last Update",
+	})
+	if len(overlays) > 0 {
+		data := [][]string{}
+		for _, o := range overlays {
+			var sections map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(o.Value), &sections); err != nil {
+				return err
+			}
+			names := ""
+			for s := range sections {
+				names += s + " "
+			}
+			_o := []string{
+				o.Type,
+				o.Target,
+				names,
+				o.UpdatedAt.String(),
+			}
+			data = append(data, _o)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No overlays\n")
+	}
+	return nil
+}
+
+func showOverlay(c *cli.Context) error {
+	overlay, err := overlaysmgr.Get(overlayFlags(c))
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(json.RawMessage(overlay.Value), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", output)
+	return nil
+}
+
+func setOverlay(c *cli.Context) error {
+	envName, otype, target := overlayFlags(c)
+	if !envs.Exists(envName) {
+		fmt.Printf("Environment %s does not exist\n", envName)
+		os.Exit(1)
+	}
+	value, err := readJSONFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	return overlaysmgr.Set(envName, otype, target, value)
+}
+
+func deleteOverlay(c *cli.Context) error {
+	return overlaysmgr.Delete(overlayFlags(c))
+}
+
+func previewOverlay(c *cli.Context) error {
+	uuid := c.String("uuid")
+	if uuid == "" {
+		fmt.Println("uuid is required")
+		os.Exit(1)
+	}
+	node, err := nodesmgr.GetByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	env, err := envs.Get(node.Environment)
+	if err != nil {
+		return err
+	}
+	conf, err := configsmgr.Load(env.Name, env.Configuration)
+	if err != nil {
+		return err
+	}
+	packs, err := packsmgr.Attached(env.Name)
+	if err != nil {
+		return err
+	}
+	conf.MergePacks(packs)
+	tags, err := nodesmgr.GetTags(node.UUID)
+	if err != nil {
+		return err
+	}
+	overlays, err := overlaysmgr.ForNode(env.Name, config.OverlayNodeData{
+		UUID:     node.UUID,
+		Platform: node.Platform,
+		Tags:     tags,
+	})
+	if err != nil {
+		return err
+	}
+	for _, o := range overlays {
+		fmt.Printf("Applying %s overlay %s\n", o.Type, o.Target)
+	}
+	merged, err := conf.ApplyOverlays(overlays)
+	if err != nil {
+		return err
+	}
+	output, err := merged.JSON()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", output)
+	return nil
+}
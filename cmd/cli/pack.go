@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the pack name from flags
+func packName(c *cli.Context) string {
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Pack name is required")
+		os.Exit(1)
+	}
+	return name
+}
+
+// Helper to get the environment name from flags
+func packEnvironment(c *cli.Context) string {
+	envName := c.String("environment")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	if !envs.Exists(envName) {
+		fmt.Printf("Environment %s does not exist\n", envName)
+		os.Exit(1)
+	}
+	return envName
+}
+
+func addPack(c *cli.Context) error {
+	name := packName(c)
+	value, err := readJSONFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	return packsmgr.Create(name, c.String("description"), value)
+}
+
+func updatePack(c *cli.Context) error {
+	name := packName(c)
+	pack, err := packsmgr.Get(name)
+	if err != nil {
+		return err
+	}
+	value := json.RawMessage(pack.Value)
+	if c.String("file") != "" {
+		value, err = readJSONFile(c.String("file"))
+		if err != nil {
+			return err
+		}
+	}
+	description := pack.Description
+	if c.IsSet("description") {
+		description = c.String("description")
+	}
+	return packsmgr.Update(name, description, value)
+}
+
+func deletePack(c *cli.Context) error {
+	return packsmgr.Delete(packName(c))
+}
+
+func showPack(c *cli.Context) error {
+	pack, err := packsmgr.Get(packName(c))
+	if err != nil {
+		return err
+	}
+	attached, err := packsmgr.Environments(pack.Name)
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(json.RawMessage(pack.Value), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf(" Name: %s\n", pack.Name)
+	fmt.Printf(" Description: %s\n", pack.Description)
+	fmt.Printf(" Environments: %s\n", strings.Join(attached, ", "))
+	fmt.Println(" Pack: ")
+	fmt.Printf("%s\n", output)
+	fmt.Println()
+	return nil
+}
+
+func listPacks(c *cli.Context) error {
+	packs, err := packsmgr.All()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Description",
+		"Queries",
+		"Platform",
+		"Environments",
+	})
+	if len(packs) > 0 {
+		data := [][]string{}
+		for _, p := range packs {
+			pack, err := p.Pack()
+			if err != nil {
+				return err
+			}
+			attached, err := packsmgr.Environments(p.Name)
+			if err != nil {
+				return err
+			}
+			_p := []string{
+				p.Name,
+				p.Description,
+				strconv.Itoa(len(pack.Queries)),
+				pack.Platform,
+				strings.Join(attached, ", "),
+			}
+			data = append(data, _p)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No packs\n")
+	}
+	return nil
+}
+
+func attachPack(c *cli.Context) error {
+	return packsmgr.Attach(packName(c), packEnvironment(c))
+}
+
+func detachPack(c *cli.Context) error {
+	return packsmgr.Detach(packName(c), packEnvironment(c))
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 
+	"github.com/jmpsec/osctrl/pkg/queries"
 	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
@@ -34,6 +38,8 @@ func listQueries(c *cli.Context) error {
 		"Creator",
 		"Query",
 		"Type",
+		"Repeats",
+		"Generation",
 		"Executions",
 		"Errors",
 		"Active",
@@ -49,6 +55,8 @@ func listQueries(c *cli.Context) error {
 				q.Creator,
 				q.Query,
 				q.Type,
+				q.Schedule(),
+				strconv.FormatUint(uint64(q.Generation), 10),
 				strconv.Itoa(q.Executions),
 				strconv.Itoa(q.Errors),
 				stringifyBool(q.Active),
@@ -84,3 +92,95 @@ func deleteQuery(c *cli.Context) error {
 	}
 	return queriesmgr.Delete(name)
 }
+
+func resultsQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Query name is required")
+		os.Exit(1)
+	}
+	format := c.String("format")
+	if !queries.ValidExportFormat(format) {
+		fmt.Println("format must be csv, jsonl or parquet")
+		os.Exit(1)
+	}
+	if _, err := queriesmgr.Get(name); err != nil {
+		return fmt.Errorf("error getting query %v", err)
+	}
+	allNodes, err := nodesmgr.Gets("all", 0)
+	if err != nil {
+		return err
+	}
+	hostnames := make(map[string]string)
+	for _, n := range allNodes {
+		hostnames[n.UUID] = n.Hostname
+	}
+	var out io.Writer = os.Stdout
+	if c.String("output") != "" {
+		f, err := os.Create(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	buf := bufio.NewWriter(out)
+	if err := queriesmgr.ExportResults(name, format, c.Uint("generation"), hostnames, buf); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+func changesQuery(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("Query name is required")
+		os.Exit(1)
+	}
+	query, err := queriesmgr.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting query %v", err)
+	}
+	if !query.Recurring() {
+		return fmt.Errorf("query %s is not recurring", name)
+	}
+	generation := c.Uint("generation")
+	if generation == 0 {
+		generation = query.Generation
+	}
+	diff, err := queriesmgr.CompareGenerations(name, generation)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Change",
+		"UUID",
+		"Hostname",
+		"Row",
+	})
+	hostnames := make(map[string]string)
+	data := [][]string{}
+	for _, change := range []struct {
+		name string
+		rows []queries.ResultDiffRow
+	}{{"added", diff.Added}, {"removed", diff.Removed}} {
+		for _, r := range change.rows {
+			if _, ok := hostnames[r.UUID]; !ok {
+				if node, err := nodesmgr.GetByUUID(r.UUID); err == nil {
+					hostnames[r.UUID] = node.Hostname
+				}
+			}
+			row, _ := json.Marshal(r.Row)
+			data = append(data, []string{change.name, r.UUID, hostnames[r.UUID], string(row)})
+		}
+	}
+	fmt.Printf("Generation %d compared to %d in %d nodes, %d added and %d removed\n", diff.Generation, diff.Previous, diff.Nodes, len(diff.Added), len(diff.Removed))
+	if len(data) > 0 {
+		table.AppendBulk(data)
+		table.Render()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to get the environment and name of a secret from flags
+func secretFlags(c *cli.Context) (string, string) {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	secretName := c.String("secret")
+	if secretName == "" {
+		fmt.Println("Secret name is required")
+		os.Exit(1)
+	}
+	return envName, secretName
+}
+
+func listSecrets(c *cli.Context) error {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	env, err := envs.Get(envName)
+	if err != nil {
+		return err
+	}
+	secrets, err := envs.Secrets(envName)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Status",
+		"Primary",
+		"Expires",
+		"Enrollments",
+		"Max Enrollments",
+	})
+	if len(secrets) > 0 {
+		data := [][]string{}
+		for _, s := range secrets {
+			expires := "never"
+			if !s.Expires.IsZero() {
+				expires = s.Expires.String()
+			}
+			_s := []string{
+				s.Name,
+				s.Status(),
+				stringifyBool(s.Secret == env.Secret),
+				expires,
+				strconv.Itoa(s.Enrollments),
+				strconv.Itoa(s.MaxEnrollments),
+			}
+			data = append(data, _s)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No secrets\n")
+	}
+	return nil
+}
+
+func showSecret(c *cli.Context) error {
+	secret, err := envs.GetSecret(secretFlags(c))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", secret.Secret)
+	return nil
+}
+
+func addSecret(c *cli.Context) error {
+	envName, secretName := secretFlags(c)
+	secret, err := envs.AddSecret(envName, secretName, c.String("value"), c.Int("hours"), c.Int("max"))
+	if err != nil {
+		return err
+	}
+	if c.Bool("primary") {
+		if err := envs.SetPrimarySecret(envName, secretName); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s\n", secret.Secret)
+	return nil
+}
+
+func rotateSecret(c *cli.Context) error {
+	envName := c.String("name")
+	if envName == "" {
+		fmt.Println("Environment name is required")
+		os.Exit(1)
+	}
+	secret, err := envs.RotateSecret(envName, c.Int("overlap"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("New primary secret %s\n", secret.Name)
+	return nil
+}
+
+func primarySecret(c *cli.Context) error {
+	return envs.SetPrimarySecret(secretFlags(c))
+}
+
+func expireSecret(c *cli.Context) error {
+	envName, secretName := secretFlags(c)
+	return envs.ExpireSecret(envName, secretName, c.Int("hours"))
+}
+
+func deleteSecret(c *cli.Context) error {
+	return envs.DeleteSecret(secretFlags(c))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jmpsec/osctrl/pkg/logging"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/spool"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+// Helper to open the spool, using the directory from flags or from the TLS settings
+func openSpool(c *cli.Context) (*spool.Spool, error) {
+	dir := c.String("dir")
+	if dir == "" {
+		dir = settingsmgr.SpoolDir(settings.ServiceTLS)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("spool directory is not configured")
+	}
+	return spool.CreateSpool(dir, settingsmgr.SpoolMaxSize(settings.ServiceTLS)*1024*1024, settingsmgr.SpoolAttempts(settings.ServiceTLS))
+}
+
+func listSpool(c *cli.Context) error {
+	s, err := openSpool(c)
+	if err != nil {
+		return err
+	}
+	dests, err := s.Destinations()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Destination",
+		"Entries",
+		"Quarantined",
+		"Bytes",
+		"Oldest",
+		"Newest",
+	})
+	if len(dests) > 0 {
+		data := [][]string{}
+		fmt.Printf("Spool in %s:\n", s.Dir)
+		for _, d := range dests {
+			info, err := s.Inspect(d)
+			if err != nil {
+				return err
+			}
+			_d := []string{
+				info.Destination,
+				strconv.Itoa(info.Entries),
+				strconv.Itoa(info.Quarantined),
+				strconv.FormatInt(info.Size, 10),
+				pastTimeAgo(info.Oldest),
+				pastTimeAgo(info.Newest),
+			}
+			data = append(data, _d)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No spooled logs\n")
+	}
+	return nil
+}
+
+func showSpool(c *cli.Context) error {
+	// Get values from flags
+	destination := c.String("destination")
+	if destination == "" {
+		fmt.Println("destination is required")
+		os.Exit(1)
+	}
+	s, err := openSpool(c)
+	if err != nil {
+		return err
+	}
+	quarantined := c.Bool("quarantined")
+	entries, err := s.Entries(destination, quarantined)
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Spooled",
+		"Type",
+		"Environment",
+		"UUID",
+		"Bytes",
+		"Attempts",
+		"Error",
+		"Data",
+	})
+	if len(entries) > 0 {
+		data := [][]string{}
+		fmt.Printf("Spooled logs for %s (%d):\n", destination, len(entries))
+		for _, e := range entries {
+			_e := []string{
+				pastTimeAgo(e.Spooled),
+				e.LogType,
+				e.Environment,
+				e.UUID,
+				strconv.Itoa(len(e.Data)),
+				strconv.Itoa(e.Attempts),
+				truncateString(e.LastError, 40),
+				truncateString(string(e.Data), 40),
+			}
+			data = append(data, _e)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No spooled logs for %s\n", destination)
+	}
+	return nil
+}
+
+func replaySpool(c *cli.Context) error {
+	// Get values from flags
+	destination := c.String("destination")
+	if destination == "" {
+		fmt.Println("destination is required")
+		os.Exit(1)
+	}
+	s, err := openSpool(c)
+	if err != nil {
+		return err
+	}
+	// Logs are replayed using the logging dispatcher, like osctrl-tls does
+	d := logging.CreateDispatcher([]string{destination}, logging.SinkOptions{DB: db}, nil)
+	defer d.Close()
+	if err := d.EnableSpool(s.Dir, s.MaxSize, s.MaxAttempts); err != nil {
+		return err
+	}
+	replayed, err := d.Replay(destination)
+	fmt.Printf("Replayed %d spooled logs for %s\n", replayed, destination)
+	return err
+}
+
+func purgeSpool(c *cli.Context) error {
+	// Get values from flags
+	destination := c.String("destination")
+	if destination == "" {
+		fmt.Println("destination is required")
+		os.Exit(1)
+	}
+	s, err := openSpool(c)
+	if err != nil {
+		return err
+	}
+	purged, err := s.Purge(destination, c.Bool("quarantined"))
+	fmt.Printf("Purged %d spooled logs for %s\n", purged, destination)
+	return err
+}
+
+func requeueSpool(c *cli.Context) error {
+	// Get values from flags
+	destination := c.String("destination")
+	if destination == "" {
+		fmt.Println("destination is required")
+		os.Exit(1)
+	}
+	s, err := openSpool(c)
+	if err != nil {
+		return err
+	}
+	requeued, err := s.Requeue(destination)
+	fmt.Printf("Requeued %d quarantined logs for %s\n", requeued, destination)
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmpsec/osctrl/pkg/nodes"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli"
+)
+
+func listTagRules(c *cli.Context) error {
+	rules, err := nodesmgr.GetTagRules()
+	if err != nil {
+		return err
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Name",
+		"Type",
+		"Pattern",
+		"Platform",
+		"Environment",
+		"Tag",
+	})
+	if len(rules) > 0 {
+		data := [][]string{}
+		fmt.Printf("Existing tag rules (%d):\n", len(rules))
+		for _, r := range rules {
+			_r := []string{
+				r.Name,
+				r.Type,
+				r.Pattern,
+				r.Platform,
+				r.Environment,
+				r.Key + "=" + r.Value,
+			}
+			data = append(data, _r)
+		}
+		table.AppendBulk(data)
+		table.Render()
+	} else {
+		fmt.Printf("No tag rules\n")
+	}
+	return nil
+}
+
+func addTagRule(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	tag := strings.SplitN(c.String("tag"), "=", 2)
+	if len(tag) != 2 || tag[0] == "" {
+		fmt.Println("tag is required as key=value")
+		os.Exit(1)
+	}
+	environment := c.String("environment")
+	if environment != "" && !envs.Exists(environment) {
+		fmt.Printf("Environment %s does not exist\n", environment)
+		os.Exit(1)
+	}
+	rule := nodes.TagRule{
+		Name:        name,
+		Environment: environment,
+		Type:        c.String("type"),
+		Pattern:     c.String("pattern"),
+		Platform:    c.String("platform"),
+		Key:         tag[0],
+		Value:       tag[1],
+	}
+	count, err := nodesmgr.CreateTagRule(rule)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tag rule %s created successfully and applied to %d nodes\n", name, count)
+	return nil
+}
+
+func deleteTagRule(c *cli.Context) error {
+	// Get values from flags
+	name := c.String("name")
+	if name == "" {
+		fmt.Println("name is required")
+		os.Exit(1)
+	}
+	return nodesmgr.DeleteTagRule(name)
+}
+
+func applyTagRules(c *cli.Context) error {
+	count, err := nodesmgr.ApplyTagRulesAll()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tag rules applied to %d nodes\n", count)
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jmpsec/osctrl/pkg/carves"
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/jmpsec/osctrl/pkg/queries"
@@ -107,10 +108,11 @@ func enrollHandler(w http.ResponseWriter, r *http.Request) {
 	var nodeKey string
 	var newNode nodes.OsqueryNode
 	nodeInvalid := true
-	if checkValidSecret(t.EnrollSecret, env) {
+	secret, err := envs.EnrollWith(env, t.EnrollSecret)
+	if err == nil {
 		// Generate node_key using UUID as entropy
 		nodeKey = generateNodeKey(t.HostIdentifier)
-		newNode = nodeFromEnroll(t, env, r.Header.Get("X-Real-IP"), nodeKey)
+		newNode = nodeFromEnroll(t, env, secret.Name, r.Header.Get("X-Real-IP"), nodeKey)
 		// Check if UUID exists already, if so archive node and enroll new node
 		if nodesmgr.CheckByUUID(t.HostIdentifier) {
 			err := nodesmgr.Archive(t.HostIdentifier, "exists")
@@ -137,7 +139,14 @@ func enrollHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		incMetric(metricEnrollErr)
-		log.Printf("error invalid enrolling secret %s", t.EnrollSecret)
+		log.Printf("error invalid enrolling secret %s - %v", t.EnrollSecret, err)
+	}
+	// Set the tags of the rules matching the new node
+	if !nodeInvalid {
+		if err := nodesmgr.ApplyTagRules(newNode); err != nil {
+			incMetric(metricEnrollErr)
+			log.Printf("error applying tag rules %v", err)
+		}
 	}
 	// Prepare response
 	response, err = json.Marshal(types.EnrollResponse{NodeKey: nodeKey, NodeInvalid: nodeInvalid})
@@ -204,7 +213,23 @@ func configHandler(w http.ResponseWriter, r *http.Request) {
 			incMetric(metricConfigErr)
 			log.Printf("error refreshing last config %v", err)
 		}
-		response = []byte(e.Configuration)
+		// Assemble configuration for this node
+		node, err := nodesmgr.GetByKey(t.NodeKey)
+		if err == nil {
+			response, err = generateConfiguration(e, node)
+		}
+		if err != nil {
+			incMetric(metricConfigErr)
+			log.Printf("error generating configuration %v", err)
+			response = []byte(e.Configuration)
+		}
+		// Keep the hash of the served configuration, to detect drift
+		if node.ID != 0 {
+			if err := nodesmgr.UpdateExpectedHash(node, config.Hash(response)); err != nil {
+				incMetric(metricConfigErr)
+				log.Printf("error updating expected hash %v", err)
+			}
+		}
 	} else {
 		response, err = json.Marshal(types.ConfigResponse{NodeInvalid: true})
 		if err != nil {
@@ -281,8 +306,14 @@ func logHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if provided node_key is valid and if so, update node
 	if nodesmgr.CheckByKey(t.NodeKey) {
 		nodeInvalid = false
-		// Process logs and update metadata
-		processLogs(t.Data, t.LogType, env, r.Header.Get("X-Real-IP"))
+		// Queue logs to be processed and dispatched, so the node does not wait for it
+		incomingQueue.Enqueue(logJob{
+			LogType:     t.LogType,
+			Environment: env,
+			NodeKey:     t.NodeKey,
+			IPAddress:   r.Header.Get("X-Real-IP"),
+			Data:        t.Data,
+		})
 	} else {
 		nodeInvalid = true
 	}
@@ -313,6 +344,10 @@ func processLogs(data json.RawMessage, logType, environment, ipaddress string) {
 		// FIXME metrics for this
 		log.Printf("error parsing log %s %v", string(data), err)
 	}
+	if len(logs) == 0 {
+		log.Printf("no logs to process for %s", environment)
+		return
+	}
 	// Iterate through received messages to extract metadata
 	var uuids, hosts, names, users, osqueryusers, hashes, dhashes, osqueryversions []string
 	for _, l := range logs {
@@ -344,19 +379,17 @@ func dispatchLogs(data []byte, uuid, ipaddress, user, osqueryuser, hostname, loc
 	if err := nodesmgr.UpdateMetadataByUUID(user, osqueryuser, hostname, localname, ipaddress, hash, dhash, osqueryversion, uuid); err != nil {
 		log.Printf("error updating metadata %s", err)
 	}
-	// Send data to storage
-	// FIXME allow multiple types of logging
+	// Queue data for all the logging destinations
 	if envsmap[environment].DebugHTTP {
-		log.Printf("dispatching logs to %s", tlsConfig.Logging)
-	}
-	logsDispatcher(
-		tlsConfig.Logging,
-		logType,
-		db,
-		data,
-		environment,
-		uuid,
-		envsmap[environment].DebugHTTP)
+		log.Printf("dispatching logs to %v", loggingDests)
+	}
+	enqueueLogging(logJob{
+		LogType:     logType,
+		Environment: environment,
+		UUID:        uuid,
+		Data:        data,
+		Debug:       envsmap[environment].DebugHTTP,
+	})
 	// Refresh last logging request
 	if logType == types.StatusLog {
 		err := nodesmgr.RefreshLastStatus(uuid)
@@ -382,21 +415,17 @@ func dispatchQueries(queryData types.QueryWriteData, node nodes.OsqueryNode) {
 	if err := nodesmgr.RefreshLastQueryWrite(node.UUID); err != nil {
 		log.Printf("error refreshing last query write %v", err)
 	}
-	// Send data to storage
-	// FIXME allow multiple types of logging
+	// Queue data for all the logging destinations
 	if envsmap[node.Environment].DebugHTTP {
-		log.Printf("dispatching queries to %s", tlsConfig.Logging)
-	}
-	logsDispatcher(
-		tlsConfig.Logging,
-		types.QueryLog,
-		db,
-		data,
-		node.Environment,
-		node.UUID,
-		queryData.Name,
-		queryData.Status,
-		envsmap[node.Environment].DebugHTTP)
+		log.Printf("dispatching queries to %v", loggingDests)
+	}
+	enqueueLogging(logJob{
+		LogType:     types.QueryLog,
+		Environment: node.Environment,
+		UUID:        node.UUID,
+		Data:        data,
+		Debug:       envsmap[node.Environment].DebugHTTP,
+	})
 }
 
 // Function to handle on-demand queries to osquery nodes
@@ -438,7 +467,12 @@ func queryReadHandler(w http.ResponseWriter, r *http.Request) {
 			log.Printf("error updating IP Address %v", err)
 		}
 		nodeInvalid = false
-		qs, err = queriesmgr.NodeQueries(node)
+		tags, err := nodesmgr.GetTags(node.UUID)
+		if err != nil {
+			incMetric(metricReadErr)
+			log.Printf("error getting tags %v", err)
+		}
+		qs, err = queriesmgr.NodeQueries(node, tags)
 		if err != nil {
 			incMetric(metricReadErr)
 			log.Printf("error getting queries from db %v", err)
@@ -531,37 +565,40 @@ func queryWriteHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper to process on-demand query result logs
-func processLogQueryResult(queries types.QueryWriteQueries, statuses types.QueryWriteStatuses, nodeKey string, environment string) {
+func processLogQueryResult(results types.QueryWriteQueries, statuses types.QueryWriteStatuses, nodeKey string, environment string) {
 	// Retrieve node
 	node, err := nodesmgr.GetByKey(nodeKey)
 	if err != nil {
 		log.Printf("error retrieving node %s", err)
 	}
 	// Tap into results so we can update internal metrics
-	for q, r := range queries {
-		// Dispatch query name, result and status
+	for q, r := range results {
+		// Recurring queries are sent with the generation in the name
+		name, generation := queries.SplitGenerationName(q)
+		// Dispatch query name, generation, result and status
 		d := types.QueryWriteData{
-			Name:   q,
-			Result: r,
-			Status: statuses[q],
+			Name:       name,
+			Generation: generation,
+			Result:     r,
+			Status:     statuses[q],
 		}
 		go dispatchQueries(d, node)
 		// Update internal metrics per query
 		var err error
 		if statuses[q] != 0 {
-			err = queriesmgr.IncError(q)
+			err = queriesmgr.IncError(name, generation)
 		} else {
-			err = queriesmgr.IncExecution(q)
+			err = queriesmgr.IncExecution(name, generation)
 		}
 		if err != nil {
 			log.Printf("error updating query %s", err)
 		}
 		// Add a record for this query
-		if err := queriesmgr.TrackExecution(q, node.UUID, statuses[q]); err != nil {
+		if err := queriesmgr.TrackExecution(name, node.UUID, generation, statuses[q]); err != nil {
 			log.Printf("error adding query execution %s", err)
 		}
 		// Check if query is completed
-		if err := queriesmgr.VerifyComplete(q); err != nil {
+		if err := queriesmgr.VerifyComplete(name); err != nil {
 			log.Printf("error verifying and completing query %s", err)
 		}
 	}
@@ -613,6 +650,19 @@ func quickEnrollHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	// Enrollment packages are served with the same secret path
+	if format, ok := environments.PackageScript(script); ok {
+		pkg, err := environments.BuildPackage(e, format, projectName)
+		if err != nil {
+			log.Printf("error building package %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", environments.PackageContentType(format))
+		w.Header().Set("Content-Disposition", "attachment; filename="+environments.PackageFilename(projectName, e.Name, format))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(pkg)
+		return
+	}
 	// Prepare response with the script
 	quickScript, err := environments.QuickAddScript(projectName, script, e)
 	if err != nil {
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/jmpsec/osctrl/pkg/carves"
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
+	"github.com/jmpsec/osctrl/pkg/logging"
 	"github.com/jmpsec/osctrl/pkg/metrics"
 	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/jmpsec/osctrl/pkg/queries"
@@ -40,24 +46,39 @@ const (
 	configurationFile string = "config/" + settings.ServiceTLS + ".json"
 	// Default DB configuration file
 	dbConfigurationFile string = "config/db.json"
+	// Default pattern for external logging plugins
+	pluginsPattern string = "plugins/*.so"
 	// Default refreshing interval in seconds
 	defaultRefresh int = 300
+	// Interval to check for recurring queries that are due
+	recurringInterval = 1 * time.Minute
+	// Default spool size in megabytes
+	defaultSpoolSize int = 1024
+	// Time to wait for requests in progress when the service stops
+	shutdownTimeout = 30 * time.Second
 )
 
 // Global variables
 var (
-	tlsConfig      types.JSONConfigurationService
-	db             *gorm.DB
-	settingsmgr    *settings.Settings
-	envs           *environments.Environment
-	envsmap        environments.MapEnvironments
-	envsTicker     *time.Ticker
-	settingsmap    settings.MapSettings
-	settingsTicker *time.Ticker
-	nodesmgr       *nodes.NodeManager
-	queriesmgr     *queries.Queries
-	filecarves     *carves.Carves
-	_metrics       *metrics.Metrics
+	tlsConfig       types.JSONConfigurationService
+	db              *gorm.DB
+	settingsmgr     *settings.Settings
+	envs            *environments.Environment
+	envsmap         environments.MapEnvironments
+	envsTicker      *time.Ticker
+	settingsmap     settings.MapSettings
+	settingsTicker  *time.Ticker
+	recurringTicker *time.Ticker
+	nodesmgr        *nodes.NodeManager
+	queriesmgr      *queries.Queries
+	filecarves      *carves.Carves
+	configsmgr      *config.Configs
+	packsmgr        *config.Packs
+	overlaysmgr     *config.Overlays
+	rolloutsmgr     *config.Rollouts
+	_metrics        *metrics.Metrics
+	loggingDests    []string
+	dispatcher      *logging.Dispatcher
 )
 
 // Variables for flags
@@ -65,17 +86,13 @@ var (
 	versionFlag *bool
 	configFlag  *string
 	dbFlag      *string
+	pluginsFlag *string
 )
 
-// Valid values for auth and logging in configuration
+// Valid values for auth in configuration
 var validAuth = map[string]bool{
 	settings.AuthNone:    true,
 }
-var validLogging = map[string]bool{
-	settings.LoggingDB:      true,
-	settings.LoggingGraylog: true,
-	settings.LoggingSplunk:  true,
-}
 
 // Function to load the configuration file and assign to variables
 func loadConfiguration(file string) (types.JSONConfigurationService, error) {
@@ -97,15 +114,18 @@ func loadConfiguration(file string) (types.JSONConfigurationService, error) {
 	if !validAuth[cfg.Auth] {
 		return cfg, fmt.Errorf("Invalid auth method")
 	}
-	if !validLogging[cfg.Logging] {
-		return cfg, fmt.Errorf("Invalid logging method")
+	// Logging can be sent to multiple destinations, separated by comma
+	for _, l := range splitLogging(cfg.Logging) {
+		if !logging.IsRegistered(l) {
+			return cfg, fmt.Errorf("Invalid logging method %s, valid are %v", l, logging.RegisteredSinks())
+		}
 	}
 	// No errors!
 	return cfg, nil
 }
 
-// Initialization code
-func init() {
+// Initialization code, called from main so the package can be loaded by tests
+func initialize() {
 	var err error
 	// Command line flags
 	flag.Usage = tlsUsage
@@ -113,6 +133,7 @@ func init() {
 	versionFlag = flag.Bool("v", false, "Displays the binary version.")
 	configFlag = flag.String("c", configurationFile, "Service configuration JSON file to use.")
 	dbFlag = flag.String("D", dbConfigurationFile, "DB configuration JSON file to use.")
+	pluginsFlag = flag.String("P", "", "Pattern of external logging plugins to load, e.g. "+pluginsPattern)
 	// Parse all flags
 	flag.Parse()
 	if *versionFlag {
@@ -120,18 +141,23 @@ func init() {
 	}
 	// Logging format flags
 	log.SetFlags(log.Lshortfile)
+	// Load external logging plugins, so they are available as logging destinations
+	if *pluginsFlag != "" {
+		if err := logging.LoadPlugins(*pluginsFlag); err != nil {
+			log.Fatalf("Error loading plugins - %v", err)
+		}
+	}
 	// Load TLS configuration
 	tlsConfig, err = loadConfiguration(*configFlag)
 	if err != nil {
 		log.Fatalf("Error loading %s - %s", *configFlag, err)
 	}
+	loggingDests = splitLogging(tlsConfig.Logging)
 }
 
 // Go go!
 func main() {
-	if err := loadPlugins(); err != nil {
-		log.Printf("Error loading plugins - %v", err)
-	}
+	initialize()
 	log.Println("Loading DB")
 	// Database handler
 	db = getDB(*dbFlag)
@@ -153,11 +179,31 @@ func main() {
 	queriesmgr = queries.CreateQueries(db)
 	// Initialize carves
 	filecarves = carves.CreateFileCarves(db)
+	// Initialize configurations
+	configsmgr = config.CreateConfigs(db)
+	// Initialize shared packs
+	packsmgr = config.CreatePacks(db)
+	// Initialize configuration overlays
+	overlaysmgr = config.CreateOverlays(db)
+	// Initialize configuration rollouts
+	rolloutsmgr = config.CreateRollouts(db)
 	// Initialize service settings
 	log.Println("Loading service settings")
 	loadingSettings()
-	// multiple listeners channel
-	finish := make(chan bool)
+	// Initialize logging destinations, once metrics are ready
+	log.Printf("Loading logging destinations %v", loggingDests)
+	dispatcher = logging.CreateDispatcher(loggingDests, logging.SinkOptions{DB: db}, _metrics)
+	if spoolDir := settingsmgr.SpoolDir(settings.ServiceTLS); spoolDir != "" {
+		spoolMax := settingsmgr.SpoolMaxSize(settings.ServiceTLS) * 1024 * 1024
+		spoolAttempts := settingsmgr.SpoolAttempts(settings.ServiceTLS)
+		if err := dispatcher.EnableSpool(spoolDir, spoolMax, spoolAttempts); err != nil {
+			log.Printf("Failed to create spool - %v", err)
+		}
+		dispatcher.StartReplay()
+	}
+	// Initialize queues between handlers and logging destinations
+	log.Println("Loading logs queues")
+	loadQueues()
 
 	/////////////////////////// ALL CONTENT IS UNAUTHENTICATED FOR TLS
 	if settingsmgr.DebugService(settings.ServiceTLS) {
@@ -227,12 +273,48 @@ func main() {
 		}
 	}()
 
+	// Ticker to start the next generation of recurring queries
+	if settingsmgr.DebugService(settings.ServiceTLS) {
+		log.Println("DebugService: Recurring queries ticker")
+	}
+	go func() {
+		recurringTicker = time.NewTicker(recurringInterval)
+		for {
+			select {
+			case <-recurringTicker.C:
+				go runRecurringQueries()
+			}
+		}
+	}()
+
 	// Launch HTTP server for TLS endpoint
+	serviceListener := tlsConfig.Listener + ":" + tlsConfig.Port
+	server := &http.Server{Addr: serviceListener, Handler: routerTLS}
 	go func() {
-		serviceListener := tlsConfig.Listener + ":" + tlsConfig.Port
 		log.Printf("%s v%s - HTTP listening %s", serviceName, serviceVersion, serviceListener)
-		log.Fatal(http.ListenAndServe(serviceListener, routerTLS))
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
 	}()
 
-	<-finish
+	// Wait until the service is stopped
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	shutdown(server)
+}
+
+// Helper to stop the service without losing logs. Requests in progress are completed, the
+// queued logs are dispatched, and then logging destinations are closed to flush buffered logs
+func shutdown(server *http.Server) {
+	log.Println("Stopping HTTP server")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("error stopping HTTP server %v", err)
+	}
+	log.Println("Draining logs queues")
+	closeQueues()
+	log.Println("Closing logging destinations")
+	dispatcher.Close()
 }
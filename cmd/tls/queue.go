@@ -0,0 +1,442 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+const (
+	// Default number of logs waiting in each queue
+	defaultQueueSize int = 10000
+	// Default number of workers for each queue, logs of the same node are always handled by the same worker
+	defaultQueueWorkers int = 4
+	// Default number of logs to dispatch together
+	defaultQueueBatch int = 50
+	// Interval in seconds to report queues depth and reload spilled logs
+	queueInterval int = 10
+	// Extension for spilled logs
+	spillExtension string = ".json"
+	// Name of the queue between handlers and logging destinations
+	queueIncoming string = "incoming"
+)
+
+const (
+	metricQueuePrefix  = "queue-"
+	metricQueueDepth   = "-depth"
+	metricQueueDropped = "-dropped"
+	metricQueueSpilled = "-spilled"
+)
+
+// logJob to hold one log request waiting to be processed or dispatched
+type logJob struct {
+	LogType     string `json:"log_type"`
+	Environment string `json:"environment"`
+	UUID        string `json:"uuid"`
+	NodeKey     string `json:"-"`
+	Hash        uint32 `json:"hash"`
+	IPAddress   string `json:"ip_address"`
+	Data        []byte `json:"data"`
+	Debug       bool   `json:"debug"`
+}
+
+// Helper to hash the node of a log, incoming logs only have the node key
+// The hash is kept in the log, so the node key is not written when logs are spilled
+func (j *logJob) hash() uint32 {
+	if j.Hash == 0 {
+		key := j.UUID
+		if key == "" {
+			key = j.NodeKey
+		}
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		j.Hash = h.Sum32()
+	}
+	return j.Hash
+}
+
+// LogQueue to keep logs in a bounded queue, handled in batches by a pool of workers
+// Each worker has its own shard of the queue, and logs are sharded by node so they are handled in order
+type LogQueue struct {
+	Name     string
+	Overflow string
+	SpillDir string
+	Batch    int
+	shards   []chan logJob
+	spilled  []int
+	handler  func(jobs []logJob)
+	spillMux sync.Mutex
+	mux      sync.RWMutex
+	closed   bool
+	done     chan struct{}
+	workers  sync.WaitGroup
+}
+
+// CreateLogQueue to initialize a queue and start its workers
+func CreateLogQueue(name string, size, workers, batch int, overflow, spillDir string, handler func(jobs []logJob)) *LogQueue {
+	q := &LogQueue{
+		Name:     name,
+		Overflow: overflow,
+		SpillDir: spillDir,
+		Batch:    batch,
+		handler:  handler,
+		done:     make(chan struct{}),
+	}
+	if q.Overflow == settings.OverflowSpill {
+		if q.SpillDir == "" {
+			log.Printf("No spill directory for queue %s, blocking instead", q.Name)
+			q.Overflow = settings.OverflowBlock
+		} else if err := os.MkdirAll(q.SpillDir, 0750); err != nil {
+			log.Printf("error creating spill directory %s, blocking instead - %v", q.SpillDir, err)
+			q.Overflow = settings.OverflowBlock
+		}
+	}
+	shardSize := size / workers
+	if shardSize <= 0 {
+		shardSize = 1
+	}
+	for i := 0; i < workers; i++ {
+		jobs := make(chan logJob, shardSize)
+		q.shards = append(q.shards, jobs)
+		q.workers.Add(1)
+		go q.worker(jobs)
+	}
+	q.spilled = make([]int, workers)
+	if q.Overflow == settings.OverflowSpill {
+		q.countSpilled()
+	}
+	go q.monitor()
+	return q
+}
+
+// Depth returns the number of logs waiting in the queue
+func (q *LogQueue) Depth() int {
+	depth := 0
+	for _, jobs := range q.shards {
+		depth += len(jobs)
+	}
+	return depth
+}
+
+// Helper to get the index of the shard of the queue for a log, by node
+func (q *LogQueue) shard(job *logJob) int {
+	return int(job.hash() % uint32(len(q.shards)))
+}
+
+// Enqueue adds one log to the queue, applying the overflow policy if the queue is full
+func (q *LogQueue) Enqueue(job logJob) {
+	q.mux.RLock()
+	defer q.mux.RUnlock()
+	if q.closed {
+		log.Printf("Queue %s is closed - Dropping %d bytes", q.Name, len(job.Data))
+		return
+	}
+	i := q.shard(&job)
+	jobs := q.shards[i]
+	switch q.Overflow {
+	case settings.OverflowDropOldest:
+		for {
+			select {
+			case jobs <- job:
+				return
+			default:
+			}
+			// Queue is full, discard the oldest log and try again
+			select {
+			case dropped := <-jobs:
+				incMetric(metricQueuePrefix + q.Name + metricQueueDropped)
+				log.Printf("Queue %s is full - Dropping %d bytes", q.Name, len(dropped.Data))
+			default:
+			}
+		}
+	case settings.OverflowSpill:
+		if err := q.enqueueOrSpill(i, job); err != nil {
+			log.Printf("error spilling log from queue %s, blocking - %v", q.Name, err)
+			jobs <- job
+		}
+	default:
+		jobs <- job
+	}
+}
+
+// Close stops accepting logs and waits until the workers handle all the logs in the queue
+// Spilled logs are kept on disk, to be loaded again when the service starts
+func (q *LogQueue) Close() {
+	q.mux.Lock()
+	q.spillMux.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+		for _, jobs := range q.shards {
+			close(jobs)
+		}
+	}
+	q.spillMux.Unlock()
+	q.mux.Unlock()
+	q.workers.Wait()
+}
+
+// Worker to handle batches of logs from one shard of the queue
+func (q *LogQueue) worker(jobs chan logJob) {
+	defer q.workers.Done()
+	for job := range jobs {
+		batch := []logJob{job}
+		// Collect waiting logs, without waiting for more
+	collect:
+		for len(batch) < q.Batch {
+			select {
+			case j, ok := <-jobs:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, j)
+			default:
+				break collect
+			}
+		}
+		q.handler(batch)
+	}
+}
+
+// Monitor to report the depth of the queue and reload spilled logs when there is room
+func (q *LogQueue) monitor() {
+	ticker := time.NewTicker(time.Duration(queueInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			gaugeMetric(metricQueuePrefix+q.Name+metricQueueDepth, q.Depth())
+			if q.Overflow == settings.OverflowSpill {
+				q.unspill()
+			}
+		}
+	}
+}
+
+// Helper to add one log to its shard, or to spill it if the shard is full
+// Logs are spilled too while the shard has spilled logs, so they are loaded again after the older logs
+func (q *LogQueue) enqueueOrSpill(i int, job logJob) error {
+	q.spillMux.Lock()
+	defer q.spillMux.Unlock()
+	if q.spilled[i] == 0 {
+		select {
+		case q.shards[i] <- job:
+			return nil
+		default:
+		}
+	}
+	return q.spill(i, job)
+}
+
+// Helper to write one log to the spill directory, spillMux must be held
+func (q *LogQueue) spill(i int, job logJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	// Nanoseconds in the filename keep the order of spilled logs
+	file := filepath.Join(q.SpillDir, fmt.Sprintf("%s-%020d%s", q.Name, time.Now().UnixNano(), spillExtension))
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		return err
+	}
+	q.spilled[i]++
+	incMetric(metricQueuePrefix + q.Name + metricQueueSpilled)
+	return nil
+}
+
+// Helper to list the spilled logs of the queue, oldest first
+func (q *LogQueue) spillFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(q.SpillDir, q.Name+"-*"+spillExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Helper to read one spilled log
+func readSpilled(file string) (logJob, error) {
+	var job logJob
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return job, err
+	}
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
+
+// Helper to count the logs spilled by each shard before the service started
+// The number of shards may have changed, so the shard is calculated again with the hash of each log
+func (q *LogQueue) countSpilled() {
+	files, err := q.spillFiles()
+	if err != nil {
+		log.Printf("error reading spill directory %s - %v", q.SpillDir, err)
+		return
+	}
+	for _, f := range files {
+		job, err := readSpilled(f)
+		if err != nil {
+			log.Printf("error reading spilled log %s - %v", f, err)
+			continue
+		}
+		q.spilled[q.shard(&job)]++
+	}
+}
+
+// Helper to move spilled logs back into the queue, oldest first, while there is room
+func (q *LogQueue) unspill() {
+	q.spillMux.Lock()
+	defer q.spillMux.Unlock()
+	if q.closed {
+		return
+	}
+	files, err := q.spillFiles()
+	if err != nil {
+		log.Printf("error reading spill directory %s - %v", q.SpillDir, err)
+		return
+	}
+	full := make(map[int]bool)
+	for _, f := range files {
+		job, err := readSpilled(f)
+		if err != nil {
+			log.Printf("error reading spilled log %s - %v", f, err)
+			continue
+		}
+		// Skip the rest of the logs of a full shard, so logs of the same node stay in order
+		i := q.shard(&job)
+		if full[i] {
+			continue
+		}
+		select {
+		case q.shards[i] <- job:
+			if err := os.Remove(f); err != nil {
+				log.Printf("error removing spilled log %s - %v", f, err)
+			}
+			if q.spilled[i] > 0 {
+				q.spilled[i]--
+			}
+		default:
+			full[i] = true
+			if len(full) == len(q.shards) {
+				return
+			}
+		}
+	}
+}
+
+// Queues for the logs, one for incoming logs and one per logging destination
+var (
+	incomingQueue *LogQueue
+	loggingQueues map[string]*LogQueue
+)
+
+// Helper to create all the queues using the service settings
+func loadQueues() {
+	size := int(settingsmgr.LogQueueSize(settings.ServiceTLS))
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	workers := int(settingsmgr.LogQueueWorkers(settings.ServiceTLS))
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	batch := int(settingsmgr.LogQueueBatch(settings.ServiceTLS))
+	if batch <= 0 {
+		batch = defaultQueueBatch
+	}
+	overflow := settingsmgr.LogQueueOverflow(settings.ServiceTLS)
+	spillDir := settingsmgr.LogQueueSpill(settings.ServiceTLS)
+	incomingQueue = CreateLogQueue(queueIncoming, size, workers, batch, overflow, spillPath(spillDir, queueIncoming), processLogsBatch)
+	loggingQueues = make(map[string]*LogQueue)
+	for _, d := range loggingDests {
+		dest := d
+		loggingQueues[dest] = CreateLogQueue(dest, size, workers, batch, overflow, spillPath(spillDir, dest), func(jobs []logJob) {
+			dispatchBatch(dest, jobs)
+		})
+	}
+}
+
+// Helper to close all the queues, incoming logs first because they are sent to the logging queues
+func closeQueues() {
+	incomingQueue.Close()
+	for _, q := range loggingQueues {
+		q.Close()
+	}
+}
+
+// Helper to generate the spill directory for each queue, empty if spilling is not configured
+func spillPath(spillDir, name string) string {
+	if spillDir == "" {
+		return ""
+	}
+	return filepath.Join(spillDir, name)
+}
+
+// Helper to process a batch of incoming logs
+func processLogsBatch(jobs []logJob) {
+	for _, j := range jobs {
+		processLogs(j.Data, j.LogType, j.Environment, j.IPAddress)
+	}
+}
+
+// Helper to send a log to the queues of all logging destinations
+func enqueueLogging(job logJob) {
+	for _, q := range loggingQueues {
+		q.Enqueue(job)
+	}
+}
+
+// Helper to dispatch a batch of logs to one logging destination
+// Status and result logs from the same node are merged together in one dispatch
+func dispatchBatch(destination string, jobs []logJob) {
+	var merged []logJob
+	index := make(map[string]int)
+	for _, j := range jobs {
+		if j.LogType == types.QueryLog {
+			merged = append(merged, j)
+			continue
+		}
+		key := strings.Join([]string{j.LogType, j.Environment, j.UUID}, "|")
+		if i, ok := index[key]; ok {
+			data, err := mergeLogs(merged[i].Data, j.Data)
+			if err == nil {
+				merged[i].Data = data
+				merged[i].Debug = merged[i].Debug || j.Debug
+				continue
+			}
+			log.Printf("error merging logs %v", err)
+		}
+		index[key] = len(merged)
+		merged = append(merged, j)
+	}
+	for _, j := range merged {
+		if err := dispatcher.DispatchTo(destination, j.LogType, j.Data, j.Environment, j.UUID, j.Debug); err != nil {
+			log.Printf("Logging with %s failed - %v", destination, err)
+		}
+	}
+}
+
+// Helper to merge two JSON arrays of logs
+func mergeLogs(a, b []byte) ([]byte, error) {
+	var logsA, logsB []json.RawMessage
+	if err := json.Unmarshal(a, &logsA); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &logsB); err != nil {
+		return nil, err
+	}
+	return json.Marshal(append(logsA, logsB...))
+}
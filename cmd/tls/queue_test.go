@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/pkg/settings"
+)
+
+func TestMain(m *testing.M) {
+	// Settings without a reachable database, so metrics are disabled
+	sqlDB, _ := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	db, _ := gorm.Open("postgres", sqlDB)
+	settingsmgr = &settings.Settings{DB: db.LogMode(false)}
+	os.Exit(m.Run())
+}
+
+// testHandler records handled logs, optionally waiting to be released after each batch
+type testHandler struct {
+	mux     sync.Mutex
+	handled map[string][]int
+	started chan int
+	release chan struct{}
+}
+
+func newTestHandler(blocking bool) *testHandler {
+	h := &testHandler{handled: make(map[string][]int)}
+	if blocking {
+		h.started = make(chan int, 100)
+		h.release = make(chan struct{})
+	}
+	return h
+}
+
+func (h *testHandler) handle(jobs []logJob) {
+	for _, j := range jobs {
+		n, _ := strconv.Atoi(string(j.Data))
+		h.mux.Lock()
+		h.handled[j.UUID] = append(h.handled[j.UUID], n)
+		h.mux.Unlock()
+		if h.started != nil {
+			h.started <- n
+			<-h.release
+		}
+	}
+}
+
+// Helper to wait until the handler starts with a log
+func (h *testHandler) wait(t *testing.T, want int) {
+	t.Helper()
+	select {
+	case n := <-h.started:
+		if n != want {
+			t.Fatalf("handling log %d, want %d", n, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for log %d", want)
+	}
+}
+
+func testJob(uuid string, n int) logJob {
+	return logJob{LogType: "status", UUID: uuid, Data: []byte(strconv.Itoa(n))}
+}
+
+func TestLogQueueOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		batch   int
+	}{
+		{"one worker", 1, 1},
+		{"workers", 4, 1},
+		{"batches", 4, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(false)
+			q := CreateLogQueue("test", 8, tt.workers, tt.batch, settings.OverflowBlock, "", h.handle)
+			nodes := []string{"a", "b", "c", "d", "e"}
+			for i := 0; i < 100; i++ {
+				q.Enqueue(testJob(nodes[i%len(nodes)], i))
+			}
+			q.Close()
+			for j, n := range nodes {
+				var want []int
+				for i := j; i < 100; i += len(nodes) {
+					want = append(want, i)
+				}
+				if !reflect.DeepEqual(h.handled[n], want) {
+					t.Errorf("node %s handled %v, want %v", n, h.handled[n], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLogQueueDropOldest(t *testing.T) {
+	h := newTestHandler(true)
+	q := CreateLogQueue("test", 2, 1, 1, settings.OverflowDropOldest, "", h.handle)
+	q.Enqueue(testJob("a", 0))
+	h.wait(t, 0)
+	for i := 1; i <= 4; i++ {
+		q.Enqueue(testJob("a", i))
+	}
+	if q.Depth() != 2 {
+		t.Fatalf("queue depth %d, want 2", q.Depth())
+	}
+	close(h.release)
+	q.Close()
+	if want := []int{0, 3, 4}; !reflect.DeepEqual(h.handled["a"], want) {
+		t.Errorf("handled %v, want %v", h.handled["a"], want)
+	}
+}
+
+func TestLogQueueClose(t *testing.T) {
+	h := newTestHandler(false)
+	q := CreateLogQueue("test", 100, 2, 10, settings.OverflowBlock, "", func(jobs []logJob) {
+		time.Sleep(time.Millisecond)
+		h.handle(jobs)
+	})
+	for i := 0; i < 50; i++ {
+		q.Enqueue(testJob("a", i))
+	}
+	q.Close()
+	if len(h.handled["a"]) != 50 {
+		t.Fatalf("handled %d logs before closing, want 50", len(h.handled["a"]))
+	}
+	q.Enqueue(testJob("a", 50))
+	q.Close()
+	if len(h.handled["a"]) != 50 {
+		t.Errorf("handled %d logs after closing, want 50", len(h.handled["a"]))
+	}
+}
+
+func TestLogQueueSpill(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(true)
+	q := CreateLogQueue("test", 1, 1, 1, settings.OverflowSpill, dir, h.handle)
+	q.Enqueue(testJob("a", 0))
+	h.wait(t, 0)
+	// Log 1 waits in the queue, logs 2 and 3 are spilled
+	for i := 1; i <= 3; i++ {
+		q.Enqueue(testJob("a", i))
+	}
+	h.release <- struct{}{}
+	h.wait(t, 1)
+	// The queue has room again, but log 4 is spilled after the older spilled logs
+	q.Enqueue(testJob("a", 4))
+	if q.spilled[0] != 3 || q.Depth() != 0 {
+		t.Fatalf("%d spilled logs and depth %d, want 3 and 0", q.spilled[0], q.Depth())
+	}
+	for i := 2; i <= 4; i++ {
+		q.unspill()
+		h.release <- struct{}{}
+		h.wait(t, i)
+	}
+	if q.spilled[0] != 0 {
+		t.Fatalf("%d spilled logs after loading them", q.spilled[0])
+	}
+	// Logs spilled before closing are counted again by the new queue
+	q.Enqueue(testJob("a", 5))
+	q.Enqueue(testJob("a", 6))
+	close(h.release)
+	q.Close()
+	if want := []int{0, 1, 2, 3, 4, 5}; !reflect.DeepEqual(h.handled["a"], want) {
+		t.Fatalf("handled %v, want %v", h.handled["a"], want)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*"+spillExtension))
+	if len(files) != 1 {
+		t.Fatalf("%d spilled files after closing, want 1", len(files))
+	}
+	h = newTestHandler(false)
+	q = CreateLogQueue("test", 4, 2, 1, settings.OverflowSpill, dir, h.handle)
+	q.spillMux.Lock()
+	total := 0
+	for _, n := range q.spilled {
+		total += n
+	}
+	q.spillMux.Unlock()
+	if total != 1 {
+		t.Errorf("%d spilled logs counted when starting, want 1", total)
+	}
+	q.unspill()
+	q.Close()
+	if want := []int{6}; !reflect.DeepEqual(h.handled["a"], want) {
+		t.Errorf("handled %v after starting, want %v", h.handled["a"], want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/jmpsec/osctrl/pkg/metrics"
 	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/spool"
 )
 
 // Function to load all settings for the service
@@ -51,6 +52,60 @@ func loadingSettings() {
 			log.Fatalf("Failed to add %s to configuration: %v", settings.RefreshSettings, err)
 		}
 	}
+	// Check if service settings for logs queue size is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.LogQueueSize) {
+		if err := settingsmgr.NewIntegerValue(settings.ServiceTLS, settings.LogQueueSize, int64(defaultQueueSize)); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.LogQueueSize, err)
+		}
+	}
+	// Check if service settings for logs queue workers is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.LogQueueWorkers) {
+		if err := settingsmgr.NewIntegerValue(settings.ServiceTLS, settings.LogQueueWorkers, int64(defaultQueueWorkers)); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.LogQueueWorkers, err)
+		}
+	}
+	// Check if service settings for logs queue batch is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.LogQueueBatch) {
+		if err := settingsmgr.NewIntegerValue(settings.ServiceTLS, settings.LogQueueBatch, int64(defaultQueueBatch)); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.LogQueueBatch, err)
+		}
+	}
+	// Check if service settings for logs queue overflow policy is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.LogQueueOverflow) {
+		if err := settingsmgr.NewStringValue(settings.ServiceTLS, settings.LogQueueOverflow, settings.OverflowBlock); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.LogQueueOverflow, err)
+		}
+	}
+	// Check if service settings for logs queue spill directory is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.LogQueueSpill) {
+		if err := settingsmgr.NewStringValue(settings.ServiceTLS, settings.LogQueueSpill, ""); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.LogQueueSpill, err)
+		}
+	}
+	// Check if service settings for spool directory is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.SpoolDir) {
+		if err := settingsmgr.NewStringValue(settings.ServiceTLS, settings.SpoolDir, ""); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.SpoolDir, err)
+		}
+	}
+	// Check if service settings for spool size is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.SpoolMaxSize) {
+		if err := settingsmgr.NewIntegerValue(settings.ServiceTLS, settings.SpoolMaxSize, int64(defaultSpoolSize)); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.SpoolMaxSize, err)
+		}
+	}
+	// Check if service settings for spool attempts is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.SpoolAttempts) {
+		if err := settingsmgr.NewIntegerValue(settings.ServiceTLS, settings.SpoolAttempts, int64(spool.DefaultMaxAttempts)); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.SpoolAttempts, err)
+		}
+	}
+	// Check if service settings for remote flags is ready
+	if !settingsmgr.IsValue(settings.ServiceTLS, settings.RemoteFlags) {
+		if err := settingsmgr.NewBooleanValue(settings.ServiceTLS, settings.RemoteFlags, false); err != nil {
+			log.Fatalf("Failed to add %s to configuration: %v", settings.RemoteFlags, err)
+		}
+	}
 	// Write JSON config to settings
 	if err := settingsmgr.SetAllJSON(settings.ServiceTLS, tlsConfig.Listener, tlsConfig.Port, tlsConfig.Host, tlsConfig.Auth, tlsConfig.Logging); err != nil {
 		log.Fatalf("Failed to add JSON values to configuration: %v", err)
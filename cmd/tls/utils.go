@@ -13,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jmpsec/osctrl/pkg/config"
 	"github.com/jmpsec/osctrl/pkg/environments"
 	"github.com/jmpsec/osctrl/pkg/nodes"
 	"github.com/jmpsec/osctrl/pkg/settings"
@@ -35,15 +36,6 @@ func generateCarveSessionID() string {
 	return id.String()
 }
 
-// Helper to check if the provided secret is valid for this environment
-func checkValidSecret(enrollSecret string, environment string) bool {
-	env, err := envs.Get(environment)
-	if err != nil {
-		return false
-	}
-	return (strings.TrimSpace(enrollSecret) == env.Secret)
-}
-
 // Helper to check if the provided SecretPath is valid for enrolling in a environment
 func checkValidEnrollSecretPath(environment, secretpath string) bool {
 	env, err := envs.Get(environment)
@@ -63,7 +55,7 @@ func checkValidRemoveSecretPath(environment, secretpath string) bool {
 }
 
 // Helper to convert an enrollment request into a osquery node
-func nodeFromEnroll(req types.EnrollRequest, environment, ipaddress, nodekey string) nodes.OsqueryNode {
+func nodeFromEnroll(req types.EnrollRequest, environment, secret, ipaddress, nodekey string) nodes.OsqueryNode {
 	// Prepare the enrollment request to be stored as raw JSON
 	enrollRaw, err := json.Marshal(req)
 	if err != nil {
@@ -84,6 +76,7 @@ func nodeFromEnroll(req types.EnrollRequest, environment, ipaddress, nodekey str
 		Username:        "unknown",
 		OsqueryUser:     "unknown",
 		Environment:     environment,
+		EnrollSecret:    secret,
 		CPU:             strings.TrimRight(req.HostDetails.EnrollSystemInfo.CPUBrand, "\x00"),
 		Memory:          req.HostDetails.EnrollSystemInfo.PhysicalMemory,
 		HardwareSerial:  req.HostDetails.EnrollSystemInfo.HardwareSerial,
@@ -110,6 +103,17 @@ func uniq(duplicated []string) []string {
 	return result
 }
 
+// Helper to split the configured logging into all its destinations
+func splitLogging(logging string) []string {
+	var dests []string
+	for _, l := range strings.Split(logging, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			dests = append(dests, l)
+		}
+	}
+	return uniq(dests)
+}
+
 // Helper to determine if an IPv4 is public, based on the following:
 // Class   Starting IPAddress  Ending IPAddress
 // A       		10.0.0.0       	 10.255.255.255
@@ -147,6 +151,68 @@ func incMetric(name string) {
 	}
 }
 
+// Helper to send the current value of a metric if it is enabled
+func gaugeMetric(name string, value int) {
+	if settingsmgr.ServiceMetrics(settings.ServiceTLS) {
+		_metrics.ConnectAndSend(name, value)
+	}
+}
+
+// Helper to assemble the configuration of an environment for a node
+// Nodes in the cohort of an active rollout get the candidate configuration instead of the current one
+// Shared packs are merged and then the overlays for the platform, tags and UUID of the node
+// Tags set by rules are applied when nodes enroll and when their hostname or IP address change
+// With remote flags enabled, flags that are not CLI only are served as options
+// Configurations that can not be parsed are served as they are
+func generateConfiguration(env environments.TLSEnvironment, node nodes.OsqueryNode) ([]byte, error) {
+	tags, err := nodesmgr.GetTags(node.UUID)
+	if err != nil {
+		return nil, err
+	}
+	nodeData := config.OverlayNodeData{
+		UUID:     node.UUID,
+		Platform: node.Platform,
+		Tags:     tags,
+	}
+	var conf config.OsqueryConf
+	rollout, canary := rolloutsmgr.Cohort(env.Name, nodeData)
+	if canary {
+		if conf, err = rollout.Candidate(); err != nil {
+			log.Printf("error parsing rollout candidate for %s, using current configuration - %v", env.Name, err)
+			canary = false
+		}
+	}
+	if !canary {
+		if conf, err = configsmgr.Load(env.Name, env.Configuration); err != nil {
+			return []byte(env.Configuration), nil
+		}
+	}
+	packs, err := packsmgr.Attached(env.Name)
+	if err != nil {
+		return nil, err
+	}
+	conf.MergePacks(packs)
+	if settingsmgr.RemoteFlags(settings.ServiceTLS) {
+		flags, err := environments.RemoteFlags(env.Flags)
+		if err != nil {
+			log.Printf("error parsing flags for %s, not serving them - %v", env.Name, err)
+		} else {
+			conf.MergeOptions(flags)
+		}
+	}
+	overlays, err := overlaysmgr.ForNode(env.Name, nodeData)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := conf.ApplyOverlays(overlays)
+	if err != nil {
+		// A broken overlay must not leave the node without configuration
+		log.Printf("error applying overlays for %s, using base configuration - %v", node.UUID, err)
+		return conf.JSON()
+	}
+	return merged.JSON()
+}
+
 // Helper to refresh the environments map until cache/Redis support is implemented
 func refreshEnvironments() {
 	log.Printf("Refreshing environments...\n")
@@ -183,3 +249,14 @@ func tlsVersion() {
 	fmt.Printf("%s v%s\n", serviceName, serviceVersion)
 	os.Exit(0)
 }
+
+// Helper to start the next generation of the recurring queries that are due
+func runRecurringQueries() {
+	started, err := queriesmgr.RunRecurring(time.Now())
+	if err != nil {
+		log.Printf("error running recurring queries %v\n", err)
+	}
+	for _, q := range started {
+		log.Printf("Recurring query %s generation %d, next run %s\n", q.Name, q.Generation, q.NextRun)
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ConfigSection to store one section of the osquery configuration of an environment
+// Packs are stored one per row, using the pack name, so they can be changed separately
+type ConfigSection struct {
+	gorm.Model
+	Environment string `gorm:"index"`
+	Section     string `gorm:"index"`
+	Name        string
+	Value       string
+}
+
+// Configs keeps all the osquery configurations by environment
+type Configs struct {
+	DB *gorm.DB
+}
+
+// CreateConfigs to initialize the configurations struct and tables
+func CreateConfigs(backend *gorm.DB) *Configs {
+	var c *Configs
+	c = &Configs{DB: backend}
+	// table config_sections
+	if err := backend.AutoMigrate(ConfigSection{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (config_sections): %v", err)
+	}
+	return c
+}
+
+// Helper to convert a configuration into rows to be stored
+func toRows(environment string, conf OsqueryConf) ([]ConfigSection, error) {
+	var rows []ConfigSection
+	sections, err := conf.Sections()
+	if err != nil {
+		return rows, err
+	}
+	for s, v := range sections {
+		if s == SectionPacks {
+			continue
+		}
+		rows = append(rows, ConfigSection{Environment: environment, Section: s, Value: string(v)})
+	}
+	for n, p := range conf.Packs {
+		rows = append(rows, ConfigSection{Environment: environment, Section: SectionPacks, Name: n, Value: string(p)})
+	}
+	return rows, nil
+}
+
+// Helper to convert stored rows into a configuration
+func fromRows(rows []ConfigSection) (OsqueryConf, error) {
+	var conf OsqueryConf
+	for _, r := range rows {
+		var err error
+		if r.Section == SectionPacks {
+			err = conf.SetPack(r.Name, json.RawMessage(r.Value))
+		} else {
+			err = conf.SetSection(r.Section, json.RawMessage(r.Value))
+		}
+		if err != nil {
+			return conf, err
+		}
+	}
+	return conf, nil
+}
+
+// Exists checks if the environment has a structured configuration
+func (c *Configs) Exists(environment string) bool {
+	var results int
+	c.DB.Model(&ConfigSection{}).Where("environment = ?", environment).Count(&results)
+	return (results > 0)
+}
+
+// Get the configuration of an environment
+func (c *Configs) Get(environment string) (OsqueryConf, error) {
+	var rows []ConfigSection
+	if err := c.DB.Where("environment = ?", environment).Find(&rows).Error; err != nil {
+		return OsqueryConf{}, err
+	}
+	return fromRows(rows)
+}
+
+// Load the configuration of an environment from its sections
+// Environments without stored sections are parsed from the provided configuration
+func (c *Configs) Load(environment, configuration string) (OsqueryConf, error) {
+	if c.Exists(environment) {
+		return c.Get(environment)
+	}
+	return ParseConfiguration([]byte(configuration))
+}
+
+// Generate the final osquery configuration JSON of an environment
+func (c *Configs) Generate(environment string) ([]byte, error) {
+	conf, err := c.Get(environment)
+	if err != nil {
+		return nil, err
+	}
+	return conf.JSON()
+}
+
+// Save validates the configuration of an environment and stores it
+// Only the sections and packs that changed are updated
+func (c *Configs) Save(environment string, conf OsqueryConf) error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	rows, err := toRows(environment, conf)
+	if err != nil {
+		return err
+	}
+	var existing []ConfigSection
+	if err := c.DB.Where("environment = ?", environment).Find(&existing).Error; err != nil {
+		return err
+	}
+	current := make(map[string]ConfigSection)
+	for _, e := range existing {
+		current[e.Section+"/"+e.Name] = e
+	}
+	tx := c.DB.Begin()
+	for _, r := range rows {
+		key := r.Section + "/" + r.Name
+		e, ok := current[key]
+		delete(current, key)
+		if ok && e.Value == r.Value {
+			continue
+		}
+		if ok {
+			err = tx.Model(&e).Update("value", r.Value).Error
+		} else {
+			err = tx.Create(&r).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error saving %s - %v", key, err)
+		}
+	}
+	// Sections and packs that are not in the configuration anymore
+	for key, e := range current {
+		if err := tx.Unscoped().Delete(&e).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error deleting %s - %v", key, err)
+		}
+	}
+	return tx.Commit().Error
+}
+
+// Import parses and validates a full osquery configuration and stores it for an environment
+func (c *Configs) Import(environment string, raw []byte) error {
+	conf, err := ParseConfiguration(raw)
+	if err != nil {
+		return err
+	}
+	return c.Save(environment, conf)
+}
+
+// SaveSection replaces one section of the configuration of an environment
+func (c *Configs) SaveSection(environment, section string, value json.RawMessage) error {
+	conf, err := c.Get(environment)
+	if err != nil {
+		return err
+	}
+	if err := conf.SetSection(section, value); err != nil {
+		return err
+	}
+	return c.Save(environment, conf)
+}
+
+// DeleteSection removes one section from the configuration of an environment
+func (c *Configs) DeleteSection(environment, section string) error {
+	if err := c.DB.Unscoped().Where("environment = ? AND section = ?", environment, section).Delete(&ConfigSection{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// SavePack adds or replaces one pack in the configuration of an environment
+func (c *Configs) SavePack(environment, name string, value json.RawMessage) error {
+	conf, err := c.Get(environment)
+	if err != nil {
+		return err
+	}
+	if err := conf.SetPack(name, value); err != nil {
+		return err
+	}
+	return c.Save(environment, conf)
+}
+
+// DeletePack removes one pack from the configuration of an environment
+func (c *Configs) DeletePack(environment, name string) error {
+	if err := c.DB.Unscoped().Where("environment = ? AND section = ? AND name = ?", environment, SectionPacks, name).Delete(&ConfigSection{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// Delete the configuration of an environment
+func (c *Configs) Delete(environment string) error {
+	if err := c.DB.Unscoped().Where("environment = ?", environment).Delete(&ConfigSection{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+module github.com/jmpsec/osctrl/pkg/config
+
+go 1.12
+
+require (
+	github.com/jinzhu/gorm v1.9.8
+	github.com/jmpsec/osctrl/pkg/nodes v0.1.5
+)
@@ -0,0 +1,427 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Sections of the osquery configuration
+const (
+	SectionOptions    string = "options"
+	SectionSchedule   string = "schedule"
+	SectionPacks      string = "packs"
+	SectionDecorators string = "decorators"
+	SectionFilePaths  string = "file_paths"
+	SectionATC        string = "auto_table_construction"
+	SectionYara       string = "yara"
+)
+
+// Other sections osquery understands, stored as they are
+var extraSections = map[string]bool{
+	"file_paths_query":   true,
+	"file_accesses":      true,
+	"exclude_paths":      true,
+	"events":             true,
+	"views":              true,
+	"prometheus_targets": true,
+	"feature_vectors":    true,
+	"kafka_topics":       true,
+}
+
+// ScheduledQuery for queries in the schedule and in packs
+type ScheduledQuery struct {
+	Query       string `json:"query"`
+	Interval    int    `json:"interval"`
+	Removed     *bool  `json:"removed,omitempty"`
+	Snapshot    *bool  `json:"snapshot,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Shard       int    `json:"shard,omitempty"`
+	Denylist    *bool  `json:"denylist,omitempty"`
+	Blacklist   *bool  `json:"blacklist,omitempty"`
+	Description string `json:"description,omitempty"`
+	Value       string `json:"value,omitempty"`
+}
+
+// UnmarshalJSON decodes a scheduled query rejecting unknown fields
+// Interval and shard can be numbers or numeric strings, as osquery accepts both
+func (q *ScheduledQuery) UnmarshalJSON(data []byte) error {
+	type scheduledQuery ScheduledQuery
+	aux := struct {
+		*scheduledQuery
+		Interval numericInt `json:"interval"`
+		Shard    numericInt `json:"shard,omitempty"`
+	}{scheduledQuery: (*scheduledQuery)(q)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return err
+	}
+	q.Interval = int(aux.Interval)
+	q.Shard = int(aux.Shard)
+	return nil
+}
+
+// numericInt to decode integers from numbers or numeric strings
+type numericInt int
+
+// UnmarshalJSON decodes a number or a string with a number
+func (n *numericInt) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil || string(data) == "null" {
+		var i int
+		if err := json.Unmarshal(data, &i); err != nil {
+			return err
+		}
+		*n = numericInt(i)
+		return nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	*n = numericInt(i)
+	return nil
+}
+
+// Pack for query packs defined inside the configuration
+type Pack struct {
+	Queries   map[string]ScheduledQuery `json:"queries"`
+	Discovery []string                  `json:"discovery,omitempty"`
+	Platform  string                    `json:"platform,omitempty"`
+	Version   string                    `json:"version,omitempty"`
+	Shard     int                       `json:"shard,omitempty"`
+	Oncall    string                    `json:"oncall,omitempty"`
+}
+
+// Decorators for the decorators section
+type Decorators struct {
+	Load     []string            `json:"load,omitempty"`
+	Always   []string            `json:"always,omitempty"`
+	Interval map[string][]string `json:"interval,omitempty"`
+}
+
+// ATCTable for each table in the auto_table_construction section
+type ATCTable struct {
+	Query    string   `json:"query"`
+	Path     string   `json:"path"`
+	Columns  []string `json:"columns"`
+	Platform string   `json:"platform,omitempty"`
+}
+
+// Yara for the yara section
+type Yara struct {
+	Signatures    map[string][]string `json:"signatures,omitempty"`
+	FilePaths     map[string][]string `json:"file_paths,omitempty"`
+	SignatureURLs []string            `json:"signature_urls,omitempty"`
+}
+
+// OsqueryConf to hold the osquery configuration by section
+// Packs can be a Pack or a string with the path to the pack in the node
+type OsqueryConf struct {
+	Options    map[string]interface{}
+	Schedule   map[string]ScheduledQuery
+	Packs      map[string]json.RawMessage
+	Decorators *Decorators
+	FilePaths  map[string][]string
+	ATC        map[string]ATCTable
+	Yara       *Yara
+	Extra      map[string]json.RawMessage
+}
+
+// Helper to decode JSON rejecting unknown fields
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ParseConfiguration parses and validates a full osquery configuration
+func ParseConfiguration(raw []byte) (OsqueryConf, error) {
+	var conf OsqueryConf
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return conf, fmt.Errorf("invalid configuration - %v", err)
+	}
+	for section, value := range sections {
+		if err := conf.SetSection(section, value); err != nil {
+			return conf, err
+		}
+	}
+	return conf, conf.Validate()
+}
+
+// SetSection parses one section and replaces it in the configuration
+func (conf *OsqueryConf) SetSection(section string, value json.RawMessage) error {
+	var err error
+	switch section {
+	case SectionOptions:
+		conf.Options = nil
+		err = decodeStrict(value, &conf.Options)
+	case SectionSchedule:
+		conf.Schedule = nil
+		err = decodeStrict(value, &conf.Schedule)
+	case SectionPacks:
+		conf.Packs = nil
+		err = decodeStrict(value, &conf.Packs)
+	case SectionDecorators:
+		conf.Decorators = nil
+		err = decodeStrict(value, &conf.Decorators)
+	case SectionFilePaths:
+		conf.FilePaths = nil
+		err = decodeStrict(value, &conf.FilePaths)
+	case SectionATC:
+		conf.ATC = nil
+		err = decodeStrict(value, &conf.ATC)
+	case SectionYara:
+		conf.Yara = nil
+		err = decodeStrict(value, &conf.Yara)
+	default:
+		if !extraSections[section] {
+			return fmt.Errorf("unknown section %s", section)
+		}
+		var v interface{}
+		if err = json.Unmarshal(value, &v); err == nil {
+			if conf.Extra == nil {
+				conf.Extra = make(map[string]json.RawMessage)
+			}
+			conf.Extra[section] = value
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s - %v", section, err)
+	}
+	return nil
+}
+
+// SetPack parses and validates one pack, and replaces it in the configuration
+func (conf *OsqueryConf) SetPack(name string, value json.RawMessage) error {
+	if err := ValidatePack(name, value); err != nil {
+		return err
+	}
+	if conf.Packs == nil {
+		conf.Packs = make(map[string]json.RawMessage)
+	}
+	conf.Packs[name] = value
+	return nil
+}
+
+// Helper to validate one scheduled query
+func validateQuery(name string, q ScheduledQuery) error {
+	if name == "" {
+		return fmt.Errorf("query without name")
+	}
+	if q.Query == "" {
+		return fmt.Errorf("query %s is empty", name)
+	}
+	if q.Interval <= 0 {
+		return fmt.Errorf("query %s has invalid interval %d", name, q.Interval)
+	}
+	if q.Shard < 0 || q.Shard > 100 {
+		return fmt.Errorf("query %s has invalid shard %d", name, q.Shard)
+	}
+	return nil
+}
+
+// ValidatePack checks if a pack is valid, it can be a pack or a string with the path to the pack
+func ValidatePack(name string, value json.RawMessage) error {
+	var path string
+	if err := json.Unmarshal(value, &path); err == nil {
+		if path == "" {
+			return fmt.Errorf("pack %s has empty path", name)
+		}
+		return nil
+	}
+	_, err := ParsePack(name, value)
+	return err
+}
+
+// ParsePack parses and validates a pack with its queries
+func ParsePack(name string, value json.RawMessage) (Pack, error) {
+	var p Pack
+	if err := decodeStrict(value, &p); err != nil {
+		return p, fmt.Errorf("invalid pack %s - %v", name, err)
+	}
+	if p.Shard < 0 || p.Shard > 100 {
+		return p, fmt.Errorf("pack %s has invalid shard %d", name, p.Shard)
+	}
+	for n, q := range p.Queries {
+		if err := validateQuery(n, q); err != nil {
+			return p, fmt.Errorf("pack %s - %v", name, err)
+		}
+	}
+	return p, nil
+}
+
+// Validate checks the configuration against the osquery schema
+func (conf OsqueryConf) Validate() error {
+	for k, v := range conf.Options {
+		switch v.(type) {
+		case string, float64, bool:
+		default:
+			return fmt.Errorf("option %s must be string, number or boolean", k)
+		}
+	}
+	for n, q := range conf.Schedule {
+		if err := validateQuery(n, q); err != nil {
+			return fmt.Errorf("schedule - %v", err)
+		}
+	}
+	for n, p := range conf.Packs {
+		if err := ValidatePack(n, p); err != nil {
+			return err
+		}
+	}
+	if conf.Decorators != nil {
+		for i := range conf.Decorators.Interval {
+			secs, err := strconv.Atoi(i)
+			if err != nil || secs <= 0 || secs%60 != 0 {
+				return fmt.Errorf("decorators interval %s must be a multiple of 60", i)
+			}
+		}
+	}
+	for t, a := range conf.ATC {
+		if a.Query == "" || a.Path == "" || len(a.Columns) == 0 {
+			return fmt.Errorf("auto_table_construction %s needs query, path and columns", t)
+		}
+	}
+	return nil
+}
+
+// QueryChecker checks the SQL of a scheduled query for its platform, and returns warnings
+// Tables are the extra tables defined by the configuration
+type QueryChecker func(query, platform string, tables []string) ([]string, error)
+
+// CheckQueries checks the SQL of the queries in the schedule and in the packs of the configuration
+func (conf OsqueryConf) CheckQueries(check QueryChecker) ([]string, error) {
+	var tables []string
+	for t := range conf.ATC {
+		tables = append(tables, t)
+	}
+	var warnings []string
+	for n, q := range conf.Schedule {
+		w, err := check(q.Query, q.Platform, tables)
+		if err != nil {
+			return warnings, fmt.Errorf("schedule - query %s - %v", n, err)
+		}
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("schedule - query %s - %s", n, warning))
+		}
+	}
+	for n, p := range conf.Packs {
+		pack, err := ParsePack(n, p)
+		if err != nil {
+			// Packs with a path to the pack in the node can not be checked
+			continue
+		}
+		w, err := pack.CheckQueries(n, check, tables)
+		warnings = append(warnings, w...)
+		if err != nil {
+			return warnings, err
+		}
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
+
+// CheckQueries checks the SQL of the queries in a pack, using the platform of the pack when queries do not have one
+func (p Pack) CheckQueries(name string, check QueryChecker, tables []string) ([]string, error) {
+	var warnings []string
+	for n, q := range p.Queries {
+		platform := q.Platform
+		if platform == "" {
+			platform = p.Platform
+		}
+		w, err := check(q.Query, platform, tables)
+		if err != nil {
+			return warnings, fmt.Errorf("pack %s - query %s - %v", name, n, err)
+		}
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("pack %s - query %s - %s", name, n, warning))
+		}
+	}
+	return warnings, nil
+}
+
+// Sections returns the JSON of each section present in the configuration
+func (conf OsqueryConf) Sections() (map[string]json.RawMessage, error) {
+	values := map[string]interface{}{}
+	if conf.Options != nil {
+		values[SectionOptions] = conf.Options
+	}
+	if conf.Schedule != nil {
+		values[SectionSchedule] = conf.Schedule
+	}
+	if conf.Packs != nil {
+		values[SectionPacks] = conf.Packs
+	}
+	if conf.Decorators != nil {
+		values[SectionDecorators] = conf.Decorators
+	}
+	if conf.FilePaths != nil {
+		values[SectionFilePaths] = conf.FilePaths
+	}
+	if conf.ATC != nil {
+		values[SectionATC] = conf.ATC
+	}
+	if conf.Yara != nil {
+		values[SectionYara] = conf.Yara
+	}
+	sections := make(map[string]json.RawMessage)
+	for s, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return sections, fmt.Errorf("error serializing %s - %v", s, err)
+		}
+		sections[s] = b
+	}
+	for s, v := range conf.Extra {
+		sections[s] = v
+	}
+	return sections, nil
+}
+
+// SectionNames returns the names of the sections present in the configuration, sorted
+func (conf OsqueryConf) SectionNames() []string {
+	sections, _ := conf.Sections()
+	var names []string
+	for s := range sections {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JSON generates the final osquery configuration, with stable order of keys
+func (conf OsqueryConf) JSON() ([]byte, error) {
+	sections, err := conf.Sections()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(sections, "", "  ")
+}
+
+// MergeOptions adds flags to the options of the configuration
+// Options defined in the configuration take precedence over the flags
+func (conf *OsqueryConf) MergeOptions(flags map[string]interface{}) {
+	for name, value := range flags {
+		if _, ok := conf.Options[name]; ok {
+			continue
+		}
+		if conf.Options == nil {
+			conf.Options = make(map[string]interface{})
+		}
+		conf.Options[name] = value
+	}
+}
+
+// Hash generates the configuration hash that osquery reports for a served configuration
+// osquery hashes each configuration source with SHA1, and then the concatenation of those hashes
+func Hash(served []byte) string {
+	source := sha1.Sum(served)
+	hash := sha1.Sum([]byte(hex.EncodeToString(source[:])))
+	return hex.EncodeToString(hash[:])
+}
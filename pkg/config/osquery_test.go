@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testConfiguration = `{
+  "options": {"host_identifier": "uuid", "schedule_splay_percent": 10, "utc": true},
+  "schedule": {"uptime": {"query": "SELECT * FROM uptime;", "interval": 3600, "snapshot": true}},
+  "packs": {
+    "local": "/etc/osquery/packs/local.conf",
+    "procs": {"platform": "darwin", "queries": {"procs": {"query": "SELECT * FROM processes;", "interval": 60, "shard": 50}}}
+  },
+  "decorators": {"load": ["SELECT uuid FROM system_info;"], "interval": {"3600": ["SELECT total_seconds FROM uptime;"]}},
+  "file_paths": {"etc": ["/etc/%%"]},
+  "auto_table_construction": {"chrome": {"query": "SELECT * FROM urls;", "path": "/tmp/History", "columns": ["url"]}},
+  "events": {"disable_subscribers": ["user_events"]}
+}`
+
+func TestParseConfiguration(t *testing.T) {
+	conf, err := ParseConfiguration([]byte(testConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"auto_table_construction", "decorators", "events", "file_paths", "options", "packs", "schedule"}
+	if got := conf.SectionNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sections %v, want %v", got, want)
+	}
+	if q := conf.Schedule["uptime"]; q.Interval != 3600 || q.Snapshot == nil || !*q.Snapshot {
+		t.Errorf("unexpected scheduled query %+v", q)
+	}
+	if _, ok := conf.Extra["events"]; !ok {
+		t.Error("missing events section")
+	}
+}
+
+func TestParseConfigurationStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+	}{
+		{"invalid JSON", `{"options":`},
+		{"unknown section", `{"unknown": {}}`},
+		{"unknown query field", `{"schedule": {"q": {"query": "SELECT 1;", "interval": 60, "intervl": 10}}}`},
+		{"unknown pack field", `{"packs": {"p": {"queries": {}, "owner": "me"}}}`},
+		{"wrong type", `{"schedule": {"q": {"query": "SELECT 1;", "interval": true}}}`},
+		{"not a number", `{"schedule": {"q": {"query": "SELECT 1;", "interval": "1h"}}}`},
+		{"unknown field in pack query", `{"packs": {"p": {"queries": {"q": {"query": "SELECT 1;", "interval": "60", "owner": "me"}}}}}`},
+		{"invalid extra section", `{"events": nope}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseConfiguration([]byte(tt.conf)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestParseNumericStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		interval int
+		shard    int
+	}{
+		{"numbers", `{"query": "SELECT 1;", "interval": 60, "shard": 10}`, 60, 10},
+		{"strings", `{"query": "SELECT 1;", "interval": "60", "shard": "10"}`, 60, 10},
+		{"null shard", `{"query": "SELECT 1;", "interval": "3600", "shard": null}`, 3600, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := ParseConfiguration([]byte(`{"schedule": {"q": ` + tt.query + `}}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q := conf.Schedule["q"]; q.Interval != tt.interval || q.Shard != tt.shard {
+				t.Errorf("interval %d and shard %d, want %d and %d", q.Interval, q.Shard, tt.interval, tt.shard)
+			}
+			// Strings are generated again as numbers
+			data, err := conf.JSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := ParseConfiguration(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again.Schedule, conf.Schedule) {
+				t.Errorf("schedule changed after round trip %s", data)
+			}
+		})
+	}
+	if err := (&OsqueryConf{}).SetPack("p", json.RawMessage(`{"queries": {"q": {"query": "SELECT 1;", "interval": "0"}}}`)); err == nil {
+		t.Error("expected error for invalid interval in pack")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	shard := func(s int) map[string]ScheduledQuery {
+		return map[string]ScheduledQuery{"q": {Query: "SELECT 1;", Interval: 60, Shard: s}}
+	}
+	tests := []struct {
+		name  string
+		conf  OsqueryConf
+		valid bool
+	}{
+		{"empty", OsqueryConf{}, true},
+		{"valid schedule", OsqueryConf{Schedule: shard(100)}, true},
+		{"invalid option", OsqueryConf{Options: map[string]interface{}{"o": []string{"a"}}}, false},
+		{"empty query", OsqueryConf{Schedule: map[string]ScheduledQuery{"q": {Interval: 60}}}, false},
+		{"invalid interval", OsqueryConf{Schedule: map[string]ScheduledQuery{"q": {Query: "SELECT 1;"}}}, false},
+		{"invalid shard", OsqueryConf{Schedule: shard(101)}, false},
+		{"empty pack path", OsqueryConf{Packs: map[string]json.RawMessage{"p": json.RawMessage(`""`)}}, false},
+		{"invalid pack shard", OsqueryConf{Packs: map[string]json.RawMessage{"p": json.RawMessage(`{"shard": -1}`)}}, false},
+		{"invalid decorators interval", OsqueryConf{Decorators: &Decorators{Interval: map[string][]string{"90": nil}}}, false},
+		{"incomplete table", OsqueryConf{ATC: map[string]ATCTable{"t": {Query: "SELECT 1;"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.conf.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	conf, err := ParseConfiguration([]byte(testConfiguration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := conf.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseConfiguration(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Generated JSON is stable, so parsing it again generates the same JSON
+	if dataAgain, err := again.JSON(); err != nil || string(dataAgain) != string(data) {
+		t.Errorf("configuration changed after round trip\n%s\n%s", data, dataAgain)
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(testConfiguration), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON() = %s", data)
+	}
+}
+
+func TestSetPack(t *testing.T) {
+	var conf OsqueryConf
+	if err := conf.SetPack("p", json.RawMessage(`{"queries": {"q": {"query": "SELECT 1;", "interval": 0}}}`)); err == nil {
+		t.Error("expected error for invalid query in pack")
+	}
+	if err := conf.SetPack("p", json.RawMessage(`{"queries": {"q": {"query": "SELECT 1;", "interval": 60}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.SetSection(SectionOptions, json.RawMessage(`{"verbose": false}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := conf.SectionNames(); !reflect.DeepEqual(got, []string{"options", "packs"}) {
+		t.Errorf("sections %v", got)
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		served string
+		hash   string
+	}{
+		{"", "10a34637ad661d98ba3344717656fcc76209c2f8"},
+		{`{"options":{}}`, "815db24bb8149caa747889e86e2a362b72010ebe"},
+	}
+	for _, tt := range tests {
+		if got := Hash([]byte(tt.served)); got != tt.hash {
+			t.Errorf("Hash(%q) = %s, want %s", tt.served, got, tt.hash)
+		}
+	}
+	// Any change in the served configuration changes the hash
+	if Hash([]byte(`{"options":{}}`)) == Hash([]byte(`{"options": {}}`)) {
+		t.Error("expected different hashes")
+	}
+}
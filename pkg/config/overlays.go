@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/pkg/nodes"
+)
+
+// Types of overlays, applied in this order over the configuration of the environment
+const (
+	OverlayPlatform string = "platform"
+	OverlayTag      string = "tag"
+	OverlayNode     string = "node"
+)
+
+// Families of platforms that can be used as target of platform overlays
+const (
+	PlatformLinux string = "linux"
+	PlatformPosix string = "posix"
+)
+
+// ConfigOverlay to store a partial configuration to be merged for some nodes of an environment
+// Target is a platform or family for platform overlays, a tag expression for tag overlays and the UUID for node overlays
+type ConfigOverlay struct {
+	gorm.Model
+	Environment string `gorm:"index"`
+	Type        string
+	Target      string
+	Value       string
+}
+
+// OverlayNodeData with the node details needed to select overlays
+type OverlayNodeData struct {
+	UUID     string
+	Platform string
+	Tags     map[string]string
+}
+
+// Overlays keeps all the configuration overlays by environment
+type Overlays struct {
+	DB *gorm.DB
+}
+
+// CreateOverlays to initialize the overlays struct and tables
+func CreateOverlays(backend *gorm.DB) *Overlays {
+	var o *Overlays
+	o = &Overlays{DB: backend}
+	// table config_overlays
+	if err := backend.AutoMigrate(ConfigOverlay{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (config_overlays): %v", err)
+	}
+	return o
+}
+
+// ValidateOverlay checks that an overlay is a JSON object with known sections
+// Values can be partial, because they are merged over the configuration
+func ValidateOverlay(otype, target string, value json.RawMessage) error {
+	switch otype {
+	case OverlayPlatform, OverlayNode:
+		if target == "" {
+			return fmt.Errorf("empty %s overlay target", otype)
+		}
+	case OverlayTag:
+		if _, err := nodes.ParseTagExpression(target); err != nil {
+			return fmt.Errorf("invalid tag overlay target - %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown overlay type %s", otype)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(value, &sections); err != nil {
+		return fmt.Errorf("invalid overlay - %v", err)
+	}
+	var scratch OsqueryConf
+	for section, v := range sections {
+		// null removes the section from the configuration
+		if string(v) == "null" {
+			continue
+		}
+		if section == SectionPacks || section == SectionSchedule {
+			var entries map[string]json.RawMessage
+			if err := json.Unmarshal(v, &entries); err != nil {
+				return fmt.Errorf("invalid %s - %v", section, err)
+			}
+			continue
+		}
+		if err := scratch.SetSection(section, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlatformMatches checks if the platform of a node matches the target of a platform overlay
+func PlatformMatches(target, platform string) bool {
+	switch target {
+	case platform:
+		return true
+	case PlatformPosix:
+		return platform != "windows"
+	case PlatformLinux:
+		return platform != "windows" && platform != "darwin" && platform != "freebsd"
+	}
+	return false
+}
+
+// Get one overlay of an environment
+func (o *Overlays) Get(environment, otype, target string) (ConfigOverlay, error) {
+	var overlay ConfigOverlay
+	if err := o.DB.Where("environment = ? AND type = ? AND target = ?", environment, otype, target).First(&overlay).Error; err != nil {
+		return overlay, err
+	}
+	return overlay, nil
+}
+
+// All gets all the overlays of an environment
+func (o *Overlays) All(environment string) ([]ConfigOverlay, error) {
+	var overlays []ConfigOverlay
+	if err := o.DB.Where("environment = ?", environment).Order("type, target").Find(&overlays).Error; err != nil {
+		return overlays, err
+	}
+	return overlays, nil
+}
+
+// Set validates and stores one overlay, replacing the existing value
+func (o *Overlays) Set(environment, otype, target string, value json.RawMessage) error {
+	if err := ValidateOverlay(otype, target, value); err != nil {
+		return err
+	}
+	overlay, err := o.Get(environment, otype, target)
+	if err == nil {
+		if err := o.DB.Model(&overlay).Update("value", string(value)).Error; err != nil {
+			return fmt.Errorf("Update %v", err)
+		}
+		return nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	overlay = ConfigOverlay{
+		Environment: environment,
+		Type:        otype,
+		Target:      target,
+		Value:       string(value),
+	}
+	if err := o.DB.Create(&overlay).Error; err != nil {
+		return fmt.Errorf("Create ConfigOverlay %v", err)
+	}
+	return nil
+}
+
+// Delete one overlay of an environment
+func (o *Overlays) Delete(environment, otype, target string) error {
+	if err := o.DB.Unscoped().Where("environment = ? AND type = ? AND target = ?", environment, otype, target).Delete(&ConfigOverlay{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// DeleteAll removes all the overlays of an environment
+func (o *Overlays) DeleteAll(environment string) error {
+	if err := o.DB.Unscoped().Where("environment = ?", environment).Delete(&ConfigOverlay{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// ForNode gets the overlays of an environment that apply to a node, in the order to be merged
+func (o *Overlays) ForNode(environment string, node OverlayNodeData) ([]ConfigOverlay, error) {
+	all, err := o.All(environment)
+	if err != nil {
+		return nil, err
+	}
+	var platform, tags, uuid []ConfigOverlay
+	for _, ov := range all {
+		switch ov.Type {
+		case OverlayPlatform:
+			if PlatformMatches(ov.Target, node.Platform) {
+				platform = append(platform, ov)
+			}
+		case OverlayTag:
+			if ok, _ := nodes.MatchTags(ov.Target, node.Tags); ok {
+				tags = append(tags, ov)
+			}
+		case OverlayNode:
+			if ov.Target == node.UUID {
+				uuid = append(uuid, ov)
+			}
+		}
+	}
+	// Families go before the exact platform, so the most specific overlay wins
+	sort.SliceStable(platform, func(i, j int) bool {
+		return platform[i].Target != node.Platform && platform[j].Target == node.Platform
+	})
+	overlays := append(platform, tags...)
+	return append(overlays, uuid...), nil
+}
+
+// Helper to decode JSON keeping numbers as they are
+func decodeNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// DeepMerge merges the overlay over the base, recursively for objects
+// Arrays and values in the overlay replace the ones in the base, and null removes the key
+func DeepMerge(base, overlay map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = make(map[string]interface{})
+	}
+	for k, v := range overlay {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+		vMap, vOK := v.(map[string]interface{})
+		bMap, bOK := base[k].(map[string]interface{})
+		if vOK && bOK {
+			base[k] = DeepMerge(bMap, vMap)
+			continue
+		}
+		base[k] = v
+	}
+	return base
+}
+
+// ApplyOverlays merges the overlays over the configuration, and returns the resulting configuration
+func (conf OsqueryConf) ApplyOverlays(overlays []ConfigOverlay) (OsqueryConf, error) {
+	if len(overlays) == 0 {
+		return conf, nil
+	}
+	raw, err := conf.JSON()
+	if err != nil {
+		return conf, err
+	}
+	var merged map[string]interface{}
+	if err := decodeNumbers(raw, &merged); err != nil {
+		return conf, err
+	}
+	for _, ov := range overlays {
+		var layer map[string]interface{}
+		if err := decodeNumbers([]byte(ov.Value), &layer); err != nil {
+			return conf, fmt.Errorf("invalid %s overlay %s - %v", ov.Type, ov.Target, err)
+		}
+		merged = DeepMerge(merged, layer)
+	}
+	result, err := json.Marshal(merged)
+	if err != nil {
+		return conf, err
+	}
+	return ParseConfiguration(result)
+}
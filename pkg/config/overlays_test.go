@@ -0,0 +1,127 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDeepMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+	}{
+		{"empty overlay", `{"a":1}`, `{}`, `{"a":1}`},
+		{"empty base", `{}`, `{"a":1}`, `{"a":1}`},
+		{"null base", `null`, `{"a":1}`, `{"a":1}`},
+		{"replace value", `{"a":1,"b":2}`, `{"a":3}`, `{"a":3,"b":2}`},
+		{"nested objects", `{"a":{"x":1,"y":2}}`, `{"a":{"y":3,"z":4}}`, `{"a":{"x":1,"y":3,"z":4}}`},
+		{"deeply nested", `{"a":{"b":{"c":1,"d":2}}}`, `{"a":{"b":{"d":3}}}`, `{"a":{"b":{"c":1,"d":3}}}`},
+		{"arrays are replaced", `{"a":[1,2,3]}`, `{"a":[4]}`, `{"a":[4]}`},
+		{"null removes", `{"a":1,"b":2}`, `{"a":null}`, `{"b":2}`},
+		{"nested null removes", `{"a":{"x":1,"y":2}}`, `{"a":{"x":null}}`, `{"a":{"y":2}}`},
+		{"null for missing key", `{"a":1}`, `{"b":null}`, `{"a":1}`},
+		{"object replaces value", `{"a":1}`, `{"a":{"x":1}}`, `{"a":{"x":1}}`},
+		{"value replaces object", `{"a":{"x":1}}`, `{"a":1}`, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var base, overlay, want map[string]interface{}
+			for _, v := range []struct {
+				raw string
+				dst *map[string]interface{}
+			}{{tt.base, &base}, {tt.overlay, &overlay}, {tt.want, &want}} {
+				if err := json.Unmarshal([]byte(v.raw), v.dst); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := DeepMerge(base, overlay); !reflect.DeepEqual(got, want) {
+				t.Errorf("DeepMerge() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPlatformMatches(t *testing.T) {
+	tests := []struct {
+		target   string
+		platform string
+		match    bool
+	}{
+		{"darwin", "darwin", true},
+		{"ubuntu", "ubuntu", true},
+		{"ubuntu", "centos", false},
+		{PlatformPosix, "darwin", true},
+		{PlatformPosix, "ubuntu", true},
+		{PlatformPosix, "windows", false},
+		{PlatformLinux, "ubuntu", true},
+		{PlatformLinux, "darwin", false},
+		{PlatformLinux, "freebsd", false},
+		{PlatformLinux, "windows", false},
+	}
+	for _, tt := range tests {
+		if got := PlatformMatches(tt.target, tt.platform); got != tt.match {
+			t.Errorf("PlatformMatches(%s, %s) = %v, want %v", tt.target, tt.platform, got, tt.match)
+		}
+	}
+}
+
+func TestValidateOverlay(t *testing.T) {
+	tests := []struct {
+		name   string
+		otype  string
+		target string
+		value  string
+		err    bool
+	}{
+		{"options", OverlayPlatform, "darwin", `{"options":{"logger_tls_period":60}}`, false},
+		{"partial schedule", OverlayTag, "team=payments", `{"schedule":{"uptime":{"interval":60}}}`, false},
+		{"remove section", OverlayNode, "node-uuid", `{"yara":null}`, false},
+		{"empty target", OverlayPlatform, "", `{}`, true},
+		{"invalid tag", OverlayTag, "team=", `{}`, true},
+		{"unknown type", "group", "all", `{}`, true},
+		{"not an object", OverlayNode, "node-uuid", `[]`, true},
+		{"unknown section", OverlayNode, "node-uuid", `{"nothing":{}}`, true},
+		{"invalid options", OverlayNode, "node-uuid", `{"options":[]}`, true},
+		{"invalid schedule", OverlayNode, "node-uuid", `{"schedule":[]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateOverlay(tt.otype, tt.target, json.RawMessage(tt.value)); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestApplyOverlays(t *testing.T) {
+	conf, err := ParseConfiguration([]byte(`{
+		"options": {"logger_tls_period": 10, "host_identifier": "uuid"},
+		"schedule": {"uptime": {"query": "SELECT * FROM uptime;", "interval": 3600}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := conf.ApplyOverlays([]ConfigOverlay{
+		{Type: OverlayPlatform, Target: "darwin", Value: `{"options":{"logger_tls_period":60}}`},
+		{Type: OverlayNode, Target: "node-uuid", Value: `{"schedule":{"uptime":{"interval":60}},"options":{"host_identifier":null}}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := json.Marshal(merged.Options); string(v) != `{"logger_tls_period":60}` {
+		t.Errorf("options %s", string(v))
+	}
+	if q := merged.Schedule["uptime"]; q.Interval != 60 || q.Query != "SELECT * FROM uptime;" {
+		t.Errorf("schedule %+v", q)
+	}
+	// The configuration of the environment does not change
+	if conf.Schedule["uptime"].Interval != 3600 {
+		t.Errorf("base configuration changed %+v", conf.Schedule["uptime"])
+	}
+	if _, err := conf.ApplyOverlays([]ConfigOverlay{{Type: OverlayNode, Target: "node-uuid", Value: `{`}}); err == nil {
+		t.Error("expected error for invalid overlay")
+	}
+}
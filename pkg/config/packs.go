@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SharedPack to store a pack once, so it can be attached to many environments
+type SharedPack struct {
+	gorm.Model
+	Name        string `gorm:"unique;index"`
+	Description string
+	Value       string
+}
+
+// PackAttachment to link one shared pack with one environment
+type PackAttachment struct {
+	gorm.Model
+	Pack        string `gorm:"index"`
+	Environment string `gorm:"index"`
+}
+
+// Packs keeps all the shared packs and the environments using them
+type Packs struct {
+	DB *gorm.DB
+}
+
+// CreatePacks to initialize the packs struct and tables
+func CreatePacks(backend *gorm.DB) *Packs {
+	var p *Packs
+	p = &Packs{DB: backend}
+	// table shared_packs
+	if err := backend.AutoMigrate(SharedPack{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (shared_packs): %v", err)
+	}
+	// table pack_attachments
+	if err := backend.AutoMigrate(PackAttachment{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (pack_attachments): %v", err)
+	}
+	return p
+}
+
+// Pack parses the value of a shared pack
+func (s SharedPack) Pack() (Pack, error) {
+	return ParsePack(s.Name, json.RawMessage(s.Value))
+}
+
+// Get a shared pack by name
+func (p *Packs) Get(name string) (SharedPack, error) {
+	var pack SharedPack
+	if err := p.DB.Where("name = ?", name).First(&pack).Error; err != nil {
+		return pack, err
+	}
+	return pack, nil
+}
+
+// Exists checks if a shared pack exists
+func (p *Packs) Exists(name string) bool {
+	var results int
+	p.DB.Model(&SharedPack{}).Where("name = ?", name).Count(&results)
+	return (results > 0)
+}
+
+// All gets all the shared packs
+func (p *Packs) All() ([]SharedPack, error) {
+	var packs []SharedPack
+	if err := p.DB.Order("name").Find(&packs).Error; err != nil {
+		return packs, err
+	}
+	return packs, nil
+}
+
+// Create validates and stores a new shared pack
+func (p *Packs) Create(name, description string, value json.RawMessage) error {
+	if name == "" {
+		return fmt.Errorf("empty pack name")
+	}
+	if p.Exists(name) {
+		return fmt.Errorf("pack %s already exists", name)
+	}
+	if _, err := ParsePack(name, value); err != nil {
+		return err
+	}
+	pack := SharedPack{
+		Name:        name,
+		Description: description,
+		Value:       string(value),
+	}
+	if p.DB.NewRecord(pack) {
+		if err := p.DB.Create(&pack).Error; err != nil {
+			return fmt.Errorf("Create SharedPack %v", err)
+		}
+	} else {
+		return fmt.Errorf("p.DB.NewRecord did not return true")
+	}
+	return nil
+}
+
+// Update validates and replaces the description and the value of a shared pack
+func (p *Packs) Update(name, description string, value json.RawMessage) error {
+	pack, err := p.Get(name)
+	if err != nil {
+		return err
+	}
+	if _, err := ParsePack(name, value); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"description": description,
+		"value":       string(value),
+	}
+	if err := p.DB.Model(&pack).Updates(updates).Error; err != nil {
+		return fmt.Errorf("Updates %v", err)
+	}
+	return nil
+}
+
+// Delete a shared pack and detach it from all environments
+func (p *Packs) Delete(name string) error {
+	tx := p.DB.Begin()
+	if err := tx.Unscoped().Where("pack = ?", name).Delete(&PackAttachment{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Delete %v", err)
+	}
+	if err := tx.Unscoped().Where("name = ?", name).Delete(&SharedPack{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Delete %v", err)
+	}
+	return tx.Commit().Error
+}
+
+// IsAttached checks if a shared pack is attached to an environment
+func (p *Packs) IsAttached(name, environment string) bool {
+	var results int
+	p.DB.Model(&PackAttachment{}).Where("pack = ? AND environment = ?", name, environment).Count(&results)
+	return (results > 0)
+}
+
+// Attach a shared pack to an environment
+func (p *Packs) Attach(name, environment string) error {
+	if !p.Exists(name) {
+		return fmt.Errorf("pack %s does not exist", name)
+	}
+	if p.IsAttached(name, environment) {
+		return nil
+	}
+	attachment := PackAttachment{
+		Pack:        name,
+		Environment: environment,
+	}
+	if err := p.DB.Create(&attachment).Error; err != nil {
+		return fmt.Errorf("Create PackAttachment %v", err)
+	}
+	return nil
+}
+
+// Detach a shared pack from an environment
+func (p *Packs) Detach(name, environment string) error {
+	if err := p.DB.Unscoped().Where("pack = ? AND environment = ?", name, environment).Delete(&PackAttachment{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// SetEnvironments attaches a shared pack to the provided environments and detaches it from the rest
+func (p *Packs) SetEnvironments(name string, environments []string) error {
+	current, err := p.Environments(name)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, e := range environments {
+		keep[e] = true
+		if err := p.Attach(name, e); err != nil {
+			return err
+		}
+	}
+	for _, e := range current {
+		if keep[e] {
+			continue
+		}
+		if err := p.Detach(name, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DetachAll removes all the shared packs from an environment
+func (p *Packs) DetachAll(environment string) error {
+	if err := p.DB.Unscoped().Where("environment = ?", environment).Delete(&PackAttachment{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// Attached gets all the shared packs attached to an environment
+func (p *Packs) Attached(environment string) ([]SharedPack, error) {
+	var packs []SharedPack
+	err := p.DB.Where("name IN (?)", p.DB.Table("pack_attachments").Select("pack").Where("environment = ? AND deleted_at IS NULL", environment).QueryExpr()).Order("name").Find(&packs).Error
+	if err != nil {
+		return packs, err
+	}
+	return packs, nil
+}
+
+// Environments gets the names of all the environments where a shared pack is attached
+func (p *Packs) Environments(name string) ([]string, error) {
+	var attachments []PackAttachment
+	var envs []string
+	if err := p.DB.Where("pack = ?", name).Order("environment").Find(&attachments).Error; err != nil {
+		return envs, err
+	}
+	for _, a := range attachments {
+		envs = append(envs, a.Environment)
+	}
+	return envs, nil
+}
+
+// MergePacks adds shared packs to the configuration
+// Packs defined in the configuration of the environment take precedence over shared packs with the same name
+func (conf *OsqueryConf) MergePacks(packs []SharedPack) {
+	for _, p := range packs {
+		if _, ok := conf.Packs[p.Name]; ok {
+			continue
+		}
+		if conf.Packs == nil {
+			conf.Packs = make(map[string]json.RawMessage)
+		}
+		conf.Packs[p.Name] = json.RawMessage(p.Value)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePacks(t *testing.T) {
+	shared := []SharedPack{
+		{Name: "procs", Value: `{"queries": {"shared": {"query": "SELECT * FROM processes;", "interval": 60}}}`},
+		{Name: "users", Value: `{"queries": {"users": {"query": "SELECT * FROM users;", "interval": 60}}}`},
+	}
+	tests := []struct {
+		name  string
+		packs map[string]json.RawMessage
+		want  map[string]string
+	}{
+		{
+			"without packs",
+			nil,
+			map[string]string{"procs": shared[0].Value, "users": shared[1].Value},
+		},
+		{
+			"environment pack takes precedence",
+			map[string]json.RawMessage{"procs": json.RawMessage(`"/etc/osquery/packs/procs.conf"`)},
+			map[string]string{"procs": `"/etc/osquery/packs/procs.conf"`, "users": shared[1].Value},
+		},
+		{
+			"other environment packs are kept",
+			map[string]json.RawMessage{"local": json.RawMessage(`"/etc/osquery/packs/local.conf"`)},
+			map[string]string{"local": `"/etc/osquery/packs/local.conf"`, "procs": shared[0].Value, "users": shared[1].Value},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := OsqueryConf{Packs: tt.packs}
+			conf.MergePacks(shared)
+			got := make(map[string]string)
+			for n, p := range conf.Packs {
+				got[n] = string(p)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("packs %v, want %v", got, tt.want)
+			}
+			if err := conf.Validate(); err != nil {
+				t.Errorf("merged configuration is invalid - %v", err)
+			}
+		})
+	}
+	// Merging without shared packs does not create the section
+	var conf OsqueryConf
+	conf.MergePacks(nil)
+	if conf.Packs != nil {
+		t.Errorf("unexpected packs %v", conf.Packs)
+	}
+}
+
+func TestSharedPack(t *testing.T) {
+	p, err := SharedPack{Name: "procs", Value: `{"platform": "linux", "queries": {"q": {"query": "SELECT 1;", "interval": 60}}}`}.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Platform != "linux" || len(p.Queries) != 1 {
+		t.Errorf("unexpected pack %+v", p)
+	}
+	if _, err := (SharedPack{Name: "procs", Value: `{"queries": {"q": {"query": "SELECT 1;"}}}`}).Pack(); err == nil {
+		t.Error("expected error for invalid pack")
+	}
+}
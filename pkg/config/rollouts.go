@@ -0,0 +1,185 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/pkg/nodes"
+)
+
+// Status of configuration rollouts
+const (
+	RolloutActive   string = "active"
+	RolloutPromoted string = "promoted"
+	RolloutAborted  string = "aborted"
+)
+
+// Unique index for the active rollout of each environment, so concurrent starts can not create two
+const rolloutActiveIndex string = "CREATE UNIQUE INDEX IF NOT EXISTS idx_config_rollouts_active ON config_rollouts (environment) WHERE status = 'active' AND deleted_at IS NULL"
+
+// ConfigRollout to serve a candidate configuration to a cohort of nodes before the whole environment
+// Nodes are selected by Tag, a tag expression, when it is set, otherwise by a hash of the UUID below Percentage
+type ConfigRollout struct {
+	gorm.Model
+	Environment   string `gorm:"index"`
+	Configuration string
+	BaseRevision  int
+	Percentage    int
+	Tag           string
+	Status        string
+	Author        string
+	Comment       string
+	Finished      time.Time
+}
+
+// Rollouts keeps all the configuration rollouts by environment
+type Rollouts struct {
+	DB *gorm.DB
+}
+
+// CreateRollouts to initialize the rollouts struct and tables
+func CreateRollouts(backend *gorm.DB) *Rollouts {
+	var r *Rollouts
+	r = &Rollouts{DB: backend}
+	// table config_rollouts
+	if err := backend.AutoMigrate(ConfigRollout{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (config_rollouts): %v", err)
+	}
+	if err := backend.Exec(rolloutActiveIndex).Error; err != nil {
+		log.Fatalf("Failed to create index for active rollouts: %v", err)
+	}
+	return r
+}
+
+// UUIDBucket maps a node UUID to a bucket between 0 and 99
+// The same UUID always lands in the same bucket, so raising the percentage keeps the current cohort
+func UUIDBucket(uuid string) int {
+	hash := sha1.Sum([]byte(strings.ToUpper(uuid)))
+	return int(binary.BigEndian.Uint32(hash[:4]) % 100)
+}
+
+// InCohort checks if a node receives the candidate configuration of the rollout
+func (r ConfigRollout) InCohort(node OverlayNodeData) bool {
+	if r.Tag != "" {
+		ok, _ := nodes.MatchTags(r.Tag, node.Tags)
+		return ok
+	}
+	return UUIDBucket(node.UUID) < r.Percentage
+}
+
+// Candidate parses the candidate configuration of the rollout
+func (r ConfigRollout) Candidate() (OsqueryConf, error) {
+	return ParseConfiguration([]byte(r.Configuration))
+}
+
+// Target returns a readable description of the nodes in the cohort
+func (r ConfigRollout) Target() string {
+	if r.Tag != "" {
+		return "tag " + r.Tag
+	}
+	return fmt.Sprintf("%d%% of nodes", r.Percentage)
+}
+
+// CanPromote checks that the configuration did not change since the rollout started
+// It gets the latest revision that changed the configuration, revisions changing only flags or intervals are fine
+// Promoting after a configuration change would overwrite it with the candidate, based on an older revision
+func (r ConfigRollout) CanPromote(configuration int) error {
+	if configuration > r.BaseRevision {
+		return fmt.Errorf("configuration changed in revision %d after the rollout started from revision %d, abort and start a new rollout", configuration, r.BaseRevision)
+	}
+	return nil
+}
+
+// Active gets the active rollout of an environment
+func (r *Rollouts) Active(environment string) (ConfigRollout, error) {
+	var rollout ConfigRollout
+	if err := r.DB.Where("environment = ? AND status = ?", environment, RolloutActive).First(&rollout).Error; err != nil {
+		return rollout, err
+	}
+	return rollout, nil
+}
+
+// Cohort gets the active rollout of an environment, if the node is part of its cohort
+func (r *Rollouts) Cohort(environment string, node OverlayNodeData) (ConfigRollout, bool) {
+	rollout, err := r.Active(environment)
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			log.Printf("error getting rollout for %s - %v", environment, err)
+		}
+		return rollout, false
+	}
+	return rollout, rollout.InCohort(node)
+}
+
+// All gets all the rollouts of an environment, newest first
+func (r *Rollouts) All(environment string) ([]ConfigRollout, error) {
+	var rollouts []ConfigRollout
+	if err := r.DB.Where("environment = ?", environment).Order("created_at desc").Find(&rollouts).Error; err != nil {
+		return rollouts, err
+	}
+	return rollouts, nil
+}
+
+// Start validates and stores a new rollout, only one can be active for each environment
+func (r *Rollouts) Start(environment string, configuration []byte, base, percentage int, tag, author, comment string) (ConfigRollout, error) {
+	rollout := ConfigRollout{
+		Environment:   environment,
+		Configuration: string(configuration),
+		BaseRevision:  base,
+		Percentage:    percentage,
+		Tag:           strings.TrimSpace(tag),
+		Status:        RolloutActive,
+		Author:        author,
+		Comment:       comment,
+	}
+	if rollout.Tag != "" {
+		if _, err := nodes.ParseTagExpression(rollout.Tag); err != nil {
+			return rollout, fmt.Errorf("invalid rollout tag - %v", err)
+		}
+		rollout.Percentage = 0
+	} else if percentage < 1 || percentage > 100 {
+		return rollout, fmt.Errorf("rollout percentage must be between 1 and 100")
+	}
+	if _, err := rollout.Candidate(); err != nil {
+		return rollout, err
+	}
+	if _, err := r.Active(environment); err == nil {
+		return rollout, fmt.Errorf("rollout already active for %s", environment)
+	}
+	// The unique index rejects the rollout if another one was started after the check
+	if err := r.DB.Create(&rollout).Error; err != nil {
+		if _, errActive := r.Active(environment); errActive == nil {
+			return rollout, fmt.Errorf("rollout already active for %s", environment)
+		}
+		return rollout, fmt.Errorf("Create ConfigRollout %v", err)
+	}
+	return rollout, nil
+}
+
+// Finish sets the final status of the active rollout of an environment
+func (r *Rollouts) Finish(environment, status string) (ConfigRollout, error) {
+	rollout, err := r.Active(environment)
+	if err != nil {
+		return rollout, err
+	}
+	if err := r.DB.Model(&rollout).Updates(map[string]interface{}{
+		"status":   status,
+		"finished": time.Now(),
+	}).Error; err != nil {
+		return rollout, fmt.Errorf("Updates %v", err)
+	}
+	return rollout, nil
+}
+
+// DeleteAll removes all the rollouts of an environment
+func (r *Rollouts) DeleteAll(environment string) error {
+	if err := r.DB.Unscoped().Where("environment = ?", environment).Delete(&ConfigRollout{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
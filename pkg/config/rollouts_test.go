@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestUUIDBucket(t *testing.T) {
+	for _, uuid := range []string{"", "node-uuid", "00000000-0000-0000-0000-000000000000"} {
+		b := UUIDBucket(uuid)
+		if b < 0 || b > 99 {
+			t.Errorf("UUIDBucket(%s) = %d, out of range", uuid, b)
+		}
+	}
+	if UUIDBucket("node-uuid") != UUIDBucket("NODE-UUID") {
+		t.Error("expected the same bucket regardless of case")
+	}
+}
+
+func TestInCohort(t *testing.T) {
+	node := OverlayNodeData{UUID: "node-uuid", Platform: "darwin", Tags: map[string]string{"team": "payments"}}
+	bucket := UUIDBucket(node.UUID)
+	tests := []struct {
+		name    string
+		rollout ConfigRollout
+		cohort  bool
+	}{
+		{"all nodes", ConfigRollout{Percentage: 100}, true},
+		{"below bucket", ConfigRollout{Percentage: bucket}, false},
+		{"above bucket", ConfigRollout{Percentage: bucket + 1}, true},
+		{"matching tag", ConfigRollout{Tag: "team=payments"}, true},
+		{"other tag", ConfigRollout{Tag: "team=search", Percentage: 100}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rollout.InCohort(node); got != tt.cohort {
+				t.Errorf("InCohort() = %v, want %v", got, tt.cohort)
+			}
+		})
+	}
+}
+
+func TestCanPromote(t *testing.T) {
+	rollout := ConfigRollout{BaseRevision: 3}
+	tests := []struct {
+		name          string
+		configuration int
+		promote       bool
+	}{
+		{"configuration of the base revision", 3, true},
+		{"configuration of an older revision", 1, true},
+		{"configuration changed", 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := rollout.CanPromote(tt.configuration); (err == nil) != tt.promote {
+				t.Errorf("CanPromote(%d) = %v, want promote %v", tt.configuration, err, tt.promote)
+			}
+		})
+	}
+}
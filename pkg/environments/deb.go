@@ -0,0 +1,60 @@
+package environments
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+const (
+	// DebControlTemplate for the control file of deb packages
+	DebControlTemplate string = `Package: %s
+Version: %s
+Architecture: all
+Maintainer: %s
+Depends: osquery
+Section: admin
+Priority: optional
+Installed-Size: %d
+Description: %s
+ Flagfile, enroll secret, certificate and systemd unit of osquery.
+`
+)
+
+// Helper to add one member to an ar archive
+func arMember(buf *bytes.Buffer, name string, modTime time.Time, data []byte) {
+	fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, modTime.Unix(), 0, 0, 0100644, len(data))
+	buf.Write(data)
+	// Members are aligned to 2 bytes
+	if len(data)%2 != 0 {
+		buf.WriteByte('\n')
+	}
+}
+
+// Helper to generate a deb package, an ar archive with debian-binary, control.tar.gz and data.tar.gz
+func buildDeb(pkg Package) ([]byte, error) {
+	size := 0
+	for _, f := range pkg.Files {
+		size += len(f.Data)
+	}
+	control := fmt.Sprintf(DebControlTemplate, pkg.Name, pkg.Version, pkg.Project, (size+1023)/1024, pkg.Summary)
+	controlTar, err := packageTarGz([]PackageFile{
+		{Path: "/control", Mode: 0644, Data: []byte(control)},
+		{Path: "/preinst", Mode: 0755, Data: []byte(linuxPreinst)},
+		{Path: "/postinst", Mode: 0755, Data: []byte(linuxPostinst)},
+		{Path: "/prerm", Mode: 0755, Data: []byte(debPrerm)},
+	}, "./", pkg.Built)
+	if err != nil {
+		return nil, err
+	}
+	dataTar, err := packageTarGz(pkg.Files, "./", pkg.Built)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	arMember(&buf, "debian-binary", pkg.Built, []byte("2.0\n"))
+	arMember(&buf, "control.tar.gz", pkg.Built, controlTar)
+	arMember(&buf, "data.tar.gz", pkg.Built, dataTar)
+	return buf.Bytes(), nil
+}
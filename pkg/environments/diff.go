@@ -0,0 +1,83 @@
+package environments
+
+import (
+	"strings"
+)
+
+// Types of lines in a diff
+const (
+	DiffEqual   string = " "
+	DiffAdded   string = "+"
+	DiffRemoved string = "-"
+)
+
+// DiffLine for each line of a diff
+type DiffLine struct {
+	Type string `json:"type"`
+	Line string `json:"line"`
+}
+
+// Diff compares two texts line by line, using the longest common subsequence
+func Diff(a, b string) []DiffLine {
+	linesA := strings.Split(a, "\n")
+	linesB := strings.Split(b, "\n")
+	var prefix, suffix []DiffLine
+	// Common lines at the beginning and the end do not need to be compared
+	for len(linesA) > 0 && len(linesB) > 0 && linesA[0] == linesB[0] {
+		prefix = append(prefix, DiffLine{Type: DiffEqual, Line: linesA[0]})
+		linesA, linesB = linesA[1:], linesB[1:]
+	}
+	for len(linesA) > 0 && len(linesB) > 0 && linesA[len(linesA)-1] == linesB[len(linesB)-1] {
+		suffix = append([]DiffLine{{Type: DiffEqual, Line: linesA[len(linesA)-1]}}, suffix...)
+		linesA, linesB = linesA[:len(linesA)-1], linesB[:len(linesB)-1]
+	}
+	// Length of the longest common subsequence from each position
+	lcs := make([][]int32, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	diff := prefix
+	i, j := 0, 0
+	for i < len(linesA) && j < len(linesB) {
+		switch {
+		case linesA[i] == linesB[j]:
+			diff = append(diff, DiffLine{Type: DiffEqual, Line: linesA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Type: DiffRemoved, Line: linesA[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Type: DiffAdded, Line: linesB[j]})
+			j++
+		}
+	}
+	for ; i < len(linesA); i++ {
+		diff = append(diff, DiffLine{Type: DiffRemoved, Line: linesA[i]})
+	}
+	for ; j < len(linesB); j++ {
+		diff = append(diff, DiffLine{Type: DiffAdded, Line: linesB[j]})
+	}
+	return append(diff, suffix...)
+}
+
+// Changed checks if a diff has added or removed lines
+func Changed(diff []DiffLine) bool {
+	for _, l := range diff {
+		if l.Type != DiffEqual {
+			return true
+		}
+	}
+	return false
+}
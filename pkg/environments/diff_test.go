@@ -0,0 +1,80 @@
+package environments
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Helper to show a diff as lines prefixed with their type
+func diffLines(diff []DiffLine) []string {
+	var lines []string
+	for _, l := range diff {
+		lines = append(lines, l.Type+l.Line)
+	}
+	return lines
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []string
+	}{
+		{"equal", "a\nb", "a\nb", []string{" a", " b"}},
+		{"added line", "a\nc", "a\nb\nc", []string{" a", "+b", " c"}},
+		{"removed line", "a\nb\nc", "a\nc", []string{" a", "-b", " c"}},
+		{"changed line", "a\nb\nc", "a\nx\nc", []string{" a", "-b", "+x", " c"}},
+		{"from empty", "", "a", []string{"-", "+a"}},
+		{"all different", "a\nb", "c\nd", []string{"-a", "-b", "+c", "+d"}},
+		{
+			"common lines in the middle",
+			"x\na\nb\ny\nc",
+			"a\nz\nb\nc\nw",
+			[]string{"-x", " a", "+z", " b", "-y", " c", "+w"},
+		},
+		{
+			"moved block",
+			"{\n  \"a\": 1,\n  \"b\": 2\n}",
+			"{\n  \"b\": 2,\n  \"a\": 1\n}",
+			[]string{" {", "-  \"a\": 1,", "-  \"b\": 2", "+  \"b\": 2,", "+  \"a\": 1", " }"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Diff(tt.a, tt.b)
+			if got := diffLines(diff); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+			if Changed(diff) != (tt.a != tt.b) {
+				t.Errorf("Changed() = %v", Changed(diff))
+			}
+		})
+	}
+}
+
+func TestDiffReconstruct(t *testing.T) {
+	a := strings.Repeat("line\nother\n", 50) + "end"
+	b := strings.Repeat("other\nline\nnew\n", 40) + "end"
+	var gotA, gotB []string
+	equal := 0
+	for _, l := range Diff(a, b) {
+		if l.Type != DiffAdded {
+			gotA = append(gotA, l.Line)
+		}
+		if l.Type != DiffRemoved {
+			gotB = append(gotB, l.Line)
+		}
+		if l.Type == DiffEqual {
+			equal++
+		}
+	}
+	// Both texts can be rebuilt from the diff, and the common lines are the longest subsequence
+	if strings.Join(gotA, "\n") != a || strings.Join(gotB, "\n") != b {
+		t.Fatal("texts can not be rebuilt from the diff")
+	}
+	if equal != 81 {
+		t.Errorf("%d equal lines, want 81", equal)
+	}
+}
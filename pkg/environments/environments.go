@@ -87,6 +87,14 @@ func CreateEnvironment(backend *gorm.DB) *Environment {
 	if err := backend.AutoMigrate(TLSEnvironment{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (tls_environments): %v", err)
 	}
+	// table revisions
+	if err := backend.AutoMigrate(Revision{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (revisions): %v", err)
+	}
+	// table enroll_secrets
+	if err := backend.AutoMigrate(EnrollSecret{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (enroll_secrets): %v", err)
+	}
 	return e
 }
 
@@ -221,16 +229,20 @@ func (environment *Environment) UpdateCertificate(name, certificate string) erro
 	return nil
 }
 
-// UpdateFlags to update flags for an environment
-func (environment *Environment) UpdateFlags(name, flags string) error {
+// UpdateFlags to validate and update flags for an environment, warnings for unknown flags are returned
+func (environment *Environment) UpdateFlags(name, flags string) ([]string, error) {
+	warnings, err := ValidateFlags(flags)
+	if err != nil {
+		return nil, err
+	}
 	env, err := environment.Get(name)
 	if err != nil {
-		return fmt.Errorf("error getting environment %v", err)
+		return nil, fmt.Errorf("error getting environment %v", err)
 	}
 	if err := environment.DB.Model(&env).Update("flags", flags).Error; err != nil {
-		return fmt.Errorf("Update %v", err)
+		return nil, fmt.Errorf("Update %v", err)
 	}
-	return nil
+	return warnings, nil
 }
 
 // UpdateIntervals to update intervals for an environment
@@ -250,13 +262,18 @@ func (environment *Environment) UpdateIntervals(name string, csecs, lsecs, qsecs
 }
 
 // RotateSecrets to replace Secret and SecretPath for an environment
+// The previous secret is still valid for DefaultSecretOverlap hours
 func (environment *Environment) RotateSecrets(name string) error {
 	env, err := environment.Get(name)
 	if err != nil {
 		return fmt.Errorf("error getting environment %v", err)
 	}
+	if _, err := environment.RotateSecret(name, DefaultSecretOverlap); err != nil {
+		return fmt.Errorf("error rotating secret %v", err)
+	}
 	rotated := env
-	rotated.Secret = generateRandomString(DefaultSecretLength)
+	// Secret was already replaced, empty values are not updated
+	rotated.Secret = ""
 	rotated.EnrollSecretPath = generateKSUID()
 	rotated.RemoveSecretPath = generateKSUID()
 	rotated.EnrollExpire = time.Now().Add(time.Duration(DefaultLinkExpire) * time.Hour)
@@ -282,21 +299,6 @@ func (environment *Environment) RotateEnrollPath(name string) error {
 	return nil
 }
 
-// RotateSecret to replace the current Secret for an environment
-func (environment *Environment) RotateSecret(name string) error {
-	env, err := environment.Get(name)
-	if err != nil {
-		return fmt.Errorf("error getting environment %v", err)
-	}
-	rotated := env
-	rotated.Secret = generateRandomString(DefaultSecretLength)
-	rotated.EnrollExpire = time.Now().Add(time.Duration(DefaultLinkExpire) * time.Hour)
-	if err := environment.DB.Model(&env).Updates(rotated).Error; err != nil {
-		return fmt.Errorf("Updates %v", err)
-	}
-	return nil
-}
-
 // ExpireEnroll to expire the enroll in an environment
 func (environment *Environment) ExpireEnroll(name string) error {
 	env, err := environment.Get(name)
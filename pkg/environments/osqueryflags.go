@@ -0,0 +1,303 @@
+package environments
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of values for osquery flags
+const (
+	FlagBool   string = "bool"
+	FlagInt    string = "int"
+	FlagString string = "string"
+)
+
+// Platforms with their own paths in the flagfile
+const (
+	FlagsWindows string = "windows"
+	FlagsDarwin  string = "darwin"
+	FlagsLinux   string = "linux"
+	FlagsFreeBSD string = "freebsd"
+)
+
+// OsqueryFlag describes one flag that osquery understands
+// CLI flags can only be set in the flagfile, the rest can be served with the options of the configuration
+type OsqueryFlag struct {
+	Type string
+	CLI  bool
+}
+
+// Flag with one value of a flagfile
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// KnownFlags with the osquery flags that can be used in environments
+var KnownFlags = map[string]OsqueryFlag{
+	// Daemon and general behavior
+	"host_identifier":                  {Type: FlagString, CLI: true},
+	"specified_identifier":             {Type: FlagString},
+	"force":                            {Type: FlagBool, CLI: true},
+	"utc":                              {Type: FlagBool},
+	"verbose":                          {Type: FlagBool},
+	"debug":                            {Type: FlagBool, CLI: true},
+	"daemonize":                        {Type: FlagBool, CLI: true},
+	"pidfile":                          {Type: FlagString, CLI: true},
+	"database_path":                    {Type: FlagString, CLI: true},
+	"disable_database":                 {Type: FlagBool, CLI: true},
+	"ephemeral":                        {Type: FlagBool, CLI: true},
+	"extensions_socket":                {Type: FlagString, CLI: true},
+	"extensions_autoload":              {Type: FlagString, CLI: true},
+	"extensions_timeout":               {Type: FlagInt, CLI: true},
+	"extensions_interval":              {Type: FlagInt, CLI: true},
+	"extensions_require":               {Type: FlagString, CLI: true},
+	"disable_extensions":               {Type: FlagBool, CLI: true},
+	"disable_watchdog":                 {Type: FlagBool, CLI: true},
+	"watchdog_level":                   {Type: FlagInt, CLI: true},
+	"watchdog_memory_limit":            {Type: FlagInt, CLI: true},
+	"watchdog_utilization_limit":       {Type: FlagInt, CLI: true},
+	"watchdog_delay":                   {Type: FlagInt, CLI: true},
+	"schedule_splay_percent":           {Type: FlagInt},
+	"schedule_default_interval":        {Type: FlagInt},
+	"schedule_timeout":                 {Type: FlagInt},
+	"schedule_max_drift":               {Type: FlagInt},
+	"schedule_reload":                  {Type: FlagInt},
+	"pack_refresh_interval":            {Type: FlagInt},
+	"pack_delimiter":                   {Type: FlagString},
+	"table_delay":                      {Type: FlagInt},
+	"read_max":                         {Type: FlagInt},
+	"hash_cache_max":                   {Type: FlagInt},
+	"disable_tables":                   {Type: FlagString},
+	"enable_tables":                    {Type: FlagString},
+	"disable_audit":                    {Type: FlagBool},
+	"disable_events":                   {Type: FlagBool},
+	"events_expiry":                    {Type: FlagInt},
+	"events_max":                       {Type: FlagInt},
+	"enable_file_events":               {Type: FlagBool},
+	"enable_bpf_events":                {Type: FlagBool},
+	"enable_syslog":                    {Type: FlagBool},
+	"enable_windows_events_publisher":  {Type: FlagBool},
+	"enable_windows_events_subscriber": {Type: FlagBool},
+	"windows_event_channels":           {Type: FlagString},
+	"audit_allow_config":               {Type: FlagBool},
+	"audit_allow_sockets":              {Type: FlagBool},
+	"audit_allow_process_events":       {Type: FlagBool},
+	"audit_persist":                    {Type: FlagBool},
+	"yara_delay":                       {Type: FlagInt},
+	"disable_hash_cache":               {Type: FlagBool},
+	"decorations_top_level":            {Type: FlagBool},
+	// Enrollment and TLS
+	"enroll_secret_path":      {Type: FlagString, CLI: true},
+	"enroll_secret_env":       {Type: FlagString, CLI: true},
+	"enroll_tls_endpoint":     {Type: FlagString, CLI: true},
+	"enroll_always":           {Type: FlagBool, CLI: true},
+	"disable_enrollment":      {Type: FlagBool, CLI: true},
+	"tls_hostname":            {Type: FlagString, CLI: true},
+	"tls_server_certs":        {Type: FlagString, CLI: true},
+	"tls_client_cert":         {Type: FlagString, CLI: true},
+	"tls_client_key":          {Type: FlagString, CLI: true},
+	"tls_enroll_max_attempts": {Type: FlagInt},
+	"tls_enroll_max_interval": {Type: FlagInt},
+	"tls_dump":                {Type: FlagBool},
+	"tls_session_reuse":       {Type: FlagBool},
+	"tls_session_timeout":     {Type: FlagInt},
+	"proxy_hostname":          {Type: FlagString, CLI: true},
+	// Configuration
+	"config_plugin":                  {Type: FlagString, CLI: true},
+	"config_path":                    {Type: FlagString, CLI: true},
+	"config_check":                   {Type: FlagBool, CLI: true},
+	"config_dump":                    {Type: FlagBool, CLI: true},
+	"config_refresh":                 {Type: FlagInt},
+	"config_accelerated_refresh":     {Type: FlagInt},
+	"config_enable_backup":           {Type: FlagBool},
+	"config_tls_endpoint":            {Type: FlagString, CLI: true},
+	"config_tls_refresh":             {Type: FlagInt},
+	"config_tls_accelerated_refresh": {Type: FlagInt},
+	"config_tls_max_attempts":        {Type: FlagInt},
+	// Logging
+	"logger_plugin":                {Type: FlagString, CLI: true},
+	"logger_path":                  {Type: FlagString, CLI: true},
+	"logger_mode":                  {Type: FlagString, CLI: true},
+	"logger_min_status":            {Type: FlagInt},
+	"logger_min_stderr":            {Type: FlagInt},
+	"logger_event_type":            {Type: FlagBool},
+	"logger_snapshot_event_type":   {Type: FlagBool},
+	"logger_secondary_status_only": {Type: FlagBool},
+	"logger_rotate":                {Type: FlagBool},
+	"logger_rotate_size":           {Type: FlagInt},
+	"logger_rotate_max_files":      {Type: FlagInt},
+	"logger_tls_endpoint":          {Type: FlagString, CLI: true},
+	"logger_tls_period":            {Type: FlagInt},
+	"logger_tls_compress":          {Type: FlagBool},
+	"logger_tls_max_lines":         {Type: FlagInt},
+	"logger_tls_max_linesize":      {Type: FlagInt},
+	"buffered_log_max":             {Type: FlagInt},
+	"disable_logging":              {Type: FlagBool},
+	"log_result_events":            {Type: FlagBool},
+	"value_max":                    {Type: FlagInt},
+	// Distributed queries
+	"disable_distributed":            {Type: FlagBool},
+	"distributed_plugin":             {Type: FlagString, CLI: true},
+	"distributed_interval":           {Type: FlagInt},
+	"distributed_denylist_duration":  {Type: FlagInt},
+	"distributed_tls_max_attempts":   {Type: FlagInt},
+	"distributed_tls_read_endpoint":  {Type: FlagString, CLI: true},
+	"distributed_tls_write_endpoint": {Type: FlagString, CLI: true},
+	// File carving
+	"disable_carver":           {Type: FlagBool},
+	"carver_disable_function":  {Type: FlagBool},
+	"carver_start_endpoint":    {Type: FlagString, CLI: true},
+	"carver_continue_endpoint": {Type: FlagString, CLI: true},
+	"carver_block_size":        {Type: FlagInt},
+	"carver_compression":       {Type: FlagBool},
+	"carver_expiry":            {Type: FlagInt},
+}
+
+// Helper to check that a value has the type of the flag
+func checkFlagValue(flag OsqueryFlag, value string) error {
+	switch flag.Type {
+	case FlagBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+	case FlagInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("expected integer")
+		}
+	}
+	return nil
+}
+
+// ParseFlags parses and validates a flagfile, with one --name=value per line
+// Flags without value are booleans set to true, empty lines and comments are skipped
+// Unknown flags are kept as they are, with a warning, because newer osquery versions may add them
+func ParseFlags(text string) ([]Flag, []string, error) {
+	var flags []Flag
+	var warnings []string
+	seen := make(map[string]bool)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return nil, nil, fmt.Errorf("line %d: flags must start with --", i+1)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "--"), "=", 2)
+		name := parts[0]
+		if name == "" {
+			return nil, nil, fmt.Errorf("line %d: flag without name", i+1)
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("line %d: duplicated flag %s", i+1, name)
+		}
+		seen[name] = true
+		known, ok := KnownFlags[name]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("line %d: unknown flag %s", i+1, name))
+			known = OsqueryFlag{Type: FlagBool, CLI: true}
+			if len(parts) == 2 {
+				known.Type = FlagString
+			}
+		}
+		if len(parts) == 1 {
+			if known.Type != FlagBool {
+				return nil, nil, fmt.Errorf("line %d: flag %s needs a value", i+1, name)
+			}
+			flags = append(flags, Flag{Name: name, Value: "true"})
+			continue
+		}
+		if err := checkFlagValue(known, parts[1]); err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid value for %s, %v", i+1, name, err)
+		}
+		flags = append(flags, Flag{Name: name, Value: parts[1]})
+	}
+	return flags, warnings, nil
+}
+
+// ValidateFlags checks that known flags have values of the right type, returning warnings for unknown flags
+func ValidateFlags(text string) ([]string, error) {
+	_, warnings, err := ParseFlags(text)
+	return warnings, err
+}
+
+// RemoteFlags gets the flags that can be served with the options of the configuration, with typed values
+// Nodes with a config refresh interval pick up changes to these flags without updating the flagfile
+// Unknown flags are not served, because they may only work in the flagfile
+func RemoteFlags(text string) (map[string]interface{}, error) {
+	flags, _, err := ParseFlags(text)
+	if err != nil {
+		return nil, err
+	}
+	remote := make(map[string]interface{})
+	for _, f := range flags {
+		known, ok := KnownFlags[f.Name]
+		if !ok || known.CLI {
+			continue
+		}
+		switch known.Type {
+		case FlagBool:
+			remote[f.Name], _ = strconv.ParseBool(f.Value)
+		case FlagInt:
+			remote[f.Name], _ = strconv.ParseInt(f.Value, 10, 64)
+		default:
+			remote[f.Name] = f.Value
+		}
+	}
+	return remote, nil
+}
+
+// FlagNames returns the names of all known flags, sorted
+func FlagNames() []string {
+	var names []string
+	for n := range KnownFlags {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FlagsPaths gets the paths for the secret, certificate and flagfile of osquery in each platform
+// Paths are the same used by the quick add scripts
+func FlagsPaths(platform, project string) (string, string, string, error) {
+	switch platform {
+	case FlagsWindows:
+		base := `C:\Program Files\osquery\`
+		return base + "osquery.secret", base + project + ".crt", base + "osquery.flags", nil
+	case FlagsDarwin:
+		base := "/private/var/osquery/"
+		return base + "osquery.secret", base + "certs/" + project + ".crt", base + "osquery.flags", nil
+	case FlagsLinux:
+		base := "/etc/osquery/"
+		return base + "osquery.secret", base + "certs/" + project + ".crt", base + "osquery.flags", nil
+	case FlagsFreeBSD:
+		base := "/usr/local/etc/"
+		return base + "osquery.secret", base + "certs/" + project + ".crt", base + "osquery.flags", nil
+	}
+	return "", "", "", fmt.Errorf("unknown platform %s", platform)
+}
+
+// PlatformFlags generates the flagfile of an environment for one platform
+// The stored flags keep placeholders for the secret and the certificate, replaced with the paths of the platform
+// Flags are validated when they are updated, so they are used as they are stored
+func PlatformFlags(env TLSEnvironment, platform, project string) (string, error) {
+	secret, cert, _, err := FlagsPaths(platform, project)
+	if err != nil {
+		return "", err
+	}
+	flags := env.Flags
+	if flags == "" {
+		if flags, err = GenerateFlags(env, "", ""); err != nil {
+			return "", err
+		}
+	}
+	flags = strings.Replace(flags, emptyFlagSecret, secret, -1)
+	flags = strings.Replace(flags, emptyFlagCert, cert, -1)
+	if platform == FlagsWindows {
+		flags = strings.Replace(flags, "\n", "\r\n", -1)
+	}
+	return flags, nil
+}
@@ -0,0 +1,110 @@
+package environments
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		flags    []Flag
+		warnings int
+		err      bool
+	}{
+		{"values", "--host_identifier=uuid\n--config_tls_refresh=10", []Flag{{"host_identifier", "uuid"}, {"config_tls_refresh", "10"}}, 0, false},
+		{"comments and empty lines", "# comment\n\n  --utc=true  \n", []Flag{{"utc", "true"}}, 0, false},
+		{"boolean without value", "--verbose", []Flag{{"verbose", "true"}}, 0, false},
+		{"unknown flag", "--utc\n--new_flag=value", []Flag{{"utc", "true"}, {"new_flag", "value"}}, 1, false},
+		{"unknown flag without value", "--new_flag", []Flag{{"new_flag", "true"}}, 1, false},
+		{"empty", "", nil, 0, false},
+		{"missing dashes", "utc=true", nil, 0, true},
+		{"missing name", "--=true", nil, 0, true},
+		{"duplicated", "--utc\n--utc=false", nil, 0, true},
+		{"duplicated unknown", "--new_flag=a\n--new_flag=b", nil, 0, true},
+		{"missing value", "--logger_tls_period", nil, 0, true},
+		{"invalid integer", "--logger_tls_period=often", nil, 0, true},
+		{"invalid boolean", "--utc=maybe", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags, warnings, err := ParseFlags(tt.text)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(flags, tt.flags) {
+				t.Errorf("got flags %v, want %v", flags, tt.flags)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("got warnings %v, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestRemoteFlags(t *testing.T) {
+	remote, err := RemoteFlags("--host_identifier=uuid\n--utc\n--logger_tls_period=60\n--pack_delimiter=/\n--new_flag=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"utc": true, "logger_tls_period": int64(60), "pack_delimiter": "/"}
+	if !reflect.DeepEqual(remote, want) {
+		t.Errorf("got %v, want %v", remote, want)
+	}
+	if _, err := RemoteFlags("utc"); err == nil {
+		t.Error("expected error for invalid flags")
+	}
+}
+
+func TestFlagsPaths(t *testing.T) {
+	tests := []struct {
+		platform string
+		secret   string
+		cert     string
+		flags    string
+		err      bool
+	}{
+		{FlagsWindows, `C:\Program Files\osquery\osquery.secret`, `C:\Program Files\osquery\osctrl.crt`, `C:\Program Files\osquery\osquery.flags`, false},
+		{FlagsDarwin, "/private/var/osquery/osquery.secret", "/private/var/osquery/certs/osctrl.crt", "/private/var/osquery/osquery.flags", false},
+		{FlagsLinux, "/etc/osquery/osquery.secret", "/etc/osquery/certs/osctrl.crt", "/etc/osquery/osquery.flags", false},
+		{FlagsFreeBSD, "/usr/local/etc/osquery.secret", "/usr/local/etc/certs/osctrl.crt", "/usr/local/etc/osquery.flags", false},
+		{"solaris", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			secret, cert, flags, err := FlagsPaths(tt.platform, "osctrl")
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if secret != tt.secret || cert != tt.cert || flags != tt.flags {
+				t.Errorf("got %s, %s and %s", secret, cert, flags)
+			}
+		})
+	}
+}
+
+func TestPlatformFlags(t *testing.T) {
+	env := TLSEnvironment{Flags: "--enroll_secret_path=" + emptyFlagSecret + "\n--tls_server_certs=" + emptyFlagCert + "\n--new_flag=1"}
+	tests := []struct {
+		platform string
+		flags    string
+	}{
+		{FlagsLinux, "--enroll_secret_path=/etc/osquery/osquery.secret\n--tls_server_certs=/etc/osquery/certs/osctrl.crt\n--new_flag=1"},
+		{FlagsWindows, "--enroll_secret_path=C:\\Program Files\\osquery\\osquery.secret\r\n--tls_server_certs=C:\\Program Files\\osquery\\osctrl.crt\r\n--new_flag=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			flags, err := PlatformFlags(env, tt.platform, "osctrl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flags != tt.flags {
+				t.Errorf("got\n%s\nwant\n%s", flags, tt.flags)
+			}
+		})
+	}
+	if _, err := PlatformFlags(env, "solaris", "osctrl"); err == nil {
+		t.Error("expected error for unknown platform")
+	}
+}
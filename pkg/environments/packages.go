@@ -0,0 +1,369 @@
+package environments
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Types of enrollment packages
+const (
+	PackageDeb string = "deb"
+	PackageRPM string = "rpm"
+	PackagePkg string = "pkg"
+)
+
+const (
+	// SystemdUnitTemplate to run osqueryd with the flagfile of the environment in Linux
+	SystemdUnitTemplate string = `[Unit]
+Description=osquery daemon for {{ .Project }} environment {{ .Environment }}
+After=network.target syslog.service
+
+[Service]
+TimeoutStartSec=0
+ExecStart=/usr/bin/osqueryd --flagfile {{ .FlagsFile }} --config_path /etc/osquery/osquery.conf
+Restart=on-failure
+KillMode=process
+KillSignal=SIGTERM
+
+[Install]
+WantedBy=multi-user.target
+`
+	// LaunchdPlistTemplate to run osqueryd with the flagfile of the environment in macOS
+	LaunchdPlistTemplate string = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>com.facebook.osqueryd</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>/usr/local/bin/osqueryd</string>
+    <string>--flagfile</string>
+    <string>{{ .FlagsFile }}</string>
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <true/>
+  <key>ThrottleInterval</key>
+  <integer>60</integer>
+</dict>
+</plist>
+`
+	// PkgBuildTemplate to build the macOS package from the payload layout
+	PkgBuildTemplate string = `#!/usr/bin/env bash
+# Build the enrollment package for {{ .Project }} environment {{ .Environment }}
+# It needs pkgbuild, available in macOS with the Xcode command line tools
+cd "$(dirname "$0")"
+pkgbuild --root root --scripts scripts --identifier {{ .Identifier }} --version {{ .Version }} --install-location / "{{ .Name }}.pkg"
+`
+)
+
+// Scripts to stop osqueryd before installing and to start it afterwards
+const (
+	linuxPreinst string = `#!/bin/sh
+systemctl stop osqueryd >/dev/null 2>&1 || true
+`
+	linuxPostinst string = `#!/bin/sh
+systemctl daemon-reload >/dev/null 2>&1 || true
+systemctl enable osqueryd >/dev/null 2>&1 || true
+systemctl restart osqueryd
+`
+	debPrerm string = `#!/bin/sh
+if [ "$1" = "remove" ]; then
+  systemctl stop osqueryd >/dev/null 2>&1 || true
+  systemctl disable osqueryd >/dev/null 2>&1 || true
+fi
+`
+	rpmPreun string = `#!/bin/sh
+if [ "$1" -eq 0 ]; then
+  systemctl stop osqueryd >/dev/null 2>&1 || true
+  systemctl disable osqueryd >/dev/null 2>&1 || true
+fi
+`
+	darwinPreinstall string = `#!/usr/bin/env bash
+if launchctl list | grep -qcm1 com.facebook.osqueryd; then
+  launchctl unload /Library/LaunchDaemons/com.facebook.osqueryd.plist
+fi
+exit 0
+`
+	darwinPostinstall string = `#!/usr/bin/env bash
+launchctl load /Library/LaunchDaemons/com.facebook.osqueryd.plist
+exit 0
+`
+)
+
+const (
+	systemdUnitPath  string = "/etc/systemd/system/osqueryd.service"
+	launchdPlistPath string = "/Library/LaunchDaemons/com.facebook.osqueryd.plist"
+)
+
+// PackageFile is one file installed by an enrollment package
+type PackageFile struct {
+	Path string
+	Mode int64
+	Data []byte
+}
+
+// Package with the metadata and files of an enrollment package
+type Package struct {
+	Name        string
+	Version     string
+	Summary     string
+	Project     string
+	Environment string
+	Files       []PackageFile
+	Built       time.Time
+}
+
+type packageData struct {
+	Project     string
+	Environment string
+	FlagsFile   string
+	Identifier  string
+	Name        string
+	Version     string
+}
+
+// PackageName generates the name of the enrollment package of an environment
+// Only lowercase letters, numbers, dots and dashes are valid in the names of deb and rpm packages
+func PackageName(project, environment string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '-'
+	}, project+"-"+environment)
+	return name
+}
+
+// PackageVersion generates the version of the enrollment package, using the last update of the environment
+// Packages built after flags, secrets or certificate change will upgrade the ones already installed
+func PackageVersion(env TLSEnvironment) string {
+	if env.UpdatedAt.IsZero() {
+		return "1"
+	}
+	return env.UpdatedAt.UTC().Format("20060102.150405")
+}
+
+// PackageFilename generates the filename for the enrollment package of an environment
+func PackageFilename(project, environment, format string) string {
+	name := PackageName(project, environment)
+	switch format {
+	case PackageDeb:
+		return name + ".deb"
+	case PackageRPM:
+		return name + ".noarch.rpm"
+	case PackagePkg:
+		return name + "-pkg.tar.gz"
+	}
+	return name
+}
+
+// PackageContentType gets the content type to serve an enrollment package
+func PackageContentType(format string) string {
+	switch format {
+	case PackageDeb:
+		return "application/vnd.debian.binary-package"
+	case PackageRPM:
+		return "application/x-rpm"
+	}
+	return "application/gzip"
+}
+
+// PackageScript gets the format of the package requested with the quick add scripts, as enroll.deb
+func PackageScript(script string) (string, bool) {
+	switch script {
+	case "enroll." + PackageDeb:
+		return PackageDeb, true
+	case "enroll." + PackageRPM:
+		return PackageRPM, true
+	case "enroll." + PackagePkg:
+		return PackagePkg, true
+	}
+	return "", false
+}
+
+// QuickAddPackageURL to get the URL to download an enrollment package, using the enroll secret path
+func QuickAddPackageURL(environment TLSEnvironment, format string) string {
+	return "https://" + environment.Hostname + "/" + environment.Name + "/" + environment.EnrollSecretPath + "/enroll." + format
+}
+
+// Helper to render the templates of packages
+func renderPackageTemplate(name, text string, data packageData) ([]byte, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, data); err != nil {
+		return nil, err
+	}
+	return tpl.Bytes(), nil
+}
+
+// PreparePackage collects the files of the enrollment package of an environment for one platform
+func PreparePackage(env TLSEnvironment, platform, project string) (Package, error) {
+	pkg := Package{
+		Name:        PackageName(project, env.Name),
+		Version:     PackageVersion(env),
+		Summary:     fmt.Sprintf("osquery enrollment for %s environment %s", project, env.Name),
+		Project:     project,
+		Environment: env.Name,
+		Built:       time.Now(),
+	}
+	secretFile, certFile, flagsFile, err := FlagsPaths(platform, project)
+	if err != nil {
+		return pkg, err
+	}
+	flags, err := PlatformFlags(env, platform, project)
+	if err != nil {
+		return pkg, err
+	}
+	data := packageData{
+		Project:     project,
+		Environment: env.Name,
+		FlagsFile:   flagsFile,
+		Identifier:  "com." + strings.Replace(pkg.Name, "-", ".", -1),
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+	}
+	pkg.Files = []PackageFile{
+		{Path: flagsFile, Mode: 0600, Data: []byte(strings.TrimLeft(flags, "\r\n"))},
+		{Path: secretFile, Mode: 0600, Data: []byte(env.Secret)},
+		{Path: certFile, Mode: 0644, Data: []byte(env.Certificate)},
+	}
+	var service []byte
+	switch platform {
+	case FlagsLinux:
+		if service, err = renderPackageTemplate("systemd", SystemdUnitTemplate, data); err != nil {
+			return pkg, err
+		}
+		pkg.Files = append(pkg.Files, PackageFile{Path: systemdUnitPath, Mode: 0644, Data: service})
+	case FlagsDarwin:
+		if service, err = renderPackageTemplate("launchd", LaunchdPlistTemplate, data); err != nil {
+			return pkg, err
+		}
+		pkg.Files = append(pkg.Files, PackageFile{Path: launchdPlistPath, Mode: 0644, Data: service})
+	default:
+		return pkg, fmt.Errorf("no packages for platform %s", platform)
+	}
+	return pkg, nil
+}
+
+// BuildPackage generates the enrollment package of an environment, deb or rpm for Linux and the payload layout of a pkg for macOS
+func BuildPackage(env TLSEnvironment, format, project string) ([]byte, error) {
+	platform := FlagsLinux
+	if format == PackagePkg {
+		platform = FlagsDarwin
+	}
+	pkg, err := PreparePackage(env, platform, project)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case PackageDeb:
+		return buildDeb(pkg)
+	case PackageRPM:
+		return buildRPM(pkg)
+	case PackagePkg:
+		return buildPkgLayout(pkg)
+	}
+	return nil, fmt.Errorf("unknown package format %s", format)
+}
+
+// Helper to get the parent directories of the files of a package, sorted and without the root
+func packageDirs(files []PackageFile) []string {
+	seen := make(map[string]bool)
+	for _, f := range files {
+		for dir := path.Dir(f.Path); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			seen[dir] = true
+		}
+	}
+	var dirs []string
+	for d := range seen {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Helper to generate a tar.gz with the files and their directories, with prefix before each path
+func packageTarGz(files []PackageFile, prefix string, modTime time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, d := range packageDirs(files) {
+		hdr := &tar.Header{
+			Name:     prefix + strings.TrimPrefix(d, "/") + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+			ModTime:  modTime,
+			Uname:    "root",
+			Gname:    "root",
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:     prefix + strings.TrimPrefix(f.Path, "/"),
+			Typeflag: tar.TypeReg,
+			Mode:     f.Mode,
+			Size:     int64(len(f.Data)),
+			ModTime:  modTime,
+			Uname:    "root",
+			Gname:    "root",
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Helper to generate the payload layout for pkgbuild in macOS
+// The tar.gz has the payload in root/, the install scripts in scripts/ and build.sh to run pkgbuild
+func buildPkgLayout(pkg Package) ([]byte, error) {
+	data := packageData{
+		Project:     pkg.Project,
+		Environment: pkg.Environment,
+		Identifier:  "com." + strings.Replace(pkg.Name, "-", ".", -1),
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+	}
+	build, err := renderPackageTemplate("pkgbuild", PkgBuildTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	var files []PackageFile
+	for _, f := range pkg.Files {
+		files = append(files, PackageFile{Path: "/root" + f.Path, Mode: f.Mode, Data: f.Data})
+	}
+	files = append(files,
+		PackageFile{Path: "/scripts/preinstall", Mode: 0755, Data: []byte(darwinPreinstall)},
+		PackageFile{Path: "/scripts/postinstall", Mode: 0755, Data: []byte(darwinPostinstall)},
+		PackageFile{Path: "/build.sh", Mode: 0755, Data: build},
+	)
+	return packageTarGz(files, pkg.Name+"/", pkg.Built)
+}
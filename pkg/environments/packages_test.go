@@ -0,0 +1,316 @@
+package environments
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper to create an environment to build packages
+func testPackageEnv() TLSEnvironment {
+	env := TLSEnvironment{
+		Name:        "Prod",
+		Hostname:    "osctrl.example.com",
+		Secret:      "enroll-secret",
+		Certificate: "-----BEGIN CERTIFICATE-----\n",
+		EnrollPath:  "enroll",
+		LogPath:     "log",
+		ConfigPath:  "config",
+	}
+	env.UpdatedAt = time.Date(2020, time.January, 6, 10, 30, 0, 0, time.UTC)
+	return env
+}
+
+// Helper to read the files of a tar.gz by name, directories have no data
+func readTarGz(t *testing.T, data []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(content)
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	tests := []struct {
+		project     string
+		environment string
+		name        string
+	}{
+		{"osctrl", "prod", "osctrl-prod"},
+		{"osctrl", "Prod", "osctrl-prod"},
+		{"my project", "dev_1", "my-project-dev-1"},
+		{"osctrl", "v1.2", "osctrl-v1.2"},
+	}
+	for _, tt := range tests {
+		if got := PackageName(tt.project, tt.environment); got != tt.name {
+			t.Errorf("PackageName(%s, %s) = %s, want %s", tt.project, tt.environment, got, tt.name)
+		}
+	}
+}
+
+func TestPackageVersion(t *testing.T) {
+	if v := PackageVersion(TLSEnvironment{}); v != "1" {
+		t.Errorf("version %s, want 1", v)
+	}
+	if v := PackageVersion(testPackageEnv()); v != "20200106.103000" {
+		t.Errorf("version %s, want 20200106.103000", v)
+	}
+}
+
+func TestBuildDeb(t *testing.T) {
+	data, err := BuildPackage(testPackageEnv(), PackageDeb, "osctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("!<arch>\n")) {
+		t.Fatal("missing ar magic")
+	}
+	// Members of the ar archive, with headers of 60 bytes
+	members := make(map[string][]byte)
+	var names []string
+	for pos := 8; pos < len(data); {
+		hdr := string(data[pos : pos+60])
+		if !strings.HasSuffix(hdr, "`\n") {
+			t.Fatalf("invalid ar header %q", hdr)
+		}
+		name := strings.TrimSpace(hdr[0:16])
+		size, err := strconv.Atoi(strings.TrimSpace(hdr[48:58]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pos += 60
+		members[name] = data[pos : pos+size]
+		names = append(names, name)
+		pos += size + size%2
+	}
+	if strings.Join(names, ",") != "debian-binary,control.tar.gz,data.tar.gz" {
+		t.Fatalf("members %v", names)
+	}
+	if string(members["debian-binary"]) != "2.0\n" {
+		t.Errorf("debian-binary %q", members["debian-binary"])
+	}
+	control := readTarGz(t, members["control.tar.gz"])
+	for _, f := range []string{"./control", "./preinst", "./postinst", "./prerm"} {
+		if _, ok := control[f]; !ok {
+			t.Errorf("missing %s in control.tar.gz", f)
+		}
+	}
+	if !strings.Contains(control["./control"], "Package: osctrl-prod\nVersion: 20200106.103000\n") {
+		t.Errorf("control %s", control["./control"])
+	}
+	files := readTarGz(t, members["data.tar.gz"])
+	if files["./etc/osquery/osquery.secret"] != "enroll-secret" {
+		t.Errorf("secret %q", files["./etc/osquery/osquery.secret"])
+	}
+	if files["./etc/osquery/certs/osctrl.crt"] != "-----BEGIN CERTIFICATE-----\n" {
+		t.Errorf("certificate %q", files["./etc/osquery/certs/osctrl.crt"])
+	}
+	if !strings.Contains(files["./etc/osquery/osquery.flags"], "--enroll_secret_path=/etc/osquery/osquery.secret") {
+		t.Errorf("flags %s", files["./etc/osquery/osquery.flags"])
+	}
+	if !strings.Contains(files["./etc/systemd/system/osqueryd.service"], "--flagfile /etc/osquery/osquery.flags") {
+		t.Errorf("systemd unit %s", files["./etc/systemd/system/osqueryd.service"])
+	}
+	for _, d := range []string{"./etc/", "./etc/osquery/", "./etc/osquery/certs/", "./etc/systemd/"} {
+		if _, ok := files[d]; !ok {
+			t.Errorf("missing directory %s", d)
+		}
+	}
+}
+
+// rpmTag is one decoded tag of a rpm header
+type rpmTag struct {
+	kind   uint32
+	offset uint32
+	count  uint32
+}
+
+// Helper to decode a rpm header at the position, returns the tags, the store and the end of the header
+func readRPMHeader(t *testing.T, data []byte, pos int) (map[uint32]rpmTag, []byte, int) {
+	if !bytes.Equal(data[pos:pos+4], []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		t.Fatalf("missing header magic at %d", pos)
+	}
+	count := int(binary.BigEndian.Uint32(data[pos+8:]))
+	size := int(binary.BigEndian.Uint32(data[pos+12:]))
+	tags := make(map[uint32]rpmTag)
+	index := data[pos+16 : pos+16+count*16]
+	store := data[pos+16+count*16 : pos+16+count*16+size]
+	for i := 0; i < count; i++ {
+		e := index[i*16:]
+		tags[binary.BigEndian.Uint32(e)] = rpmTag{
+			kind:   binary.BigEndian.Uint32(e[4:]),
+			offset: binary.BigEndian.Uint32(e[8:]),
+			count:  binary.BigEndian.Uint32(e[12:]),
+		}
+	}
+	return tags, store, pos + 16 + count*16 + size
+}
+
+// Helper to get the strings of a tag
+func rpmStrings(tag rpmTag, store []byte) []string {
+	var result []string
+	pos := int(tag.offset)
+	for i := 0; i < int(tag.count); i++ {
+		end := pos + bytes.IndexByte(store[pos:], 0)
+		result = append(result, string(store[pos:end]))
+		pos = end + 1
+	}
+	return result
+}
+
+func TestBuildRPM(t *testing.T) {
+	data, err := BuildPackage(testPackageEnv(), PackageRPM, "osctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte{0xed, 0xab, 0xee, 0xdb}) {
+		t.Fatal("missing lead magic")
+	}
+	sigTags, sigStore, pos := readRPMHeader(t, data, 96)
+	// The header starts aligned to 8 bytes after the signature
+	pos += (8 - pos%8) % 8
+	tags, store, end := readRPMHeader(t, data, pos)
+	header, payload := data[pos:end], data[end:]
+	if region := tags[rpmTagHeaderImmutable]; region.kind != rpmBin || region.count != 16 {
+		t.Errorf("header region %+v", region)
+	}
+	if region := sigTags[rpmTagHeaderSignatures]; region.kind != rpmBin || region.count != 16 {
+		t.Errorf("signature region %+v", region)
+	}
+	for tag, want := range map[uint32]string{
+		rpmTagName:    "osctrl-prod",
+		rpmTagVersion: "20200106.103000",
+		rpmTagRelease: "1",
+		rpmTagArch:    "noarch",
+		rpmTagOS:      "linux",
+	} {
+		if got := rpmStrings(tags[tag], store); len(got) != 1 || got[0] != want {
+			t.Errorf("tag %d is %v, want %s", tag, got, want)
+		}
+	}
+	// Digests and sizes in the signature
+	if got := rpmStrings(sigTags[rpmSigTagSHA256], sigStore); got[0] != fmt.Sprintf("%x", sha256.Sum256(header)) {
+		t.Errorf("header sha256 %s", got[0])
+	}
+	size := sigTags[rpmSigTagSize]
+	if got := int(binary.BigEndian.Uint32(sigStore[size.offset:])); got != len(header)+len(payload) {
+		t.Errorf("size %d, want %d", got, len(header)+len(payload))
+	}
+	digest := md5.New()
+	digest.Write(header)
+	digest.Write(payload)
+	md5Tag := sigTags[rpmSigTagMD5]
+	if !bytes.Equal(sigStore[md5Tag.offset:md5Tag.offset+md5Tag.count], digest.Sum(nil)) {
+		t.Error("md5 does not match")
+	}
+	// Payload is a gzip cpio in newc format
+	gz, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpio, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadSize := sigTags[rpmSigTagPayloadSize]
+	if got := int(binary.BigEndian.Uint32(sigStore[payloadSize.offset:])); got != len(cpio) {
+		t.Errorf("payload size %d, want %d", got, len(cpio))
+	}
+	files := make(map[string]string)
+	var names []string
+	for p := 0; ; {
+		hdr := string(cpio[p : p+110])
+		if !strings.HasPrefix(hdr, "070701") {
+			t.Fatalf("invalid cpio header %q", hdr)
+		}
+		fileSize, _ := strconv.ParseInt(hdr[54:62], 16, 64)
+		nameSize, _ := strconv.ParseInt(hdr[94:102], 16, 64)
+		p += 110
+		name := string(cpio[p : p+int(nameSize)-1])
+		p += int(nameSize)
+		p += (4 - p%4) % 4
+		if name == "TRAILER!!!" {
+			break
+		}
+		files[name] = string(cpio[p : p+int(fileSize)])
+		names = append(names, name)
+		p += int(fileSize)
+		p += (4 - p%4) % 4
+	}
+	if files["./etc/osquery/osquery.secret"] != "enroll-secret" {
+		t.Errorf("secret %q", files["./etc/osquery/osquery.secret"])
+	}
+	if _, ok := files["./etc/systemd/system/osqueryd.service"]; !ok {
+		t.Errorf("missing systemd unit in %v", names)
+	}
+	// Files in the header match the payload
+	dirs := rpmStrings(tags[rpmTagDirNames], store)
+	bases := rpmStrings(tags[rpmTagBaseNames], store)
+	indexes := tags[rpmTagDirIndexes]
+	if len(bases) != len(names) {
+		t.Fatalf("%d files in header, %d in payload", len(bases), len(names))
+	}
+	for i, b := range bases {
+		dir := dirs[binary.BigEndian.Uint32(store[int(indexes.offset)+i*4:])]
+		if "."+dir+b != names[i] {
+			t.Errorf("file %d is %s%s in header and %s in payload", i, dir, b, names[i])
+		}
+	}
+}
+
+func TestBuildPkgLayout(t *testing.T) {
+	data, err := BuildPackage(testPackageEnv(), PackagePkg, "osctrl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readTarGz(t, data)
+	for _, f := range []string{
+		"osctrl-prod/build.sh",
+		"osctrl-prod/scripts/preinstall",
+		"osctrl-prod/scripts/postinstall",
+		"osctrl-prod/root/private/var/osquery/osquery.flags",
+		"osctrl-prod/root/private/var/osquery/certs/osctrl.crt",
+		"osctrl-prod/root/Library/LaunchDaemons/com.facebook.osqueryd.plist",
+	} {
+		if _, ok := files[f]; !ok {
+			t.Errorf("missing %s", f)
+		}
+	}
+	if files["osctrl-prod/root/private/var/osquery/osquery.secret"] != "enroll-secret" {
+		t.Errorf("secret %q", files["osctrl-prod/root/private/var/osquery/osquery.secret"])
+	}
+	if !strings.Contains(files["osctrl-prod/build.sh"], "--identifier com.osctrl.prod --version 20200106.103000") {
+		t.Errorf("build.sh %s", files["osctrl-prod/build.sh"])
+	}
+}
+
+func TestBuildPackageUnknown(t *testing.T) {
+	if _, err := BuildPackage(testPackageEnv(), "msi", "osctrl"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
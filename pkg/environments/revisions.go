@@ -0,0 +1,184 @@
+package environments
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Revision to keep an immutable copy of the configuration, flags and intervals of an environment
+type Revision struct {
+	gorm.Model
+	Environment    string `gorm:"index"`
+	Number         int    `gorm:"index"`
+	Configuration  string
+	Flags          string
+	ConfigInterval int
+	LogInterval    int
+	QueryInterval  int
+	Author         string
+	Comment        string
+}
+
+// RevisionDiff to hold the differences between two revisions
+type RevisionDiff struct {
+	From          int        `json:"from"`
+	To            int        `json:"to"`
+	Configuration []DiffLine `json:"configuration"`
+	Flags         []DiffLine `json:"flags"`
+	Intervals     []DiffLine `json:"intervals"`
+}
+
+// Helper to check if the environment is the same as stored in the revision
+func (r Revision) matches(env TLSEnvironment) bool {
+	return r.Configuration == env.Configuration &&
+		r.Flags == env.Flags &&
+		r.ConfigInterval == env.ConfigInterval &&
+		r.LogInterval == env.LogInterval &&
+		r.QueryInterval == env.QueryInterval
+}
+
+// Helper to generate the intervals of a revision as text, to be compared
+func (r Revision) intervals() string {
+	return "config: " + strconv.Itoa(r.ConfigInterval) + "\n" +
+		"log: " + strconv.Itoa(r.LogInterval) + "\n" +
+		"query: " + strconv.Itoa(r.QueryInterval)
+}
+
+// LatestRevision to get the last revision of an environment
+func (environment *Environment) LatestRevision(name string) (Revision, error) {
+	var rev Revision
+	if err := environment.DB.Where("environment = ?", name).Order("number desc").First(&rev).Error; err != nil {
+		return rev, err
+	}
+	return rev, nil
+}
+
+// LatestConfigurationRevision to get the number of the revision that set the current configuration of an environment
+// Later revisions changing only flags or intervals keep the same configuration
+func (environment *Environment) LatestConfigurationRevision(name string) (int, error) {
+	latest, err := environment.LatestRevision(name)
+	if err != nil {
+		return 0, err
+	}
+	var rev Revision
+	err = environment.DB.Where("environment = ? AND configuration <> ?", name, latest.Configuration).Order("number desc").First(&rev).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rev.Number + 1, nil
+}
+
+// GetRevision to get one revision of an environment by number
+func (environment *Environment) GetRevision(name string, number int) (Revision, error) {
+	var rev Revision
+	if err := environment.DB.Where("environment = ? AND number = ?", name, number).First(&rev).Error; err != nil {
+		return rev, err
+	}
+	return rev, nil
+}
+
+// Revisions to get all the revisions of an environment, newest first
+func (environment *Environment) Revisions(name string) ([]Revision, error) {
+	var revs []Revision
+	if err := environment.DB.Where("environment = ?", name).Order("number desc").Find(&revs).Error; err != nil {
+		return revs, err
+	}
+	return revs, nil
+}
+
+// SaveRevision to store the current configuration, flags and intervals of an environment as a new revision
+// If nothing changed since the last revision, no revision is created and the last one is returned
+func (environment *Environment) SaveRevision(name, author, comment string) (Revision, error) {
+	env, err := environment.Get(name)
+	if err != nil {
+		return Revision{}, fmt.Errorf("error getting environment %v", err)
+	}
+	number := 1
+	latest, err := environment.LatestRevision(name)
+	if err == nil {
+		if latest.matches(env) {
+			return latest, nil
+		}
+		number = latest.Number + 1
+	} else if !gorm.IsRecordNotFoundError(err) {
+		return latest, err
+	}
+	rev := Revision{
+		Environment:    name,
+		Number:         number,
+		Configuration:  env.Configuration,
+		Flags:          env.Flags,
+		ConfigInterval: env.ConfigInterval,
+		LogInterval:    env.LogInterval,
+		QueryInterval:  env.QueryInterval,
+		Author:         author,
+		Comment:        comment,
+	}
+	if err := environment.DB.Create(&rev).Error; err != nil {
+		return rev, fmt.Errorf("Create Revision %v", err)
+	}
+	return rev, nil
+}
+
+// BaselineRevision to store the first revision of an environment, if it does not have any
+func (environment *Environment) BaselineRevision(name, author string) error {
+	if _, err := environment.LatestRevision(name); !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	_, err := environment.SaveRevision(name, author, "Baseline")
+	return err
+}
+
+// Rollback to restore the configuration, flags and intervals of a revision
+// The rollback is stored as a new revision, so the history is never rewritten
+func (environment *Environment) Rollback(name string, number int, author string) (Revision, error) {
+	rev, err := environment.GetRevision(name, number)
+	if err != nil {
+		return rev, fmt.Errorf("error getting revision %v", err)
+	}
+	env, err := environment.Get(name)
+	if err != nil {
+		return rev, fmt.Errorf("error getting environment %v", err)
+	}
+	restored := map[string]interface{}{
+		"configuration":   rev.Configuration,
+		"flags":           rev.Flags,
+		"config_interval": rev.ConfigInterval,
+		"log_interval":    rev.LogInterval,
+		"query_interval":  rev.QueryInterval,
+	}
+	if err := environment.DB.Model(&env).Updates(restored).Error; err != nil {
+		return rev, fmt.Errorf("Updates %v", err)
+	}
+	return environment.SaveRevision(name, author, fmt.Sprintf("Rollback to revision %d", number))
+}
+
+// DiffRevisions to compare two revisions of an environment
+func (environment *Environment) DiffRevisions(name string, from, to int) (RevisionDiff, error) {
+	diff := RevisionDiff{From: from, To: to}
+	fromRev, err := environment.GetRevision(name, from)
+	if err != nil {
+		return diff, fmt.Errorf("error getting revision %d %v", from, err)
+	}
+	toRev, err := environment.GetRevision(name, to)
+	if err != nil {
+		return diff, fmt.Errorf("error getting revision %d %v", to, err)
+	}
+	diff.Configuration = Diff(fromRev.Configuration, toRev.Configuration)
+	diff.Flags = Diff(fromRev.Flags, toRev.Flags)
+	diff.Intervals = Diff(fromRev.intervals(), toRev.intervals())
+	return diff, nil
+}
+
+// DeleteRevisions to remove all the revisions of an environment
+func (environment *Environment) DeleteRevisions(name string) error {
+	if err := environment.DB.Unscoped().Where("environment = ?", name).Delete(&Revision{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
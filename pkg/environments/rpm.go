@@ -0,0 +1,316 @@
+package environments
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Types of values in rpm headers
+const (
+	rpmInt16       uint32 = 3
+	rpmInt32       uint32 = 4
+	rpmString      uint32 = 6
+	rpmBin         uint32 = 7
+	rpmStringArray uint32 = 8
+	rpmI18NString  uint32 = 9
+)
+
+// Tags of rpm headers used by enrollment packages
+const (
+	rpmTagHeaderSignatures  uint32 = 62
+	rpmTagHeaderImmutable   uint32 = 63
+	rpmTagI18NTable         uint32 = 100
+	rpmSigTagSHA1           uint32 = 269
+	rpmSigTagSHA256         uint32 = 273
+	rpmSigTagSize           uint32 = 1000
+	rpmSigTagMD5            uint32 = 1004
+	rpmSigTagPayloadSize    uint32 = 1007
+	rpmTagName              uint32 = 1000
+	rpmTagVersion           uint32 = 1001
+	rpmTagRelease           uint32 = 1002
+	rpmTagSummary           uint32 = 1004
+	rpmTagDescription       uint32 = 1005
+	rpmTagBuildTime         uint32 = 1006
+	rpmTagSize              uint32 = 1009
+	rpmTagLicense           uint32 = 1014
+	rpmTagGroup             uint32 = 1016
+	rpmTagOS                uint32 = 1021
+	rpmTagArch              uint32 = 1022
+	rpmTagPreIn             uint32 = 1023
+	rpmTagPostIn            uint32 = 1024
+	rpmTagPreUn             uint32 = 1025
+	rpmTagFileSizes         uint32 = 1028
+	rpmTagFileModes         uint32 = 1030
+	rpmTagFileRDevs         uint32 = 1033
+	rpmTagFileMTimes        uint32 = 1034
+	rpmTagFileDigests       uint32 = 1035
+	rpmTagFileLinkTos       uint32 = 1036
+	rpmTagFileFlags         uint32 = 1037
+	rpmTagFileUsername      uint32 = 1039
+	rpmTagFileGroupname     uint32 = 1040
+	rpmTagSourceRPM         uint32 = 1044
+	rpmTagFileVerifyFlags   uint32 = 1045
+	rpmTagProvideName       uint32 = 1047
+	rpmTagRequireFlags      uint32 = 1048
+	rpmTagRequireName       uint32 = 1049
+	rpmTagRequireVersion    uint32 = 1050
+	rpmTagPreInProg         uint32 = 1085
+	rpmTagPostInProg        uint32 = 1086
+	rpmTagPreUnProg         uint32 = 1087
+	rpmTagFileDevices       uint32 = 1095
+	rpmTagFileInodes        uint32 = 1096
+	rpmTagFileLangs         uint32 = 1097
+	rpmTagProvideFlags      uint32 = 1112
+	rpmTagProvideVersion    uint32 = 1113
+	rpmTagDirIndexes        uint32 = 1116
+	rpmTagBaseNames         uint32 = 1117
+	rpmTagDirNames          uint32 = 1118
+	rpmTagPayloadFormat     uint32 = 1124
+	rpmTagPayloadCompressor uint32 = 1125
+	rpmTagPayloadFlags      uint32 = 1126
+	rpmTagFileDigestAlgo    uint32 = 5011
+)
+
+// Flags of rpm dependencies
+const (
+	rpmSenseLess   int32 = 0x02
+	rpmSenseEqual  int32 = 0x08
+	rpmSenseRPMLib int32 = 0x1000000
+)
+
+// rpmEntry is one tag of a rpm header, with its value already encoded
+type rpmEntry struct {
+	Tag   uint32
+	Type  uint32
+	Count uint32
+	Data  []byte
+}
+
+// rpmHeader to collect the tags of a rpm header
+type rpmHeader struct {
+	entries []rpmEntry
+}
+
+// Helper to add a tag to a rpm header, encoding the value by its type
+func (h *rpmHeader) add(tag, kind uint32, value interface{}) {
+	var buf bytes.Buffer
+	var count int
+	switch v := value.(type) {
+	case string:
+		buf.WriteString(v)
+		buf.WriteByte(0)
+		count = 1
+	case []string:
+		for _, s := range v {
+			buf.WriteString(s)
+			buf.WriteByte(0)
+		}
+		count = len(v)
+	case []int16:
+		_ = binary.Write(&buf, binary.BigEndian, v)
+		count = len(v)
+	case []int32:
+		_ = binary.Write(&buf, binary.BigEndian, v)
+		count = len(v)
+	case []byte:
+		buf.Write(v)
+		count = len(v)
+	}
+	h.entries = append(h.entries, rpmEntry{Tag: tag, Type: kind, Count: uint32(count), Data: buf.Bytes()})
+}
+
+// Helper to encode a rpm header with its region tag
+func (h *rpmHeader) bytes(region uint32) []byte {
+	entries := append([]rpmEntry{}, h.entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Tag < entries[j].Tag })
+	var index, store bytes.Buffer
+	total := len(entries) + 1
+	for _, e := range entries {
+		// Numbers are aligned to their size
+		align := 1
+		switch e.Type {
+		case rpmInt16:
+			align = 2
+		case rpmInt32:
+			align = 4
+		}
+		for store.Len()%align != 0 {
+			store.WriteByte(0)
+		}
+		_ = binary.Write(&index, binary.BigEndian, []uint32{e.Tag, e.Type, uint32(store.Len()), e.Count})
+		store.Write(e.Data)
+	}
+	// The region tag goes first and points to a trailer at the end of the store
+	var head bytes.Buffer
+	_ = binary.Write(&head, binary.BigEndian, []uint32{region, rpmBin, uint32(store.Len()), 16})
+	_ = binary.Write(&store, binary.BigEndian, []int32{int32(region), int32(rpmBin), int32(-total * 16), 16})
+	var buf bytes.Buffer
+	buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{uint32(total), uint32(store.Len())})
+	buf.Write(head.Bytes())
+	buf.Write(index.Bytes())
+	buf.Write(store.Bytes())
+	return buf.Bytes()
+}
+
+// Helper to add one entry to a cpio archive in newc format, used as payload of rpm packages
+func cpioEntry(buf *bytes.Buffer, name string, inode, mode, mtime int64, data []byte) {
+	fmt.Fprintf(buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		inode, mode, 0, 0, 1, mtime, len(data), 0, 0, 0, 0, len(name)+1, 0)
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.Write(data)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+}
+
+// Helper to generate a rpm package, with lead, signature, header and a gzip cpio payload
+func buildRPM(pkg Package) ([]byte, error) {
+	mtime := pkg.Built.Unix()
+	release := "1"
+	// Payload with the files
+	var cpio bytes.Buffer
+	for i, f := range pkg.Files {
+		cpioEntry(&cpio, "."+f.Path, int64(i+1), 0100000|f.Mode, mtime, f.Data)
+	}
+	cpioEntry(&cpio, "TRAILER!!!", 0, 0, 0, nil)
+	var payload bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&payload, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gz.Write(cpio.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	// Header with the metadata of the package and the files
+	var sizes, mtimes, flags, verify, devices, inodes, dirIndexes []int32
+	var modes, rdevs []int16
+	var digests, links, users, groups, langs, baseNames, dirNames []string
+	dirs := make(map[string]int)
+	total := 0
+	for i, f := range pkg.Files {
+		dir := path.Dir(f.Path) + "/"
+		if _, ok := dirs[dir]; !ok {
+			dirs[dir] = len(dirNames)
+			dirNames = append(dirNames, dir)
+		}
+		total += len(f.Data)
+		sizes = append(sizes, int32(len(f.Data)))
+		mtimes = append(mtimes, int32(mtime))
+		flags = append(flags, 0)
+		verify = append(verify, -1)
+		devices = append(devices, 1)
+		inodes = append(inodes, int32(i+1))
+		dirIndexes = append(dirIndexes, int32(dirs[dir]))
+		modes = append(modes, int16(0100000|f.Mode))
+		rdevs = append(rdevs, 0)
+		digests = append(digests, fmt.Sprintf("%x", sha256.Sum256(f.Data)))
+		links = append(links, "")
+		users = append(users, "root")
+		groups = append(groups, "root")
+		langs = append(langs, "")
+		baseNames = append(baseNames, path.Base(f.Path))
+	}
+	h := &rpmHeader{}
+	h.add(rpmTagI18NTable, rpmStringArray, []string{"C"})
+	h.add(rpmTagName, rpmString, pkg.Name)
+	h.add(rpmTagVersion, rpmString, pkg.Version)
+	h.add(rpmTagRelease, rpmString, release)
+	h.add(rpmTagSummary, rpmI18NString, pkg.Summary)
+	h.add(rpmTagDescription, rpmI18NString, "Flagfile, enroll secret, certificate and systemd unit of osquery.")
+	h.add(rpmTagBuildTime, rpmInt32, []int32{int32(mtime)})
+	h.add(rpmTagSize, rpmInt32, []int32{int32(total)})
+	h.add(rpmTagLicense, rpmString, "Proprietary")
+	h.add(rpmTagGroup, rpmI18NString, "System Environment/Daemons")
+	h.add(rpmTagOS, rpmString, "linux")
+	h.add(rpmTagArch, rpmString, "noarch")
+	h.add(rpmTagSourceRPM, rpmString, strings.Join([]string{pkg.Name, pkg.Version, release}, "-")+".src.rpm")
+	h.add(rpmTagPreIn, rpmString, linuxPreinst)
+	h.add(rpmTagPostIn, rpmString, linuxPostinst)
+	h.add(rpmTagPreUn, rpmString, rpmPreun)
+	h.add(rpmTagPreInProg, rpmString, "/bin/sh")
+	h.add(rpmTagPostInProg, rpmString, "/bin/sh")
+	h.add(rpmTagPreUnProg, rpmString, "/bin/sh")
+	h.add(rpmTagFileSizes, rpmInt32, sizes)
+	h.add(rpmTagFileModes, rpmInt16, modes)
+	h.add(rpmTagFileRDevs, rpmInt16, rdevs)
+	h.add(rpmTagFileMTimes, rpmInt32, mtimes)
+	h.add(rpmTagFileDigests, rpmStringArray, digests)
+	h.add(rpmTagFileLinkTos, rpmStringArray, links)
+	h.add(rpmTagFileFlags, rpmInt32, flags)
+	h.add(rpmTagFileUsername, rpmStringArray, users)
+	h.add(rpmTagFileGroupname, rpmStringArray, groups)
+	h.add(rpmTagFileVerifyFlags, rpmInt32, verify)
+	h.add(rpmTagFileDevices, rpmInt32, devices)
+	h.add(rpmTagFileInodes, rpmInt32, inodes)
+	h.add(rpmTagFileLangs, rpmStringArray, langs)
+	h.add(rpmTagDirIndexes, rpmInt32, dirIndexes)
+	h.add(rpmTagBaseNames, rpmStringArray, baseNames)
+	h.add(rpmTagDirNames, rpmStringArray, dirNames)
+	h.add(rpmTagFileDigestAlgo, rpmInt32, []int32{8})
+	h.add(rpmTagProvideName, rpmStringArray, []string{pkg.Name})
+	h.add(rpmTagProvideFlags, rpmInt32, []int32{rpmSenseEqual})
+	h.add(rpmTagProvideVersion, rpmStringArray, []string{pkg.Version + "-" + release})
+	h.add(rpmTagRequireName, rpmStringArray, []string{
+		"/bin/sh",
+		"osquery",
+		"rpmlib(CompressedFileNames)",
+		"rpmlib(FileDigests)",
+		"rpmlib(PayloadFilesHavePrefix)",
+	})
+	rpmlib := rpmSenseRPMLib | rpmSenseLess | rpmSenseEqual
+	h.add(rpmTagRequireFlags, rpmInt32, []int32{0, 0, rpmlib, rpmlib, rpmlib})
+	h.add(rpmTagRequireVersion, rpmStringArray, []string{"", "", "3.0.4-1", "4.6.0-1", "4.0-1"})
+	h.add(rpmTagPayloadFormat, rpmString, "cpio")
+	h.add(rpmTagPayloadCompressor, rpmString, "gzip")
+	h.add(rpmTagPayloadFlags, rpmString, "9")
+	header := h.bytes(rpmTagHeaderImmutable)
+	// Signature with the digests of header and payload
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(payload.Bytes())
+	s := &rpmHeader{}
+	s.add(rpmSigTagSHA1, rpmString, fmt.Sprintf("%x", sha1.Sum(header)))
+	s.add(rpmSigTagSHA256, rpmString, fmt.Sprintf("%x", sha256.Sum256(header)))
+	s.add(rpmSigTagSize, rpmInt32, []int32{int32(len(header) + payload.Len())})
+	s.add(rpmSigTagMD5, rpmBin, md5sum.Sum(nil))
+	s.add(rpmSigTagPayloadSize, rpmInt32, []int32{int32(cpio.Len())})
+	signature := s.bytes(rpmTagHeaderSignatures)
+	// Lead, mostly ignored by current versions of rpm
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	binary.BigEndian.PutUint16(lead[6:], 0)
+	binary.BigEndian.PutUint16(lead[8:], 0)
+	leadName := strings.Join([]string{pkg.Name, pkg.Version, release}, "-")
+	if len(leadName) > 65 {
+		leadName = leadName[:65]
+	}
+	copy(lead[10:76], leadName)
+	binary.BigEndian.PutUint16(lead[76:], 1)
+	binary.BigEndian.PutUint16(lead[78:], 5)
+	var buf bytes.Buffer
+	buf.Write(lead)
+	buf.Write(signature)
+	// Signature is aligned to 8 bytes
+	for buf.Len()%8 != 0 {
+		buf.WriteByte(0)
+	}
+	buf.Write(header)
+	buf.Write(payload.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,249 @@
+package environments
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// DefaultSecretName as name for the secret created with the environment
+	DefaultSecretName string = "default"
+	// DefaultSecretOverlap as default time in hours that the previous secret is still valid after rotation
+	DefaultSecretOverlap int = 72
+)
+
+// Status of enroll secrets
+const (
+	SecretActive    string = "active"
+	SecretExpired   string = "expired"
+	SecretExhausted string = "exhausted"
+)
+
+// EnrollSecret to hold one of the secrets that nodes can use to enroll in an environment
+// Expires and MaxEnrollments are not enforced when they are empty
+type EnrollSecret struct {
+	gorm.Model
+	Environment    string `gorm:"index"`
+	Name           string
+	Secret         string `gorm:"index"`
+	Expires        time.Time
+	MaxEnrollments int
+	Enrollments    int
+	LastUsed       time.Time
+}
+
+// Status returns if the secret can be used to enroll nodes
+func (s EnrollSecret) Status() string {
+	if !s.Expires.IsZero() && IsItExpired(s.Expires) {
+		return SecretExpired
+	}
+	if s.MaxEnrollments > 0 && s.Enrollments >= s.MaxEnrollments {
+		return SecretExhausted
+	}
+	return SecretActive
+}
+
+// Helper to check if a secret must expire when the overlap of a rotation ends
+// Secrets that can not be used or that expire before the overlap ends are kept as they are
+func (s EnrollSecret) expiresWithOverlap(expires time.Time) bool {
+	return s.Status() == SecretActive && (s.Expires.IsZero() || !s.Expires.Before(expires))
+}
+
+// Helper to create the default secret of an environment from its Secret, for environments without secrets
+func (environment *Environment) seedSecrets(name string) error {
+	var count int
+	if err := environment.DB.Model(&EnrollSecret{}).Where("environment = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	secret := EnrollSecret{
+		Environment: name,
+		Name:        DefaultSecretName,
+		Secret:      env.Secret,
+	}
+	if err := environment.DB.Create(&secret).Error; err != nil {
+		return fmt.Errorf("Create EnrollSecret %v", err)
+	}
+	return nil
+}
+
+// Secrets gets all the enroll secrets of an environment
+func (environment *Environment) Secrets(name string) ([]EnrollSecret, error) {
+	var secrets []EnrollSecret
+	if err := environment.seedSecrets(name); err != nil {
+		return secrets, err
+	}
+	if err := environment.DB.Where("environment = ?", name).Order("created_at").Find(&secrets).Error; err != nil {
+		return secrets, err
+	}
+	return secrets, nil
+}
+
+// GetSecret gets one enroll secret of an environment by name
+func (environment *Environment) GetSecret(name, secretName string) (EnrollSecret, error) {
+	var secret EnrollSecret
+	if err := environment.seedSecrets(name); err != nil {
+		return secret, err
+	}
+	if err := environment.DB.Where("environment = ? AND name = ?", name, secretName).First(&secret).Error; err != nil {
+		return secret, err
+	}
+	return secret, nil
+}
+
+// AddSecret creates a new enroll secret for an environment, the value is generated if it is empty
+// Hours sets the expiration of the secret and maxEnrollments how many nodes can use it, zero for no limit
+func (environment *Environment) AddSecret(name, secretName, value string, hours, maxEnrollments int) (EnrollSecret, error) {
+	secret := EnrollSecret{
+		Environment:    name,
+		Name:           strings.TrimSpace(secretName),
+		Secret:         strings.TrimSpace(value),
+		MaxEnrollments: maxEnrollments,
+	}
+	if secret.Name == "" {
+		return secret, fmt.Errorf("secret name is required")
+	}
+	if hours < 0 || maxEnrollments < 0 {
+		return secret, fmt.Errorf("expiration and max enrollments can not be negative")
+	}
+	if _, err := environment.GetSecret(name, secret.Name); err == nil {
+		return secret, fmt.Errorf("secret %s already exists in %s", secret.Name, name)
+	}
+	if secret.Secret == "" {
+		secret.Secret = generateRandomString(DefaultSecretLength)
+	}
+	if hours > 0 {
+		secret.Expires = time.Now().Add(time.Duration(hours) * time.Hour)
+	}
+	if err := environment.DB.Create(&secret).Error; err != nil {
+		return secret, fmt.Errorf("Create EnrollSecret %v", err)
+	}
+	return secret, nil
+}
+
+// SetPrimarySecret makes one enroll secret the one distributed with flags, scripts and packages
+func (environment *Environment) SetPrimarySecret(name, secretName string) error {
+	secret, err := environment.GetSecret(name, secretName)
+	if err != nil {
+		return fmt.Errorf("error getting secret %v", err)
+	}
+	if secret.Status() != SecretActive {
+		return fmt.Errorf("secret %s is %s", secretName, secret.Status())
+	}
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	if err := environment.DB.Model(&env).Update("secret", secret.Secret).Error; err != nil {
+		return fmt.Errorf("Update %v", err)
+	}
+	return nil
+}
+
+// ExpireSecret expires one enroll secret of an environment after the provided hours, zero to expire it now
+func (environment *Environment) ExpireSecret(name, secretName string, hours int) error {
+	secret, err := environment.GetSecret(name, secretName)
+	if err != nil {
+		return fmt.Errorf("error getting secret %v", err)
+	}
+	if err := environment.DB.Model(&secret).Update("expires", time.Now().Add(time.Duration(hours)*time.Hour)).Error; err != nil {
+		return fmt.Errorf("Update %v", err)
+	}
+	return nil
+}
+
+// DeleteSecret removes one enroll secret of an environment, the primary secret can not be removed
+func (environment *Environment) DeleteSecret(name, secretName string) error {
+	secret, err := environment.GetSecret(name, secretName)
+	if err != nil {
+		return fmt.Errorf("error getting secret %v", err)
+	}
+	env, err := environment.Get(name)
+	if err != nil {
+		return fmt.Errorf("error getting environment %v", err)
+	}
+	if secret.Secret == env.Secret {
+		return fmt.Errorf("secret %s is the primary secret of %s", secretName, name)
+	}
+	if err := environment.DB.Unscoped().Delete(&secret).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// DeleteSecrets removes all the enroll secrets of an environment
+func (environment *Environment) DeleteSecrets(name string) error {
+	if err := environment.DB.Unscoped().Where("environment = ?", name).Delete(&EnrollSecret{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// RotateSecret creates a new primary secret for an environment
+// The secrets valid until now expire after overlap hours, so nodes still using them can enroll meanwhile
+func (environment *Environment) RotateSecret(name string, overlap int) (EnrollSecret, error) {
+	secrets, err := environment.Secrets(name)
+	if err != nil {
+		return EnrollSecret{}, fmt.Errorf("error getting secrets %v", err)
+	}
+	secretName := "rotated-" + time.Now().UTC().Format("20060102150405")
+	secret, err := environment.AddSecret(name, secretName, "", 0, 0)
+	if err != nil {
+		return secret, err
+	}
+	if err := environment.SetPrimarySecret(name, secretName); err != nil {
+		return secret, err
+	}
+	expires := time.Now().Add(time.Duration(overlap) * time.Hour)
+	for _, s := range secrets {
+		if !s.expiresWithOverlap(expires) {
+			continue
+		}
+		if err := environment.DB.Model(&s).Update("expires", expires).Error; err != nil {
+			return secret, fmt.Errorf("Update %v", err)
+		}
+	}
+	return secret, nil
+}
+
+// EnrollWith checks the secret used by a node to enroll and counts the enrollment
+// It returns the matching secret if it is valid for the environment
+func (environment *Environment) EnrollWith(name, value string) (EnrollSecret, error) {
+	var secret EnrollSecret
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return secret, fmt.Errorf("empty secret")
+	}
+	if err := environment.seedSecrets(name); err != nil {
+		return secret, err
+	}
+	if err := environment.DB.Where("environment = ? AND secret = ?", name, value).First(&secret).Error; err != nil {
+		return secret, fmt.Errorf("unknown secret")
+	}
+	if status := secret.Status(); status != SecretActive {
+		return secret, fmt.Errorf("secret %s is %s", secret.Name, status)
+	}
+	// Counting in the same statement keeps max enrollments with concurrent requests
+	result := environment.DB.Model(&secret).
+		Where("max_enrollments = 0 OR enrollments < max_enrollments").
+		Updates(map[string]interface{}{
+			"enrollments": gorm.Expr("enrollments + 1"),
+			"last_used":   time.Now(),
+		})
+	if result.Error != nil {
+		return secret, fmt.Errorf("Updates %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return secret, fmt.Errorf("secret %s is %s", secret.Name, SecretExhausted)
+	}
+	return secret, nil
+}
@@ -0,0 +1,51 @@
+package environments
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnrollSecretStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret EnrollSecret
+		status string
+	}{
+		{"no limits", EnrollSecret{Enrollments: 100}, SecretActive},
+		{"not expired", EnrollSecret{Expires: time.Now().Add(time.Hour)}, SecretActive},
+		{"expired", EnrollSecret{Expires: time.Now().Add(-time.Hour)}, SecretExpired},
+		{"below max enrollments", EnrollSecret{MaxEnrollments: 2, Enrollments: 1}, SecretActive},
+		{"max enrollments", EnrollSecret{MaxEnrollments: 2, Enrollments: 2}, SecretExhausted},
+		{"expired and exhausted", EnrollSecret{Expires: time.Now().Add(-time.Hour), MaxEnrollments: 1, Enrollments: 1}, SecretExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.secret.Status(); got != tt.status {
+				t.Errorf("Status() = %s, want %s", got, tt.status)
+			}
+		})
+	}
+}
+
+func TestExpiresWithOverlap(t *testing.T) {
+	overlap := time.Now().Add(time.Duration(DefaultSecretOverlap) * time.Hour)
+	tests := []struct {
+		name    string
+		secret  EnrollSecret
+		expires bool
+	}{
+		{"without expiration", EnrollSecret{}, true},
+		{"expires after the overlap", EnrollSecret{Expires: overlap.Add(time.Hour)}, true},
+		{"expires when the overlap ends", EnrollSecret{Expires: overlap}, true},
+		{"expires before the overlap ends", EnrollSecret{Expires: overlap.Add(-time.Hour)}, false},
+		{"already expired", EnrollSecret{Expires: time.Now().Add(-time.Hour)}, false},
+		{"exhausted", EnrollSecret{MaxEnrollments: 1, Enrollments: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.secret.expiresWithOverlap(overlap); got != tt.expires {
+				t.Errorf("expiresWithOverlap() = %v, want %v", got, tt.expires)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/viper"
+)
+
+// Helper to load the configuration of a logging destination from its JSON file, config/<name>.json
+func loadConfiguration(name string, cfg interface{}) error {
+	file := "config/" + name + ".json"
+	log.Printf("Loading %s", file)
+	// Each destination uses its own viper, so they can be loaded concurrently
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	cfgRaw := v.Sub(name)
+	if cfgRaw == nil {
+		return fmt.Errorf("no %s section in %s", name, file)
+	}
+	return cfgRaw.Unmarshal(cfg)
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// OsqueryResultData to log result data to database, one row per result
+// Columns is JSONB so it can be queried, like columns->>'name'
+type OsqueryResultData struct {
+	gorm.Model
+	UUID        string `gorm:"index"`
+	Environment string `gorm:"index"`
+	Name        string `gorm:"index"`
+	Action      string `gorm:"index"`
+	Epoch       int64
+	Columns     string `gorm:"type:jsonb"`
+	Counter     int
+	Timestamp   time.Time `gorm:"index"`
+}
+
+// OsqueryStatusData to log status data to database
+type OsqueryStatusData struct {
+	gorm.Model
+	UUID        string `gorm:"index"`
+	Environment string
+	Line        string
+	Message     string
+	Version     string
+	Filename    string
+	Severity    string
+}
+
+// OsqueryQueryData to log query data to database
+type OsqueryQueryData struct {
+	gorm.Model
+	UUID        string `gorm:"index"`
+	Environment string
+	Name        string
+	Generation  uint
+	Data        json.RawMessage
+	Status      int
+}
+
+// DBSink to send logs to the database of the service
+// FIXME maybe allow different DB to be used than the one from the service
+type DBSink struct {
+	db *gorm.DB
+}
+
+func init() {
+	RegisterSink(settings.LoggingDB, CreateDBSink)
+}
+
+// CreateDBSink to initialize the DB logging destination
+func CreateDBSink(opts SinkOptions) (Sink, error) {
+	if opts.DB == nil {
+		return nil, fmt.Errorf("no database for %s", settings.LoggingDB)
+	}
+	return &DBSink{db: opts.DB}, nil
+}
+
+// Name of the logging destination
+func (s *DBSink) Name() string {
+	return settings.LoggingDB
+}
+
+// Send - Function that sends JSON result/status/query logs to the configured DB
+func (s *DBSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	if debug {
+		log.Printf("Sending %d bytes to DB for %s - %s", len(data), environment, uuid)
+	}
+	switch logType {
+	case types.StatusLog:
+		return s.status(data, environment, uuid, debug)
+	case types.ResultLog:
+		return s.result(data, environment, uuid, debug)
+	case types.QueryLog:
+		return s.query(data, environment, uuid, debug)
+	}
+	return Permanent(fmt.Errorf("unknown log type %s", logType))
+}
+
+// Flush does nothing, logs are inserted as they are sent
+func (s *DBSink) Flush() error {
+	return nil
+}
+
+// Close does nothing, the database belongs to the service
+func (s *DBSink) Close() error {
+	return nil
+}
+
+// Helper to insert JSON status logs, all of them or none so they can be sent again
+func (s *DBSink) status(data []byte, environment, uuid string, debug bool) error {
+	// Parse JSON
+	var logs []types.LogStatusData
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return Permanent(fmt.Errorf("error parsing logs %s %v", string(data), err))
+	}
+	// Iterate and insert in DB
+	tx := s.db.Begin()
+	for _, l := range logs {
+		entry := OsqueryStatusData{
+			UUID:        l.HostIdentifier,
+			Environment: environment,
+			Line:        l.Line,
+			Message:     l.Message,
+			Version:     l.Version,
+			Filename:    l.Filename,
+			Severity:    l.Severity,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Error creating status log entry %s", err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to insert %d status log entries %v", len(logs), err)
+	}
+	return nil
+}
+
+// Helper to insert JSON result logs, unpacked as one entry per row, all of them or none so they can be sent again
+func (s *DBSink) result(data []byte, environment, uuid string, debug bool) error {
+	rows, err := UnpackResults(data)
+	if err != nil {
+		return Permanent(err)
+	}
+	// Iterate and insert in DB
+	tx := s.db.Begin()
+	for _, r := range rows {
+		columns := string(r.Columns)
+		if columns == "" {
+			columns = "{}"
+		}
+		entry := OsqueryResultData{
+			UUID:        r.UUID,
+			Environment: environment,
+			Name:        r.Name,
+			Action:      r.Action,
+			Epoch:       r.Epoch,
+			Columns:     columns,
+			Counter:     r.Counter,
+			Timestamp:   r.Timestamp,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Error creating result log entry %s", err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to insert %d result log entries %v", len(rows), err)
+	}
+	return nil
+}
+
+// Helper to insert JSON query logs, name, generation and status come from the query data
+func (s *DBSink) query(data []byte, environment, uuid string, debug bool) error {
+	var q types.QueryWriteData
+	if err := json.Unmarshal(data, &q); err != nil {
+		return Permanent(fmt.Errorf("error parsing query %s %v", string(data), err))
+	}
+	// Prepare data
+	entry := OsqueryQueryData{
+		UUID:        uuid,
+		Environment: environment,
+		Name:        q.Name,
+		Generation:  q.Generation,
+		Data:        data,
+		Status:      q.Status,
+	}
+	// Insert in DB
+	if s.db.NewRecord(entry) {
+		if err := s.db.Create(&entry).Error; err != nil {
+			return fmt.Errorf("Error creating query log %s", err)
+		}
+	} else {
+		return fmt.Errorf("db.NewRecord did not return true")
+	}
+	return nil
+}
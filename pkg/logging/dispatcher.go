@@ -0,0 +1,237 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/metrics"
+	"github.com/jmpsec/osctrl/pkg/spool"
+)
+
+const (
+	// Interval in seconds to replay spooled logs
+	spoolInterval int = 30
+	// Prefix for all metrics of the logging dispatcher
+	metricPrefix string = "logging-"
+	// Suffix for metrics of successful deliveries
+	metricOK string = "-ok"
+	// Suffix for metrics of failed deliveries
+	metricErr string = "-err"
+	// Suffix for metrics of spooled logs
+	metricSpooled string = "-spooled"
+)
+
+// destination to keep one logging destination and its state
+// Deliveries and replays hold the read lock, re-creating and closing the sink hold the write lock
+type destination struct {
+	name string
+	sink Sink
+	mux  sync.RWMutex
+}
+
+// Dispatcher to send logs to the configured logging destinations
+type Dispatcher struct {
+	Destinations []string
+	opts         SinkOptions
+	metrics      *metrics.Metrics
+	spool        *spool.Spool
+	dests        map[string]*destination
+}
+
+// CreateDispatcher to initialize all the logging destinations by name
+// Destinations that fail to be created are retried when their spool is replayed
+func CreateDispatcher(destinations []string, opts SinkOptions, m *metrics.Metrics) *Dispatcher {
+	d := &Dispatcher{
+		Destinations: destinations,
+		opts:         opts,
+		metrics:      m,
+		dests:        make(map[string]*destination),
+	}
+	for _, name := range destinations {
+		dest := &destination{name: name}
+		sink, err := CreateSink(name, opts)
+		if err != nil {
+			log.Printf("Failed to setup %s - %v", name, err)
+		} else {
+			dest.sink = sink
+		}
+		d.dests[name] = dest
+	}
+	return d
+}
+
+// EnableSpool to keep the logs that can not be delivered in the spool directory
+func (d *Dispatcher) EnableSpool(dir string, maxSize int64, maxAttempts int) error {
+	s, err := spool.CreateSpool(dir, maxSize, maxAttempts)
+	if err != nil {
+		return err
+	}
+	d.spool = s
+	return nil
+}
+
+// StartReplay to replay periodically the spooled logs of all destinations
+func (d *Dispatcher) StartReplay() {
+	if d.spool == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(spoolInterval) * time.Second)
+		for range ticker.C {
+			for _, name := range d.Destinations {
+				// Another process, like osctrl-cli, may be replaying the same spool
+				if _, err := d.Replay(name); err != nil && err != spool.ErrLocked {
+					log.Printf("Replaying spool for %s failed - %v", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// Helper to send per destination metrics, if they are enabled
+func (d *Dispatcher) incMetric(name, suffix string) {
+	if d.metrics != nil {
+		d.metrics.Inc(metricPrefix + name + suffix)
+	}
+}
+
+// Dispatch logs to all the logging destinations
+func (d *Dispatcher) Dispatch(logType string, data []byte, environment, uuid string, debug bool) {
+	for _, name := range d.Destinations {
+		if err := d.DispatchTo(name, logType, data, environment, uuid, debug); err != nil {
+			log.Printf("Logging with %s failed - %v", name, err)
+		}
+	}
+}
+
+// DispatchTo sends logs to one logging destination, keeping them in the spool if they can not be delivered
+func (d *Dispatcher) DispatchTo(name, logType string, data []byte, environment, uuid string, debug bool) error {
+	dest, ok := d.dests[name]
+	if !ok {
+		return fmt.Errorf("unknown logging destination %s - Dropping %d bytes", name, len(data))
+	}
+	dest.mux.RLock()
+	defer dest.mux.RUnlock()
+	var err error
+	// Logs already in the spool must be delivered first, to preserve the order
+	if d.spool != nil && d.spool.Pending(name) {
+		err = fmt.Errorf("%s has spooled logs", name)
+	} else if dest.sink == nil {
+		err = fmt.Errorf("%s isn't ready", name)
+	} else {
+		err = dest.sink.Send(logType, data, environment, uuid, debug)
+	}
+	if err == nil {
+		d.incMetric(name, metricOK)
+		return nil
+	}
+	d.incMetric(name, metricErr)
+	// Logs rejected or already delivered must not be spooled, only the remaining ones of a partial delivery
+	if IsPermanent(err) {
+		return fmt.Errorf("%v - Dropping %d bytes", err, len(data))
+	}
+	if e, ok := err.(*DeliveryError); ok {
+		data = e.Remaining
+	}
+	if d.spool == nil {
+		return fmt.Errorf("%v - Dropping %d bytes", err, len(data))
+	}
+	entry := spool.Entry{
+		LogType:     logType,
+		Environment: environment,
+		UUID:        uuid,
+		Data:        data,
+		Debug:       debug,
+	}
+	if errSpool := d.spool.Store(name, entry); errSpool != nil {
+		return fmt.Errorf("%v - %v", err, errSpool)
+	}
+	d.incMetric(name, metricSpooled)
+	return fmt.Errorf("%v - Spooled", err)
+}
+
+// Replay the spooled logs of one destination, creating its sink again if it is not ready
+// The write lock is only held to create the sink, logs are replayed with the read lock
+func (d *Dispatcher) Replay(name string) (int, error) {
+	if d.spool == nil {
+		return 0, fmt.Errorf("spool is not enabled")
+	}
+	dest, ok := d.dests[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown logging destination %s", name)
+	}
+	// Other processes may have replayed or purged the spool
+	if err := d.spool.Refresh(name); err != nil {
+		return 0, err
+	}
+	if !d.spool.Pending(name) {
+		return 0, nil
+	}
+	dest.mux.Lock()
+	if dest.sink == nil {
+		sink, err := CreateSink(name, d.opts)
+		if err != nil {
+			dest.mux.Unlock()
+			return 0, fmt.Errorf("%s isn't ready - %v", name, err)
+		}
+		dest.sink = sink
+	}
+	dest.mux.Unlock()
+	dest.mux.RLock()
+	defer dest.mux.RUnlock()
+	// The sink could be closed before the read lock is held
+	if dest.sink == nil {
+		return 0, fmt.Errorf("%s isn't ready", name)
+	}
+	replayed, err := d.spool.Replay(name, func(e *spool.Entry) error {
+		err := dest.sink.Send(e.LogType, e.Data, e.Environment, e.UUID, e.Debug)
+		// Spooled logs that can not be sent again are dropped, so they do not block the rest
+		if IsPermanent(err) {
+			log.Printf("Dropping spooled logs for %s - %v", name, err)
+			return nil
+		}
+		// Only the logs that were not delivered are kept in the spool
+		if de, ok := err.(*DeliveryError); ok {
+			e.Data = de.Remaining
+		}
+		return err
+	})
+	if replayed > 0 {
+		log.Printf("Replayed %d spooled logs for %s", replayed, name)
+	}
+	return replayed, err
+}
+
+// Flush all the logging destinations
+func (d *Dispatcher) Flush() {
+	for _, name := range d.Destinations {
+		dest := d.dests[name]
+		dest.mux.RLock()
+		if dest.sink != nil {
+			if err := dest.sink.Flush(); err != nil {
+				log.Printf("Flushing %s failed - %v", name, err)
+			}
+		}
+		dest.mux.RUnlock()
+	}
+}
+
+// Close all the logging destinations, logs can not be dispatched afterwards
+func (d *Dispatcher) Close() {
+	for _, name := range d.Destinations {
+		dest := d.dests[name]
+		dest.mux.Lock()
+		if dest.sink != nil {
+			if err := dest.sink.Flush(); err != nil {
+				log.Printf("Flushing %s failed - %v", name, err)
+			}
+			if err := dest.sink.Close(); err != nil {
+				log.Printf("Closing %s failed - %v", name, err)
+			}
+			dest.sink = nil
+		}
+		dest.mux.Unlock()
+	}
+}
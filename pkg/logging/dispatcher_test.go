@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/jmpsec/osctrl/pkg/metrics"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// Helper to create metrics sent to a local UDP listener
+func testMetrics(t *testing.T) *metrics.Metrics {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	m, err := metrics.CreateMetrics("udp", "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDispatch(t *testing.T) {
+	ok := &testSink{name: "test-ok"}
+	failing := &testSink{name: "test-failing", err: fmt.Errorf("destination is down")}
+	missing := &testSink{name: "test-missing", err: errSinkCreate}
+	for _, s := range []*testSink{ok, failing, missing} {
+		registerTestSink(t, s)
+	}
+	m := testMetrics(t)
+	d := CreateDispatcher([]string{"test-ok", "test-failing", "test-missing", "unknown"}, SinkOptions{}, m)
+	d.Dispatch(types.StatusLog, []byte("status"), "env", "uuid", false)
+	d.Dispatch(types.ResultLog, []byte("result"), "env", "uuid", false)
+	if want := []string{"status:status", "result:result"}; !reflect.DeepEqual(ok.sent, want) {
+		t.Errorf("sent %v, want %v", ok.sent, want)
+	}
+	if err := d.DispatchTo("not-configured", types.StatusLog, []byte("status"), "env", "uuid", false); err == nil {
+		t.Error("expected error for an unknown destination")
+	}
+	// The first increment sets the counter to 1, the next ones increase it
+	counters := map[string]int{
+		"logging-test-ok-ok":       2,
+		"logging-test-failing-err": 2,
+		"logging-test-missing-err": 2,
+		"logging-unknown-err":      2,
+	}
+	for name, count := range counters {
+		if c, ok := m.Counters[name]; !ok || c.Count != count {
+			t.Errorf("metric %s is %+v, want %d", name, c, count)
+		}
+	}
+	for _, name := range []string{"logging-test-ok-err", "logging-test-failing-ok", "logging-not-configured-err"} {
+		if _, ok := m.Counters[name]; ok {
+			t.Errorf("unexpected metric %s", name)
+		}
+	}
+	d.Close()
+	if err := d.DispatchTo("test-ok", types.StatusLog, []byte("status"), "env", "uuid", false); err == nil {
+		t.Error("expected error after closing the dispatcher")
+	}
+}
@@ -0,0 +1,389 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+	"github.com/jmpsec/osctrl/pkg/utils"
+)
+
+const (
+	// Method to send requests
+	elkMethod string = "POST"
+	// Endpoint for the bulk API
+	elkBulkPath string = "/_bulk"
+	// Content type for the bulk API
+	elkContentType string = "application/x-ndjson"
+	// Placeholder for the environment in the index template
+	elkIndexEnvironment = "{{ENVIRONMENT}}"
+	// Placeholder for the log type in the index template
+	elkIndexType = "{{TYPE}}"
+	// Format for the daily suffix of indices
+	elkIndexDate = "2006.01.02"
+	// Default index template, a daily suffix is always added
+	elkDefaultIndex = "{{ENVIRONMENT}}-osquery-{{TYPE}}"
+	// Default number of retries
+	elkDefaultRetries = 3
+	// Default initial backoff in milliseconds
+	elkDefaultBackoff = 500
+)
+
+// ELKStatusData to send status logs, same as OsqueryStatusData
+type ELKStatusData struct {
+	CreatedAt   time.Time `json:"created_at"`
+	UUID        string    `json:"uuid"`
+	Environment string    `json:"environment"`
+	Line        string    `json:"line"`
+	Message     string    `json:"message"`
+	Version     string    `json:"version"`
+	Filename    string    `json:"filename"`
+	Severity    string    `json:"severity"`
+}
+
+// ELKResultData to send result logs, same as OsqueryResultData
+type ELKResultData struct {
+	CreatedAt   time.Time       `json:"created_at"`
+	UUID        string          `json:"uuid"`
+	Environment string          `json:"environment"`
+	Name        string          `json:"name"`
+	Action      string          `json:"action"`
+	Epoch       int64           `json:"epoch"`
+	Columns     json.RawMessage `json:"columns"`
+	Counter     int             `json:"counter"`
+	Timestamp   time.Time       `json:"timestamp"`
+}
+
+// ELKQueryData to send query logs, same as OsqueryQueryData
+type ELKQueryData struct {
+	CreatedAt   time.Time       `json:"created_at"`
+	UUID        string          `json:"uuid"`
+	Environment string          `json:"environment"`
+	Name        string          `json:"name"`
+	Generation  uint            `json:"generation,omitempty"`
+	Data        json.RawMessage `json:"data"`
+	Status      int             `json:"status"`
+}
+
+// ELKBulkAction for the action line of each document in the bulk API
+type ELKBulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+	} `json:"index"`
+}
+
+// ELKBulkResponse to parse the response of the bulk API
+type ELKBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []struct {
+		Index struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"index"`
+	} `json:"items"`
+}
+
+// elkRequestError for bulk requests rejected as a whole, like authentication errors or missing indices
+// Retrying them right away would fail again, but the logs can be sent once Elasticsearch is fixed
+type elkRequestError struct {
+	status int
+	body   []byte
+}
+
+func (e *elkRequestError) Error() string {
+	return fmt.Sprintf("HTTP %d %s", e.status, e.body)
+}
+
+// ELKConfiguration to hold all elk configuration values
+// Index can use {{ENVIRONMENT}} and {{TYPE}} to generate one index per environment and log type
+// TLS certificates are verified unless insecure is true
+type ELKConfiguration struct {
+	URL        string `json:"url"`
+	Index      string `json:"index"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Retries    int    `json:"retries"`
+	Backoff    int    `json:"backoff"`
+	DeadLetter string `json:"dead_letter" mapstructure:"dead_letter"`
+	Insecure   bool   `json:"insecure"`
+}
+
+// ELKSink to send logs to Elasticsearch using the bulk API
+type ELKSink struct {
+	Configuration ELKConfiguration
+	url           string
+	headers       map[string]string
+	backoff       time.Duration
+	deadMux       sync.Mutex
+}
+
+func init() {
+	RegisterSink(settings.LoggingELK, CreateELKSink)
+}
+
+// CreateELKSink to initialize the elk logging destination from config/elk.json
+func CreateELKSink(opts SinkOptions) (Sink, error) {
+	var cfg ELKConfiguration
+	if err := loadConfiguration(settings.LoggingELK, &cfg); err != nil {
+		return nil, fmt.Errorf("Failed to load elk json - %v", err)
+	}
+	return NewELKSink(cfg)
+}
+
+// NewELKSink prepares the sink to send logs to Elasticsearch
+func NewELKSink(cfg ELKConfiguration) (*ELKSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("Elasticsearch URL can not be empty")
+	}
+	if cfg.Index == "" {
+		cfg.Index = elkDefaultIndex
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = elkDefaultRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = elkDefaultBackoff
+	}
+	s := &ELKSink{
+		Configuration: cfg,
+		url:           strings.TrimRight(cfg.URL, "/") + elkBulkPath,
+		headers: map[string]string{
+			"Content-Type": elkContentType,
+		},
+		backoff: time.Duration(cfg.Backoff) * time.Millisecond,
+	}
+	if cfg.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(cfg.Username + ":" + cfg.Password))
+		s.headers["Authorization"] = "Basic " + auth
+	}
+	return s, nil
+}
+
+// Name of the logging destination
+func (s *ELKSink) Name() string {
+	return settings.LoggingELK
+}
+
+// Flush does nothing, documents are sent as they come
+func (s *ELKSink) Flush() error {
+	return nil
+}
+
+// Close does nothing, there are no open connections
+func (s *ELKSink) Close() error {
+	return nil
+}
+
+// Helper to generate the daily index for an environment and log type
+func (s *ELKSink) index(environment, logType string) string {
+	i := strings.Replace(s.Configuration.Index, elkIndexEnvironment, environment, -1)
+	i = strings.Replace(i, elkIndexType, logType, -1)
+	return strings.ToLower(i + "-" + time.Now().UTC().Format(elkIndexDate))
+}
+
+// Helper to convert logs into documents with the same format as the DB
+func elkDocuments(logType string, data []byte, environment, uuid string) ([]interface{}, error) {
+	var docs []interface{}
+	now := time.Now().UTC()
+	switch logType {
+	case types.StatusLog:
+		var logs []types.LogStatusData
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return docs, fmt.Errorf("error parsing logs %s %v", string(data), err)
+		}
+		for _, l := range logs {
+			docs = append(docs, ELKStatusData{
+				CreatedAt:   now,
+				UUID:        l.HostIdentifier,
+				Environment: environment,
+				Line:        l.Line,
+				Message:     l.Message,
+				Version:     l.Version,
+				Filename:    l.Filename,
+				Severity:    l.Severity,
+			})
+		}
+	case types.ResultLog:
+		rows, err := UnpackResults(data)
+		if err != nil {
+			return docs, err
+		}
+		for _, r := range rows {
+			docs = append(docs, ELKResultData{
+				CreatedAt:   now,
+				UUID:        r.UUID,
+				Environment: environment,
+				Name:        r.Name,
+				Action:      r.Action,
+				Epoch:       r.Epoch,
+				Columns:     r.Columns,
+				Counter:     r.Counter,
+				Timestamp:   r.Timestamp,
+			})
+		}
+	case types.QueryLog:
+		var q types.QueryWriteData
+		if err := json.Unmarshal(data, &q); err != nil {
+			return docs, fmt.Errorf("error parsing query %s %v", string(data), err)
+		}
+		docs = append(docs, ELKQueryData{
+			CreatedAt:   now,
+			UUID:        uuid,
+			Environment: environment,
+			Name:        q.Name,
+			Generation:  q.Generation,
+			Data:        data,
+			Status:      q.Status,
+		})
+	default:
+		return docs, fmt.Errorf("unknown log type %s", logType)
+	}
+	return docs, nil
+}
+
+// Send - Function that sends JSON logs to Elasticsearch using the bulk API
+func (s *ELKSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	docs, err := elkDocuments(logType, data, environment, uuid)
+	if err != nil {
+		return Permanent(err)
+	}
+	// Prepare pairs of action and document lines
+	var action ELKBulkAction
+	action.Index.Index = s.index(environment, logType)
+	jsonAction, err := json.Marshal(action)
+	if err != nil {
+		return fmt.Errorf("Error parsing action %s", err)
+	}
+	var lines [][]byte
+	for _, d := range docs {
+		jsonDoc, err := json.Marshal(d)
+		if err != nil {
+			log.Printf("Error parsing data %s", err)
+			continue
+		}
+		line := make([]byte, 0, len(jsonAction)+len(jsonDoc)+1)
+		line = append(line, jsonAction...)
+		line = append(line, '\n')
+		lines = append(lines, append(line, jsonDoc...))
+	}
+	if debug {
+		log.Printf("Sending %d bytes to Elasticsearch index %s for %s - %s", len(data), action.Index.Index, environment, uuid)
+	}
+	// Send with retries, only pending lines are sent again
+	backoff := s.backoff
+	total := len(lines)
+	rejected := 0
+	for i := 0; i <= s.Configuration.Retries && len(lines) > 0; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var failed [][]byte
+		lines, failed, err = s.bulk(lines, debug)
+		if len(failed) > 0 {
+			rejected += len(failed)
+			s.deadLetter(failed)
+		}
+		if err != nil {
+			log.Printf("Elasticsearch: attempt %d failed %v", i+1, err)
+		}
+		if _, ok := err.(*elkRequestError); ok {
+			break
+		}
+	}
+	if len(lines) > 0 {
+		// Nothing was indexed, so all the logs can be sent again later
+		if len(lines) == total {
+			return fmt.Errorf("Elasticsearch: failed to send %d documents - %v", total, err)
+		}
+		// Sending them again would duplicate the documents already indexed
+		s.deadLetter(lines)
+		return Permanent(fmt.Errorf("Elasticsearch: failed to send %d of %d documents - %v", len(lines)+rejected, total, err))
+	}
+	// Rejected documents are in the dead letter file, they would be rejected again
+	if rejected > 0 {
+		return Permanent(fmt.Errorf("Elasticsearch: %d of %d documents rejected", rejected, total))
+	}
+	return nil
+}
+
+// Helper to send lines to the bulk API, returning the lines to be retried and the failed ones
+func (s *ELKSink) bulk(lines [][]byte, debug bool) ([][]byte, [][]byte, error) {
+	var body bytes.Buffer
+	for _, l := range lines {
+		body.Write(l)
+		body.WriteByte('\n')
+	}
+	resp, respBody, err := utils.SendRequest(s.Configuration.Insecure, elkMethod, s.url, &body, s.headers)
+	if err != nil {
+		return lines, nil, err
+	}
+	if debug {
+		log.Printf("Elasticsearch: HTTP %d", resp)
+	}
+	// Server side and throttling errors can be retried
+	if resp == http.StatusTooManyRequests || resp >= http.StatusInternalServerError {
+		return lines, nil, fmt.Errorf("HTTP %d %s", resp, respBody)
+	}
+	if resp != http.StatusOK {
+		return lines, nil, &elkRequestError{status: resp, body: respBody}
+	}
+	// Without a valid response it is unknown which documents were indexed
+	var bulk ELKBulkResponse
+	if err := json.Unmarshal(respBody, &bulk); err != nil {
+		return lines, nil, fmt.Errorf("error parsing response %v", err)
+	}
+	if !bulk.Errors {
+		return nil, nil, nil
+	}
+	// Check each document separately
+	var retry, failed [][]byte
+	for i, item := range bulk.Items {
+		if i >= len(lines) {
+			break
+		}
+		switch {
+		case item.Index.Status == http.StatusTooManyRequests || item.Index.Status >= http.StatusInternalServerError:
+			retry = append(retry, lines[i])
+		case item.Index.Status >= http.StatusBadRequest:
+			log.Printf("Elasticsearch: document rejected %s", string(item.Index.Error))
+			failed = append(failed, lines[i])
+		}
+	}
+	return retry, failed, fmt.Errorf("%d documents to retry, %d rejected", len(retry), len(failed))
+}
+
+// Helper to write documents that could not be sent to the dead letter file
+func (s *ELKSink) deadLetter(lines [][]byte) {
+	if s.Configuration.DeadLetter == "" {
+		log.Printf("Elasticsearch: dropping %d documents", len(lines))
+		return
+	}
+	s.deadMux.Lock()
+	defer s.deadMux.Unlock()
+	f, err := os.OpenFile(s.Configuration.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("Elasticsearch: error opening dead letter file %v - dropping %d documents", err, len(lines))
+		return
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Printf("Failed to close dead letter file %v", err)
+		}
+	}()
+	for _, l := range lines {
+		if _, err := fmt.Fprintf(f, "%s\n", l); err != nil {
+			log.Printf("Elasticsearch: error writing dead letter file %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package logging
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// elkResponse for each request received by the test server
+type elkResponse struct {
+	status int
+	body   string
+}
+
+// Helper to start a server that answers with the given responses and records the documents of each request
+func elkServer(t *testing.T, responses ...elkResponse) (*httptest.Server, func() [][]string) {
+	var mux sync.Mutex
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		// Only document lines, skipping the action lines
+		var docs []string
+		for i, l := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+			if i%2 == 1 {
+				docs = append(docs, l)
+			}
+		}
+		mux.Lock()
+		requests = append(requests, docs)
+		resp := elkResponse{http.StatusOK, `{"errors":false}`}
+		if len(requests) <= len(responses) {
+			resp = responses[len(requests)-1]
+		}
+		mux.Unlock()
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() [][]string {
+		mux.Lock()
+		defer mux.Unlock()
+		return requests
+	}
+}
+
+// Helper to read the messages of the documents in the dead letter file
+func elkDeadLetters(t *testing.T, path string) []string {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if l := scanner.Text(); strings.Contains(l, `"message"`) {
+			lines = append(lines, elkMessage(l))
+		}
+	}
+	return lines
+}
+
+// Helper to get the message of a status document
+func elkMessage(doc string) string {
+	start := strings.Index(doc, `"message":"`) + len(`"message":"`)
+	return doc[start : start+strings.Index(doc[start:], `"`)]
+}
+
+// Helper to get the messages of the documents in each request
+func elkMessages(requests [][]string) []string {
+	var all []string
+	for _, docs := range requests {
+		var msgs []string
+		for _, d := range docs {
+			msgs = append(msgs, elkMessage(d))
+		}
+		all = append(all, strings.Join(msgs, ","))
+	}
+	return all
+}
+
+func TestELKSend(t *testing.T) {
+	const logs = `[{"message":"a","hostIdentifier":"node-uuid"},{"message":"b","hostIdentifier":"node-uuid"},{"message":"c","hostIdentifier":"node-uuid"}]`
+	tests := []struct {
+		name      string
+		responses []elkResponse
+		requests  []string
+		dead      []string
+		// Error expected, nil if logs are delivered
+		err func(error) bool
+	}{
+		{
+			"delivered",
+			nil,
+			[]string{"a,b,c"},
+			nil,
+			func(err error) bool { return err == nil },
+		},
+		{
+			"documents retried",
+			[]elkResponse{{http.StatusOK, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429}},{"index":{"status":503}}]}`}},
+			[]string{"a,b,c", "b,c"},
+			nil,
+			func(err error) bool { return err == nil },
+		},
+		{
+			"documents rejected",
+			[]elkResponse{{http.StatusOK, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}},{"index":{"status":201}}]}`}},
+			[]string{"a,b,c"},
+			[]string{"b"},
+			IsPermanent,
+		},
+		{
+			"partially indexed",
+			[]elkResponse{
+				{http.StatusOK, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429}},{"index":{"status":201}}]}`},
+				{http.StatusServiceUnavailable, ""},
+				{http.StatusServiceUnavailable, ""},
+			},
+			[]string{"a,b,c", "b", "b"},
+			[]string{"b"},
+			IsPermanent,
+		},
+		{
+			"server errors",
+			[]elkResponse{{http.StatusInternalServerError, ""}, {http.StatusBadGateway, ""}, {http.StatusTooManyRequests, ""}},
+			[]string{"a,b,c", "a,b,c", "a,b,c"},
+			nil,
+			func(err error) bool { return err != nil && !IsPermanent(err) },
+		},
+		{
+			"invalid response",
+			[]elkResponse{{http.StatusOK, `<html>`}, {http.StatusOK, `{"errors":`}, {http.StatusOK, ``}},
+			[]string{"a,b,c", "a,b,c", "a,b,c"},
+			nil,
+			func(err error) bool { return err != nil && !IsPermanent(err) },
+		},
+		{
+			"invalid response then delivered",
+			[]elkResponse{{http.StatusOK, `<html>`}},
+			[]string{"a,b,c", "a,b,c"},
+			nil,
+			func(err error) bool { return err == nil },
+		},
+		{
+			"unauthorized",
+			[]elkResponse{{http.StatusUnauthorized, `{"error":"unauthorized"}`}},
+			[]string{"a,b,c"},
+			nil,
+			func(err error) bool { return err != nil && !IsPermanent(err) },
+		},
+		{
+			"missing index",
+			[]elkResponse{{http.StatusNotFound, `{"error":"index_not_found_exception"}`}},
+			[]string{"a,b,c"},
+			nil,
+			func(err error) bool { return err != nil && !IsPermanent(err) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := elkServer(t, tt.responses...)
+			dead := filepath.Join(t.TempDir(), "dead.ndjson")
+			s, err := NewELKSink(ELKConfiguration{URL: srv.URL, Retries: 2, Backoff: 1, DeadLetter: dead})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Send(types.StatusLog, []byte(logs), "prod", "node-uuid", false)
+			if !tt.err(err) {
+				t.Errorf("unexpected error %v", err)
+			}
+			if got := elkMessages(requests()); strings.Join(got, "|") != strings.Join(tt.requests, "|") {
+				t.Errorf("requests %q, want %q", got, tt.requests)
+			}
+			if got := elkDeadLetters(t, dead); strings.Join(got, "|") != strings.Join(tt.dead, "|") {
+				t.Errorf("dead letters %q, want %q", got, tt.dead)
+			}
+		})
+	}
+}
+
+func TestELKSendInvalidLogs(t *testing.T) {
+	s, err := NewELKSink(ELKConfiguration{URL: "http://localhost:9200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, logType := range []string{types.StatusLog, types.ResultLog, types.QueryLog, "unknown"} {
+		if err := s.Send(logType, []byte(`{"not":"an array"`), "prod", "node-uuid", false); !IsPermanent(err) {
+			t.Errorf("expected permanent error for %s, got %v", logType, err)
+		}
+	}
+}
+
+func TestELKIndex(t *testing.T) {
+	s, err := NewELKSink(ELKConfiguration{URL: "http://localhost:9200/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.url != "http://localhost:9200/_bulk" {
+		t.Errorf("unexpected URL %s", s.url)
+	}
+	if i := s.index("Prod", types.ResultLog); !strings.HasPrefix(i, "prod-osquery-result-") {
+		t.Errorf("unexpected index %s", i)
+	}
+}
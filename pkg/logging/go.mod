@@ -0,0 +1,15 @@
+module github.com/jmpsec/osctrl/pkg/logging
+
+go 1.12
+
+require (
+	github.com/Shopify/sarama v1.23.1
+	github.com/jinzhu/gorm v1.9.10
+	github.com/jmpsec/osctrl/pkg/metrics v0.1.5
+	github.com/jmpsec/osctrl/pkg/settings v0.1.5
+	github.com/jmpsec/osctrl/pkg/spool v0.1.5
+	github.com/jmpsec/osctrl/pkg/types v0.1.5
+	github.com/jmpsec/osctrl/pkg/utils v0.1.5
+	github.com/spf13/viper v1.4.0
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+)
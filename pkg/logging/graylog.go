@@ -1,11 +1,14 @@
-package main
+package logging
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/jmpsec/osctrl/pkg/settings"
 	"github.com/jmpsec/osctrl/pkg/utils"
 )
 
@@ -20,6 +23,11 @@ const (
 	graylogMethod = "POST"
 )
 
+// GraylogConfiguration to hold all graylog configuration values
+type GraylogConfiguration struct {
+	URL string `json:"url"`
+}
+
 // GraylogMessage to handle log format to be sent to Graylog
 type GraylogMessage struct {
 	Version      string `json:"version"`
@@ -32,8 +40,31 @@ type GraylogMessage struct {
 	UUID         string `json:"_uuid"`
 }
 
-// GraylogSend - Function that sends JSON logs to Graylog
-func GraylogSend(logType string, data []byte, environment, uuid, url string, debug bool) {
+// GraylogSink to send logs to Graylog
+type GraylogSink struct {
+	Configuration GraylogConfiguration
+}
+
+func init() {
+	RegisterSink(settings.LoggingGraylog, CreateGraylogSink)
+}
+
+// CreateGraylogSink to initialize the graylog logging destination from config/graylog.json
+func CreateGraylogSink(opts SinkOptions) (Sink, error) {
+	s := &GraylogSink{}
+	if err := loadConfiguration(settings.LoggingGraylog, &s.Configuration); err != nil {
+		return nil, fmt.Errorf("Failed to load graylog json - %v", err)
+	}
+	return s, nil
+}
+
+// Name of the logging destination
+func (s *GraylogSink) Name() string {
+	return settings.LoggingGraylog
+}
+
+// Send - Function that sends JSON logs to Graylog
+func (s *GraylogSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
 	// Prepare headers
 	headers := map[string]string{
 		"Content-Type": "application/json",
@@ -67,19 +98,33 @@ func GraylogSend(logType string, data []byte, environment, uuid, url string, deb
 	// Serialize data using GELF
 	jsonMessages, err := json.Marshal(messages)
 	if err != nil {
-		log.Printf("Error parsing data %s", err)
+		return fmt.Errorf("Error parsing data %s", err)
 	}
 	jsonParam := strings.NewReader(string(jsonMessages))
 	if debug {
 		log.Printf("Sending %d bytes to Graylog for %s - %s", len(data), environment, uuid)
 	}
 	// Send log with a POST to the Graylog URL
-	resp, body, err := utils.SendRequest(true, graylogMethod, url, jsonParam, headers)
+	resp, body, err := utils.SendRequest(true, graylogMethod, s.Configuration.URL, jsonParam, headers)
 	if err != nil {
-		log.Printf("Error sending request %s", err)
-		return
+		return fmt.Errorf("Error sending request %s", err)
 	}
 	if debug {
 		log.Printf("Graylog: HTTP %d %s", resp, body)
 	}
+	// GELF HTTP input replies with 202 Accepted
+	if resp != http.StatusOK && resp != http.StatusAccepted {
+		return fmt.Errorf("Graylog: HTTP %d %s", resp, body)
+	}
+	return nil
+}
+
+// Flush does nothing, logs are sent as they come
+func (s *GraylogSink) Flush() error {
+	return nil
+}
+
+// Close does nothing, there are no open connections
+func (s *GraylogSink) Close() error {
+	return nil
 }
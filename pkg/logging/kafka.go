@@ -0,0 +1,203 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+const (
+	// Host as source for Kafka messages
+	kafkaHost = "osctrl"
+	// Client ID for the Kafka producer
+	kafkaClientID = "osctrl-tls"
+	// Placeholder for the environment in the topic template
+	kafkaTopicEnvironment = "{{ENVIRONMENT}}"
+	// Placeholder for the log type in the topic template
+	kafkaTopicType = "{{TYPE}}"
+)
+
+// Acknowledgement levels for produced messages
+const (
+	kafkaAcksNone   = "none"
+	kafkaAcksLeader = "leader"
+	kafkaAcksAll    = "all"
+)
+
+// KafkaConfiguration to hold all kafka configuration values
+// Topic can use {{ENVIRONMENT}} and {{TYPE}} to generate one topic per environment and log type
+type KafkaConfiguration struct {
+	Brokers        []string `json:"brokers"`
+	Version        string   `json:"version"`
+	Topic          string   `json:"topic"`
+	Acks           string   `json:"acks"`
+	BatchMessages  int      `json:"batch_messages" mapstructure:"batch_messages"`
+	BatchBytes     int      `json:"batch_bytes" mapstructure:"batch_bytes"`
+	BatchFrequency int      `json:"batch_frequency" mapstructure:"batch_frequency"`
+}
+
+// KafkaMessage to handle log format to be sent to Kafka
+type KafkaMessage struct {
+	Time        int64           `json:"time"`
+	Host        string          `json:"host"`
+	UUID        string          `json:"uuid"`
+	Environment string          `json:"environment"`
+	Type        string          `json:"type"`
+	Event       json.RawMessage `json:"event"`
+}
+
+// KafkaSink to send logs to Kafka brokers
+type KafkaSink struct {
+	Configuration KafkaConfiguration
+	producer      sarama.SyncProducer
+}
+
+func init() {
+	RegisterSink(settings.LoggingKafka, CreateKafkaSink)
+}
+
+// CreateKafkaSink to initialize the kafka logging destination from config/kafka.json
+func CreateKafkaSink(opts SinkOptions) (Sink, error) {
+	var cfg KafkaConfiguration
+	if err := loadConfiguration(settings.LoggingKafka, &cfg); err != nil {
+		return nil, fmt.Errorf("Failed to load kafka json - %v", err)
+	}
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("No brokers for %s", settings.LoggingKafka)
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("No topic for %s", settings.LoggingKafka)
+	}
+	return NewKafkaSink(cfg)
+}
+
+// NewKafkaSink creates the producer to send logs to the Kafka brokers
+func NewKafkaSink(config KafkaConfiguration) (*KafkaSink, error) {
+	cfg := sarama.NewConfig()
+	cfg.ClientID = kafkaClientID
+	if config.Version != "" {
+		v, err := sarama.ParseKafkaVersion(config.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka version %s - %v", config.Version, err)
+		}
+		cfg.Version = v
+	}
+	switch config.Acks {
+	case kafkaAcksNone:
+		cfg.Producer.RequiredAcks = sarama.NoResponse
+	case kafkaAcksLeader, "":
+		cfg.Producer.RequiredAcks = sarama.WaitForLocal
+	case kafkaAcksAll:
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return nil, fmt.Errorf("invalid kafka acks %s", config.Acks)
+	}
+	// Required by the synchronous producer
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+	// Batching of messages before they are sent to the brokers
+	cfg.Producer.Flush.Messages = config.BatchMessages
+	cfg.Producer.Flush.Bytes = config.BatchBytes
+	cfg.Producer.Flush.Frequency = time.Duration(config.BatchFrequency) * time.Millisecond
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka configuration - %v", err)
+	}
+	producer, err := sarama.NewSyncProducer(config.Brokers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KafkaSink{Configuration: config, producer: producer}, nil
+}
+
+// Name of the logging destination
+func (s *KafkaSink) Name() string {
+	return settings.LoggingKafka
+}
+
+// Helper to generate the topic for an environment and log type
+func (s *KafkaSink) topic(environment, logType string) string {
+	t := strings.Replace(s.Configuration.Topic, kafkaTopicEnvironment, environment, -1)
+	return strings.Replace(t, kafkaTopicType, logType, -1)
+}
+
+// Send - Function that sends JSON logs to Kafka
+func (s *KafkaSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	// Check if this is result/status or query
+	var logs []json.RawMessage
+	if logType == types.QueryLog {
+		// For on-demand queries, just a JSON blob with results and statuses
+		logs = append(logs, json.RawMessage(data))
+	} else {
+		// For scheduled queries, convert the array in an array of multiple messages
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return fmt.Errorf("error parsing log %s %v", string(data), err)
+		}
+	}
+	topic := s.topic(environment, logType)
+	// Prepare messages, using the UUID as key to keep all logs from a node in the same partition
+	var messages []*sarama.ProducerMessage
+	var events []json.RawMessage
+	for _, l := range logs {
+		jsonMessage, err := json.Marshal(KafkaMessage{
+			Time:        time.Now().Unix(),
+			Host:        kafkaHost,
+			UUID:        uuid,
+			Environment: environment,
+			Type:        logType,
+			Event:       l,
+		})
+		if err != nil {
+			log.Printf("Error parsing data %s", err)
+			continue
+		}
+		messages = append(messages, &sarama.ProducerMessage{
+			Topic: topic,
+			Key:   sarama.StringEncoder(uuid),
+			Value: sarama.ByteEncoder(jsonMessage),
+		})
+		events = append(events, l)
+	}
+	if debug {
+		log.Printf("Sending %d bytes to Kafka topic %s for %s - %s", len(data), topic, environment, uuid)
+	}
+	// Send all messages as one batch
+	if err := s.producer.SendMessages(messages); err != nil {
+		return s.failed(err, logType, data, messages, events)
+	}
+	return nil
+}
+
+// Helper to return the error of a batch, only the logs of the messages that failed can be sent again
+func (s *KafkaSink) failed(err error, logType string, data []byte, messages []*sarama.ProducerMessage, events []json.RawMessage) error {
+	errs, ok := err.(sarama.ProducerErrors)
+	if !ok || len(errs) >= len(messages) {
+		return fmt.Errorf("Error sending messages %s", err)
+	}
+	failed := make(map[*sarama.ProducerMessage]bool)
+	for _, e := range errs {
+		failed[e.Msg] = true
+	}
+	var remaining []json.RawMessage
+	for i, m := range messages {
+		if failed[m] {
+			remaining = append(remaining, events[i])
+		}
+	}
+	return Partial(fmt.Errorf("Error sending %d of %d messages %s", len(errs), len(messages), err), remainingLogs(logType, data, remaining))
+}
+
+// Flush does nothing, the synchronous producer waits for messages to be sent
+func (s *KafkaSink) Flush() error {
+	return nil
+}
+
+// Close the producer and the connections to the brokers
+func (s *KafkaSink) Close() error {
+	return s.producer.Close()
+}
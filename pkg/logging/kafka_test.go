@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// Helper to create a kafka sink with a mock producer
+func mockKafkaSink(t *testing.T, topic string) (*KafkaSink, *mocks.SyncProducer) {
+	cfg := sarama.NewConfig()
+	cfg.Producer.Return.Successes = true
+	producer := mocks.NewSyncProducer(t, cfg)
+	return &KafkaSink{Configuration: KafkaConfiguration{Topic: topic}, producer: producer}, producer
+}
+
+// Helper to check the message sent for one event
+func checkKafkaMessage(logType, event string) mocks.ValueChecker {
+	return func(val []byte) error {
+		var m KafkaMessage
+		if err := json.Unmarshal(val, &m); err != nil {
+			return err
+		}
+		if m.Host != kafkaHost || m.UUID != "node-uuid" || m.Environment != "prod" || m.Type != logType {
+			return fmt.Errorf("unexpected message %s", string(val))
+		}
+		if string(m.Event) != event {
+			return fmt.Errorf("event %s, want %s", string(m.Event), event)
+		}
+		return nil
+	}
+}
+
+func TestNewKafkaSinkInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config KafkaConfiguration
+	}{
+		{"invalid version", KafkaConfiguration{Brokers: []string{"localhost:9092"}, Version: "nope"}},
+		{"invalid acks", KafkaConfiguration{Brokers: []string{"localhost:9092"}, Acks: "some"}},
+		{"invalid batch", KafkaConfiguration{Brokers: []string{"localhost:9092"}, BatchMessages: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKafkaSink(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestKafkaTopic(t *testing.T) {
+	tests := []struct {
+		topic string
+		want  string
+	}{
+		{"osquery", "osquery"},
+		{"osquery-{{ENVIRONMENT}}", "osquery-prod"},
+		{"osquery-{{ENVIRONMENT}}-{{TYPE}}", "osquery-prod-result"},
+		{"{{TYPE}}.{{TYPE}}", "result.result"},
+	}
+	for _, tt := range tests {
+		s := &KafkaSink{Configuration: KafkaConfiguration{Topic: tt.topic}}
+		if got := s.topic("prod", types.ResultLog); got != tt.want {
+			t.Errorf("topic(%s) = %s, want %s", tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestKafkaSend(t *testing.T) {
+	s, producer := mockKafkaSink(t, "osquery-{{TYPE}}")
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(checkKafkaMessage(types.ResultLog, `{"name":"first"}`))
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(checkKafkaMessage(types.ResultLog, `{"name":"second"}`))
+	if err := s.Send(types.ResultLog, []byte(`[{"name":"first"},{"name":"second"}]`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	// On-demand query results are sent as one message
+	producer.ExpectSendMessageWithCheckerFunctionAndSucceed(checkKafkaMessage(types.QueryLog, `{"result":[]}`))
+	if err := s.Send(types.QueryLog, []byte(`{"result":[]}`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKafkaSendErrors(t *testing.T) {
+	s, producer := mockKafkaSink(t, "osquery")
+	if err := s.Send(types.ResultLog, []byte(`{"not":"an array"}`), "prod", "node-uuid", false); err == nil {
+		t.Error("expected error for invalid log")
+	}
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	if err := s.Send(types.StatusLog, []byte(`[{"line":1}]`), "prod", "node-uuid", false); err == nil {
+		t.Error("expected error when the producer fails")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// partialProducer fails the messages with the provided events, to check partial deliveries
+type partialProducer struct {
+	fail map[string]bool
+}
+
+func (p *partialProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, p.SendMessages([]*sarama.ProducerMessage{msg})
+}
+
+func (p *partialProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	var errs sarama.ProducerErrors
+	for _, msg := range msgs {
+		val, err := msg.Value.Encode()
+		if err != nil {
+			return err
+		}
+		var m KafkaMessage
+		if err := json.Unmarshal(val, &m); err != nil {
+			return err
+		}
+		if p.fail[string(m.Event)] {
+			errs = append(errs, &sarama.ProducerError{Msg: msg, Err: sarama.ErrNotLeaderForPartition})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (p *partialProducer) Close() error {
+	return nil
+}
+
+func TestKafkaSendPartial(t *testing.T) {
+	producer := &partialProducer{fail: map[string]bool{`{"line":2}`: true, `{"line":4}`: true}}
+	s := &KafkaSink{Configuration: KafkaConfiguration{Topic: "osquery"}, producer: producer}
+	err := s.Send(types.StatusLog, []byte(`[{"line":1},{"line":2},{"line":3},{"line":4}]`), "prod", "node-uuid", false)
+	e, ok := err.(*DeliveryError)
+	if !ok || IsPermanent(err) {
+		t.Fatalf("expected partial delivery, got %v", err)
+	}
+	if string(e.Remaining) != `[{"line":2},{"line":4}]` {
+		t.Errorf("remaining logs %s", e.Remaining)
+	}
+	// Nothing was delivered, so all the logs can be sent again
+	err = s.Send(types.StatusLog, []byte(`[{"line":2}]`), "prod", "node-uuid", false)
+	if err == nil {
+		t.Fatal("expected error when all messages fail")
+	}
+	if _, ok := err.(*DeliveryError); ok {
+		t.Errorf("unexpected delivery error %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// ResultRow to hold one row from result logs, with the action that generated it
+type ResultRow struct {
+	UUID      string
+	Name      string
+	Action    string
+	Epoch     int64
+	Counter   int
+	Timestamp time.Time
+	Columns   json.RawMessage
+}
+
+// UnpackResults parses result logs into rows, one per event, per diffResults added/removed entry and per snapshot row
+func UnpackResults(data []byte) ([]ResultRow, error) {
+	var logs []types.LogResultData
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return nil, fmt.Errorf("error parsing logs %s %v", string(data), err)
+	}
+	var rows []ResultRow
+	for _, l := range logs {
+		timestamp := time.Unix(int64(l.UnixTime), 0).UTC()
+		if l.UnixTime == 0 {
+			timestamp = time.Now().UTC()
+		}
+		add := func(action string, columns json.RawMessage) {
+			rows = append(rows, ResultRow{
+				UUID:      l.HostIdentifier,
+				Name:      l.Name,
+				Action:    action,
+				Epoch:     l.Epoch,
+				Counter:   l.Counter,
+				Timestamp: timestamp,
+				Columns:   columns,
+			})
+		}
+		switch {
+		case l.Action == types.ResultSnapshot || len(l.Snapshot) > 0:
+			for _, c := range l.Snapshot {
+				add(types.ResultSnapshot, c)
+			}
+		case l.Action != "":
+			add(l.Action, l.Columns)
+		default:
+			for _, c := range l.DiffResults.Added {
+				add(types.ResultAdded, c)
+			}
+			for _, c := range l.DiffResults.Removed {
+				add(types.ResultRemoved, c)
+			}
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+func TestUnpackResults(t *testing.T) {
+	type row struct {
+		action  string
+		columns string
+	}
+	tests := []struct {
+		name string
+		data string
+		rows []row
+	}{
+		{
+			"event",
+			`[{"name":"pack_procs","hostIdentifier":"node-uuid","action":"added","columns":{"pid":"1"},"epoch":2,"counter":3,"unixTime":1570000000}]`,
+			[]row{{types.ResultAdded, `{"pid":"1"}`}},
+		},
+		{
+			"diffResults",
+			`[{"name":"pack_procs","hostIdentifier":"node-uuid","diffResults":{"added":[{"pid":"1"},{"pid":"2"}],"removed":[{"pid":"3"}]},"epoch":2,"counter":3,"unixTime":1570000000}]`,
+			[]row{{types.ResultAdded, `{"pid":"1"}`}, {types.ResultAdded, `{"pid":"2"}`}, {types.ResultRemoved, `{"pid":"3"}`}},
+		},
+		{
+			"snapshot",
+			`[{"name":"pack_procs","hostIdentifier":"node-uuid","action":"snapshot","snapshot":[{"pid":"1"},{"pid":"2"}],"epoch":2,"counter":3,"unixTime":1570000000}]`,
+			[]row{{types.ResultSnapshot, `{"pid":"1"}`}, {types.ResultSnapshot, `{"pid":"2"}`}},
+		},
+		{
+			"snapshot without action",
+			`[{"name":"pack_procs","hostIdentifier":"node-uuid","snapshot":[{"pid":"1"}],"epoch":2,"counter":3,"unixTime":1570000000}]`,
+			[]row{{types.ResultSnapshot, `{"pid":"1"}`}},
+		},
+		{
+			"empty diffResults",
+			`[{"name":"pack_procs","hostIdentifier":"node-uuid","diffResults":{"added":[],"removed":[]},"epoch":2,"counter":3,"unixTime":1570000000}]`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := UnpackResults([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.rows) {
+				t.Fatalf("%d rows, want %d", len(rows), len(tt.rows))
+			}
+			for i, r := range rows {
+				if r.Action != tt.rows[i].action || string(r.Columns) != tt.rows[i].columns {
+					t.Errorf("row %d is %s %s, want %+v", i, r.Action, string(r.Columns), tt.rows[i])
+				}
+				if r.UUID != "node-uuid" || r.Name != "pack_procs" || r.Epoch != 2 || r.Counter != 3 {
+					t.Errorf("unexpected row %+v", r)
+				}
+				if !r.Timestamp.Equal(time.Unix(1570000000, 0)) {
+					t.Errorf("timestamp %v", r.Timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestUnpackResultsErrors(t *testing.T) {
+	if _, err := UnpackResults([]byte(`{"name":"not an array"}`)); err == nil {
+		t.Error("expected error for invalid logs")
+	}
+	// Logs without time are stored with the current time
+	rows, err := UnpackResults([]byte(`[{"name":"q","action":"removed","columns":{}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || time.Since(rows[0].Timestamp) > time.Minute {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// Sink to be implemented by all logging destinations
+type Sink interface {
+	// Name of the logging destination
+	Name() string
+	// Send logs of one type from one node
+	Send(logType string, data []byte, environment, uuid string, debug bool) error
+	// Flush logs buffered by the logging destination
+	Flush() error
+	// Close the logging destination and release its resources
+	Close() error
+}
+
+// SinkOptions to pass everything logging destinations may need to be created
+type SinkOptions struct {
+	DB *gorm.DB
+}
+
+// SinkCreator to create a logging destination
+type SinkCreator func(opts SinkOptions) (Sink, error)
+
+// Registry of all available logging destinations
+var (
+	registry    = make(map[string]SinkCreator)
+	registryMux sync.RWMutex
+)
+
+// RegisterSink to make a logging destination available by name
+// Built-in destinations register themselves, external plugins can do the same in their init()
+func RegisterSink(name string, creator SinkCreator) {
+	registryMux.Lock()
+	defer registryMux.Unlock()
+	if _, ok := registry[name]; ok {
+		log.Printf("Logging destination %s is already registered, replacing it", name)
+	}
+	registry[name] = creator
+}
+
+// IsRegistered checks if a logging destination is available by name
+func IsRegistered(name string) bool {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	_, ok := registry[name]
+	return ok
+}
+
+// RegisteredSinks returns the names of all available logging destinations
+func RegisteredSinks() []string {
+	registryMux.RLock()
+	defer registryMux.RUnlock()
+	var names []string
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CreateSink creates a logging destination by name
+func CreateSink(name string, opts SinkOptions) (Sink, error) {
+	registryMux.RLock()
+	creator, ok := registry[name]
+	registryMux.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown logging destination %s", name)
+	}
+	return creator(opts)
+}
+
+// LoadPlugins opens all the plugins (.so) matching the pattern, so they register their logging destinations
+// Plugins must be built with the same toolchain and dependencies than the binary loading them
+func LoadPlugins(pattern string) error {
+	plugins, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, p := range plugins {
+		log.Printf("Loading logging plugin %s", p)
+		if _, err := plugin.Open(p); err != nil {
+			return fmt.Errorf("error loading %s - %v", p, err)
+		}
+	}
+	return nil
+}
+
+// DeliveryError is returned by logging destinations when logs were partially delivered or rejected
+// Remaining are the logs that can be sent again, in the same format, or nil when none of them can
+// Logs that failed with any other error were not delivered at all and can be sent again as they are
+type DeliveryError struct {
+	Err       error
+	Remaining []byte
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+// Permanent wraps an error for logs that must not be sent again, because they were rejected or already delivered
+func Permanent(err error) error {
+	return &DeliveryError{Err: err}
+}
+
+// Partial wraps an error for logs that were partially delivered, only the remaining ones can be sent again
+func Partial(err error, remaining []byte) error {
+	return &DeliveryError{Err: err, Remaining: remaining}
+}
+
+// IsPermanent checks if logs failed and none of them can be sent again
+func IsPermanent(err error) bool {
+	e, ok := err.(*DeliveryError)
+	return ok && e.Remaining == nil
+}
+
+// Helper to prepare the remaining logs of a partial delivery, the same JSON array of log lines
+// On-demand query logs are a single JSON blob that is kept as it is
+func remainingLogs(logType string, data []byte, logs []json.RawMessage) []byte {
+	if logType == types.QueryLog {
+		return data
+	}
+	remaining, err := json.Marshal(logs)
+	if err != nil {
+		return nil
+	}
+	return remaining
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+)
+
+// testSink to record the logs sent and fail when requested
+type testSink struct {
+	name string
+	err  error
+	sent []string
+}
+
+func (s *testSink) Name() string {
+	return s.name
+}
+
+func (s *testSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, logType+":"+string(data))
+	return nil
+}
+
+func (s *testSink) Flush() error {
+	return nil
+}
+
+func (s *testSink) Close() error {
+	return nil
+}
+
+// Helper to register a test sink, that is removed from the registry when the test ends
+func registerTestSink(t *testing.T, s *testSink) {
+	RegisterSink(s.name, func(opts SinkOptions) (Sink, error) {
+		if s.err == errSinkCreate {
+			return nil, s.err
+		}
+		return s, nil
+	})
+	t.Cleanup(func() {
+		registryMux.Lock()
+		delete(registry, s.name)
+		registryMux.Unlock()
+	})
+}
+
+var errSinkCreate = fmt.Errorf("sink can not be created")
+
+func TestBuiltinSinks(t *testing.T) {
+	for _, name := range []string{
+		settings.LoggingDB,
+		settings.LoggingELK,
+		settings.LoggingGraylog,
+		settings.LoggingKafka,
+		settings.LoggingSplunk,
+		settings.LoggingStdout,
+	} {
+		if !IsRegistered(name) {
+			t.Errorf("%s is not registered", name)
+		}
+	}
+	if IsRegistered("unknown") {
+		t.Error("unknown is registered")
+	}
+}
+
+func TestRegisterSink(t *testing.T) {
+	first := &testSink{name: "test-sink"}
+	registerTestSink(t, first)
+	if !IsRegistered("test-sink") {
+		t.Fatal("test-sink is not registered")
+	}
+	names := RegisteredSinks()
+	found := false
+	for i, n := range names {
+		found = found || n == "test-sink"
+		if i > 0 && names[i-1] > n {
+			t.Errorf("names are not sorted %v", names)
+		}
+	}
+	if !found {
+		t.Errorf("test-sink missing in %v", names)
+	}
+	// Registering the same name again replaces the creator
+	second := &testSink{name: "test-sink"}
+	registerTestSink(t, second)
+	s, err := CreateSink("test-sink", SinkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != Sink(second) {
+		t.Error("expected the second sink to be created")
+	}
+	if _, err := CreateSink("unknown", SinkOptions{}); err == nil {
+		t.Error("expected error for an unknown sink")
+	}
+}
@@ -1,11 +1,14 @@
-package main
+package logging
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/jmpsec/osctrl/pkg/settings"
 	"github.com/jmpsec/osctrl/pkg/types"
 	"github.com/jmpsec/osctrl/pkg/utils"
 )
@@ -19,6 +22,13 @@ const (
 	splunkIndex string = "osquery"
 )
 
+// SlunkConfiguration to hold all splunk configuration values
+type SlunkConfiguration struct {
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Search string `json:"search"`
+}
+
 // SplunkMessage to handle log format to be sent to Splunk
 type SplunkMessage struct {
 	Time       int64       `json:"time"`
@@ -29,11 +39,34 @@ type SplunkMessage struct {
 	Event      interface{} `json:"event"`
 }
 
-// SplunkSend - Function that sends JSON logs to Splunk HTTP Event Collector
-func SplunkSend(logType string, data []byte, environment, uuid, url, token string, debug bool) {
+// SplunkSink to send logs to Splunk HTTP Event Collector
+type SplunkSink struct {
+	Configuration SlunkConfiguration
+}
+
+func init() {
+	RegisterSink(settings.LoggingSplunk, CreateSplunkSink)
+}
+
+// CreateSplunkSink to initialize the splunk logging destination from config/splunk.json
+func CreateSplunkSink(opts SinkOptions) (Sink, error) {
+	s := &SplunkSink{}
+	if err := loadConfiguration(settings.LoggingSplunk, &s.Configuration); err != nil {
+		return nil, fmt.Errorf("Failed to load splunk json - %v", err)
+	}
+	return s, nil
+}
+
+// Name of the logging destination
+func (s *SplunkSink) Name() string {
+	return settings.LoggingSplunk
+}
+
+// Send - Function that sends JSON logs to Splunk HTTP Event Collector
+func (s *SplunkSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
 	// Prepare headers
 	headers := map[string]string{
-		"Authorization": "Splunk " + token,
+		"Authorization": "Splunk " + s.Configuration.Token,
 		"Content-Type":  "application/json",
 	}
 	// Check if this is result/status or query
@@ -77,18 +110,32 @@ func SplunkSend(logType string, data []byte, environment, uuid, url, token strin
 	// Serialize data for Splunk
 	jsonEvents, err := json.Marshal(events)
 	if err != nil {
-		log.Printf("Error parsing data %s", err)
+		return fmt.Errorf("Error parsing data %s", err)
 	}
 	jsonParam := strings.NewReader(string(jsonEvents))
 	if debug {
 		log.Printf("Sending %d bytes to Splunk for %s - %s", len(data), environment, uuid)
 	}
 	// Send log with a POST to the Splunk URL
-	resp, body, err := utils.SendRequest(true, splunkMethod, url, jsonParam, headers)
+	resp, body, err := utils.SendRequest(true, splunkMethod, s.Configuration.URL, jsonParam, headers)
 	if err != nil {
-		log.Printf("Error sending request %s", err)
+		return fmt.Errorf("Error sending request %s", err)
 	}
 	if debug {
 		log.Printf("Splunk: HTTP %d %s", resp, body)
 	}
+	if resp != http.StatusOK {
+		return fmt.Errorf("Splunk: HTTP %d %s", resp, body)
+	}
+	return nil
+}
+
+// Flush does nothing, logs are sent as they come
+func (s *SplunkSink) Flush() error {
+	return nil
+}
+
+// Close does nothing, there are no open connections
+func (s *SplunkSink) Close() error {
+	return nil
 }
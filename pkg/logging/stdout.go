@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// Extension for log files
+	stdoutExtension = ".log"
+)
+
+// StdoutConfiguration to hold all stdout configuration values
+// Without directory, logs are written to stdout. Otherwise to one file per environment and log type
+// Max size is in megabytes, rotate is in hours and max age is in days
+type StdoutConfiguration struct {
+	Directory  string `json:"directory"`
+	MaxSize    int    `json:"max_size" mapstructure:"max_size"`
+	Rotate     int    `json:"rotate"`
+	Compress   bool   `json:"compress"`
+	MaxBackups int    `json:"max_backups" mapstructure:"max_backups"`
+	MaxAge     int    `json:"max_age" mapstructure:"max_age"`
+}
+
+// StdoutMessage to handle log format to be written as one JSON line
+type StdoutMessage struct {
+	Time        int64           `json:"time"`
+	UUID        string          `json:"uuid"`
+	Environment string          `json:"environment"`
+	Type        string          `json:"type"`
+	Event       json.RawMessage `json:"event"`
+}
+
+// rotatingFile to keep one log file per environment and log type
+type rotatingFile struct {
+	logger  *lumberjack.Logger
+	created time.Time
+}
+
+// StdoutSink to write logs to stdout or to files
+type StdoutSink struct {
+	Configuration StdoutConfiguration
+	files         map[string]*rotatingFile
+	mux           sync.Mutex
+}
+
+func init() {
+	RegisterSink(settings.LoggingStdout, CreateStdoutSink)
+}
+
+// CreateStdoutSink to initialize the stdout logging destination, a missing config/stdout.json means stdout
+func CreateStdoutSink(opts SinkOptions) (Sink, error) {
+	var cfg StdoutConfiguration
+	if err := loadConfiguration(settings.LoggingStdout, &cfg); err != nil {
+		log.Printf("Failed to load stdout json, using stdout - %v", err)
+		cfg = StdoutConfiguration{}
+	}
+	return NewStdoutSink(cfg)
+}
+
+// NewStdoutSink prepares the sink to write logs, an empty directory means stdout
+func NewStdoutSink(cfg StdoutConfiguration) (*StdoutSink, error) {
+	if cfg.Directory != "" {
+		if err := os.MkdirAll(cfg.Directory, 0750); err != nil {
+			return nil, fmt.Errorf("error creating %s - %v", cfg.Directory, err)
+		}
+	}
+	return &StdoutSink{
+		Configuration: cfg,
+		files:         make(map[string]*rotatingFile),
+	}, nil
+}
+
+// Name of the logging destination
+func (s *StdoutSink) Name() string {
+	return settings.LoggingStdout
+}
+
+// Helper to get the writer for an environment and log type, rotating by time if needed
+// It must be called with the mutex locked
+func (s *StdoutSink) writer(environment, logType string) io.Writer {
+	if s.Configuration.Directory == "" {
+		return os.Stdout
+	}
+	name := environment + "-" + logType
+	f, ok := s.files[name]
+	if !ok {
+		f = &rotatingFile{
+			logger: &lumberjack.Logger{
+				Filename:   filepath.Join(s.Configuration.Directory, name+stdoutExtension),
+				MaxSize:    s.Configuration.MaxSize,
+				MaxBackups: s.Configuration.MaxBackups,
+				MaxAge:     s.Configuration.MaxAge,
+				Compress:   s.Configuration.Compress,
+				LocalTime:  false,
+			},
+			created: time.Now(),
+		}
+		s.files[name] = f
+	}
+	rotate := time.Duration(s.Configuration.Rotate) * time.Hour
+	if rotate > 0 && time.Since(f.created) >= rotate {
+		if err := f.logger.Rotate(); err != nil {
+			log.Printf("error rotating %s - %v", f.logger.Filename, err)
+		}
+		f.created = time.Now()
+	}
+	return f.logger
+}
+
+// Send - Function that writes JSON logs as one line per log
+func (s *StdoutSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	// Check if this is result/status or query
+	var logs []json.RawMessage
+	if logType == types.QueryLog {
+		// For on-demand queries, just a JSON blob with results and statuses
+		logs = append(logs, json.RawMessage(data))
+	} else {
+		// For scheduled queries, convert the array in multiple lines
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return fmt.Errorf("error parsing log %s %v", string(data), err)
+		}
+	}
+	var lines []byte
+	now := time.Now().Unix()
+	for _, l := range logs {
+		jsonLine, err := json.Marshal(StdoutMessage{
+			Time:        now,
+			UUID:        uuid,
+			Environment: environment,
+			Type:        logType,
+			Event:       l,
+		})
+		if err != nil {
+			log.Printf("Error parsing data %s", err)
+			continue
+		}
+		lines = append(lines, jsonLine...)
+		lines = append(lines, '\n')
+	}
+	if debug {
+		log.Printf("Writing %d bytes for %s - %s", len(data), environment, uuid)
+	}
+	// All lines are written at once, so they are not mixed with other logs
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, err := s.writer(environment, logType).Write(lines); err != nil {
+		return fmt.Errorf("error writing logs %v", err)
+	}
+	return nil
+}
+
+// Flush does nothing, lines are written as they come
+func (s *StdoutSink) Flush() error {
+	return nil
+}
+
+// Close all the open log files
+func (s *StdoutSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var err error
+	for name, f := range s.files {
+		if errClose := f.logger.Close(); errClose != nil {
+			err = errClose
+		}
+		delete(s.files, name)
+	}
+	return err
+}
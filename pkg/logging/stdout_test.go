@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// Helper to read the log lines written to one file
+func readStdoutLines(t *testing.T, path string) []StdoutMessage {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []StdoutMessage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m StdoutMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("invalid line %s - %v", scanner.Text(), err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestStdoutSendFiles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStdoutSink(StdoutConfiguration{Directory: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send(types.ResultLog, []byte(`[{"name":"first"},{"name":"second"}]`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.QueryLog, []byte(`{"result":[]}`), "dev", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.StatusLog, []byte(`{"not":"an array"}`), "prod", "node-uuid", false); err == nil {
+		t.Error("expected error for invalid log")
+	}
+	results := readStdoutLines(t, filepath.Join(dir, "prod-result.log"))
+	if len(results) != 2 || string(results[0].Event) != `{"name":"first"}` || string(results[1].Event) != `{"name":"second"}` {
+		t.Errorf("unexpected result lines %+v", results)
+	}
+	if results[0].UUID != "node-uuid" || results[0].Environment != "prod" || results[0].Type != types.ResultLog {
+		t.Errorf("unexpected result line %+v", results[0])
+	}
+	queries := readStdoutLines(t, filepath.Join(dir, "dev-query.log"))
+	if len(queries) != 1 || string(queries[0].Event) != `{"result":[]}` {
+		t.Errorf("unexpected query lines %+v", queries)
+	}
+}
+
+func TestStdoutRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		rotate int
+		files  int
+	}{
+		{"rotation disabled", 0, 1},
+		{"rotation due", 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewStdoutSink(StdoutConfiguration{Directory: dir, Rotate: tt.rotate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := s.Send(types.ResultLog, []byte(`[{"line":1}]`), "prod", "node-uuid", false); err != nil {
+				t.Fatal(err)
+			}
+			// Pretend the file was created two hours ago
+			s.files["prod-result"].created = time.Now().Add(-2 * time.Hour)
+			if err := s.Send(types.ResultLog, []byte(`[{"line":2}]`), "prod", "node-uuid", false); err != nil {
+				t.Fatal(err)
+			}
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != tt.files {
+				t.Fatalf("%d files, want %d", len(files), tt.files)
+			}
+			lines := readStdoutLines(t, filepath.Join(dir, "prod-result.log"))
+			if len(lines) != 3-tt.files || string(lines[len(lines)-1].Event) != `{"line":2}` {
+				t.Errorf("unexpected lines %+v", lines)
+			}
+			if tt.rotate > 0 && time.Since(s.files["prod-result"].created) > time.Minute {
+				t.Error("expected the rotation time to be reset")
+			}
+		})
+	}
+}
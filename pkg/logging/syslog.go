@@ -0,0 +1,281 @@
+package logging
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+const (
+	// Application name for syslog messages
+	syslogAppName = "osctrl"
+	// Version of the syslog protocol, RFC 5424
+	syslogVersion = 1
+	// Structured data ID, using the private enterprise number for documentation
+	syslogSDID = "osctrl@32473"
+	// Default facility (local0)
+	syslogDefaultFacility = 16
+	// Default severity (informational)
+	syslogDefaultSeverity = 6
+	// Default timeout in seconds to connect and write
+	syslogDefaultTimeout = 10
+	// Value for empty fields in the syslog header
+	syslogNil = "-"
+)
+
+// Transports for syslog messages
+const (
+	syslogUDP = "udp"
+	syslogTCP = "tcp"
+	syslogTLS = "tls"
+)
+
+// SyslogConfiguration to hold all syslog configuration values
+// Protocol can be udp, tcp or tls. TCP and TLS messages use octet-counted framing (RFC 6587 and RFC 5425)
+// Facility and severity are pointers, so 0 (kern and emerg) can be configured and unset values use the defaults
+type SyslogConfiguration struct {
+	Protocol   string `json:"protocol"`
+	Address    string `json:"address"`
+	Facility   *int   `json:"facility"`
+	Severity   *int   `json:"severity"`
+	AppName    string `json:"app_name" mapstructure:"app_name"`
+	CA         string `json:"ca"`
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	ServerName string `json:"server_name" mapstructure:"server_name"`
+	Timeout    int    `json:"timeout"`
+}
+
+// SyslogSink to send logs to a syslog server using RFC 5424
+type SyslogSink struct {
+	Configuration SyslogConfiguration
+	hostname      string
+	facility      int
+	severity      int
+	tlsConfig     *tls.Config
+	conn          net.Conn
+	mux           sync.Mutex
+}
+
+func init() {
+	RegisterSink(settings.LoggingSyslog, CreateSyslogSink)
+}
+
+// CreateSyslogSink to initialize the syslog logging destination from config/syslog.json
+func CreateSyslogSink(opts SinkOptions) (Sink, error) {
+	var cfg SyslogConfiguration
+	if err := loadConfiguration(settings.LoggingSyslog, &cfg); err != nil {
+		return nil, fmt.Errorf("Failed to load syslog json - %v", err)
+	}
+	return NewSyslogSink(cfg)
+}
+
+// NewSyslogSink prepares the sink and connects to the syslog server
+func NewSyslogSink(cfg SyslogConfiguration) (*SyslogSink, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("syslog address can not be empty")
+	}
+	switch cfg.Protocol {
+	case "":
+		cfg.Protocol = syslogUDP
+	case syslogUDP, syslogTCP, syslogTLS:
+	default:
+		return nil, fmt.Errorf("invalid syslog protocol %s", cfg.Protocol)
+	}
+	facility := syslogDefaultFacility
+	if cfg.Facility != nil {
+		if *cfg.Facility < 0 || *cfg.Facility > 23 {
+			return nil, fmt.Errorf("invalid syslog facility %d, must be between 0 and 23", *cfg.Facility)
+		}
+		facility = *cfg.Facility
+	}
+	severity := syslogDefaultSeverity
+	if cfg.Severity != nil {
+		if *cfg.Severity < 0 || *cfg.Severity > 7 {
+			return nil, fmt.Errorf("invalid syslog severity %d, must be between 0 and 7", *cfg.Severity)
+		}
+		severity = *cfg.Severity
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = syslogAppName
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = syslogDefaultTimeout
+	}
+	s := &SyslogSink{Configuration: cfg, facility: facility, severity: severity}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = syslogNil
+	}
+	s.hostname = hostname
+	if cfg.Protocol == syslogTLS {
+		if s.tlsConfig, err = syslogTLSConfig(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Helper to prepare the TLS configuration, with a custom CA and client certificate if provided
+func syslogTLSConfig(cfg SyslogConfiguration) (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: cfg.ServerName}
+	if tlsCfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address %s - %v", cfg.Address, err)
+		}
+		tlsCfg.ServerName = host
+	}
+	if cfg.CA != "" {
+		pem, err := ioutil.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA %s - %v", cfg.CA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA %s", cfg.CA)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.Cert != "" && cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate - %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Helper to connect to the syslog server
+// It must be called with the mutex locked or before the sink is used
+func (s *SyslogSink) connect() error {
+	timeout := time.Duration(s.Configuration.Timeout) * time.Second
+	var conn net.Conn
+	var err error
+	switch s.Configuration.Protocol {
+	case syslogTLS:
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", s.Configuration.Address, s.tlsConfig)
+	default:
+		conn, err = net.DialTimeout(s.Configuration.Protocol, s.Configuration.Address, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to syslog %s - %v", s.Configuration.Address, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Name of the logging destination
+func (s *SyslogSink) Name() string {
+	return settings.LoggingSyslog
+}
+
+// Helper to escape values of structured data parameters
+func syslogEscape(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	return r.Replace(value)
+}
+
+// Helper to format one log line as RFC 5424 message
+func (s *SyslogSink) format(logType, environment, uuid string, msg []byte) []byte {
+	pri := s.facility*8 + s.severity
+	sd := fmt.Sprintf(`[%s environment="%s" uuid="%s" type="%s"]`,
+		syslogSDID, syslogEscape(environment), syslogEscape(uuid), syslogEscape(logType))
+	header := fmt.Sprintf("<%d>%d %s %s %s %s %s %s ",
+		pri,
+		syslogVersion,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.Configuration.AppName,
+		syslogNil,
+		logType,
+		sd)
+	return append([]byte(header), msg...)
+}
+
+// Helper to frame one message for the transport, octet-counted for TCP and TLS
+func (s *SyslogSink) frame(message []byte) []byte {
+	if s.Configuration.Protocol == syslogUDP {
+		return message
+	}
+	return append([]byte(strconv.Itoa(len(message))+" "), message...)
+}
+
+// Send - Function that sends JSON logs to syslog, one message per log line
+func (s *SyslogSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	// Check if this is result/status or query
+	var logs []json.RawMessage
+	if logType == types.QueryLog {
+		// For on-demand queries, just a JSON blob with results and statuses
+		logs = append(logs, json.RawMessage(data))
+	} else {
+		// For scheduled queries, convert the array in multiple messages
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return Permanent(fmt.Errorf("error parsing log %s %v", string(data), err))
+		}
+	}
+	if debug {
+		log.Printf("Sending %d bytes to syslog %s for %s - %s", len(data), s.Configuration.Address, environment, uuid)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	timeout := time.Duration(s.Configuration.Timeout) * time.Second
+	for i, l := range logs {
+		// Reconnect if the previous write failed
+		if s.conn == nil {
+			if err := s.connect(); err != nil {
+				return s.failed(err, logType, data, logs, i)
+			}
+		}
+		if err := s.conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			log.Printf("error setting syslog deadline %v", err)
+		}
+		if _, err := s.conn.Write(s.frame(s.format(logType, environment, uuid, l))); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+			return s.failed(fmt.Errorf("error writing to syslog %v", err), logType, data, logs, i)
+		}
+	}
+	return nil
+}
+
+// Helper to return the error of a send, only the messages from the failed one can be sent again
+func (s *SyslogSink) failed(err error, logType string, data []byte, logs []json.RawMessage, sent int) error {
+	if sent == 0 {
+		return err
+	}
+	return Partial(fmt.Errorf("%v - %d of %d messages sent", err, sent, len(logs)), remainingLogs(logType, data, logs[sent:]))
+}
+
+// Flush does nothing, messages are written as they come
+func (s *SyslogSink) Flush() error {
+	return nil
+}
+
+// Close the connection to the syslog server
+func (s *SyslogSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,153 @@
+package logging
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// Helper to read octet-counted frames from a TCP connection
+func readSyslogFrames(t *testing.T, conn net.Conn, count int) []string {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	var frames []string
+	for i := 0; i < count; i++ {
+		length, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatalf("error reading frame length - %v", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Fatalf("invalid frame length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, string(msg))
+	}
+	return frames
+}
+
+func TestSyslogFormat(t *testing.T) {
+	zero, local7, warning := 0, 23, 4
+	tests := []struct {
+		name     string
+		facility *int
+		severity *int
+		pri      string
+	}{
+		{"defaults", nil, nil, "<134>"},
+		{"kern and emerg", &zero, &zero, "<0>"},
+		{"local7 and warning", &local7, &warning, "<188>"},
+	}
+	header := regexp.MustCompile(`^<\d+>1 (\S+) host osctrl - result \[osctrl@32473 environment="prod" uuid="node\\"uuid\\]" type="result"\] \{"name":"launchd"\}$`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SyslogSink{
+				Configuration: SyslogConfiguration{AppName: syslogAppName},
+				hostname:      "host",
+				facility:      syslogDefaultFacility,
+				severity:      syslogDefaultSeverity,
+			}
+			if tt.facility != nil {
+				s.facility = *tt.facility
+			}
+			if tt.severity != nil {
+				s.severity = *tt.severity
+			}
+			msg := string(s.format(types.ResultLog, "prod", `node"uuid]`, []byte(`{"name":"launchd"}`)))
+			if !strings.HasPrefix(msg, tt.pri) {
+				t.Errorf("message %s, want priority %s", msg, tt.pri)
+			}
+			m := header.FindStringSubmatch(msg)
+			if m == nil {
+				t.Fatalf("unexpected message %s", msg)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, m[1]); err != nil {
+				t.Errorf("invalid timestamp %s", m[1])
+			}
+		})
+	}
+}
+
+func TestSyslogFrame(t *testing.T) {
+	tests := []struct {
+		protocol string
+		want     string
+	}{
+		{syslogUDP, "<134>1 message"},
+		{syslogTCP, "14 <134>1 message"},
+		{syslogTLS, "14 <134>1 message"},
+	}
+	for _, tt := range tests {
+		s := &SyslogSink{Configuration: SyslogConfiguration{Protocol: tt.protocol}}
+		if got := string(s.frame([]byte("<134>1 message"))); got != tt.want {
+			t.Errorf("frame(%s) = %q, want %q", tt.protocol, got, tt.want)
+		}
+	}
+}
+
+func TestNewSyslogSinkInvalid(t *testing.T) {
+	negative, facility, severity := -1, 24, 8
+	tests := []struct {
+		name   string
+		config SyslogConfiguration
+	}{
+		{"missing address", SyslogConfiguration{}},
+		{"invalid protocol", SyslogConfiguration{Address: "localhost:514", Protocol: "http"}},
+		{"negative facility", SyslogConfiguration{Address: "localhost:514", Facility: &negative}},
+		{"invalid facility", SyslogConfiguration{Address: "localhost:514", Facility: &facility}},
+		{"invalid severity", SyslogConfiguration{Address: "localhost:514", Severity: &severity}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSyslogSink(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestSyslogSendTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, err := NewSyslogSink(SyslogConfiguration{Protocol: syslogTCP, Address: l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := s.Send(types.ResultLog, []byte(`[{"line":1},{"line":"two words"}]`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.QueryLog, []byte(`{"result":[]}`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	frames := readSyslogFrames(t, conn, 3)
+	for i, suffix := range []string{`] {"line":1}`, `] {"line":"two words"}`, `] {"result":[]}`} {
+		if !strings.HasPrefix(frames[i], "<134>1 ") || !strings.HasSuffix(frames[i], suffix) {
+			t.Errorf("unexpected frame %s", frames[i])
+		}
+	}
+	if !strings.Contains(frames[2], ` osctrl - query [osctrl@32473 environment="prod" uuid="node-uuid" type="query"] `) {
+		t.Errorf("unexpected header in %s", frames[2])
+	}
+	if err := s.Send(types.StatusLog, []byte(`{"not":"an array"}`), "prod", "node-uuid", false); err == nil {
+		t.Error("expected error for invalid log")
+	}
+}
@@ -0,0 +1,312 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jmpsec/osctrl/pkg/settings"
+	"github.com/jmpsec/osctrl/pkg/types"
+	"github.com/jmpsec/osctrl/pkg/utils"
+)
+
+const (
+	// Host as source for webhook events
+	webhookHost = "osctrl"
+	// Index for webhook events
+	webhookIndex = "osquery"
+	// Default method to send requests
+	webhookMethod = "POST"
+	// Default header for the HMAC signature
+	webhookSignatureHeader = "X-Osctrl-Signature"
+	// Prefix for the HMAC signature
+	webhookSignaturePrefix = "sha256="
+	// Default number of events per request
+	webhookDefaultBatch = 100
+	// Default number of retries
+	webhookDefaultRetries = 3
+	// Default initial backoff in milliseconds
+	webhookDefaultBackoff = 500
+	// Default template, one JSON object per event
+	webhookDefaultTemplate = `{"time":{{.Time}},"host":{{json .Host}},"source":{{json .Source}},"sourcetype":{{json .SourceType}},"index":{{json .Index}},"environment":{{json .Environment}},"event":{{.Event}}}`
+)
+
+// Types of authentication for webhooks
+const (
+	webhookAuthBearer = "bearer"
+	webhookAuthBasic  = "basic"
+)
+
+// WebhookConfiguration to hold all webhook configuration values
+// Template is a Go template rendered for each event with the fields of WebhookMessage
+// Rendered events are joined with newlines, or as a JSON array if array is true
+// TLS certificates are verified unless insecure is true
+type WebhookConfiguration struct {
+	URL        string            `json:"url"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	Auth       string            `json:"auth"`
+	Token      string            `json:"token"`
+	Username   string            `json:"username"`
+	Password   string            `json:"password"`
+	HMACSecret string            `json:"hmac_secret" mapstructure:"hmac_secret"`
+	HMACHeader string            `json:"hmac_header" mapstructure:"hmac_header"`
+	Template   string            `json:"template"`
+	Array      bool              `json:"array"`
+	Batch      int               `json:"batch"`
+	Gzip       bool              `json:"gzip"`
+	Retries    int               `json:"retries"`
+	Backoff    int               `json:"backoff"`
+	Insecure   bool              `json:"insecure"`
+}
+
+// WebhookMessage with the fields available to the template, same as SplunkMessage plus the environment
+// Event is the JSON of the log, ready to be embedded in JSON templates
+type WebhookMessage struct {
+	Time        int64
+	Host        string
+	Source      string
+	SourceType  string
+	Index       string
+	Environment string
+	Event       string
+}
+
+// WebhookSink to send logs to any HTTP collector
+type WebhookSink struct {
+	Configuration WebhookConfiguration
+	template      *template.Template
+	headers       map[string]string
+}
+
+func init() {
+	RegisterSink(settings.LoggingWebhook, CreateWebhookSink)
+}
+
+// CreateWebhookSink to initialize the webhook logging destination from config/webhook.json
+func CreateWebhookSink(opts SinkOptions) (Sink, error) {
+	var cfg WebhookConfiguration
+	if err := loadConfiguration(settings.LoggingWebhook, &cfg); err != nil {
+		return nil, fmt.Errorf("Failed to load webhook json - %v", err)
+	}
+	return NewWebhookSink(cfg)
+}
+
+// NewWebhookSink prepares the sink, parsing the template and preparing headers
+func NewWebhookSink(cfg WebhookConfiguration) (*WebhookSink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook URL can not be empty")
+	}
+	if cfg.Method == "" {
+		cfg.Method = webhookMethod
+	}
+	if cfg.HMACHeader == "" {
+		cfg.HMACHeader = webhookSignatureHeader
+	}
+	if cfg.Template == "" {
+		cfg.Template = webhookDefaultTemplate
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = webhookDefaultBatch
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = webhookDefaultRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = webhookDefaultBackoff
+	}
+	tmpl, err := template.New(settings.LoggingWebhook).Funcs(template.FuncMap{
+		"json": webhookJSON,
+	}).Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing webhook template - %v", err)
+	}
+	s := &WebhookSink{
+		Configuration: cfg,
+		template:      tmpl,
+		headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}
+	for k, v := range cfg.Headers {
+		s.headers[k] = v
+	}
+	switch strings.ToLower(cfg.Auth) {
+	case webhookAuthBearer:
+		s.headers["Authorization"] = "Bearer " + cfg.Token
+	case webhookAuthBasic:
+		auth := base64.StdEncoding.EncodeToString([]byte(cfg.Username + ":" + cfg.Password))
+		s.headers["Authorization"] = "Basic " + auth
+	case "":
+	default:
+		return nil, fmt.Errorf("invalid webhook auth %s", cfg.Auth)
+	}
+	if cfg.Gzip {
+		s.headers["Content-Encoding"] = "gzip"
+	}
+	return s, nil
+}
+
+// Helper for templates to encode values as JSON
+func webhookJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Name of the logging destination
+func (s *WebhookSink) Name() string {
+	return settings.LoggingWebhook
+}
+
+// Send - Function that sends JSON logs to the webhook, in batches of events
+func (s *WebhookSink) Send(logType string, data []byte, environment, uuid string, debug bool) error {
+	// Check if this is result/status or query, same as splunk
+	var sourceType string
+	var logs []json.RawMessage
+	if logType == types.QueryLog {
+		sourceType = logType
+		// For on-demand queries, just a JSON blob with results and statuses
+		logs = append(logs, json.RawMessage(data))
+	} else {
+		sourceType = logType + ":" + environment
+		// For scheduled queries, convert the array in multiple events
+		if err := json.Unmarshal(data, &logs); err != nil {
+			return Permanent(fmt.Errorf("error parsing log %s %v", string(data), err))
+		}
+	}
+	// Render all events using the template
+	var events [][]byte
+	now := time.Now().Unix()
+	for _, l := range logs {
+		var buf bytes.Buffer
+		err := s.template.Execute(&buf, WebhookMessage{
+			Time:        now,
+			Host:        webhookHost,
+			Source:      uuid,
+			SourceType:  sourceType,
+			Index:       webhookIndex,
+			Environment: environment,
+			Event:       string(l),
+		})
+		if err != nil {
+			return Permanent(fmt.Errorf("error rendering webhook template %v", err))
+		}
+		events = append(events, buf.Bytes())
+	}
+	if debug {
+		log.Printf("Sending %d bytes to webhook for %s - %s", len(data), environment, uuid)
+	}
+	// Send events in batches, rejected batches are skipped and the rest stop at the first failure
+	rejected := 0
+	for i := 0; i < len(events); i += s.Configuration.Batch {
+		end := i + s.Configuration.Batch
+		if end > len(events) {
+			end = len(events)
+		}
+		err := s.post(s.payload(events[i:end]), debug)
+		if err == nil {
+			continue
+		}
+		if IsPermanent(err) {
+			log.Printf("Webhook: dropping %d rejected events - %v", end-i, err)
+			rejected += end - i
+			continue
+		}
+		// Nothing was delivered, so all the logs can be sent again
+		if i == 0 {
+			return err
+		}
+		return Partial(fmt.Errorf("%v - %d of %d events delivered", err, i-rejected, len(events)), remainingLogs(logType, data, logs[i:]))
+	}
+	if rejected > 0 {
+		return Permanent(fmt.Errorf("Webhook: %d of %d events rejected", rejected, len(events)))
+	}
+	return nil
+}
+
+// Helper to join rendered events into one payload
+func (s *WebhookSink) payload(events [][]byte) []byte {
+	if s.Configuration.Array {
+		return append(append([]byte{'['}, bytes.Join(events, []byte{','})...), ']')
+	}
+	return bytes.Join(events, []byte{'\n'})
+}
+
+// Helper to send one payload, compressed and signed if configured, retrying on server errors
+// Payloads rejected by the collector are a permanent error, they would be rejected again
+func (s *WebhookSink) post(payload []byte, debug bool) error {
+	body := payload
+	if s.Configuration.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(payload); err != nil {
+			return Permanent(fmt.Errorf("error compressing payload %v", err))
+		}
+		if err := gz.Close(); err != nil {
+			return Permanent(fmt.Errorf("error compressing payload %v", err))
+		}
+		body = buf.Bytes()
+	}
+	headers := s.headers
+	// Signature is for the body as it is sent, after compression
+	if s.Configuration.HMACSecret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Configuration.HMACSecret))
+		_, _ = mac.Write(body)
+		headers = make(map[string]string)
+		for k, v := range s.headers {
+			headers[k] = v
+		}
+		headers[s.Configuration.HMACHeader] = webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+	}
+	backoff := time.Duration(s.Configuration.Backoff) * time.Millisecond
+	var err error
+	for i := 0; i <= s.Configuration.Retries; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var resp int
+		var respBody []byte
+		resp, respBody, err = utils.SendRequest(s.Configuration.Insecure, s.Configuration.Method, s.Configuration.URL, bytes.NewReader(body), headers)
+		if debug {
+			log.Printf("Webhook: HTTP %d %s", resp, respBody)
+		}
+		if err != nil {
+			err = fmt.Errorf("Error sending request %s", err)
+			continue
+		}
+		if resp >= http.StatusInternalServerError {
+			err = fmt.Errorf("Webhook: HTTP %d %s", resp, respBody)
+			continue
+		}
+		if resp == http.StatusTooManyRequests {
+			err = fmt.Errorf("Webhook: HTTP %d %s", resp, respBody)
+			continue
+		}
+		if resp < http.StatusOK || resp >= http.StatusMultipleChoices {
+			return Permanent(fmt.Errorf("Webhook: HTTP %d %s", resp, respBody))
+		}
+		return nil
+	}
+	return err
+}
+
+// Flush does nothing, events are sent as they come
+func (s *WebhookSink) Flush() error {
+	return nil
+}
+
+// Close does nothing, there are no open connections
+func (s *WebhookSink) Close() error {
+	return nil
+}
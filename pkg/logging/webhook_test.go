@@ -0,0 +1,203 @@
+package logging
+
+import (
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jmpsec/osctrl/pkg/types"
+)
+
+// webhookRequest as received by the test server
+type webhookRequest struct {
+	header http.Header
+	raw    []byte
+	body   string
+}
+
+// Helper to start a server that records requests and answers with the given status codes
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, func() []webhookRequest) {
+	var mux sync.Mutex
+	var requests []webhookRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		body := string(raw)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			plain, err := ioutil.ReadAll(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = string(plain)
+		}
+		mux.Lock()
+		requests = append(requests, webhookRequest{header: r.Header, raw: raw, body: body})
+		status := http.StatusOK
+		if len(requests) <= len(statuses) {
+			status = statuses[len(requests)-1]
+		}
+		mux.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []webhookRequest {
+		mux.Lock()
+		defer mux.Unlock()
+		return requests
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		array    bool
+		want     string
+	}{
+		{"custom lines", `{{.Environment}} {{.SourceType}} {{.Source}} {{.Event}}`, false,
+			"prod result:prod node-uuid {\"name\":\"first\"}\nprod result:prod node-uuid {\"name\":\"second\"}"},
+		{"custom array", `{"env":{{json .Environment}},"e":{{.Event}}}`, true,
+			`[{"env":"prod","e":{"name":"first"}},{"env":"prod","e":{"name":"second"}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := webhookServer(t)
+			s, err := NewWebhookSink(WebhookConfiguration{URL: srv.URL, Template: tt.template, Array: tt.array})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Send(types.ResultLog, []byte(`[{"name":"first"},{"name":"second"}]`), "prod", "node-uuid", false); err != nil {
+				t.Fatal(err)
+			}
+			if r := requests(); len(r) != 1 || r[0].body != tt.want {
+				t.Errorf("got requests %+v, want body %s", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookDefaultTemplate(t *testing.T) {
+	srv, requests := webhookServer(t)
+	s, err := NewWebhookSink(WebhookConfiguration{URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.QueryLog, []byte(`{"result":[]}`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	r := requests()
+	if len(r) != 1 {
+		t.Fatalf("%d requests, want 1", len(r))
+	}
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(r[0].body), &event); err != nil {
+		t.Fatalf("invalid JSON %s - %v", r[0].body, err)
+	}
+	if t0, ok := event["time"].(float64); !ok || t0 <= 0 {
+		t.Errorf("invalid time in %s", r[0].body)
+	}
+	delete(event, "time")
+	want := map[string]interface{}{
+		"host":        webhookHost,
+		"source":      "node-uuid",
+		"sourcetype":  types.QueryLog,
+		"index":       webhookIndex,
+		"environment": "prod",
+		"event":       map[string]interface{}{"result": []interface{}{}},
+	}
+	if !reflect.DeepEqual(event, want) {
+		t.Errorf("event %v, want %v", event, want)
+	}
+	if r[0].header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected content type %s", r[0].header.Get("Content-Type"))
+	}
+}
+
+func TestWebhookGzipHMAC(t *testing.T) {
+	srv, requests := webhookServer(t)
+	s, err := NewWebhookSink(WebhookConfiguration{
+		URL:        srv.URL,
+		Template:   `{{.Event}}`,
+		Gzip:       true,
+		HMACSecret: "secret",
+		Auth:       webhookAuthBearer,
+		Token:      "token",
+		Headers:    map[string]string{"X-Custom": "value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.StatusLog, []byte(`[{"line":1}]`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	r := requests()
+	if len(r) != 1 || r[0].body != `{"line":1}` {
+		t.Fatalf("unexpected requests %+v", r)
+	}
+	// The signature is for the compressed body, as it is sent
+	mac := hmac.New(sha256.New, []byte("secret"))
+	_, _ = mac.Write(r[0].raw)
+	if got, want := r[0].header.Get(webhookSignatureHeader), webhookSignaturePrefix+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("signature %s, want %s", got, want)
+	}
+	if r[0].header.Get("Authorization") != "Bearer token" || r[0].header.Get("X-Custom") != "value" {
+		t.Errorf("unexpected headers %v", r[0].header)
+	}
+}
+
+func TestWebhookBatchesAndRetries(t *testing.T) {
+	srv, requests := webhookServer(t, http.StatusInternalServerError)
+	s, err := NewWebhookSink(WebhookConfiguration{URL: srv.URL, Template: `{{.Event}}`, Batch: 2, Backoff: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(types.ResultLog, []byte(`[1,2,3]`), "prod", "node-uuid", false); err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for _, r := range requests() {
+		bodies = append(bodies, r.body)
+	}
+	// The first request fails with a server error and it is retried
+	if strings.Join(bodies, "|") != "1\n2|1\n2|3" {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+	srv, _ = webhookServer(t, http.StatusBadRequest)
+	s.Configuration.URL = srv.URL
+	if err := s.Send(types.ResultLog, []byte(`[1]`), "prod", "node-uuid", false); err == nil {
+		t.Error("expected error when the request is rejected")
+	}
+}
+
+func TestNewWebhookSinkInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config WebhookConfiguration
+	}{
+		{"missing URL", WebhookConfiguration{}},
+		{"invalid template", WebhookConfiguration{URL: "http://localhost", Template: "{{.Event"}},
+		{"invalid auth", WebhookConfiguration{URL: "http://localhost", Auth: "digest"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhookSink(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
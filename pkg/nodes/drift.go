@@ -0,0 +1,94 @@
+package nodes
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status of the configuration of a node, comparing the hash reported by the node with the expected hash
+const (
+	ConfigInSync  string = "in-sync"
+	ConfigDrifted string = "drifted"
+	ConfigUnknown string = "unknown"
+)
+
+// DriftStats to display the configuration status of nodes
+type DriftStats struct {
+	Total   int `json:"total"`
+	InSync  int `json:"in_sync"`
+	Drifted int `json:"drifted"`
+	Unknown int `json:"unknown"`
+}
+
+// ConfigStatus returns if the node is running the configuration it was served
+func (node OsqueryNode) ConfigStatus() string {
+	if node.ExpectedHash == "" || node.ConfigHash == "" {
+		return ConfigUnknown
+	}
+	if node.ConfigHash != node.ExpectedHash {
+		return ConfigDrifted
+	}
+	return ConfigInSync
+}
+
+// DriftDuration returns for how long the node has been drifted
+func (node OsqueryNode) DriftDuration() time.Duration {
+	if node.DriftedSince.IsZero() {
+		return 0
+	}
+	return time.Since(node.DriftedSince).Round(time.Second)
+}
+
+// Helper to mark a node as drifted, or in sync again, comparing reported and expected hashes
+func (n *NodeManager) updateDrift(node OsqueryNode, reported, expected string) error {
+	drifted := expected != "" && reported != "" && reported != expected
+	var since time.Time
+	switch {
+	case drifted && node.DriftedSince.IsZero():
+		since = time.Now()
+	case !drifted && !node.DriftedSince.IsZero():
+		since = time.Time{}
+	default:
+		return nil
+	}
+	if err := n.DB.Model(&node).Update("drifted_since", since).Error; err != nil {
+		return fmt.Errorf("Update %v", err)
+	}
+	return nil
+}
+
+// UpdateExpectedHash to keep the hash of the configuration served to a node
+func (n *NodeManager) UpdateExpectedHash(node OsqueryNode, hash string) error {
+	if node.ExpectedHash != hash {
+		if err := n.DB.Model(&node).Update("expected_hash", hash).Error; err != nil {
+			return fmt.Errorf("Update %v", err)
+		}
+	}
+	return n.updateDrift(node, node.ConfigHash, hash)
+}
+
+// GetDriftedByEnv to retrieve the nodes of an environment not running the expected configuration
+func (n *NodeManager) GetDriftedByEnv(environment string) ([]OsqueryNode, error) {
+	var nodes []OsqueryNode
+	err := n.DB.Where("environment = ?", environment).Where("expected_hash <> '' AND config_hash <> '' AND config_hash <> expected_hash").Order("drifted_since").Find(&nodes).Error
+	if err != nil {
+		return nodes, err
+	}
+	return nodes, nil
+}
+
+// GetDriftStatsByEnv to count the nodes of an environment by configuration status
+func (n *NodeManager) GetDriftStatsByEnv(environment string) (DriftStats, error) {
+	var stats DriftStats
+	if err := n.DB.Model(&OsqueryNode{}).Where("environment = ?", environment).Count(&stats.Total).Error; err != nil {
+		return stats, err
+	}
+	if err := n.DB.Model(&OsqueryNode{}).Where("environment = ?", environment).Where("expected_hash <> '' AND config_hash <> '' AND config_hash = expected_hash").Count(&stats.InSync).Error; err != nil {
+		return stats, err
+	}
+	if err := n.DB.Model(&OsqueryNode{}).Where("environment = ?", environment).Where("expected_hash <> '' AND config_hash <> '' AND config_hash <> expected_hash").Count(&stats.Drifted).Error; err != nil {
+		return stats, err
+	}
+	stats.Unknown = stats.Total - stats.InSync - stats.Drifted
+	return stats, nil
+}
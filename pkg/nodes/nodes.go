@@ -23,11 +23,14 @@ type OsqueryNode struct {
 	Username        string
 	OsqueryUser     string
 	Environment     string
+	EnrollSecret    string
 	CPU             string
 	Memory          string
 	HardwareSerial  string
 	DaemonHash      string
 	ConfigHash      string
+	ExpectedHash    string
+	DriftedSince    time.Time
 	RawEnrollment   json.RawMessage
 	LastStatus      time.Time
 	LastResult      time.Time
@@ -51,6 +54,7 @@ type ArchiveOsqueryNode struct {
 	Username        string
 	OsqueryUser     string
 	Environment     string
+	EnrollSecret    string
 	CPU             string
 	Memory          string
 	HardwareSerial  string
@@ -136,6 +140,19 @@ func CreateNodes(backend *gorm.DB) *NodeManager {
 	if err := backend.AutoMigrate(NodeHistoryUsername{}).Error; err != nil {
 		log.Fatalf("Failed to AutoMigrate table (node_history_username): %v", err)
 	}
+	// table node_tags, without duplicated tags so the unique index can be created
+	if backend.HasTable(NodeTag{}) {
+		if err := backend.Exec(dedupTags).Error; err != nil {
+			log.Fatalf("Failed to remove duplicated tags (node_tags): %v", err)
+		}
+	}
+	if err := backend.AutoMigrate(NodeTag{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (node_tags): %v", err)
+	}
+	// table tag_rules
+	if err := backend.AutoMigrate(TagRule{}).Error; err != nil {
+		log.Fatalf("Failed to AutoMigrate table (tag_rules): %v", err)
+	}
 	return n
 }
 
@@ -254,6 +271,24 @@ func (n *NodeManager) GetAllPlatforms() ([]string, error) {
 	return platforms, nil
 }
 
+// GetEnvPlatforms to get all different platforms with nodes in one environment
+func (n *NodeManager) GetEnvPlatforms(environment string) ([]string, error) {
+	var platforms []string
+	rows, err := n.DB.Table("osquery_nodes").Select("DISTINCT(platform)").Where("environment = ?", environment).Rows()
+	if err != nil {
+		return platforms, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var platform string
+		if err := rows.Scan(&platform); err != nil {
+			return platforms, err
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
 // GetStatsByEnv to populate table stats about nodes by environment. Active machine is < 3 days
 func (n *NodeManager) GetStatsByEnv(environment string, hours int64) (StatsData, error) {
 	var stats StatsData
@@ -370,6 +405,27 @@ func (n *NodeManager) UpdateMetadataByUUID(user, osqueryuser, hostname, localnam
 	if err := n.DB.Model(&node).Updates(data).Error; err != nil {
 		return fmt.Errorf("Updates %v", err)
 	}
+	// Rules can depend on the hostname and IP address, apply them again when they change
+	if data.Hostname != "" || data.Localname != "" || data.IPAddress != "" {
+		if data.Hostname != "" {
+			node.Hostname = data.Hostname
+		}
+		if data.Localname != "" {
+			node.Localname = data.Localname
+		}
+		if data.IPAddress != "" {
+			node.IPAddress = data.IPAddress
+		}
+		if err := n.ApplyTagRules(node); err != nil {
+			return fmt.Errorf("ApplyTagRules %v", err)
+		}
+	}
+	// Compare the reported configuration hash with the expected one
+	if confighash != "" {
+		if err := n.updateDrift(node, confighash, node.ExpectedHash); err != nil {
+			return fmt.Errorf("updateDrift %v", err)
+		}
+	}
 	return nil
 }
 
@@ -391,6 +447,11 @@ func (n *NodeManager) UpdateIPAddress(ipaddress string, node OsqueryNode) error
 		if err := n.DB.Model(&node).Updates(data).Error; err != nil {
 			return fmt.Errorf("Updates %v", err)
 		}
+		// Rules can depend on the IP address, apply them again when it changes
+		node.IPAddress = ipaddress
+		if err := n.ApplyTagRules(node); err != nil {
+			return fmt.Errorf("ApplyTagRules %v", err)
+		}
 	} else {
 		if err := n.IncHistoryIPAddress(node.UUID, ipaddress); err != nil {
 			return fmt.Errorf("incNodeHistoryIPAddress %v", err)
@@ -659,6 +720,7 @@ func nodeArchiveFromNode(node OsqueryNode, trigger string) ArchiveOsqueryNode {
 		Username:        node.Username,
 		OsqueryUser:     node.OsqueryUser,
 		Environment:     node.Environment,
+		EnrollSecret:    node.EnrollSecret,
 		CPU:             node.CPU,
 		Memory:          node.Memory,
 		HardwareSerial:  node.HardwareSerial,
@@ -0,0 +1,293 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operators of tag expressions
+const (
+	TagOpHas string = "has"
+	TagOpEq  string = "="
+	TagOpNeq string = "!="
+	TagOpNot string = "NOT"
+	TagOpAnd string = "AND"
+	TagOpOr  string = "OR"
+)
+
+// TagExpression to select nodes by their tags, as team=payments AND !role=db
+// Terms are key=value, key!=value or key to check that the tag exists
+// Terms are combined with AND, OR, ! or NOT and parentheses, AND binds stronger than OR
+type TagExpression struct {
+	Op    string
+	Key   string
+	Value string
+	Args  []TagExpression
+}
+
+// tagParser keeps the position while parsing a tag expression
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+// Helper to check if a character ends a word in tag expressions
+func isTagDelimiter(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')' || c == '!' || c == '=' || c == '&' || c == '|'
+}
+
+// Helper to split a tag expression in tokens, quoted values keep their quotes
+func tokenizeTags(expr string) ([]string, error) {
+	var tokens []string
+	i := 0
+	for i < len(expr) {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '!' && i+1 < len(expr) && expr[i+1] == '=':
+			tokens = append(tokens, TagOpNeq)
+			i += 2
+		case c == '!' || c == '=':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(expr) || expr[i+1] != c {
+				return nil, fmt.Errorf("unexpected %c, use %c%c", c, c, c)
+			}
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted value")
+			}
+			tokens = append(tokens, expr[i:i+end+2])
+			i += end + 2
+		default:
+			j := i
+			for j < len(expr) && !isTagDelimiter(expr[j]) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// ParseTagExpression parses an expression to select nodes by tags
+func ParseTagExpression(expr string) (TagExpression, error) {
+	tokens, err := tokenizeTags(expr)
+	if err != nil {
+		return TagExpression{}, err
+	}
+	if len(tokens) == 0 {
+		return TagExpression{}, fmt.Errorf("empty tag expression")
+	}
+	p := &tagParser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return e, err
+	}
+	if p.pos < len(p.tokens) {
+		return e, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// Helper to get the current token, empty at the end
+func (p *tagParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagParser) or() (TagExpression, error) {
+	left, err := p.and()
+	if err != nil {
+		return left, err
+	}
+	args := []TagExpression{left}
+	for t := p.peek(); strings.EqualFold(t, TagOpOr) || t == "||"; t = p.peek() {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return right, err
+		}
+		args = append(args, right)
+	}
+	if len(args) == 1 {
+		return left, nil
+	}
+	return TagExpression{Op: TagOpOr, Args: args}, nil
+}
+
+func (p *tagParser) and() (TagExpression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return left, err
+	}
+	args := []TagExpression{left}
+	for t := p.peek(); strings.EqualFold(t, TagOpAnd) || t == "&&"; t = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return right, err
+		}
+		args = append(args, right)
+	}
+	if len(args) == 1 {
+		return left, nil
+	}
+	return TagExpression{Op: TagOpAnd, Args: args}, nil
+}
+
+func (p *tagParser) unary() (TagExpression, error) {
+	t := p.peek()
+	switch {
+	case t == "":
+		return TagExpression{}, fmt.Errorf("unexpected end of tag expression")
+	case t == "!" || strings.EqualFold(t, TagOpNot):
+		p.pos++
+		e, err := p.unary()
+		if err != nil {
+			return e, err
+		}
+		return TagExpression{Op: TagOpNot, Args: []TagExpression{e}}, nil
+	case t == "(":
+		p.pos++
+		e, err := p.or()
+		if err != nil {
+			return e, err
+		}
+		if p.peek() != ")" {
+			return e, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.term()
+}
+
+func (p *tagParser) term() (TagExpression, error) {
+	key := p.peek()
+	if !isTagWord(key) {
+		return TagExpression{}, fmt.Errorf("unexpected %s, expected a tag", key)
+	}
+	p.pos++
+	op := p.peek()
+	if op != TagOpEq && op != TagOpNeq {
+		return TagExpression{Op: TagOpHas, Key: unquoteTag(key)}, nil
+	}
+	p.pos++
+	value := p.peek()
+	if !isTagWord(value) {
+		return TagExpression{}, fmt.Errorf("missing value for tag %s", key)
+	}
+	p.pos++
+	return TagExpression{Op: op, Key: unquoteTag(key), Value: unquoteTag(value)}, nil
+}
+
+// Helper to check if a token can be a key or a value
+func isTagWord(t string) bool {
+	switch {
+	case t == "", t == "(", t == ")", t == "!", t == "=", t == TagOpNeq, t == "&&", t == "||":
+		return false
+	case strings.EqualFold(t, TagOpAnd), strings.EqualFold(t, TagOpOr), strings.EqualFold(t, TagOpNot):
+		return false
+	}
+	return true
+}
+
+// Helper to remove the quotes of keys and values
+func unquoteTag(t string) string {
+	if len(t) >= 2 && (t[0] == '"' || t[0] == '\'') && t[len(t)-1] == t[0] {
+		return t[1 : len(t)-1]
+	}
+	return t
+}
+
+// Match checks if the tags of a node match the expression
+func (e TagExpression) Match(tags map[string]string) bool {
+	switch e.Op {
+	case TagOpHas:
+		_, ok := tags[e.Key]
+		return ok
+	case TagOpEq:
+		value, ok := tags[e.Key]
+		return ok && value == e.Value
+	case TagOpNeq:
+		value, ok := tags[e.Key]
+		return !ok || value != e.Value
+	case TagOpNot:
+		return !e.Args[0].Match(tags)
+	case TagOpAnd:
+		for _, a := range e.Args {
+			if !a.Match(tags) {
+				return false
+			}
+		}
+		return true
+	case TagOpOr:
+		for _, a := range e.Args {
+			if a.Match(tags) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns the expression in its canonical form
+func (e TagExpression) String() string {
+	switch e.Op {
+	case TagOpHas:
+		return quoteTag(e.Key)
+	case TagOpEq, TagOpNeq:
+		return quoteTag(e.Key) + e.Op + quoteTag(e.Value)
+	case TagOpNot:
+		return "!" + e.Args[0].nested()
+	case TagOpAnd, TagOpOr:
+		var parts []string
+		for _, a := range e.Args {
+			parts = append(parts, a.nested())
+		}
+		return strings.Join(parts, " "+e.Op+" ")
+	}
+	return ""
+}
+
+// Helper to add parentheses to nested AND and OR expressions
+func (e TagExpression) nested() string {
+	if e.Op == TagOpAnd || e.Op == TagOpOr {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
+}
+
+// Helper to quote keys and values that can not be written as they are
+func quoteTag(t string) string {
+	for i := 0; i < len(t); i++ {
+		if isTagDelimiter(t[i]) || t[i] == '"' || t[i] == '\'' {
+			return `"` + t + `"`
+		}
+	}
+	if !isTagWord(t) {
+		return `"` + t + `"`
+	}
+	return t
+}
+
+// MatchTags parses an expression and checks if the tags of a node match it
+func MatchTags(expr string, tags map[string]string) (bool, error) {
+	e, err := ParseTagExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	return e.Match(tags), nil
+}
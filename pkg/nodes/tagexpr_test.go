@@ -0,0 +1,116 @@
+package nodes
+
+import "testing"
+
+func TestParseTagExpression(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"team", "team"},
+		{"team=payments", "team=payments"},
+		{" team = payments ", "team=payments"},
+		{"team!=payments", "team!=payments"},
+		{"!role=db", "!role=db"},
+		{"NOT role=db", "!role=db"},
+		{"team=payments AND !role=db", "team=payments AND !role=db"},
+		{"team=payments && role=db", "team=payments AND role=db"},
+		{"a or b and c", "a OR (b AND c)"},
+		{"(a || b) && c", "(a OR b) AND c"},
+		{"a AND b AND c", "a AND b AND c"},
+		{"!(a OR b)", "!(a OR b)"},
+		{`owner="john doe"`, `owner="john doe"`},
+		{`'team'='pay ments'`, `team="pay ments"`},
+		{`name="and"`, `name="and"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := ParseTagExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := e.String(); got != tt.want {
+				t.Errorf("String() = %s, want %s", got, tt.want)
+			}
+			// The canonical form parses to the same expression
+			again, err := ParseTagExpression(e.String())
+			if err != nil {
+				t.Fatalf("error parsing canonical form %v", err)
+			}
+			if again.String() != e.String() {
+				t.Errorf("canonical form changed to %s", again.String())
+			}
+		})
+	}
+}
+
+func TestParseTagExpressionErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"team=",
+		"=payments",
+		"team==payments",
+		"team & role",
+		"team | role",
+		"team AND",
+		"OR team",
+		"!",
+		"(team",
+		"team)",
+		"()",
+		"team role",
+		`team="payments`,
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if e, err := ParseTagExpression(expr); err == nil {
+				t.Errorf("expected error, got %s", e.String())
+			}
+		})
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	tags := map[string]string{
+		"team":  "payments",
+		"role":  "web",
+		"owner": "john doe",
+		"empty": "",
+	}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"team", true},
+		{"missing", false},
+		{"empty", true},
+		{"empty=''", true},
+		{"team=payments", true},
+		{"team=PAYMENTS", false},
+		{"team!=payments", false},
+		{"missing!=value", true},
+		{"!missing", true},
+		{"team=payments AND role=db", false},
+		{"team=payments AND !role=db", true},
+		{"team=search OR role=web", true},
+		{"team=search OR role=db", false},
+		{"team=search OR role=web AND owner=nobody", false},
+		{"(team=search OR role=web) AND team=payments", true},
+		{`owner="john doe"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			match, err := MatchTags(tt.expr, tags)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if match != tt.match {
+				t.Errorf("got %v, want %v", match, tt.match)
+			}
+		})
+	}
+	if _, err := MatchTags("team AND", tags); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+}
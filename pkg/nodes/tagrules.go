@@ -0,0 +1,187 @@
+package nodes
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Types of tag rules
+const (
+	TagRuleHostname        string = "hostname"
+	TagRuleCIDR            string = "cidr"
+	TagRulePlatformVersion string = "platform_version"
+)
+
+// TagRule to set a tag automatically in the nodes matching a pattern
+// Hostname rules use glob patterns like web-*.example.com, CIDR rules match the IP address of nodes
+// and platform version rules use a version range like >=10.15 <11 or a glob pattern, optionally only for one platform
+// Rules apply to all environments when Environment is empty
+type TagRule struct {
+	gorm.Model
+	Name        string `gorm:"index"`
+	Environment string
+	Type        string
+	Pattern     string
+	Platform    string
+	Key         string
+	Value       string
+}
+
+// ValidateTagRule checks the type and pattern of a tag rule
+func ValidateTagRule(rule TagRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("empty rule name")
+	}
+	if strings.TrimSpace(rule.Key) == "" {
+		return fmt.Errorf("empty tag key")
+	}
+	switch rule.Type {
+	case TagRuleHostname:
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return fmt.Errorf("invalid hostname pattern - %v", err)
+		}
+	case TagRuleCIDR:
+		if _, _, err := net.ParseCIDR(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid CIDR - %v", err)
+		}
+	case TagRulePlatformVersion:
+		if err := ValidateVersionRange(rule.Pattern); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown rule type %s", rule.Type)
+	}
+	return nil
+}
+
+// Matches checks if a node matches the rule
+func (r TagRule) Matches(node OsqueryNode) bool {
+	if r.Environment != "" && r.Environment != node.Environment {
+		return false
+	}
+	if r.Platform != "" && r.Platform != node.Platform {
+		return false
+	}
+	switch r.Type {
+	case TagRuleHostname:
+		for _, h := range []string{node.Hostname, node.Localname} {
+			if ok, _ := path.Match(strings.ToLower(r.Pattern), strings.ToLower(h)); ok && h != "" {
+				return true
+			}
+		}
+	case TagRuleCIDR:
+		_, network, err := net.ParseCIDR(r.Pattern)
+		ip := net.ParseIP(strings.TrimSpace(node.IPAddress))
+		return err == nil && ip != nil && network.Contains(ip)
+	case TagRulePlatformVersion:
+		ok, _ := MatchVersionRange(node.PlatformVersion, r.Pattern)
+		return ok
+	}
+	return false
+}
+
+// GetTagRules to retrieve all the tag rules
+func (n *NodeManager) GetTagRules() ([]TagRule, error) {
+	var rules []TagRule
+	if err := n.DB.Order("id").Find(&rules).Error; err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// GetTagRule to retrieve one tag rule by name
+func (n *NodeManager) GetTagRule(name string) (TagRule, error) {
+	var rule TagRule
+	if err := n.DB.Where("name = ?", name).First(&rule).Error; err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// CreateTagRule to validate and store a new tag rule, then apply the rules to existing nodes
+// Returns the number of nodes the rules were applied to
+func (n *NodeManager) CreateTagRule(rule TagRule) (int, error) {
+	if err := ValidateTagRule(rule); err != nil {
+		return 0, err
+	}
+	if _, err := n.GetTagRule(rule.Name); err == nil {
+		return 0, fmt.Errorf("rule %s already exists", rule.Name)
+	}
+	if err := n.DB.Create(&rule).Error; err != nil {
+		return 0, fmt.Errorf("Create TagRule %v", err)
+	}
+	return n.ApplyTagRulesAll()
+}
+
+// DeleteTagRule to remove a tag rule by name, with the tags it set
+func (n *NodeManager) DeleteTagRule(name string) error {
+	rule, err := n.GetTagRule(name)
+	if err != nil {
+		return fmt.Errorf("error getting rule %v", err)
+	}
+	if err := n.DB.Unscoped().Delete(&rule).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	if err := n.DB.Unscoped().Where("source = ?", name).Delete(&NodeTag{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
+
+// Helper to set the tags of the rules matching a node and remove the ones of rules not matching anymore
+func (n *NodeManager) applyRules(node OsqueryNode, rules []TagRule) error {
+	keys := make(map[string]string)
+	for _, r := range rules {
+		// The oldest rule wins when several rules set the same key
+		if _, ok := keys[r.Key]; ok || !r.Matches(node) {
+			continue
+		}
+		keys[r.Key] = r.Name
+		if err := n.setTag(node.UUID, r.Key, r.Value, r.Name); err != nil {
+			return err
+		}
+	}
+	tags, err := n.GetNodeTags(node.UUID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if t.Source != "" && keys[t.Key] != t.Source {
+			if err := n.DB.Unscoped().Delete(&t).Error; err != nil {
+				return fmt.Errorf("Delete %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyTagRules to update the tags set by rules in one node
+func (n *NodeManager) ApplyTagRules(node OsqueryNode) error {
+	rules, err := n.GetTagRules()
+	if err != nil {
+		return err
+	}
+	return n.applyRules(node, rules)
+}
+
+// ApplyTagRulesAll to update the tags set by rules in all nodes, returns the number of nodes
+func (n *NodeManager) ApplyTagRulesAll() (int, error) {
+	rules, err := n.GetTagRules()
+	if err != nil {
+		return 0, err
+	}
+	var nodes []OsqueryNode
+	if err := n.DB.Find(&nodes).Error; err != nil {
+		return 0, err
+	}
+	for _, node := range nodes {
+		if err := n.applyRules(node, rules); err != nil {
+			return 0, err
+		}
+	}
+	return len(nodes), nil
+}
@@ -0,0 +1,110 @@
+package nodes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// NodeTag to keep key/value tags for nodes
+// Source is empty for tags set manually, and the name of the rule for tags set by rules
+type NodeTag struct {
+	gorm.Model
+	UUID   string `gorm:"unique_index:idx_node_tags_uuid_key"`
+	Key    string `gorm:"unique_index:idx_node_tags_uuid_key"`
+	Value  string
+	Source string
+}
+
+// Upsert for one tag of a node, using the unique index of UUID and key
+// Tags set manually always replace the current value, tags set by rules only replace tags set by rules
+const setTagUpsert string = `INSERT INTO node_tags (created_at, updated_at, uuid, key, value, source) VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT (uuid, key) DO UPDATE SET updated_at = EXCLUDED.updated_at, deleted_at = NULL, value = EXCLUDED.value, source = EXCLUDED.source
+WHERE EXCLUDED.source = '' OR node_tags.source <> ''`
+
+// Statement to remove duplicated tags of nodes, keeping the newest, before the unique index is created
+const dedupTags string = `DELETE FROM node_tags a USING node_tags b WHERE a.uuid = b.uuid AND a.key = b.key AND a.id < b.id`
+
+// GetTags to retrieve all the tags of a node by UUID
+func (n *NodeManager) GetTags(uuid string) (map[string]string, error) {
+	var tags []NodeTag
+	res := make(map[string]string)
+	if err := n.DB.Where("uuid = ?", uuid).Find(&tags).Error; err != nil {
+		return res, err
+	}
+	for _, t := range tags {
+		res[t.Key] = t.Value
+	}
+	return res, nil
+}
+
+// GetNodeTags to retrieve all the tags of a node by UUID, with their source
+func (n *NodeManager) GetNodeTags(uuid string) ([]NodeTag, error) {
+	var tags []NodeTag
+	if err := n.DB.Where("uuid = ?", uuid).Order("key").Find(&tags).Error; err != nil {
+		return tags, err
+	}
+	return tags, nil
+}
+
+// AllTags to retrieve the tags of all nodes, by UUID
+func (n *NodeManager) AllTags() (map[string]map[string]string, error) {
+	var tags []NodeTag
+	res := make(map[string]map[string]string)
+	if err := n.DB.Find(&tags).Error; err != nil {
+		return res, err
+	}
+	for _, t := range tags {
+		if _, ok := res[t.UUID]; !ok {
+			res[t.UUID] = make(map[string]string)
+		}
+		res[t.UUID][t.Key] = t.Value
+	}
+	return res, nil
+}
+
+// GetByTags to retrieve all/active/inactive nodes with tags matching the expression
+func (n *NodeManager) GetByTags(expr TagExpression, target string, hours int64) ([]OsqueryNode, error) {
+	all, err := n.Gets(target, hours)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := n.AllTags()
+	if err != nil {
+		return nil, err
+	}
+	var nodes []OsqueryNode
+	for _, node := range all {
+		if expr.Match(tags[node.UUID]) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// SetTag to add or replace one tag of a node by UUID
+// Tags set manually are not changed by rules afterwards
+func (n *NodeManager) SetTag(uuid, key, value string) error {
+	return n.setTag(uuid, key, value, "")
+}
+
+// Helper to add or replace one tag of a node, rules do not replace tags set manually
+func (n *NodeManager) setTag(uuid, key, value, source string) error {
+	if key == "" {
+		return fmt.Errorf("empty tag key")
+	}
+	now := time.Now()
+	if err := n.DB.Exec(setTagUpsert, now, now, uuid, key, value, source).Error; err != nil {
+		return fmt.Errorf("Upsert NodeTag %v", err)
+	}
+	return nil
+}
+
+// RemoveTag to remove one tag of a node by UUID
+func (n *NodeManager) RemoveTag(uuid, key string) error {
+	if err := n.DB.Unscoped().Where("uuid = ? AND key = ?", uuid, key).Delete(&NodeTag{}).Error; err != nil {
+		return fmt.Errorf("Delete %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package nodes
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Helper to split a version pattern in comparison operator and version
+func splitVersionPattern(pattern string) (string, string) {
+	pattern = strings.TrimSpace(pattern)
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(pattern, op) {
+			return op, strings.TrimSpace(strings.TrimPrefix(pattern, op))
+		}
+	}
+	return "", pattern
+}
+
+// CompareVersions compares two dotted versions by their numeric parts, as 10.9 < 10.15
+func CompareVersions(a, b string) int {
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' || r == '_' || r == ' ' })
+	}
+	pa, pb := split(a), split(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errx := strconv.Atoi(x)
+		ny, erry := strconv.Atoi(y)
+		if x == "" {
+			errx = nil
+		}
+		if y == "" {
+			erry = nil
+		}
+		switch {
+		case errx == nil && erry == nil && nx != ny:
+			if nx < ny {
+				return -1
+			}
+			return 1
+		case (errx != nil || erry != nil) && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Helper to split a version range in comparisons, operators can be separated from the version
+func splitVersionRange(rng string) []string {
+	var parts []string
+	for _, f := range strings.FieldsFunc(rng, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+		if n := len(parts); n > 0 && strings.Trim(parts[n-1], "<>=!") == "" {
+			parts[n-1] += f
+			continue
+		}
+		parts = append(parts, f)
+	}
+	return parts
+}
+
+// ValidateVersionRange checks a version range, as comparisons like >=3.3 <4.0 or a glob pattern like 10.15.*
+func ValidateVersionRange(rng string) error {
+	parts := splitVersionRange(rng)
+	if len(parts) == 0 {
+		return fmt.Errorf("empty version range")
+	}
+	for _, p := range parts {
+		op, version := splitVersionPattern(p)
+		if version == "" {
+			return fmt.Errorf("missing version after %s", op)
+		}
+		if op == "" {
+			if _, err := path.Match(version, ""); err != nil {
+				return fmt.Errorf("invalid version pattern - %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// MatchVersionRange checks if a version satisfies all the comparisons of a range
+func MatchVersionRange(version, rng string) (bool, error) {
+	if err := ValidateVersionRange(rng); err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(version) == "" {
+		return false, nil
+	}
+	for _, p := range splitVersionRange(rng) {
+		op, v := splitVersionPattern(p)
+		c := CompareVersions(version, v)
+		var ok bool
+		switch op {
+		case "":
+			if strings.ContainsAny(v, "*?[") {
+				ok, _ = path.Match(v, version)
+			} else {
+				ok = c == 0
+			}
+		case ">=":
+			ok = c >= 0
+		case "<=":
+			ok = c <= 0
+		case ">":
+			ok = c > 0
+		case "<":
+			ok = c < 0
+		case "=":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
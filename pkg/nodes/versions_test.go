@@ -0,0 +1,92 @@
+package nodes
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1", "1.0", 0},
+		{"1.0.0", "1", 0},
+		{"10.9", "10.15", -1},
+		{"10.15", "10.9", 1},
+		{"3.3.2", "3.4", -1},
+		{"4.0.0", "3.99.99", 1},
+		{"18.04", "18.4", 0},
+		{"4.1.2-1", "4.1.2", 1},
+		{"4.1.2_1", "4.1.2-1", 0},
+		{"1.0", "", 1},
+		{"", "", 0},
+		{"1.a", "1.b", -1},
+		{"1.b", "1.a", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := CompareVersions(tt.a, tt.b); got != tt.want {
+				t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateVersionRange(t *testing.T) {
+	tests := []struct {
+		rng string
+		err bool
+	}{
+		{">=3.3", false},
+		{">=3.3 <4.0", false},
+		{">= 3.3, < 4.0", false},
+		{"10.15.*", false},
+		{"4.1.2", false},
+		{"", true},
+		{">=", true},
+		{">=3.3 <", true},
+		{"10.[", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rng, func(t *testing.T) {
+			if err := ValidateVersionRange(tt.rng); (err != nil) != tt.err {
+				t.Errorf("got error %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMatchVersionRange(t *testing.T) {
+	tests := []struct {
+		version string
+		rng     string
+		match   bool
+	}{
+		{"3.3.2", ">=3.3", true},
+		{"3.2.6", ">=3.3", false},
+		{"3.3.2", ">=3.3 <4.0", true},
+		{"4.0.0", ">=3.3 <4.0", false},
+		{"4.0.0", ">= 3.3, <= 4.0", true},
+		{"10.15.7", "10.15.*", true},
+		{"10.14.6", "10.15.*", false},
+		{"4.1.2", "4.1.2", true},
+		{"4.1.2", "=4.1", false},
+		{"4.1.2", "!=4.1.2", false},
+		{"4.1.2", ">4.1 <4.2", true},
+		{"", ">=1.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.rng, func(t *testing.T) {
+			match, err := MatchVersionRange(tt.version, tt.rng)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if match != tt.match {
+				t.Errorf("got %v, want %v", match, tt.match)
+			}
+		})
+	}
+	if _, err := MatchVersionRange("1.0", ">="); err == nil {
+		t.Error("expected error for invalid range")
+	}
+}
@@ -0,0 +1,190 @@
+package queries
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Years to look ahead for the next run of a cron expression, before giving up
+const cronMaxYears int = 5
+
+// Cron expressions that can be used instead of the five fields
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// Names that can be used for months and days of the week
+var (
+	cronMonths = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDays   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronField defines the allowed values of one field of a cron expression
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+// Fields of a cron expression, in order
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: cronMonths},
+	{name: "day of week", min: 0, max: 7, names: cronDays},
+}
+
+// CronSchedule to keep a parsed cron expression, with the allowed values of each field as bits
+type CronSchedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	anyDay  bool
+	anyWeek bool
+}
+
+// Helper to parse one value of a field, as number or name
+func (f cronField) value(s string) (int, error) {
+	for i, n := range f.names {
+		if n != "" && strings.ToLower(s) == n {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Helper to parse one field of a cron expression, as a list of values, ranges and steps
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %s", f.name, item[i+1:])
+			}
+			item = item[:i]
+		}
+		start, end := f.min, f.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			parts := strings.SplitN(item, "-", 2)
+			var err error
+			if start, err = f.value(parts[0]); err != nil {
+				return 0, err
+			}
+			if end, err = f.value(parts[1]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid %s range %s", f.name, item)
+			}
+		default:
+			var err error
+			if start, err = f.value(item); err != nil {
+				return 0, err
+			}
+			if step > 1 {
+				end = f.max
+			} else {
+				end = start
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// ParseCron parses a cron expression with five fields (minute, hour, day of month, month and day of week)
+// Fields can be lists of values, ranges and steps, months and days can be names, and @hourly or @daily are allowed
+func ParseCron(expr string) (CronSchedule, error) {
+	var c CronSchedule
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return c, fmt.Errorf("cron expression needs %d fields, got %d", len(cronFields), len(parts))
+	}
+	values := make([]uint64, len(cronFields))
+	for i, f := range cronFields {
+		bits, err := f.parse(parts[i])
+		if err != nil {
+			return c, err
+		}
+		values[i] = bits
+	}
+	c.minute, c.hour, c.dom, c.month, c.dow = values[0], values[1], values[2], values[3], values[4]
+	// Sunday can be 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.anyDay = parts[2] == "*"
+	c.anyWeek = parts[4] == "*"
+	if c.Next(time.Now()).IsZero() {
+		return c, fmt.Errorf("cron expression %s never runs", expr)
+	}
+	return c, nil
+}
+
+// Helper to check if the day matches, when both day fields are restricted any of them can match
+func (c CronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay || c.anyWeek {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after the provided one when the cron expression matches
+// Zero time is returned when there is no match in the next years
+func (c CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	limit := t.Year() + cronMaxYears
+	for t.Year() <= limit {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
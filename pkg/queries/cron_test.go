@@ -0,0 +1,87 @@
+package queries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"a * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"10-5 * * * *",
+		"1-x * * * *",
+		"* * * foo *",
+		"@every",
+		"0 0 30 feb *",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseCron(expr); err == nil {
+				t.Errorf("expected error for %q", expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday
+	from := time.Date(2020, time.January, 6, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.January, 6, 10, 31, 0, 0, time.UTC)},
+		{"30 * * * *", time.Date(2020, time.January, 6, 11, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.January, 6, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2020, time.January, 6, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2020, time.January, 6, 13, 0, 0, 0, time.UTC)},
+		{"0,45 10 * * *", time.Date(2020, time.January, 6, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.January, 6, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2020, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2020, time.January, 12, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@YEARLY", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2020, time.January, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * fri", time.Date(2020, time.January, 10, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon-fri", time.Date(2020, time.January, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jun *", time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted, any of them matches
+		{"0 0 15 * sat", time.Date(2020, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		// Day of month restricted and any day of week, only the day of month matches
+		{"0 0 15 * *", time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if next := c.Next(from); !next.Equal(tt.next) {
+				t.Errorf("Next() = %v, want %v", next, tt.next)
+			}
+		})
+	}
+}
+
+func TestCronNextLeapYear(t *testing.T) {
+	c, err := ParseCron("0 0 29 feb *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := c.Next(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("Next() = %v, want %v", next, want)
+	}
+}
@@ -0,0 +1,298 @@
+package queries
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+const (
+	// ExportCSV to export query results as CSV with a header
+	ExportCSV string = "csv"
+	// ExportJSONL to export query results as JSON Lines, one object per row
+	ExportJSONL string = "jsonl"
+	// ExportParquet to export query results as a parquet file
+	ExportParquet string = "parquet"
+	// ResultsTable is the table where the DB logging stores on-demand query results
+	ResultsTable string = "osquery_query_data"
+)
+
+// ExportNodeColumns are the columns added to every exported row, to identify the node
+// Result columns with the same name are exported with the result_ prefix
+var ExportNodeColumns = []string{"uuid", "hostname", "environment"}
+
+// ValidExportFormat checks if the format to export results is supported
+func ValidExportFormat(format string) bool {
+	return format == ExportCSV || format == ExportJSONL || format == ExportParquet
+}
+
+// ExportContentType returns the content type for an export format
+func ExportContentType(format string) string {
+	switch format {
+	case ExportCSV:
+		return "text/csv; charset=UTF-8"
+	case ExportJSONL:
+		return "application/x-ndjson; charset=UTF-8"
+	}
+	return "application/octet-stream"
+}
+
+// ResultRows parses the rows of an on-demand query result, as stored by the DB logging
+// Values that are not strings are kept as JSON
+func ResultRows(data []byte) ([]map[string]string, error) {
+	rows, _, err := parseResult(data)
+	return rows, err
+}
+
+// Helper to parse the rows and the status of an on-demand query result
+func parseResult(data []byte) ([]map[string]string, int, error) {
+	var q struct {
+		Result json.RawMessage `json:"result"`
+		Status int             `json:"status"`
+	}
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, 0, fmt.Errorf("error parsing result %v", err)
+	}
+	if len(q.Result) == 0 || string(q.Result) == "null" || string(q.Result) == `""` {
+		return nil, q.Status, nil
+	}
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(q.Result, &raw); err != nil {
+		return nil, q.Status, fmt.Errorf("error parsing result rows %v", err)
+	}
+	rows := make([]map[string]string, 0, len(raw))
+	for _, r := range raw {
+		row := make(map[string]string, len(r))
+		for k, v := range r {
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				s = string(v)
+			}
+			row[k] = s
+		}
+		rows = append(rows, row)
+	}
+	return rows, q.Status, nil
+}
+
+// rowWriter to write rows of optional values in one export format
+type rowWriter interface {
+	write(values []string, present []bool) error
+	close() error
+}
+
+// csvRowWriter writes rows as CSV, missing values are empty
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvRowWriter) write(values []string, present []bool) error {
+	return c.w.Write(values)
+}
+
+func (c *csvRowWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlRowWriter writes rows as JSON objects with keys in the order of the columns, missing values are omitted
+type jsonlRowWriter struct {
+	w       io.Writer
+	columns []string
+	buf     bytes.Buffer
+}
+
+func (j *jsonlRowWriter) write(values []string, present []bool) error {
+	j.buf.Reset()
+	j.buf.WriteByte('{')
+	first := true
+	for i, c := range j.columns {
+		if !present[i] {
+			continue
+		}
+		if !first {
+			j.buf.WriteByte(',')
+		}
+		first = false
+		k, _ := json.Marshal(c)
+		v, _ := json.Marshal(values[i])
+		j.buf.Write(k)
+		j.buf.WriteByte(':')
+		j.buf.Write(v)
+	}
+	j.buf.WriteString("}\n")
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonlRowWriter) close() error {
+	return nil
+}
+
+// ResultsExporter writes the flattened rows of query results, with the node columns first
+type ResultsExporter struct {
+	Columns []string
+	index   map[string]int // position of the result columns
+	writer  rowWriter
+	values  []string
+	present []bool
+	dropped map[string]bool // result columns not known by the exporter
+}
+
+// NewResultsExporter creates an exporter for the result columns in one format
+// Rows are written as they come, only parquet keeps one row group in memory
+func NewResultsExporter(format string, w io.Writer, resultColumns []string) (*ResultsExporter, error) {
+	e := &ResultsExporter{
+		index:   make(map[string]int),
+		dropped: make(map[string]bool),
+	}
+	e.Columns = append(e.Columns, ExportNodeColumns...)
+	sorted := append([]string{}, resultColumns...)
+	sort.Strings(sorted)
+	for _, c := range sorted {
+		name := c
+		for _, n := range ExportNodeColumns {
+			if n == c {
+				name = "result_" + c
+			}
+		}
+		e.index[c] = len(e.Columns)
+		e.Columns = append(e.Columns, name)
+	}
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(e.Columns); err != nil {
+			return nil, err
+		}
+		e.writer = &csvRowWriter{w: cw}
+	case ExportJSONL:
+		e.writer = &jsonlRowWriter{w: w, columns: e.Columns}
+	case ExportParquet:
+		e.writer = newParquetWriter(w, e.Columns)
+	default:
+		return nil, fmt.Errorf("unknown export format %s", format)
+	}
+	e.values = make([]string, len(e.Columns))
+	e.present = make([]bool, len(e.Columns))
+	return e, nil
+}
+
+// Write adds one result row of a node, columns not known by the exporter are skipped
+func (e *ResultsExporter) Write(uuid, hostname, environment string, row map[string]string) error {
+	for i := range e.values {
+		e.values[i] = ""
+		e.present[i] = false
+	}
+	for i, v := range []string{uuid, hostname, environment} {
+		e.values[i] = v
+		e.present[i] = true
+	}
+	for k, v := range row {
+		if i, ok := e.index[k]; ok {
+			e.values[i] = v
+			e.present[i] = true
+		} else {
+			e.dropped[k] = true
+		}
+	}
+	return e.writer.write(e.values, e.present)
+}
+
+// Close writes what is pending in the export
+func (e *ResultsExporter) Close() error {
+	return e.writer.close()
+}
+
+// ResultsData iterates over the stored results of a query in order, without loading all of them
+// Generation zero iterates over the results of all generations
+func (q *Queries) ResultsData(name string, generation uint, fn func(uuid, environment string, data []byte) error) error {
+	query := q.DB.Table(ResultsTable).Select("uuid, environment, data").Where("name = ? AND deleted_at IS NULL", name)
+	if generation > 0 {
+		query = query.Where("generation = ?", generation)
+	}
+	rows, err := query.Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uuid, environment string
+		var data []byte
+		if err := rows.Scan(&uuid, &environment, &data); err != nil {
+			return err
+		}
+		if err := fn(uuid, environment, data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportResults writes the stored results of a query, of one generation or all of them, with the hostnames of the nodes by UUID
+// Results are read twice without loading all of them, first to collect the columns of all the rows and then to write them
+func (q *Queries) ExportResults(name, format string, generation uint, hostnames map[string]string, w io.Writer) error {
+	return exportResults(name, format, hostnames, w, func(fn func(uuid, environment string, data []byte) error) error {
+		return q.ResultsData(name, generation, fn)
+	})
+}
+
+// Helper to export results using a function to iterate over them, called once for each pass
+func exportResults(name, format string, hostnames map[string]string, w io.Writer, results func(fn func(uuid, environment string, data []byte) error) error) error {
+	if !ValidExportFormat(format) {
+		return fmt.Errorf("unknown export format %s", format)
+	}
+	columns := make(map[string]bool)
+	err := results(func(uuid, environment string, data []byte) error {
+		rows, err := ResultRows(data)
+		if err != nil {
+			return nil
+		}
+		for _, r := range rows {
+			for k := range r {
+				columns[k] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for c := range columns {
+		names = append(names, c)
+	}
+	exporter, err := NewResultsExporter(format, w, names)
+	if err != nil {
+		return err
+	}
+	err = results(func(uuid, environment string, data []byte) error {
+		rows, err := ResultRows(data)
+		if err != nil {
+			return nil
+		}
+		for _, r := range rows {
+			if err := exporter.Write(uuid, hostnames[uuid], environment, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Only results stored between both passes can have new columns
+	if len(exporter.dropped) > 0 {
+		var dropped []string
+		for c := range exporter.dropped {
+			dropped = append(dropped, c)
+		}
+		sort.Strings(dropped)
+		log.Printf("export of %s dropped columns %v, from results stored during the export", name, dropped)
+	}
+	return exporter.Close()
+}
@@ -0,0 +1,111 @@
+package queries
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestResultRows(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		rows []map[string]string
+		err  bool
+	}{
+		{"rows", `{"result":[{"name":"launchd","pid":"1"}],"status":0}`, []map[string]string{{"name": "launchd", "pid": "1"}}, false},
+		{"non string values", `{"result":[{"pid":1,"args":["a"],"path":null}]}`, []map[string]string{{"pid": "1", "args": `["a"]`, "path": ""}}, false},
+		{"no result", `{"status":1}`, nil, false},
+		{"empty result", `{"result":""}`, nil, false},
+		{"invalid", `{`, nil, true},
+		{"invalid rows", `{"result":{"name":"launchd"}}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ResultRows([]byte(tt.data))
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(rows, tt.rows) {
+				t.Errorf("got rows %v, want %v", rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestResultsExporter(t *testing.T) {
+	rows := []map[string]string{
+		{"name": "launchd", "pid": "1"},
+		{"name": "with \"quotes\", and comma"},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{ExportCSV, "uuid,hostname,environment,name,pid\n" +
+			"node-uuid,host,prod,launchd,1\n" +
+			"node-uuid,host,prod,\"with \"\"quotes\"\", and comma\",\n"},
+		{ExportJSONL, `{"uuid":"node-uuid","hostname":"host","environment":"prod","name":"launchd","pid":"1"}` + "\n" +
+			`{"uuid":"node-uuid","hostname":"host","environment":"prod","name":"with \"quotes\", and comma"}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			e, err := NewResultsExporter(tt.format, &buf, []string{"pid", "name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range rows {
+				if err := e.Write("node-uuid", "host", "prod", r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+	if _, err := NewResultsExporter("xml", &bytes.Buffer{}, nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestExportResults(t *testing.T) {
+	results := []struct {
+		uuid string
+		data string
+	}{
+		{"uuid-1", `{"result":[{"name":"launchd"}],"status":0}`},
+		{"uuid-2", `invalid`},
+		{"uuid-2", `{"result":"","status":1}`},
+		{"uuid-3", `{"result":[{"name":"kernel_task","pid":"0"}],"status":0}`},
+	}
+	passes := 0
+	iterate := func(fn func(uuid, environment string, data []byte) error) error {
+		passes++
+		for _, r := range results {
+			if err := fn(r.uuid, "prod", []byte(r.data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	hostnames := map[string]string{"uuid-1": "host-1", "uuid-3": "host-3"}
+	if err := exportResults("test", ExportCSV, hostnames, &buf, iterate); err != nil {
+		t.Fatal(err)
+	}
+	// The column of the last result is exported too
+	want := "uuid,hostname,environment,name,pid\n" +
+		"uuid-1,host-1,prod,launchd,\n" +
+		"uuid-3,host-3,prod,kernel_task,0\n"
+	if buf.String() != want || passes != 2 {
+		t.Errorf("got %d passes and\n%s\nwant\n%s", passes, buf.String(), want)
+	}
+	if err := exportResults("test", "xml", hostnames, &buf, iterate); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
@@ -0,0 +1,309 @@
+package queries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Parquet files are written with one optional UTF8 column per result column,
+// PLAIN encoding and no compression, buffering only one row group at a time
+
+const (
+	// Magic bytes at the start and the end of parquet files
+	parquetMagic string = "PAR1"
+	// Rows buffered in memory before writing a row group
+	parquetRowGroupSize int = 10000
+	// Creator of the parquet files
+	parquetCreatedBy string = "osctrl"
+)
+
+// Parquet enum values from the format specification
+const (
+	parquetTypeByteArray      int32 = 6
+	parquetRepetitionOptional int32 = 1
+	parquetConvertedUTF8      int32 = 0
+	parquetEncodingPlain      int32 = 0
+	parquetEncodingRLE        int32 = 3
+	parquetCodecUncompressed  int32 = 0
+	parquetPageData           int32 = 0
+)
+
+// Thrift compact protocol types
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftWriter encodes structs with the thrift compact protocol, used by parquet metadata
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	t.buf.Write(b[:n])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (t *thriftWriter) field(id int16, ftype byte) {
+	last := t.last[len(t.last)-1]
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta<<4) | ftype)
+	} else {
+		t.buf.WriteByte(ftype)
+		t.zigzag(int64(id))
+	}
+	t.last[len(t.last)-1] = id
+}
+
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+func (t *thriftWriter) list(id int16, etype byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size<<4) | etype)
+	} else {
+		t.buf.WriteByte(0xf0 | etype)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// parquetColumnChunk keeps the metadata of a written column chunk
+type parquetColumnChunk struct {
+	name   string
+	offset int64
+	size   int64
+	values int64
+}
+
+// parquetRowGroup keeps the metadata of a written row group
+type parquetRowGroup struct {
+	chunks []parquetColumnChunk
+	rows   int64
+	size   int64
+}
+
+// parquetWriter writes rows of optional strings as a parquet file
+type parquetWriter struct {
+	w       io.Writer
+	columns []string
+	values  [][]string
+	defined [][]bool
+	rows    int
+	offset  int64
+	groups  []parquetRowGroup
+	total   int64
+}
+
+// Helper to create a parquet writer, the magic bytes are written with the first row group
+func newParquetWriter(w io.Writer, columns []string) *parquetWriter {
+	return &parquetWriter{
+		w:       w,
+		columns: columns,
+		values:  make([][]string, len(columns)),
+		defined: make([][]bool, len(columns)),
+	}
+}
+
+func (p *parquetWriter) write(values []string, present []bool) error {
+	for i := range p.columns {
+		p.defined[i] = append(p.defined[i], present[i])
+		if present[i] {
+			p.values[i] = append(p.values[i], values[i])
+		}
+	}
+	p.rows++
+	if p.rows >= parquetRowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+// Helper to write bytes and keep the offset in the file
+func (p *parquetWriter) output(data []byte) error {
+	if p.offset == 0 {
+		if _, err := io.WriteString(p.w, parquetMagic); err != nil {
+			return err
+		}
+		p.offset = int64(len(parquetMagic))
+	}
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// Helper to encode definition levels of bit width 1 with the RLE hybrid encoding, prefixed by its length
+func parquetLevels(defined []bool) []byte {
+	var runs bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		n := binary.PutUvarint(b[:], uint64(j-i)<<1)
+		runs.Write(b[:n])
+		if defined[i] {
+			runs.WriteByte(1)
+		} else {
+			runs.WriteByte(0)
+		}
+		i = j
+	}
+	out := make([]byte, 4, 4+runs.Len())
+	binary.LittleEndian.PutUint32(out, uint32(runs.Len()))
+	return append(out, runs.Bytes()...)
+}
+
+// Helper to write the buffered rows as a row group, one data page per column
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(p.rows)}
+	for i, name := range p.columns {
+		page := parquetLevels(p.defined[i])
+		var l [4]byte
+		for _, v := range p.values[i] {
+			binary.LittleEndian.PutUint32(l[:], uint32(len(v)))
+			page = append(page, l[:]...)
+			page = append(page, v...)
+		}
+		var header thriftWriter
+		header.begin()
+		header.i32(1, parquetPageData)
+		header.i32(2, int32(len(page)))
+		header.i32(3, int32(len(page)))
+		header.structField(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.end()
+		header.end()
+		chunk := parquetColumnChunk{
+			name:   name,
+			offset: p.offset,
+			size:   int64(header.buf.Len() + len(page)),
+			values: int64(p.rows),
+		}
+		if chunk.offset == 0 {
+			chunk.offset = int64(len(parquetMagic))
+		}
+		if err := p.output(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := p.output(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.size
+		p.values[i] = p.values[i][:0]
+		p.defined[i] = p.defined[i][:0]
+	}
+	p.groups = append(p.groups, group)
+	p.total += int64(p.rows)
+	p.rows = 0
+	return nil
+}
+
+// Helper to write the remaining rows and the file metadata
+func (p *parquetWriter) close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	if p.offset == 0 {
+		if err := p.output(nil); err != nil {
+			return err
+		}
+	}
+	var meta thriftWriter
+	meta.begin()
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(p.columns)+1)
+	meta.begin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(p.columns)))
+	meta.end()
+	for _, c := range p.columns {
+		meta.begin()
+		meta.i32(1, parquetTypeByteArray)
+		meta.i32(3, parquetRepetitionOptional)
+		meta.binary(4, c)
+		meta.i32(6, parquetConvertedUTF8)
+		meta.end()
+	}
+	meta.i64(3, p.total)
+	meta.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		meta.begin()
+		meta.list(1, thriftStruct, len(g.chunks))
+		for _, c := range g.chunks {
+			meta.begin()
+			meta.i64(2, c.offset)
+			meta.structField(3)
+			meta.i32(1, parquetTypeByteArray)
+			meta.list(2, thriftI32, 2)
+			meta.zigzag(int64(parquetEncodingPlain))
+			meta.zigzag(int64(parquetEncodingRLE))
+			meta.list(3, thriftBinary, 1)
+			meta.varint(uint64(len(c.name)))
+			meta.buf.WriteString(c.name)
+			meta.i32(4, parquetCodecUncompressed)
+			meta.i64(5, c.values)
+			meta.i64(6, c.size)
+			meta.i64(7, c.size)
+			meta.i64(9, c.offset)
+			meta.end()
+			meta.end()
+		}
+		meta.i64(2, g.size)
+		meta.i64(3, g.rows)
+		meta.end()
+	}
+	meta.binary(6, parquetCreatedBy)
+	meta.end()
+	footer := meta.buf.Bytes()
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(len(footer)))
+	footer = append(footer, l[:]...)
+	footer = append(footer, parquetMagic...)
+	return p.output(footer)
+}
@@ -0,0 +1,285 @@
+package queries
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// thriftReader decodes thrift compact structs as maps by field id, to check the parquet metadata
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(t byte) interface{} {
+	switch t {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.varint())
+		s := string(r.data[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.data[r.pos]
+		r.pos++
+		size, etype := int(h>>4), h&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(etype)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", t))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		h := r.data[r.pos]
+		r.pos++
+		if h == 0 {
+			return fields
+		}
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(h & 0x0f)
+	}
+}
+
+// parquetFile with the decoded metadata and the values of each column, nil when the value is missing
+type parquetFile struct {
+	columns []string
+	rows    int64
+	groups  int
+	values  [][]*string
+}
+
+// Helper to decode the files written by parquetWriter
+func readParquet(t *testing.T, data []byte) parquetFile {
+	var f parquetFile
+	if len(data) < 12 || string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		t.Fatalf("missing parquet magic bytes")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{data: data[len(data)-8-size : len(data)-8]}).structure()
+	f.rows = meta[3].(int64)
+	schema := meta[2].([]interface{})
+	if n := schema[0].(map[int16]interface{})[5].(int64); int(n) != len(schema)-1 {
+		t.Fatalf("schema with %d children and %d columns", n, len(schema)-1)
+	}
+	for _, s := range schema[1:] {
+		f.columns = append(f.columns, s.(map[int16]interface{})[4].(string))
+	}
+	f.values = make([][]*string, len(f.columns))
+	groups := meta[4].([]interface{})
+	f.groups = len(groups)
+	for _, g := range groups {
+		chunks := g.(map[int16]interface{})[1].([]interface{})
+		if len(chunks) != len(f.columns) {
+			t.Fatalf("row group with %d chunks, want %d", len(chunks), len(f.columns))
+		}
+		for i, c := range chunks {
+			chunk := c.(map[int16]interface{})[3].(map[int16]interface{})
+			r := &thriftReader{data: data, pos: int(chunk[9].(int64))}
+			header := r.structure()
+			page := data[r.pos : r.pos+int(header[3].(int64))]
+			rows := int(header[5].(map[int16]interface{})[1].(int64))
+			// Definition levels with the RLE hybrid encoding, then the present values
+			levels := int(binary.LittleEndian.Uint32(page))
+			lr := &thriftReader{data: page[4 : 4+levels]}
+			var defined []bool
+			for lr.pos < len(lr.data) {
+				run := int(lr.varint() >> 1)
+				v := lr.data[lr.pos] == 1
+				lr.pos++
+				for j := 0; j < run; j++ {
+					defined = append(defined, v)
+				}
+			}
+			if len(defined) != rows {
+				t.Fatalf("column %s with %d levels and %d rows", f.columns[i], len(defined), rows)
+			}
+			pos := 4 + levels
+			for _, d := range defined {
+				if !d {
+					f.values[i] = append(f.values[i], nil)
+					continue
+				}
+				l := int(binary.LittleEndian.Uint32(page[pos:]))
+				v := string(page[pos+4 : pos+4+l])
+				f.values[i] = append(f.values[i], &v)
+				pos += 4 + l
+			}
+		}
+	}
+	return f
+}
+
+// Helper to convert decoded values to strings, missing values are shown as <nil>
+func parquetStrings(values []*string) []string {
+	var result []string
+	for _, v := range values {
+		if v == nil {
+			result = append(result, "<nil>")
+		} else {
+			result = append(result, *v)
+		}
+	}
+	return result
+}
+
+func TestParquetExport(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := NewResultsExporter(ExportParquet, &buf, []string{"pid", "name", "uuid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []map[string]string{
+		{"name": "launchd", "pid": "1", "uuid": "result uuid"},
+		{"name": "kernel_task"},
+		{"name": "", "pid": "200", "unknown": "skipped"},
+	}
+	for _, r := range rows {
+		if err := e.Write("node-uuid", "host", "prod", r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if want := []string{"uuid", "hostname", "environment", "name", "pid", "result_uuid"}; !reflect.DeepEqual(f.columns, want) {
+		t.Fatalf("columns %v, want %v", f.columns, want)
+	}
+	if f.rows != 3 || f.groups != 1 {
+		t.Fatalf("%d rows in %d groups", f.rows, f.groups)
+	}
+	want := [][]string{
+		{"node-uuid", "node-uuid", "node-uuid"},
+		{"host", "host", "host"},
+		{"prod", "prod", "prod"},
+		{"launchd", "kernel_task", ""},
+		{"1", "<nil>", "200"},
+		{"result uuid", "<nil>", "<nil>"},
+	}
+	for i := range f.columns {
+		if got := parquetStrings(f.values[i]); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("column %s is %v, want %v", f.columns[i], got, want[i])
+		}
+	}
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	w := newParquetWriter(&buf, []string{"n"})
+	total := parquetRowGroupSize + 10
+	for i := 0; i < total; i++ {
+		if err := w.write([]string{strconv.Itoa(i)}, []bool{i%2 == 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if f.rows != int64(total) || f.groups != 2 || len(f.values[0]) != total {
+		t.Fatalf("%d rows in %d groups, %d values", f.rows, f.groups, len(f.values[0]))
+	}
+	for i, v := range f.values[0] {
+		if (v != nil) != (i%2 == 0) || (v != nil && *v != strconv.Itoa(i)) {
+			t.Fatalf("row %d is %v", i, parquetStrings(f.values[0][i:i+1]))
+		}
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := newParquetWriter(&buf, []string{"a", "b"})
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+	f := readParquet(t, buf.Bytes())
+	if f.rows != 0 || f.groups != 0 || !reflect.DeepEqual(f.columns, []string{"a", "b"}) {
+		t.Errorf("unexpected file %+v", f)
+	}
+}
+
+// Rows of testdata/results.parquet, a file written by the exporter to detect changes in the format
+// The fixture can be checked with other readers, like pyarrow.parquet.read_table("testdata/results.parquet")
+var fixtureRows = []struct {
+	uuid     string
+	hostname string
+	row      map[string]string
+}{
+	{"node-1", "host-1", map[string]string{"name": "launchd", "pid": "1", "uuid": "result uuid"}},
+	{"node-1", "host-1", map[string]string{"name": "kernel_task"}},
+	{"node-2", "", map[string]string{"name": "", "pid": "200"}},
+	{"node-2", "", map[string]string{"name": "ünïcode ✓", "pid": "-3"}},
+}
+
+func TestParquetFixture(t *testing.T) {
+	fixture, err := ioutil.ReadFile(filepath.Join("testdata", "results.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	e, err := NewResultsExporter(ExportParquet, &buf, []string{"pid", "name", "uuid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range fixtureRows {
+		if err := e.Write(r.uuid, r.hostname, "prod", r.row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), fixture) {
+		t.Fatalf("export of %d bytes does not match the fixture of %d bytes", buf.Len(), len(fixture))
+	}
+	f := readParquet(t, fixture)
+	want := [][]string{
+		{"node-1", "node-1", "node-2", "node-2"},
+		{"host-1", "host-1", "", ""},
+		{"prod", "prod", "prod", "prod"},
+		{"launchd", "kernel_task", "", "ünïcode ✓"},
+		{"1", "<nil>", "200", "-3"},
+		{"result uuid", "<nil>", "<nil>", "<nil>"},
+	}
+	if f.rows != 4 || len(f.columns) != len(want) {
+		t.Fatalf("%d rows and columns %v", f.rows, f.columns)
+	}
+	for i := range f.columns {
+		if got := parquetStrings(f.values[i]); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("column %s is %v, want %v", f.columns[i], got, want[i])
+		}
+	}
+}
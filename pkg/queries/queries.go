@@ -3,6 +3,7 @@ package queries
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/jmpsec/osctrl/pkg/nodes"
@@ -17,6 +18,22 @@ const (
 	QueryTargetEnvironment string = "environment"
 	// QueryTargetUUID defines uuid as target
 	QueryTargetUUID string = "uuid"
+	// QueryTargetTag defines a tag expression as target
+	QueryTargetTag string = "tag"
+	// QueryTargetCIDR defines a network of IP addresses as target
+	QueryTargetCIDR string = "cidr"
+	// QueryTargetOsqueryVersion defines a range of osquery versions as target
+	QueryTargetOsqueryVersion string = "osquery_version"
+	// QueryTargetPlatformVersion defines a range of platform versions as target
+	QueryTargetPlatformVersion string = "platform_version"
+	// QueryTargetLastSeen defines a duration since nodes were last seen as target
+	QueryTargetLastSeen string = "last_seen"
+	// QueryTargetSeenUUID keeps the nodes that matched last seen targets when the query was launched
+	QueryTargetSeenUUID string = "seen_uuid"
+	// QueryMatchAny defines queries for nodes matching any target
+	QueryMatchAny string = "any"
+	// QueryMatchAll defines queries for nodes matching one target of each type
+	QueryMatchAll string = "all"
 	// StandardQueryType defines a regular query
 	StandardQueryType string = "query"
 	// CarveQueryType defines a regular query
@@ -47,8 +64,12 @@ type DistributedQuery struct {
 	Completed  bool
 	Deleted    bool
 	Repeat     uint
+	Cron       string
+	Generation uint
+	NextRun    time.Time
 	Type       string
 	Path       string
+	Match      string
 }
 
 // DistributedQueryTarget to keep target logic for queries
@@ -62,9 +83,10 @@ type DistributedQueryTarget struct {
 // DistributedQueryExecution to keep track of queries executing
 type DistributedQueryExecution struct {
 	gorm.Model
-	Name   string `gorm:"index"`
-	UUID   string `gorm:"index"`
-	Result int
+	Name       string `gorm:"index"`
+	UUID       string `gorm:"index"`
+	Generation uint
+	Result     int
 }
 
 // QueryReadQueries to hold the on-demand queries
@@ -97,7 +119,7 @@ func CreateQueries(backend *gorm.DB) *Queries {
 // NodeQueries to get all queries that belong to the provided node
 // FIXME this will impact the performance of the TLS endpoint due to being CPU and I/O hungry
 // FIMXE potential mitigation can be add a cache (Redis?) layer to store queries per node_key
-func (q *Queries) NodeQueries(node nodes.OsqueryNode) (QueryReadQueries, error) {
+func (q *Queries) NodeQueries(node nodes.OsqueryNode, tags map[string]string) (QueryReadQueries, error) {
 	// Get all current active queries and carvesccccccijgvvbighcllglrtditncrninnndegfhuurkgu
 
 	queries, err := q.GetActive()
@@ -111,8 +133,14 @@ func (q *Queries) NodeQueries(node nodes.OsqueryNode) (QueryReadQueries, error)
 		if err != nil {
 			return QueryReadQueries{}, err
 		}
-		if isQueryTarget(node, targets) && q.NotYetExecuted(_q.Name, node.UUID) {
-			qs[_q.Name] = _q.Query
+		// Nodes update when they poll, so last seen targets use the nodes seen at launch
+		var seen *bool
+		if hasTarget(targets, QueryTargetLastSeen) {
+			s := q.SeenAtLaunch(_q.Name, node.UUID)
+			seen = &s
+		}
+		if isQueryTarget(node, tags, targets, _q.Match, seen) && q.NotYetExecuted(_q.Name, node.UUID, _q.Generation) {
+			qs[GenerationName(_q.Name, _q.Generation)] = _q.Query
 		}
 	}
 	return qs, nil
@@ -187,11 +215,15 @@ func (q *Queries) Complete(name string) error {
 }
 
 // VerifyComplete to mark query as completed if the expected executions are done
+// Recurring queries stay active for the next generation until they are completed manually
 func (q *Queries) VerifyComplete(name string) error {
 	query, err := q.Get(name)
 	if err != nil {
 		return err
 	}
+	if query.Recurring() {
+		return nil
+	}
 	if (query.Executions + query.Errors) >= query.Expected {
 		if err := q.DB.Model(&query).Updates(map[string]interface{}{"completed": true, "active": false}).Error; err != nil {
 			return err
@@ -253,41 +285,59 @@ func (q *Queries) CreateTarget(name, targetType, targetValue string) error {
 	return nil
 }
 
-// GetTargets to retrieve targets for a given query
+// CreateSeenTargets to keep the nodes that matched last seen targets when a query is launched
+func (q *Queries) CreateSeenTargets(name string, uuids []string) error {
+	tx := q.DB.Begin()
+	for _, uuid := range uuids {
+		queryTarget := DistributedQueryTarget{
+			Name:  name,
+			Type:  QueryTargetSeenUUID,
+			Value: uuid,
+		}
+		if err := tx.Create(&queryTarget).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// SeenAtLaunch to check if a node matched the last seen targets when a query was launched
+func (q *Queries) SeenAtLaunch(name, uuid string) bool {
+	var results int
+	q.DB.Model(&DistributedQueryTarget{}).Where("name = ? AND type = ? AND value = ?", name, QueryTargetSeenUUID, uuid).Count(&results)
+	return (results > 0)
+}
+
+// GetTargets to retrieve targets for a given query, without the nodes seen at launch
 func (q *Queries) GetTargets(name string) ([]DistributedQueryTarget, error) {
 	var targets []DistributedQueryTarget
-	if err := q.DB.Where("name = ?", name).Find(&targets).Error; err != nil {
+	if err := q.DB.Where("name = ? AND type <> ?", name, QueryTargetSeenUUID).Find(&targets).Error; err != nil {
 		return targets, err
 	}
 	return targets, nil
 }
 
-// NotYetExecuted to check if query already executed or it is within the interval
-func (q *Queries) NotYetExecuted(name, uuid string) bool {
+// NotYetExecuted to check if query already executed in this generation
+func (q *Queries) NotYetExecuted(name, uuid string, generation uint) bool {
 	var results int
-	q.DB.Model(&DistributedQueryExecution{}).Where("name = ? AND uuid = ?", name, uuid).Count(&results)
+	q.DB.Model(&DistributedQueryExecution{}).Where("name = ? AND uuid = ? AND generation = ?", name, uuid, generation).Count(&results)
 	return (results == 0)
 }
 
 // IncExecution to increase the execution count for this query
-func (q *Queries) IncExecution(name string) error {
-	query, err := q.Get(name)
-	if err != nil {
-		return err
-	}
-	if err := q.DB.Model(&query).Update("executions", query.Executions+1).Error; err != nil {
+// Results of a previous generation are not counted in the current one
+func (q *Queries) IncExecution(name string, generation uint) error {
+	if err := q.DB.Model(&DistributedQuery{}).Where("name = ? AND generation = ?", name, generation).Update("executions", gorm.Expr("executions + ?", 1)).Error; err != nil {
 		return err
 	}
 	return nil
 }
 
 // IncError to increase the error count for this query
-func (q *Queries) IncError(name string) error {
-	query, err := q.Get(name)
-	if err != nil {
-		return err
-	}
-	if err := q.DB.Model(&query).Update("errors", query.Errors+1).Error; err != nil {
+// Errors of a previous generation are not counted in the current one
+func (q *Queries) IncError(name string, generation uint) error {
+	if err := q.DB.Model(&DistributedQuery{}).Where("name = ? AND generation = ?", name, generation).Update("errors", gorm.Expr("errors + ?", 1)).Error; err != nil {
 		return err
 	}
 	return nil
@@ -305,12 +355,13 @@ func (q *Queries) SetExpected(name string, expected int) error {
 	return nil
 }
 
-// TrackExecution to keep track of where queries have already ran
-func (q *Queries) TrackExecution(name, uuid string, result int) error {
+// TrackExecution to keep track of where queries have already ran, in each generation
+func (q *Queries) TrackExecution(name, uuid string, generation uint, result int) error {
 	queryExecution := DistributedQueryExecution{
-		Name:   name,
-		UUID:   uuid,
-		Result: result,
+		Name:       name,
+		UUID:       uuid,
+		Generation: generation,
+		Result:     result,
 	}
 	if q.DB.NewRecord(queryExecution) {
 		if err := q.DB.Create(&queryExecution).Error; err != nil {
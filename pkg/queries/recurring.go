@@ -0,0 +1,192 @@
+package queries
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerationSeparator joins the name of a recurring query and its generation, in the name sent to nodes
+const GenerationSeparator string = "@"
+
+// ResultDiffRow to keep one result row of a node that changed between generations
+type ResultDiffRow struct {
+	UUID        string            `json:"uuid"`
+	Environment string            `json:"environment"`
+	Row         map[string]string `json:"row"`
+}
+
+// ResultDiff to keep the rows added and removed from one generation of a recurring query to the previous one
+type ResultDiff struct {
+	Generation uint            `json:"generation"`
+	Previous   uint            `json:"previous"`
+	Nodes      int             `json:"nodes"`
+	Added      []ResultDiffRow `json:"added"`
+	Removed    []ResultDiffRow `json:"removed"`
+}
+
+// Recurring checks if the query runs again on a schedule
+func (q DistributedQuery) Recurring() bool {
+	return q.Generation > 0
+}
+
+// Schedule returns the schedule of a recurring query to be displayed
+func (q DistributedQuery) Schedule() string {
+	if q.Cron != "" {
+		return q.Cron
+	}
+	if q.Repeat > 0 {
+		return fmt.Sprintf("every %d minutes", q.Repeat)
+	}
+	return ""
+}
+
+// ValidateSchedule checks the schedule of a recurring query, every some minutes or a cron expression but not both
+func ValidateSchedule(repeat uint, cron string) error {
+	if repeat > 0 && cron != "" {
+		return fmt.Errorf("repeat and cron can not be used together")
+	}
+	if cron != "" {
+		if _, err := ParseCron(cron); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleNext returns the next run of a recurring query after the provided time
+func ScheduleNext(repeat uint, cron string, from time.Time) (time.Time, error) {
+	if cron != "" {
+		c, err := ParseCron(cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return c.Next(from), nil
+	}
+	if repeat > 0 {
+		return from.Add(time.Duration(repeat) * time.Minute), nil
+	}
+	return time.Time{}, fmt.Errorf("query is not recurring")
+}
+
+// GenerationName returns the name of a query as sent to nodes, with the generation for recurring queries
+func GenerationName(name string, generation uint) string {
+	if generation == 0 {
+		return name
+	}
+	return name + GenerationSeparator + strconv.FormatUint(uint64(generation), 10)
+}
+
+// SplitGenerationName returns the name of a query and the generation from the name sent to nodes
+func SplitGenerationName(name string) (string, uint) {
+	i := strings.LastIndex(name, GenerationSeparator)
+	if i < 0 {
+		return name, 0
+	}
+	g, err := strconv.ParseUint(name[i+1:], 10, 32)
+	if err != nil {
+		return name, 0
+	}
+	return name[:i], uint(g)
+}
+
+// RunRecurring starts a new generation for the active recurring queries that are due
+// Only one instance starts each generation, the ones that started are returned
+func (q *Queries) RunRecurring(now time.Time) ([]DistributedQuery, error) {
+	var due []DistributedQuery
+	if err := q.DB.Where("active = ? AND deleted = ? AND generation > ? AND next_run <= ?", true, false, 0, now).Find(&due).Error; err != nil {
+		return nil, err
+	}
+	var started []DistributedQuery
+	for _, d := range due {
+		next, err := ScheduleNext(d.Repeat, d.Cron, now)
+		if err != nil {
+			log.Printf("error scheduling query %s %v", d.Name, err)
+			continue
+		}
+		update := q.DB.Model(&DistributedQuery{}).Where("id = ? AND generation = ?", d.ID, d.Generation).Updates(map[string]interface{}{
+			"generation": d.Generation + 1,
+			"executions": 0,
+			"errors":     0,
+			"completed":  false,
+			"next_run":   next,
+		})
+		if update.Error != nil {
+			return started, update.Error
+		}
+		if update.RowsAffected == 0 {
+			continue
+		}
+		d.Generation++
+		d.NextRun = next
+		started = append(started, d)
+	}
+	return started, nil
+}
+
+// Helper to get the key to compare a result row of a node, JSON keeps the columns sorted
+func diffKey(uuid string, row map[string]string) string {
+	k, _ := json.Marshal(row)
+	return uuid + "\x00" + string(k)
+}
+
+// CompareGenerations gets the result rows added and removed in one generation of a recurring query
+// Rows of nodes that did not answer, or failed, in that generation are not removed
+func (q *Queries) CompareGenerations(name string, generation uint) (ResultDiff, error) {
+	diff := ResultDiff{Generation: generation}
+	if generation < 2 {
+		return diff, fmt.Errorf("generation %d has no previous generation", generation)
+	}
+	diff.Previous = generation - 1
+	previous := make(map[string][]ResultDiffRow)
+	err := q.ResultsData(name, diff.Previous, func(uuid, environment string, data []byte) error {
+		rows, status, err := parseResult(data)
+		if err != nil || status != 0 {
+			return nil
+		}
+		for _, r := range rows {
+			k := diffKey(uuid, r)
+			previous[k] = append(previous[k], ResultDiffRow{UUID: uuid, Environment: environment, Row: r})
+		}
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+	answered := make(map[string]bool)
+	err = q.ResultsData(name, generation, func(uuid, environment string, data []byte) error {
+		rows, status, err := parseResult(data)
+		if err != nil || status != 0 {
+			return nil
+		}
+		answered[uuid] = true
+		for _, r := range rows {
+			k := diffKey(uuid, r)
+			if len(previous[k]) > 0 {
+				previous[k] = previous[k][1:]
+				continue
+			}
+			diff.Added = append(diff.Added, ResultDiffRow{UUID: uuid, Environment: environment, Row: r})
+		}
+		return nil
+	})
+	if err != nil {
+		return diff, err
+	}
+	for _, rows := range previous {
+		for _, r := range rows {
+			if answered[r.UUID] {
+				diff.Removed = append(diff.Removed, r)
+			}
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diffKey(diff.Removed[i].UUID, diff.Removed[i].Row) < diffKey(diff.Removed[j].UUID, diff.Removed[j].Row)
+	})
+	diff.Nodes = len(answered)
+	return diff, nil
+}
@@ -0,0 +1,487 @@
+package queries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Platforms used by the osquery tables
+const (
+	TablePlatformLinux   string = "linux"
+	TablePlatformDarwin  string = "darwin"
+	TablePlatformWindows string = "windows"
+	TablePlatformFreeBSD string = "freebsd"
+)
+
+// ExpensiveTables with the tables that can take a long time or use many resources in nodes
+var ExpensiveTables = map[string]bool{
+	"file":                 true,
+	"hash":                 true,
+	"yara":                 true,
+	"magic":                true,
+	"curl":                 true,
+	"curl_certificate":     true,
+	"augeas":               true,
+	"device_file":          true,
+	"device_hash":          true,
+	"process_memory_map":   true,
+	"process_open_files":   true,
+	"authenticode":         true,
+	"signature":            true,
+	"ntfs_acl_permissions": true,
+	"registry":             true,
+	"suid_bin":             true,
+}
+
+// Keywords that can not be used as alias of a table
+var sqlKeywords = map[string]bool{
+	"AS": true, "ON": true, "USING": true, "WHERE": true, "GROUP": true, "ORDER": true,
+	"LIMIT": true, "HAVING": true, "WINDOW": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"INNER": true, "OUTER": true, "CROSS": true, "NATURAL": true, "SELECT": true,
+	"FROM": true, "INDEXED": true, "NOT": true, "AND": true, "OR": true, "IS": true,
+	"IN": true, "LIKE": true, "GLOB": true, "MATCH": true, "REGEXP": true,
+	"BETWEEN": true, "CASE": true, "WHEN": true, "THEN": true, "ELSE": true,
+	"END": true, "NULL": true, "DISTINCT": true, "ALL": true, "BY": true,
+	"OFFSET": true, "COLLATE": true, "ESCAPE": true, "EXISTS": true, "VALUES": true,
+	"WITH": true, "FILTER": true, "OVER": true, "ISNULL": true, "NOTNULL": true,
+}
+
+// Keywords that can follow a table in FROM or JOIN
+var sqlTableFollowers = map[string]bool{
+	"ON": true, "USING": true, "WHERE": true, "GROUP": true, "ORDER": true,
+	"LIMIT": true, "HAVING": true, "WINDOW": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "JOIN": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"INNER": true, "CROSS": true, "NATURAL": true, "INDEXED": true, "NOT": true,
+}
+
+// Keywords and operators that need an operand after them
+// Keywords that are also column names, like offset in process_memory_map, are not included
+var sqlOperandBefore = map[string]bool{
+	"WHERE": true, "AND": true, "OR": true, "ON": true, "HAVING": true, "BY": true,
+	"LIMIT": true, "NOT": true, "IS": true, "IN": true, "LIKE": true, "GLOB": true,
+	"BETWEEN": true, "WHEN": true, "THEN": true, "ELSE": true, "USING": true,
+	"=": true, "<": true, ">": true,
+}
+
+// Keywords that start a clause, so they can not be the operand of another one
+var sqlClauses = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "LIMIT": true, "HAVING": true,
+	"WINDOW": true, "UNION": true, "EXCEPT": true, "INTERSECT": true, "FROM": true,
+	"JOIN": true, "ON": true, "USING": true, "AND": true, "OR": true,
+}
+
+// TableInfo with the platforms where an osquery table is available
+type TableInfo struct {
+	Name      string
+	Platforms []string
+}
+
+// SQLValidator checks queries against the known osquery tables
+type SQLValidator struct {
+	Tables map[string][]string
+}
+
+// sqlToken is one token of a query, Kind is w for words, q for quoted identifiers, s for strings and p for punctuation
+type sqlToken struct {
+	Kind  byte
+	Value string
+}
+
+// CreateSQLValidator to initialize the validator with the osquery tables
+func CreateSQLValidator(tables []TableInfo) *SQLValidator {
+	v := &SQLValidator{Tables: make(map[string][]string)}
+	for _, t := range tables {
+		v.Tables[strings.ToLower(t.Name)] = t.Platforms
+	}
+	return v
+}
+
+// TablePlatform converts the platform of a node to the platform used by the osquery tables
+func TablePlatform(platform string) string {
+	switch platform {
+	case TablePlatformDarwin, TablePlatformWindows, TablePlatformFreeBSD:
+		return platform
+	}
+	return TablePlatformLinux
+}
+
+// Helper to split a query in tokens, skipping whitespace and comments
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end + 1
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			j := i + 1
+			var value strings.Builder
+			for {
+				if j >= len(sql) {
+					if c == '\'' {
+						return nil, fmt.Errorf("unterminated string")
+					}
+					return nil, fmt.Errorf("unterminated identifier")
+				}
+				if sql[j] == closing {
+					// Quotes are escaped by doubling them
+					if closing != ']' && j+1 < len(sql) && sql[j+1] == closing {
+						value.WriteByte(closing)
+						j += 2
+						continue
+					}
+					break
+				}
+				value.WriteByte(sql[j])
+				j++
+			}
+			kind := byte('q')
+			if c == '\'' {
+				kind = 's'
+			}
+			tokens = append(tokens, sqlToken{Kind: kind, Value: value.String()})
+			i = j + 1
+		case c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+			j := i
+			for j < len(sql) {
+				d := sql[j]
+				if d == '_' || d == '$' || d >= '0' && d <= '9' || d >= 'a' && d <= 'z' || d >= 'A' && d <= 'Z' || d >= 0x80 {
+					j++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, sqlToken{Kind: 'w', Value: sql[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, sqlToken{Kind: 'p', Value: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// Helper to check if a token is a keyword
+func (t sqlToken) is(keyword string) bool {
+	return t.Kind == 'w' && strings.EqualFold(t.Value, keyword)
+}
+
+// Helper to check if a token can be a name, numbers and keywords can not
+func (t sqlToken) isName() bool {
+	if t.Kind == 'q' {
+		return true
+	}
+	return t.Kind == 'w' && (t.Value[0] < '0' || t.Value[0] > '9') && !sqlKeywords[strings.ToUpper(t.Value)]
+}
+
+// Helper to get the keyword or operator of a token, empty for names, numbers and strings
+func (t sqlToken) keyword() string {
+	switch t.Kind {
+	case 'p':
+		return t.Value
+	case 'w':
+		if k := strings.ToUpper(t.Value); sqlKeywords[k] {
+			return k
+		}
+	}
+	return ""
+}
+
+// Helper to check that clauses and operators are complete, like a WHERE without condition
+func checkClauses(tokens []sqlToken) error {
+	for i, t := range tokens {
+		k := t.keyword()
+		if k == "GROUP" || k == "ORDER" {
+			if i+1 >= len(tokens) || !tokens[i+1].is("BY") {
+				return fmt.Errorf("missing BY after %s", k)
+			}
+			continue
+		}
+		if !sqlOperandBefore[k] {
+			continue
+		}
+		if i+1 >= len(tokens) {
+			return fmt.Errorf("incomplete query after %s", k)
+		}
+		next := tokens[i+1].keyword()
+		if next == ")" || next == "," || sqlClauses[next] {
+			return fmt.Errorf("incomplete query, unexpected %s after %s", tokens[i+1].Value, k)
+		}
+	}
+	return nil
+}
+
+// Helper to check if a token can follow a table, a clause, a join or the next table
+func (t sqlToken) isTableFollower() bool {
+	if t.Kind == 'p' {
+		return t.Value == "," || t.Value == ")"
+	}
+	return t.Kind == 'w' && sqlTableFollowers[strings.ToUpper(t.Value)]
+}
+
+// Helper to skip a group between parentheses, returns the position after the closing one
+func skipGroup(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if tokens[i].Kind != 'p' {
+			continue
+		}
+		switch tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// Helper to collect the names of common table expressions
+func cteNames(tokens []sqlToken) (map[string]bool, error) {
+	names := make(map[string]bool)
+	if len(tokens) == 0 || !tokens[0].is("WITH") {
+		return names, nil
+	}
+	i := 1
+	if i < len(tokens) && tokens[i].is("RECURSIVE") {
+		i++
+	}
+	for {
+		if i >= len(tokens) || !tokens[i].isName() {
+			return nil, fmt.Errorf("missing name of common table expression")
+		}
+		names[strings.ToLower(tokens[i].Value)] = true
+		i++
+		if i < len(tokens) && tokens[i].Value == "(" {
+			i = skipGroup(tokens, i)
+		}
+		if i >= len(tokens) || !tokens[i].is("AS") {
+			return nil, fmt.Errorf("missing AS in common table expression")
+		}
+		i++
+		if i < len(tokens) && (tokens[i].is("MATERIALIZED") || tokens[i].is("NOT")) {
+			for i < len(tokens) && tokens[i].Value != "(" {
+				i++
+			}
+		}
+		if i >= len(tokens) || tokens[i].Value != "(" {
+			return nil, fmt.Errorf("missing query of common table expression")
+		}
+		i = skipGroup(tokens, i)
+		if i < len(tokens) && tokens[i].Value == "," {
+			i++
+			continue
+		}
+		return names, nil
+	}
+}
+
+// ParseSQL checks the structure of a query and returns the tables it reads
+// Only single SELECT statements are accepted, because osquery tables are read only
+// Incomplete clauses and unexpected words after tables are rejected, but this is not a full
+// SQL parser and other syntax errors are only reported by osquery when the query runs
+func ParseSQL(sql string) ([]string, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	// Trailing semicolons are fine, but only one statement is allowed
+	for len(tokens) > 0 && tokens[len(tokens)-1].Value == ";" && tokens[len(tokens)-1].Kind == 'p' {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	if !tokens[0].is("SELECT") && !tokens[0].is("WITH") {
+		return nil, fmt.Errorf("query must start with SELECT or WITH, not %s", tokens[0].Value)
+	}
+	depth := 0
+	for _, t := range tokens {
+		if t.Kind != 'p' {
+			continue
+		}
+		switch t.Value {
+		case ";":
+			return nil, fmt.Errorf("only one statement is allowed")
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected )")
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("missing )")
+	}
+	if err := checkClauses(tokens); err != nil {
+		return nil, err
+	}
+	ctes, err := cteNames(tokens)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var tables []string
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.is("SELECT") {
+			next := i + 1
+			if next < len(tokens) && (tokens[next].is("DISTINCT") || tokens[next].is("ALL")) {
+				next++
+			}
+			if next >= len(tokens) || tokens[next].is("FROM") {
+				return nil, fmt.Errorf("missing columns after SELECT")
+			}
+			continue
+		}
+		if !t.is("FROM") && !t.is("JOIN") {
+			continue
+		}
+		// Comparison with IS [NOT] DISTINCT FROM, not a table
+		if i > 0 && tokens[i-1].is("DISTINCT") {
+			continue
+		}
+		list := t.is("FROM")
+		for {
+			i++
+			if i >= len(tokens) {
+				return nil, fmt.Errorf("missing table after %s", strings.ToUpper(t.Value))
+			}
+			// Subqueries are checked by the rest of the loop
+			if tokens[i].Value == "(" {
+				break
+			}
+			if !tokens[i].isName() {
+				return nil, fmt.Errorf("missing table after %s", strings.ToUpper(t.Value))
+			}
+			name := tokens[i].Value
+			// Schema names are skipped, as in main.processes
+			if i+2 < len(tokens) && tokens[i+1].Value == "." && tokens[i+2].isName() {
+				i += 2
+				name = tokens[i].Value
+			}
+			// Table valued functions, like json_each, are not tables
+			if i+1 < len(tokens) && tokens[i+1].Value == "(" {
+				i = skipGroup(tokens, i+1) - 1
+			} else if name = strings.ToLower(name); !ctes[name] && !seen[name] {
+				seen[name] = true
+				tables = append(tables, name)
+			}
+			// Skip the alias
+			if i+1 < len(tokens) && tokens[i+1].is("AS") {
+				i++
+			}
+			if i+1 < len(tokens) && tokens[i+1].isName() {
+				i++
+			}
+			if i+1 < len(tokens) && !tokens[i+1].isTableFollower() {
+				return nil, fmt.Errorf("unexpected %s after table %s", tokens[i+1].Value, name)
+			}
+			if !list || i+1 >= len(tokens) || tokens[i+1].Value != "," {
+				break
+			}
+			i++
+		}
+	}
+	return tables, nil
+}
+
+// Helper to get the table platforms from the platform field of scheduled queries
+func scheduledPlatforms(platform string) []string {
+	var platforms []string
+	for _, p := range strings.Split(platform, ",") {
+		switch p = strings.TrimSpace(p); p {
+		case "", "all", "any":
+			return nil
+		case "posix":
+			platforms = append(platforms, TablePlatformLinux, TablePlatformDarwin, TablePlatformFreeBSD)
+		default:
+			platforms = append(platforms, TablePlatform(p))
+		}
+	}
+	return platforms
+}
+
+// Validate checks a query for the platforms of the targeted nodes, empty for all platforms
+// Extra tables, like the ones from auto_table_construction or osquery extensions, are accepted in any platform
+// Tables missing in some of the platforms and expensive tables are returned as warnings
+func (v *SQLValidator) Validate(sql string, platforms, extra []string) ([]string, error) {
+	tables, err := ParseSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SQL - %v", err)
+	}
+	targeted := make(map[string]bool)
+	for _, p := range platforms {
+		targeted[TablePlatform(p)] = true
+	}
+	var targets []string
+	for p := range targeted {
+		targets = append(targets, p)
+	}
+	sort.Strings(targets)
+	var warnings []string
+	for _, t := range tables {
+		available, ok := v.Tables[t]
+		if !ok {
+			if inList(t, extra) {
+				continue
+			}
+			return warnings, fmt.Errorf("unknown table %s", t)
+		}
+		var missing []string
+		for _, p := range targets {
+			if !inList(p, available) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) > 0 && len(missing) == len(targets) {
+			return warnings, fmt.Errorf("table %s is not available in %s", t, strings.Join(missing, ", "))
+		}
+		if len(missing) > 0 {
+			warnings = append(warnings, fmt.Sprintf("table %s is not available in %s", t, strings.Join(missing, ", ")))
+		}
+		if ExpensiveTables[t] {
+			warnings = append(warnings, fmt.Sprintf("table %s is expensive, constrain it with WHERE", t))
+		}
+	}
+	return warnings, nil
+}
+
+// CheckScheduled checks a scheduled query using the platform field of the query
+func (v *SQLValidator) CheckScheduled(sql, platform string, extra []string) ([]string, error) {
+	return v.Validate(sql, scheduledPlatforms(platform), extra)
+}
+
+// Helper to check if a string is in a list
+func inList(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
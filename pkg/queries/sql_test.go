@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	tests := []struct {
+		sql    string
+		tables []string
+	}{
+		{"SELECT * FROM processes", []string{"processes"}},
+		{"select * from processes;", []string{"processes"}},
+		{"SELECT * FROM processes WHERE pid = 1", []string{"processes"}},
+		{"SELECT p.name, u.username FROM processes p JOIN users u ON p.uid = u.uid", []string{"processes", "users"}},
+		{"SELECT * FROM processes AS p, users AS u WHERE p.uid = u.uid", []string{"processes", "users"}},
+		{"SELECT * FROM processes LEFT OUTER JOIN users USING (uid)", []string{"processes", "users"}},
+		{"SELECT * FROM main.processes", []string{"processes"}},
+		{`SELECT * FROM "processes"`, []string{"processes"}},
+		{"SELECT * FROM Processes, processes", []string{"processes"}},
+		{"SELECT 1", nil},
+		{"SELECT * FROM (SELECT * FROM users) WHERE uid > 0", []string{"users"}},
+		{"SELECT * FROM users WHERE uid IN (SELECT uid FROM processes)", []string{"users", "processes"}},
+		{"WITH x AS (SELECT * FROM users) SELECT * FROM x", []string{"users"}},
+		{"WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM c LIMIT 5) SELECT * FROM c", nil},
+		{"SELECT value FROM osquery_info, json_each('[1,2]') AS j", []string{"osquery_info"}},
+		{"SELECT * FROM users WHERE uid IS NOT DISTINCT FROM 1", []string{"users"}},
+		{"SELECT * FROM users WHERE uid IS NOT NULL AND shell NOT LIKE '%false'", []string{"users"}},
+		{"SELECT start, end, offset FROM process_memory_map WHERE offset >= 0", []string{"process_memory_map"}},
+		{"SELECT count(*) FROM processes GROUP BY uid ORDER BY 1 DESC LIMIT 10", []string{"processes"}},
+		{"SELECT * FROM processes -- comment\nWHERE pid = 1", []string{"processes"}},
+		{"SELECT * FROM processes /* comment */ WHERE pid = 1", []string{"processes"}},
+		{"SELECT * FROM processes NOT INDEXED WHERE pid BETWEEN 1 AND 10", []string{"processes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			tables, err := ParseSQL(tt.sql)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(tables, tt.tables) {
+				t.Errorf("got tables %v, want %v", tables, tt.tables)
+			}
+		})
+	}
+}
+
+func TestParseSQLErrors(t *testing.T) {
+	tests := []string{
+		"",
+		";",
+		"DELETE FROM processes",
+		"SELECT * FROM processes; SELECT * FROM users",
+		"SELECT FROM processes",
+		"SELECT * FROM",
+		"SELECT * FROM processes WHERE",
+		"SELECT * FROM processes WHERE pid = 1 AND",
+		"SELECT * FROM processes WHERE pid = 1 OR",
+		"SELECT * FROM processes WHERE (pid = 1 AND)",
+		"SELECT * FROM processes WHERE pid =",
+		"SELECT * FROM processes WHERE GROUP BY uid",
+		"SELECT * FROM processes GROUP uid",
+		"SELECT * FROM processes ORDER BY",
+		"SELECT * FROM processes JOIN users ON",
+		"SELECT * FROM processes JOIN users ON WHERE pid = 1",
+		"SELECT * FROM users FILTER",
+		"SELECT * FROM users u extra",
+		"SELECT * FROM users AS u extra WHERE uid = 0",
+		"SELECT * FROM 1",
+		"SELECT * FROM processes WHERE name = 'unterminated",
+		"SELECT * FROM processes /* unterminated",
+		"SELECT * FROM (SELECT * FROM users",
+		"SELECT * FROM users)",
+		"WITH AS (SELECT 1) SELECT 1",
+	}
+	for _, sql := range tests {
+		t.Run(sql, func(t *testing.T) {
+			if tables, err := ParseSQL(sql); err == nil {
+				t.Errorf("expected error, got tables %v", tables)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	v := CreateSQLValidator([]TableInfo{
+		{Name: "processes", Platforms: []string{TablePlatformLinux, TablePlatformDarwin, TablePlatformWindows}},
+		{Name: "apt_sources", Platforms: []string{TablePlatformLinux}},
+		{Name: "file", Platforms: []string{TablePlatformLinux, TablePlatformDarwin, TablePlatformWindows}},
+	})
+	tests := []struct {
+		name      string
+		sql       string
+		platforms []string
+		extra     []string
+		warnings  int
+		err       bool
+	}{
+		{"known table", "SELECT * FROM processes", nil, nil, 0, false},
+		{"unknown table", "SELECT * FROM nothing", nil, nil, 0, true},
+		{"extra table", "SELECT * FROM nothing", nil, []string{"nothing"}, 0, false},
+		{"missing in some platforms", "SELECT * FROM apt_sources", []string{"ubuntu", "darwin"}, nil, 1, false},
+		{"missing in all platforms", "SELECT * FROM apt_sources", []string{"darwin", "windows"}, nil, 0, true},
+		{"expensive table", "SELECT * FROM file WHERE path = '/etc/passwd'", nil, nil, 1, false},
+		{"invalid SQL", "SELECT * FROM processes WHERE", nil, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := v.Validate(tt.sql, tt.platforms, tt.extra)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %v", err, tt.err)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("got warnings %v, want %d", warnings, tt.warnings)
+			}
+		})
+	}
+}
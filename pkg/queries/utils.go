@@ -1,28 +1,128 @@
 package queries
 
 import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
 	"github.com/jmpsec/osctrl/pkg/nodes"
 )
 
-// Helper to decide whether if the query targets apply to a give node
-func isQueryTarget(node nodes.OsqueryNode, targets []DistributedQueryTarget) bool {
+// IsQueryTarget to decide whether if the query targets apply to a give node
+// With QueryMatchAll the node must match one target of each type, otherwise any target is enough
+// Last seen targets are checked with the time the node was last seen, as when a query is launched
+func IsQueryTarget(node nodes.OsqueryNode, tags map[string]string, targets []DistributedQueryTarget, match string) bool {
+	return isQueryTarget(node, tags, targets, match, nil)
+}
+
+// Helper to decide whether if the query targets apply to a given node
+// If seen is not nil, it is used for last seen targets instead of the time the node was last seen
+func isQueryTarget(node nodes.OsqueryNode, tags map[string]string, targets []DistributedQueryTarget, match string, seen *bool) bool {
+	if match != QueryMatchAll {
+		for _, t := range targets {
+			if isTarget(node, tags, t, seen) {
+				return true
+			}
+		}
+		return false
+	}
+	matched := make(map[string]bool)
 	for _, t := range targets {
-		// Check for environment match
-		if t.Type == QueryTargetEnvironment && t.Value == node.Environment {
-			return true
+		if !matched[t.Type] {
+			matched[t.Type] = isTarget(node, tags, t, seen)
 		}
-		// Check for platform match
-		if t.Type == QueryTargetPlatform && node.Platform == t.Value {
-			return true
+	}
+	for _, m := range matched {
+		if !m {
+			return false
 		}
-		// Check for UUID match
-		if t.Type == QueryTargetUUID && node.UUID == t.Value {
+	}
+	return len(matched) > 0
+}
+
+// Helper to check if there is any target of one type
+func hasTarget(targets []DistributedQueryTarget, targetType string) bool {
+	for _, t := range targets {
+		if t.Type == targetType {
 			return true
 		}
-		// Check for localname match
-		if t.Type == QueryTargetLocalname && node.Localname == t.Value {
-			return true
+	}
+	return false
+}
+
+// Helper to decide whether if one target applies to a given node
+func isTarget(node nodes.OsqueryNode, tags map[string]string, t DistributedQueryTarget, seen *bool) bool {
+	switch t.Type {
+	// Check for environment match
+	case QueryTargetEnvironment:
+		return t.Value == node.Environment
+	// Check for platform match
+	case QueryTargetPlatform:
+		return node.Platform == t.Value
+	// Check for UUID match
+	case QueryTargetUUID:
+		return node.UUID == t.Value
+	// Check for localname match
+	case QueryTargetLocalname:
+		return node.Localname == t.Value
+	// Check for tags match, invalid expressions do not match any node
+	case QueryTargetTag:
+		ok, _ := nodes.MatchTags(t.Value, tags)
+		return ok
+	// Check for IP address in network
+	case QueryTargetCIDR:
+		_, network, err := net.ParseCIDR(t.Value)
+		ip := net.ParseIP(strings.TrimSpace(node.IPAddress))
+		return err == nil && ip != nil && network.Contains(ip)
+	// Check for versions in range
+	case QueryTargetOsqueryVersion:
+		ok, _ := nodes.MatchVersionRange(node.OsqueryVersion, t.Value)
+		return ok
+	case QueryTargetPlatformVersion:
+		ok, _ := nodes.MatchVersionRange(node.PlatformVersion, t.Value)
+		return ok
+	// Check for nodes seen within the duration
+	case QueryTargetLastSeen:
+		if seen != nil {
+			return *seen
 		}
+		d, err := time.ParseDuration(t.Value)
+		return err == nil && time.Since(node.UpdatedAt) <= d
 	}
 	return false
 }
+
+// ValidateTarget checks the value of a target by type
+func ValidateTarget(targetType, targetValue string) error {
+	if strings.TrimSpace(targetValue) == "" {
+		return fmt.Errorf("empty %s target", targetType)
+	}
+	switch targetType {
+	case QueryTargetEnvironment, QueryTargetPlatform, QueryTargetUUID, QueryTargetLocalname:
+		return nil
+	case QueryTargetTag:
+		if _, err := nodes.ParseTagExpression(targetValue); err != nil {
+			return fmt.Errorf("invalid tag expression - %v", err)
+		}
+	case QueryTargetCIDR:
+		if _, _, err := net.ParseCIDR(targetValue); err != nil {
+			return fmt.Errorf("invalid CIDR - %v", err)
+		}
+	case QueryTargetOsqueryVersion, QueryTargetPlatformVersion:
+		if err := nodes.ValidateVersionRange(targetValue); err != nil {
+			return fmt.Errorf("invalid %s - %v", targetType, err)
+		}
+	case QueryTargetLastSeen:
+		d, err := time.ParseDuration(targetValue)
+		if err != nil {
+			return fmt.Errorf("invalid last seen - %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("last seen must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown target type %s", targetType)
+	}
+	return nil
+}
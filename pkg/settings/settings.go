@@ -3,6 +3,7 @@ package settings
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/jinzhu/gorm"
 )
@@ -38,21 +39,40 @@ const (
 	LoggingSplunk  string = "splunk"
 	LoggingELK     string = "elk"
 	LoggingKafka   string = "kafka"
+	LoggingSyslog  string = "syslog"
+	LoggingWebhook string = "webhook"
 )
 
 // Names for all possible settings values
 const (
-	DebugHTTP       string = "debug_http"
-	DebugService    string = "debug_service"
-	RefreshEnvs     string = "refresh_envs"
-	RefreshSettings string = "refresh_settings"
-	CleanupSessions string = "cleanup_sessions"
-	ServiceMetrics  string = "service_metrics"
-	MetricsHost     string = "metrics_host"
-	MetricsPort     string = "metrics_port"
-	MetricsProtocol string = "metrics_protocol"
-	DefaultEnv      string = "default_env"
-	InactiveHours   string = "inactive_hours"
+	DebugHTTP        string = "debug_http"
+	DebugService     string = "debug_service"
+	RefreshEnvs      string = "refresh_envs"
+	RefreshSettings  string = "refresh_settings"
+	CleanupSessions  string = "cleanup_sessions"
+	ServiceMetrics   string = "service_metrics"
+	MetricsHost      string = "metrics_host"
+	MetricsPort      string = "metrics_port"
+	MetricsProtocol  string = "metrics_protocol"
+	DefaultEnv       string = "default_env"
+	InactiveHours    string = "inactive_hours"
+	LogQueueSize     string = "log_queue_size"
+	LogQueueWorkers  string = "log_queue_workers"
+	LogQueueBatch    string = "log_queue_batch"
+	LogQueueOverflow string = "log_queue_overflow"
+	LogQueueSpill    string = "log_queue_spill"
+	SpoolDir         string = "spool_dir"
+	SpoolMaxSize     string = "spool_max_size"
+	SpoolAttempts    string = "spool_attempts"
+	RemoteFlags      string = "remote_flags"
+	ExtraTables      string = "extra_tables"
+)
+
+// Types of overflow policies for the logs queue
+const (
+	OverflowBlock      string = "block"
+	OverflowDropOldest string = "drop_oldest"
+	OverflowSpill      string = "spill"
 )
 
 // Names for the values that are read from the JSON config file
@@ -460,6 +480,103 @@ func (conf *Settings) InactiveHours() int64 {
 	return value.Integer
 }
 
+// LogQueueSize gets the maximum number of logs waiting in each queue by service
+func (conf *Settings) LogQueueSize(service string) int64 {
+	value, err := conf.RetrieveValue(service, LogQueueSize)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// LogQueueWorkers gets the number of workers for each logs queue by service
+func (conf *Settings) LogQueueWorkers(service string) int64 {
+	value, err := conf.RetrieveValue(service, LogQueueWorkers)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// LogQueueBatch gets the maximum number of logs dispatched together by service
+func (conf *Settings) LogQueueBatch(service string) int64 {
+	value, err := conf.RetrieveValue(service, LogQueueBatch)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// LogQueueOverflow gets the policy to use when a logs queue is full by service
+func (conf *Settings) LogQueueOverflow(service string) string {
+	value, err := conf.RetrieveValue(service, LogQueueOverflow)
+	if err != nil {
+		return OverflowBlock
+	}
+	return value.String
+}
+
+// LogQueueSpill gets the directory to spill logs when a queue is full by service
+func (conf *Settings) LogQueueSpill(service string) string {
+	value, err := conf.RetrieveValue(service, LogQueueSpill)
+	if err != nil {
+		return ""
+	}
+	return value.String
+}
+
+// SpoolDir gets the directory to keep undelivered logs by service
+func (conf *Settings) SpoolDir(service string) string {
+	value, err := conf.RetrieveValue(service, SpoolDir)
+	if err != nil {
+		return ""
+	}
+	return value.String
+}
+
+// SpoolMaxSize gets the maximum size in megabytes of the spool by service
+func (conf *Settings) SpoolMaxSize(service string) int64 {
+	value, err := conf.RetrieveValue(service, SpoolMaxSize)
+	if err != nil {
+		return 0
+	}
+	return value.Integer
+}
+
+// SpoolAttempts gets the attempts to replay a spooled log before it is quarantined by service
+func (conf *Settings) SpoolAttempts(service string) int {
+	value, err := conf.RetrieveValue(service, SpoolAttempts)
+	if err != nil {
+		return 0
+	}
+	return int(value.Integer)
+}
+
+// RemoteFlags checks if flags are served with the configuration by service
+func (conf *Settings) RemoteFlags(service string) bool {
+	value, err := conf.RetrieveValue(service, RemoteFlags)
+	if err != nil {
+		return false
+	}
+	return value.Boolean
+}
+
+// ExtraTables gets the tables from osquery extensions that can be used in queries by service
+// Tables are separated by commas
+func (conf *Settings) ExtraTables(service string) []string {
+	value, err := conf.RetrieveValue(service, ExtraTables)
+	if err != nil {
+		return nil
+	}
+	var tables []string
+	for _, t := range strings.Split(value.String, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
 // DefaultEnv gets the default environment
 // FIXME customize the fallover one
 func (conf *Settings) DefaultEnv(service string) string {
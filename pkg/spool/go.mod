@@ -0,0 +1,3 @@
+module github.com/jmpsec/osctrl/pkg/spool
+
+go 1.12
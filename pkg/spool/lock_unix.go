@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package spool
+
+import (
+	"os"
+	"syscall"
+)
+
+// Helper to lock a file between processes, without waiting if it is already locked
+func lockSpool(f *os.File) error {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if err == syscall.EWOULDBLOCK {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// Helper to release the lock of a file
+func unlockSpool(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,47 @@
+//go:build windows
+// +build windows
+
+package spool
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	// Flags for LockFileEx
+	lockfileFailImmediately uintptr = 0x1
+	lockfileExclusiveLock   uintptr = 0x2
+	// Returned by LockFileEx when the file is already locked
+	errorLockViolation syscall.Errno = 33
+)
+
+// Helper to lock a file between processes, without waiting if it is already locked
+func lockSpool(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == errorLockViolation {
+			return ErrLocked
+		}
+		return err
+	}
+	return nil
+}
+
+// Helper to release the lock of a file
+func unlockSpool(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Extension for spooled entries
+	spoolExtension string = ".json"
+	// Extension for entries being written
+	tmpExtension string = ".tmp"
+	// Extension for entries that can not be parsed
+	corruptedExtension string = ".corrupted"
+	// Directory for entries that failed too many times, inside the directory of each destination
+	quarantineDir string = "quarantine"
+	// File to lock the spool of a destination between processes
+	lockFile string = ".lock"
+	// DefaultMaxSize for the spool, in bytes
+	DefaultMaxSize int64 = 1024 * 1024 * 1024
+	// DefaultMaxAttempts to replay an entry before it is quarantined
+	DefaultMaxAttempts int = 20
+)
+
+// ErrLocked is returned when the spool of a destination is being used by another process
+var ErrLocked = errors.New("spool is locked by another process")
+
+// Entry to hold one log that could not be delivered to a logging destination
+type Entry struct {
+	LogType     string    `json:"log_type"`
+	Environment string    `json:"environment"`
+	UUID        string    `json:"uuid"`
+	Data        []byte    `json:"data"`
+	Debug       bool      `json:"debug"`
+	Spooled     time.Time `json:"spooled"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+}
+
+// Info to show the state of the spool for one logging destination
+type Info struct {
+	Destination string
+	Entries     int
+	Quarantined int
+	Size        int64
+	Oldest      time.Time
+	Newest      time.Time
+}
+
+// usage to keep in memory the pending entries and bytes of one destination
+type usage struct {
+	entries int
+	size    int64
+}
+
+// Spool to keep undelivered logs on disk, one directory per logging destination
+// Pending entries and sizes are kept in memory, and synced with the disk with Refresh
+type Spool struct {
+	Dir         string
+	MaxSize     int64
+	MaxAttempts int
+	mux         sync.Mutex
+	usage       map[string]*usage
+	locks       map[string]*sync.Mutex
+	seq         uint64
+}
+
+// CreateSpool to initialize the spool and its directory
+func CreateSpool(dir string, maxSize int64, maxAttempts int) (*Spool, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("spool directory can not be empty")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating spool %s - %v", dir, err)
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	s := &Spool{
+		Dir:         dir,
+		MaxSize:     maxSize,
+		MaxAttempts: maxAttempts,
+		usage:       make(map[string]*usage),
+		locks:       make(map[string]*sync.Mutex),
+	}
+	dests, err := s.Destinations()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dests {
+		if err := s.Refresh(d); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Helper to get the sorted list of files spooled for a destination, oldest first
+func (s *Spool) files(destination string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, destination, "*"+spoolExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Helper to get the sorted list of quarantined files for a destination, oldest first
+func (s *Spool) quarantined(destination string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, destination, quarantineDir, "*"+spoolExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Helper to update the usage of a destination, it must be called with the mutex locked
+func (s *Spool) account(destination string, entries int, size int64) {
+	u, ok := s.usage[destination]
+	if !ok {
+		u = &usage{}
+		s.usage[destination] = u
+	}
+	u.entries += entries
+	u.size += size
+}
+
+// Helper to get the size in bytes of the whole spool, it must be called with the mutex locked
+func (s *Spool) size() int64 {
+	var total int64
+	for _, u := range s.usage {
+		total += u.size
+	}
+	return total
+}
+
+// Refresh syncs the usage of a destination with the disk, after changes by other processes
+func (s *Spool) Refresh(destination string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	u := &usage{}
+	files, err := s.files(destination)
+	if err != nil {
+		return err
+	}
+	u.entries = len(files)
+	err = filepath.Walk(filepath.Join(s.Dir, destination), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			u.size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.usage[destination] = u
+	return nil
+}
+
+// Store writes one entry to the spool of a destination, failing if the spool is full
+func (s *Spool) Store(destination string, entry Entry) error {
+	entry.Spooled = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	size := s.size()
+	if size+int64(len(data)) > s.MaxSize {
+		return fmt.Errorf("spool is full (%d bytes) - Dropping %d bytes", size, len(entry.Data))
+	}
+	dir := filepath.Join(s.Dir, destination)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	// Nanoseconds and a sequence in the filename keep the order of entries and make it unique
+	name := fmt.Sprintf("%020d-%010d%s", entry.Spooled.UnixNano(), atomic.AddUint64(&s.seq, 1), spoolExtension)
+	if err := writeFile(filepath.Join(dir, name), data); err != nil {
+		return err
+	}
+	s.account(destination, 1, int64(len(data)))
+	return nil
+}
+
+// Pending checks if there are spooled entries for a destination
+func (s *Spool) Pending(destination string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	u, ok := s.usage[destination]
+	return ok && u.entries > 0
+}
+
+// Destinations returns all destinations with a spool directory
+func (s *Spool) Destinations() ([]string, error) {
+	dirs, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var dests []string
+	for _, d := range dirs {
+		if d.IsDir() {
+			dests = append(dests, d.Name())
+		}
+	}
+	return dests, nil
+}
+
+// Inspect returns the state of the spool for a destination
+func (s *Spool) Inspect(destination string) (Info, error) {
+	info := Info{Destination: destination}
+	files, err := s.files(destination)
+	if err != nil {
+		return info, err
+	}
+	for _, f := range files {
+		stat, err := os.Stat(f)
+		if err != nil {
+			// Entries can be replayed while they are inspected
+			if os.IsNotExist(err) {
+				continue
+			}
+			return info, err
+		}
+		if info.Entries == 0 {
+			info.Oldest = stat.ModTime()
+		}
+		info.Entries++
+		info.Size += stat.Size()
+		info.Newest = stat.ModTime()
+	}
+	quarantined, err := s.quarantined(destination)
+	if err != nil {
+		return info, err
+	}
+	info.Quarantined = len(quarantined)
+	return info, nil
+}
+
+// Entries returns all the spooled entries for a destination, oldest first
+// Quarantined entries are returned instead if quarantined is true
+func (s *Spool) Entries(destination string, quarantined bool) ([]Entry, error) {
+	files, err := s.files(destination)
+	if quarantined {
+		files, err = s.quarantined(destination)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, f := range files {
+		entry, err := readEntry(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Helper to get the mutex for the replay of a destination
+func (s *Spool) lock(destination string) *sync.Mutex {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	l, ok := s.locks[destination]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[destination] = l
+	}
+	return l
+}
+
+// Helper to lock the spool of a destination, within the process and between processes
+// The returned function releases the lock
+func (s *Spool) acquire(destination string) (func(), error) {
+	l := s.lock(destination)
+	l.Lock()
+	dir := filepath.Join(s.Dir, destination)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		l.Unlock()
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		l.Unlock()
+		return nil, err
+	}
+	if err := lockSpool(f); err != nil {
+		_ = f.Close()
+		l.Unlock()
+		if err == ErrLocked {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error locking spool %s - %v", dir, err)
+	}
+	return func() {
+		_ = unlockSpool(f)
+		_ = f.Close()
+		l.Unlock()
+	}, nil
+}
+
+// Helper to remove one spooled file and update the usage
+func (s *Spool) remove(destination, file string, pending bool) error {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if pending {
+		s.account(destination, -1, -stat.Size())
+	} else {
+		s.account(destination, 0, -stat.Size())
+	}
+	return nil
+}
+
+// Helper to write again one entry that failed, updating the usage with the new size
+func (s *Spool) rewrite(destination, file string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(file, data); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.account(destination, 0, int64(len(data))-stat.Size())
+	return nil
+}
+
+// Helper to move one entry that failed too many times to the quarantine directory
+func (s *Spool) quarantine(destination, file string, entry Entry) error {
+	if err := s.rewrite(destination, file, entry); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.Dir, destination, quarantineDir)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	if err := os.Rename(file, filepath.Join(dir, filepath.Base(file))); err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.account(destination, -1, 0)
+	return nil
+}
+
+// Replay sends spooled entries for a destination in order, removing each one once it is sent
+// It stops at the first failure, so the order of entries is preserved. Entries that failed
+// MaxAttempts times are quarantined instead, so they do not block the rest
+// Entries can be modified by send, for example to keep only the logs that were not delivered
+// Only one process replays a destination at a time, ErrLocked is returned otherwise
+func (s *Spool) Replay(destination string, send func(*Entry) error) (int, error) {
+	release, err := s.acquire(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	files, err := s.files(destination)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, f := range files {
+		entry, err := readEntry(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			// Corrupted entries can not be replayed, keep them aside
+			if err := os.Rename(f, strings.TrimSuffix(f, spoolExtension)+corruptedExtension); err != nil {
+				return replayed, err
+			}
+			s.mux.Lock()
+			s.account(destination, -1, 0)
+			s.mux.Unlock()
+			continue
+		}
+		if err := send(&entry); err != nil {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			if entry.Attempts >= s.MaxAttempts {
+				if errQ := s.quarantine(destination, f, entry); errQ != nil {
+					return replayed, errQ
+				}
+				continue
+			}
+			if errW := s.rewrite(destination, f, entry); errW != nil {
+				return replayed, fmt.Errorf("%v - %v", err, errW)
+			}
+			return replayed, err
+		}
+		if err := s.remove(destination, f, true); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// Requeue moves the quarantined entries of a destination back to the spool, to be replayed again
+func (s *Spool) Requeue(destination string) (int, error) {
+	release, err := s.acquire(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	files, err := s.quarantined(destination)
+	if err != nil {
+		return 0, err
+	}
+	for i, f := range files {
+		entry, err := readEntry(f)
+		if err != nil {
+			return i, err
+		}
+		entry.Attempts = 0
+		if err := s.rewrite(destination, f, entry); err != nil {
+			return i, err
+		}
+		if err := os.Rename(f, filepath.Join(s.Dir, destination, filepath.Base(f))); err != nil {
+			return i, err
+		}
+		s.mux.Lock()
+		s.account(destination, 1, 0)
+		s.mux.Unlock()
+	}
+	return len(files), nil
+}
+
+// Purge removes all spooled entries for a destination
+// Quarantined entries are removed instead if quarantined is true
+func (s *Spool) Purge(destination string, quarantined bool) (int, error) {
+	release, err := s.acquire(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	files, err := s.files(destination)
+	if quarantined {
+		files, err = s.quarantined(destination)
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, f := range files {
+		if err := s.remove(destination, f, !quarantined); err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
+
+// Helper to read one spooled entry from file
+func readEntry(file string) (Entry, error) {
+	var entry Entry
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("error parsing %s - %v", file, err)
+	}
+	return entry, nil
+}
+
+// Helper to write one file atomically, so entries are never read half written
+func writeFile(file string, data []byte) error {
+	tmp := file + tmpExtension
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,249 @@
+package spool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempSpool(t *testing.T, maxSize int64, maxAttempts int) *Spool {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	s, err := CreateSpool(dir, maxSize, maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func storeEntries(t *testing.T, s *Spool, dest string, n int) {
+	for i := 0; i < n; i++ {
+		if err := s.Store(dest, Entry{LogType: "result", UUID: fmt.Sprintf("node-%d", i), Data: []byte("[]")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateSpool(t *testing.T) {
+	if _, err := CreateSpool("", 0, 0); err == nil {
+		t.Error("expected error for empty directory")
+	}
+	s := tempSpool(t, 0, 0)
+	if s.MaxSize != DefaultMaxSize {
+		t.Errorf("MaxSize = %d, want %d", s.MaxSize, DefaultMaxSize)
+	}
+	if s.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("MaxAttempts = %d, want %d", s.MaxAttempts, DefaultMaxAttempts)
+	}
+}
+
+func TestStoreOrder(t *testing.T) {
+	s := tempSpool(t, 0, 0)
+	storeEntries(t, s, "kafka", 100)
+	if !s.Pending("kafka") {
+		t.Error("expected pending entries")
+	}
+	if s.Pending("splunk") {
+		t.Error("expected no pending entries")
+	}
+	entries, err := s.Entries("kafka", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 100 {
+		t.Fatalf("got %d entries, want 100", len(entries))
+	}
+	for i, e := range entries {
+		if want := fmt.Sprintf("node-%d", i); e.UUID != want {
+			t.Fatalf("entry %d is %s, want %s", i, e.UUID, want)
+		}
+	}
+}
+
+func TestStoreFull(t *testing.T) {
+	s := tempSpool(t, 300, 0)
+	if err := s.Store("kafka", Entry{Data: []byte("[]")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store("kafka", Entry{Data: make([]byte, 300)}); err == nil {
+		t.Error("expected error for full spool")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		fail        map[string]bool
+		attempts    int
+		replays     int
+		replayed    int
+		pending     int
+		quarantined int
+	}{
+		{"all sent", nil, 3, 1, 5, 0, 0},
+		{"first fails", map[string]bool{"node-0": true}, 3, 1, 0, 5, 0},
+		{"first fails until quarantined", map[string]bool{"node-0": true}, 3, 3, 4, 0, 1},
+		{"middle fails", map[string]bool{"node-2": true}, 3, 1, 2, 3, 0},
+		{"two fail until quarantined", map[string]bool{"node-1": true, "node-3": true}, 2, 3, 3, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tempSpool(t, 0, tt.attempts)
+			storeEntries(t, s, "kafka", 5)
+			replayed := 0
+			for i := 0; i < tt.replays; i++ {
+				n, _ := s.Replay("kafka", func(e *Entry) error {
+					if tt.fail[e.UUID] {
+						return fmt.Errorf("failed %s", e.UUID)
+					}
+					return nil
+				})
+				replayed += n
+			}
+			if replayed != tt.replayed {
+				t.Errorf("replayed %d, want %d", replayed, tt.replayed)
+			}
+			info, err := s.Inspect("kafka")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Entries != tt.pending {
+				t.Errorf("pending %d, want %d", info.Entries, tt.pending)
+			}
+			if info.Quarantined != tt.quarantined {
+				t.Errorf("quarantined %d, want %d", info.Quarantined, tt.quarantined)
+			}
+			if s.Pending("kafka") != (tt.pending > 0) {
+				t.Errorf("Pending() = %v, want %v", s.Pending("kafka"), tt.pending > 0)
+			}
+		})
+	}
+}
+
+func TestReplayKeepsChanges(t *testing.T) {
+	s := tempSpool(t, 0, 0)
+	storeEntries(t, s, "kafka", 1)
+	_, err := s.Replay("kafka", func(e *Entry) error {
+		e.Data = []byte(`["remaining"]`)
+		return fmt.Errorf("partial")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	entries, err := s.Entries("kafka", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || string(entries[0].Data) != `["remaining"]` || entries[0].Attempts != 1 || entries[0].LastError != "partial" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestReplayCorrupted(t *testing.T) {
+	s := tempSpool(t, 0, 0)
+	storeEntries(t, s, "kafka", 1)
+	if err := ioutil.WriteFile(filepath.Join(s.Dir, "kafka", "00000000000000000000.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Refresh("kafka"); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := s.Replay("kafka", func(e *Entry) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != 1 || s.Pending("kafka") {
+		t.Errorf("replayed %d, pending %v", replayed, s.Pending("kafka"))
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	s := tempSpool(t, 0, 1)
+	storeEntries(t, s, "kafka", 2)
+	_, _ = s.Replay("kafka", func(e *Entry) error { return fmt.Errorf("failed") })
+	if s.Pending("kafka") {
+		t.Fatal("expected all entries quarantined")
+	}
+	requeued, err := s.Requeue("kafka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 2 || !s.Pending("kafka") {
+		t.Fatalf("requeued %d, pending %v", requeued, s.Pending("kafka"))
+	}
+	entries, err := s.Entries("kafka", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Attempts != 0 {
+			t.Errorf("attempts %d, want 0", e.Attempts)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := tempSpool(t, 0, 1)
+	storeEntries(t, s, "kafka", 3)
+	_, _ = s.Replay("kafka", func(e *Entry) error { return fmt.Errorf("failed") })
+	storeEntries(t, s, "kafka", 2)
+	purged, err := s.Purge("kafka", false)
+	if err != nil || purged != 2 {
+		t.Fatalf("purged %d - %v", purged, err)
+	}
+	purged, err = s.Purge("kafka", true)
+	if err != nil || purged != 3 {
+		t.Fatalf("purged %d quarantined - %v", purged, err)
+	}
+	if s.Pending("kafka") || s.size() != 0 {
+		t.Errorf("pending %v, size %d", s.Pending("kafka"), s.size())
+	}
+}
+
+func TestLocked(t *testing.T) {
+	s := tempSpool(t, 0, 0)
+	storeEntries(t, s, "kafka", 1)
+	// A second spool in the same directory is like another process
+	other, err := CreateSpool(s.Dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Replay("kafka", func(e *Entry) error {
+		if _, err := other.Replay("kafka", func(e *Entry) error { return nil }); err != ErrLocked {
+			t.Errorf("got %v, want ErrLocked", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s := tempSpool(t, 0, 0)
+	storeEntries(t, s, "kafka", 2)
+	other, err := CreateSpool(s.Dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !other.Pending("kafka") {
+		t.Fatal("expected pending entries loaded from disk")
+	}
+	if _, err := other.Purge("kafka", false); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Pending("kafka") {
+		t.Fatal("expected stale pending entries")
+	}
+	if err := s.Refresh("kafka"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Pending("kafka") {
+		t.Error("expected no pending entries after refresh")
+	}
+}
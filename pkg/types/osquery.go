@@ -13,6 +13,13 @@ const (
 	QueryLog  string = "query"
 )
 
+// Actions in result logs
+const (
+	ResultAdded    string = "added"
+	ResultRemoved  string = "removed"
+	ResultSnapshot string = "snapshot"
+)
+
 // OSVersionTable provided on enrollment, table os_version
 type OSVersionTable struct {
 	ID           string `json:"_id"`
@@ -127,17 +134,26 @@ type LogDecorations struct {
 	DaemonHash     string `json:"osquery_md5"`
 }
 
+// LogDiffResults for diffResults field in batch result logs
+type LogDiffResults struct {
+	Added   []json.RawMessage `json:"added"`
+	Removed []json.RawMessage `json:"removed"`
+}
+
 // LogResultData to be used processing result logs from nodes
+// Event format uses action and columns, batch format uses diffResults and snapshot uses snapshot
 type LogResultData struct {
-	Name           string          `json:"name"`
-	Epoch          int64           `json:"epoch"`
-	Action         string          `json:"action"`
-	Columns        json.RawMessage `json:"columns"`
-	Counter        int             `json:"counter"`
-	UnixTime       int             `json:"unixTime"`
-	Decorations    LogDecorations  `json:"decorations"`
-	CalendarTime   string          `json:"calendarTime"`
-	HostIdentifier string          `json:"hostIdentifier"`
+	Name           string            `json:"name"`
+	Epoch          int64             `json:"epoch"`
+	Action         string            `json:"action"`
+	Columns        json.RawMessage   `json:"columns"`
+	DiffResults    LogDiffResults    `json:"diffResults"`
+	Snapshot       []json.RawMessage `json:"snapshot"`
+	Counter        int               `json:"counter"`
+	UnixTime       int               `json:"unixTime"`
+	Decorations    LogDecorations    `json:"decorations"`
+	CalendarTime   string            `json:"calendarTime"`
+	HostIdentifier string            `json:"hostIdentifier"`
 }
 
 // LogStatusData to be used processing status logs from nodes
@@ -187,9 +203,10 @@ type QueryWriteResponse GenericResponse
 
 // QueryWriteData to store result of on-demand queries
 type QueryWriteData struct {
-	Name   string          `json:"name"`
-	Result json.RawMessage `json:"result"`
-	Status int             `json:"status"`
+	Name       string          `json:"name"`
+	Generation uint            `json:"generation,omitempty"`
+	Result     json.RawMessage `json:"result"`
+	Status     int             `json:"status"`
 }
 
 // CarveInitRequest received to begin a carve
@@ -9,10 +9,10 @@ import (
 	"net/http/httputil"
 )
 
-// SendRequest - Helper function to send HTTP requests
-func SendRequest(secure bool, reqType, url string, params io.Reader, headers map[string]string) (int, []byte, error) {
+// SendRequest - Helper function to send HTTP requests, skipping TLS verification if insecure is true
+func SendRequest(insecure bool, reqType, url string, params io.Reader, headers map[string]string) (int, []byte, error) {
 	var client *http.Client
-	if secure {
+	if insecure {
 		tr := &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
@@ -1,8 +0,0 @@
-module github.com/jmpsec/osctrl/plugins/db_logging
-
-go 1.12
-
-require (
-	github.com/jmpsec/osctrl/pkg/types v0.1.5
-	github.com/jinzhu/gorm v1.9.10
-)
@@ -1,5 +0,0 @@
-module github.com/jmpsec/osctrl/plugins/graylog_logging
-
-go 1.12
-
-require github.com/jmpsec/osctrl/pkg/utils v0.1.5
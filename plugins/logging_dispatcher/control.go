@@ -1,10 +0,0 @@
-package main
-
-const (
-	// splunkEnabled
-	splunkEnabled bool = false
-	// graylogEnabled
-	graylogEnabled bool = false
-	// dbEnabled
-	dbEnabled bool = true
-)
@@ -1,10 +0,0 @@
-module github.com/jmpsec/osctrl/plugins/logging_dispatcher
-
-go 1.12
-
-require (
-	github.com/jmpsec/osctrl/pkg/settings v0.1.5
-	github.com/jmpsec/osctrl/pkg/types v0.1.5
-	github.com/jinzhu/gorm v1.9.8
-	github.com/spf13/viper v1.4.0
-)
@@ -1,8 +0,0 @@
-module github.com/jmpsec/osctrl/plugins/splunk_logging
-
-go 1.12
-
-require (
-	github.com/jmpsec/osctrl/pkg/types v0.1.5
-	github.com/jmpsec/osctrl/pkg/utils v0.1.5
-)